@@ -0,0 +1,143 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// DefaultRedactedFields are the params fields AccessLog redacts unless
+// WithRedactedFields is given.
+var DefaultRedactedFields = []string{"password", "token", "secret", "authorization", "apiKey"}
+
+const redacted = "[REDACTED]"
+
+type accessLog struct {
+	logger Logger
+	level  Level
+	params bool
+	redact map[string]bool
+}
+
+type AccessLogOption func(*accessLog)
+
+// WithLogParams includes each request's params in its record, with redacted
+// fields replaced by "[REDACTED]".
+func WithLogParams() AccessLogOption {
+	return func(l *accessLog) {
+		l.params = true
+	}
+}
+
+// WithRedactedFields sets the names of params fields, at any depth, whose
+// values are never logged. Names are case-insensitive.
+func WithRedactedFields(fields ...string) AccessLogOption {
+	return func(l *accessLog) {
+		l.redact = redactSet(fields)
+	}
+}
+
+// WithAccessLogLevel sets the level records are logged at. Defaults to
+// LevelInfo.
+func WithAccessLogLevel(level Level) AccessLogOption {
+	return func(l *accessLog) {
+		l.level = level
+	}
+}
+
+// AccessLog returns an interceptor that logs one "access" record to logger
+// per request, with its method, id, duration, outcome ("ok" or "error"),
+// error code, and the size in bytes of its params and result:
+//
+//	rpc.Use(jsonrpc.AccessLog(logger, jsonrpc.WithLogParams()))
+func AccessLog(logger Logger, opts ...AccessLogOption) Interceptor {
+	l := &accessLog{logger: logger, level: LevelInfo, redact: redactSet(DefaultRedactedFields)}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return func(ctx context.Context, req *Request, next Handler) (*Response, error) {
+		start := time.Now()
+		rsp, err := next(ctx, req)
+		outcome, code := "ok", 0
+		if err != nil {
+			outcome, code = "error", toError(err).Code
+		} else if rsp != nil && rsp.Error != nil {
+			outcome, code = "error", rsp.Error.Code
+		}
+		paramsSize := 0
+		if req.Params != nil {
+			paramsSize = len(*req.Params)
+		}
+		keyvals := []interface{}{
+			"method", req.Method,
+			"id", req.ID,
+			"duration", time.Since(start),
+			"outcome", outcome,
+			"code", code,
+			"params_size", paramsSize,
+			"result_size", resultSize(rsp),
+		}
+		if l.params {
+			keyvals = append(keyvals, "params", l.redactParams(req.Params))
+		}
+		l.logger.Log(l.level, "access", keyvals...)
+		return rsp, err
+	}
+}
+
+func redactSet(fields []string) map[string]bool {
+	set := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		set[strings.ToLower(f)] = true
+	}
+	return set
+}
+
+func resultSize(rsp *Response) int {
+	if rsp == nil || rsp.Error != nil {
+		return 0
+	}
+	if b, ok := marshaledResult(rsp.Result); ok {
+		return len(b)
+	}
+	b, err := json.Marshal(rsp.Result)
+	if err != nil {
+		return 0
+	}
+	return len(b)
+}
+
+// redactParams returns params as JSON text with redacted fields replaced.
+func (l *accessLog) redactParams(params *ParamsRaw) string {
+	if params == nil {
+		return ""
+	}
+	var v interface{}
+	if err := json.Unmarshal(*params, &v); err != nil {
+		return redacted
+	}
+	b, err := json.Marshal(l.redactValue(v))
+	if err != nil {
+		return redacted
+	}
+	return string(b)
+}
+
+func (l *accessLog) redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, elem := range v {
+			if l.redact[strings.ToLower(k)] {
+				v[k] = redacted
+			} else {
+				v[k] = l.redactValue(elem)
+			}
+		}
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = l.redactValue(elem)
+		}
+	}
+	return v
+}
@@ -0,0 +1,63 @@
+package jsonrpc
+
+// WithAlias makes calls to alias run method, e.g. to keep an old name working
+// after a rename. Methods registered as alias itself take precedence.
+func WithAlias(alias, method string) Option {
+	return func(s *Server) {
+		if s.aliases == nil {
+			s.aliases = map[string]string{}
+		}
+		s.aliases[alias] = method
+	}
+}
+
+// WithDeprecated marks method, or an alias, as deprecated. Calls still work,
+// but are logged at LevelWarn with notice and counted by Metrics that
+// implement DeprecationMetrics.
+func WithDeprecated(method, notice string) Option {
+	return func(s *Server) {
+		if s.deprecated == nil {
+			s.deprecated = map[string]string{}
+		}
+		s.deprecated[method] = notice
+	}
+}
+
+// WithDeprecationNotices adds a "deprecated" member holding the notice to
+// responses to deprecated methods, next to the result, so clients can warn
+// without the response being an error.
+func WithDeprecationNotices() Option {
+	return func(s *Server) {
+		s.deprecationNotices = true
+	}
+}
+
+// DeprecationMetrics is implemented by Metrics that count calls to
+// deprecated methods.
+type DeprecationMetrics interface {
+	DeprecatedCall(method string)
+}
+
+// resolveMethod returns req with an alias, or an eth_subscribe call under
+// WithEthereum, replaced by the method it names, and the deprecation notice
+// for the method called, if any.
+func (s *Server) resolveMethod(req *Request) (*Request, string) {
+	notice, deprecated := s.deprecated[req.Method]
+	if deprecated {
+		s.logger.Log(LevelWarn, "deprecated method", "method", req.Method, "notice", notice)
+		if m, ok := s.metrics.(DeprecationMetrics); ok {
+			m.DeprecatedCall(req.Method)
+		}
+	}
+	return s.resolve(req), notice
+}
+
+// resolve returns req for the method it calls, following aliases.
+func (s *Server) resolve(req *Request) *Request {
+	if target, ok := s.aliases[req.Method]; ok && s.method(req.Method) == nil {
+		resolved := *req
+		resolved.Method = target
+		req = &resolved
+	}
+	return s.ethSubscribe(req)
+}
@@ -0,0 +1,51 @@
+package jsonrpc
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+)
+
+var ErrNoAttachments = errors.New("jsonrpc: socket does not support attachments")
+
+// AttachmentSocket is a Socket that carries binary attachments out of band,
+// in frames of their own, so large blobs such as file contents needn't be
+// base64 encoded into a message. ws.Socket implements it.
+type AttachmentSocket interface {
+	Socket
+	// WriteAttachment sends data, for a later message to reference by id.
+	WriteAttachment(id string, data []byte) error
+	// Attachment returns and forgets the attachment received with id.
+	Attachment(id string) ([]byte, bool)
+}
+
+// Attach sends data to the peer as an attachment and returns its id, for the
+// params or result that follow to reference. The attachment is written before
+// anything sent after Attach returns, so it has arrived by the time the peer
+// reads the message referencing it:
+//
+//	id, err := jsonrpc.ConnFromContext(ctx).Attach(contents)
+//	...
+//	return File{Name: name, Contents: id}, nil
+func (c *Conn) Attach(data []byte) (string, error) {
+	if c.attachments == nil || !c.Supports(ExtAttachments) {
+		return "", ErrNoAttachments
+	}
+	id := strconv.FormatUint(atomic.AddUint64(&c.attachmentSeq, 1), 10)
+	c.writeMu.Lock()
+	err := c.attachments.WriteAttachment(id, data)
+	c.writeMu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Attachment returns the attachment the peer sent with id. Each attachment
+// can be read once; those never read are kept until the connection closes.
+func (c *Conn) Attachment(id string) ([]byte, bool) {
+	if c.attachments == nil {
+		return nil, false
+	}
+	return c.attachments.Attachment(id)
+}
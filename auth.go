@@ -0,0 +1,166 @@
+package jsonrpc
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"strings"
+)
+
+// Codes returned for requests rejected by WithAuth.
+const (
+	CodeUnauthorized = -32003
+	CodeForbidden    = -32004
+)
+
+var (
+	ErrUnauthorized = NewError(CodeUnauthorized, "unauthorized")
+	ErrForbidden    = NewError(CodeForbidden, "forbidden")
+)
+
+// Authenticator checks a token and returns the identity it belongs to. An
+// error rejects the token.
+type Authenticator func(ctx context.Context, token string) (identity interface{}, err error)
+
+type authConfig struct {
+	auth   Authenticator
+	header string
+	param  string
+	public map[string]bool
+	// clientCert identifies connections by their TLS client certificate
+	clientCert func(cert *x509.Certificate) (interface{}, error)
+	acl        map[string]func(identity interface{}) bool
+}
+
+type AuthOption func(*authConfig)
+
+type ctxIdentityKey struct{}
+
+// WithAuth requires every request to be authenticated, except for methods
+// made public with AuthPublic. A token in the HTTP header of the connection
+// authenticates all of its requests; a token in the params authenticates
+// only that request. Requests without a valid identity get ErrUnauthorized,
+// and those denied by an ACL get ErrForbidden, before the interceptors or
+// the handler run.
+func WithAuth(auth Authenticator, opts ...AuthOption) Option {
+	return func(s *Server) {
+		s.auth = &authConfig{
+			auth:   auth,
+			header: "Authorization",
+			public: map[string]bool{},
+			acl:    map[string]func(interface{}) bool{},
+		}
+		for _, opt := range opts {
+			opt(s.auth)
+		}
+	}
+}
+
+// AuthHeader sets the HTTP header holding the connection's token. Defaults to
+// "Authorization", from which a "Bearer " prefix is removed.
+func AuthHeader(name string) AuthOption {
+	return func(c *authConfig) {
+		c.header = name
+	}
+}
+
+// AuthParam reads a per-request token from the named member of object
+// params.
+func AuthParam(name string) AuthOption {
+	return func(c *authConfig) {
+		c.param = name
+	}
+}
+
+// AuthPublic lets methods be called without an identity.
+func AuthPublic(methods ...string) AuthOption {
+	return func(c *authConfig) {
+		for _, method := range methods {
+			c.public[method] = true
+		}
+	}
+}
+
+// AuthACL only lets method be called by identities that allow accepts.
+func AuthACL(method string, allow func(identity interface{}) bool) AuthOption {
+	return func(c *authConfig) {
+		c.acl[method] = allow
+	}
+}
+
+// IdentityFromContext returns the identity of the authenticated caller, or
+// nil.
+func IdentityFromContext(ctx context.Context) interface{} {
+	return ctx.Value(ctxIdentityKey{})
+}
+
+// authenticateConn authenticates a connection from its TLS client
+// certificate with AuthClientCert, or else from the header of the HTTP
+// request it was made with, if there is one. Connections without either are
+// allowed; their requests must carry their own token.
+func (s *Server) authenticateConn(ctx context.Context) (context.Context, error) {
+	if s.auth == nil {
+		return ctx, nil
+	}
+	if cert := ClientCertFromContext(ctx); cert != nil && s.auth.clientCert != nil {
+		identity, err := s.auth.clientCert(cert)
+		if err != nil {
+			return ctx, ErrUnauthorized.WithData(err.Error())
+		}
+		return context.WithValue(ctx, ctxIdentityKey{}, identity), nil
+	}
+	r := HTTPRequestFromContext(ctx)
+	if r == nil {
+		return ctx, nil
+	}
+	token := r.Header.Get(s.auth.header)
+	if s.auth.header == "Authorization" && len(token) > 7 && strings.EqualFold(token[:7], "bearer ") {
+		token = token[7:]
+	}
+	if token == "" {
+		return ctx, nil
+	}
+	identity, err := s.auth.auth(ctx, token)
+	if err != nil {
+		return ctx, ErrUnauthorized.WithData(err.Error())
+	}
+	return context.WithValue(ctx, ctxIdentityKey{}, identity), nil
+}
+
+// authorize checks the caller may call req's method.
+func (s *Server) authorize(ctx context.Context, req *Request) (context.Context, error) {
+	if s.auth == nil {
+		return ctx, nil
+	}
+	if token := s.auth.paramToken(req); token != "" {
+		identity, err := s.auth.auth(ctx, token)
+		if err != nil {
+			return ctx, ErrUnauthorized.WithData(err.Error())
+		}
+		ctx = context.WithValue(ctx, ctxIdentityKey{}, identity)
+	}
+	if s.auth.public[req.Method] {
+		return ctx, nil
+	}
+	identity := IdentityFromContext(ctx)
+	if identity == nil {
+		return ctx, ErrUnauthorized
+	}
+	if allow := s.auth.acl[req.Method]; allow != nil && !allow(identity) {
+		return ctx, ErrForbidden
+	}
+	return ctx, nil
+}
+
+func (c *authConfig) paramToken(req *Request) string {
+	if c.param == "" || req.Params == nil {
+		return ""
+	}
+	var params map[string]json.RawMessage
+	if json.Unmarshal(*req.Params, &params) != nil {
+		return ""
+	}
+	var token string
+	_ = json.Unmarshal(params[c.param], &token)
+	return token
+}
@@ -0,0 +1,190 @@
+package jsonrpc
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Batch collects calls and notifications to send as one JSON-RPC batch.
+type Batch struct {
+	conn  *Conn
+	reqs  []*Request
+	calls []*BatchCall
+	err   error
+}
+
+// BatchCall is a call queued on a Batch. Its result is decoded once the
+// batch has been sent.
+type BatchCall struct {
+	id     ID
+	ch     chan *rawResponse
+	result interface{}
+	err    error
+}
+
+// Err returns the call's error once Send has returned, such as an *Error
+// returned by the peer.
+func (c *BatchCall) Err() error {
+	return c.err
+}
+
+// Batch starts a batch on the connection.
+func (c *Conn) Batch() *Batch {
+	return &Batch{conn: c}
+}
+
+// Batch starts a batch, see Conn.Batch.
+func (c *Client) Batch() *Batch {
+	return c.conn.Batch()
+}
+
+// Call queues a call whose result is decoded into result, which may be nil.
+func (b *Batch) Call(method string, params, result interface{}) *BatchCall {
+	call := &BatchCall{result: result}
+	b.calls = append(b.calls, call)
+	req, err := newOutgoingRequest(method, params)
+	if err != nil {
+		call.err = err
+		return call
+	}
+	call.id, call.ch, err = b.conn.pending.add()
+	if err != nil {
+		call.err = err
+		return call
+	}
+	req.ID = &call.id
+	b.reqs = append(b.reqs, req)
+	return call
+}
+
+// Notify queues a notification.
+func (b *Batch) Notify(method string, params interface{}) {
+	req, err := newOutgoingRequest(method, params)
+	if err != nil {
+		if b.err == nil {
+			b.err = err
+		}
+		return
+	}
+	b.reqs = append(b.reqs, req)
+}
+
+// Send writes the batch and waits for the response to every call in it. It
+// returns an error if the batch could not be written; each call's own error
+// is in its Err.
+func (b *Batch) Send(ctx context.Context) error {
+	defer func() {
+		for _, call := range b.calls {
+			if call.ch != nil {
+				b.conn.pending.remove(call.id)
+			}
+		}
+	}()
+	if b.err != nil {
+		return b.err
+	}
+	if len(b.reqs) == 0 {
+		return nil
+	}
+	for _, req := range b.reqs {
+		if !req.IsNotification() {
+			b.conn.stamp(ctx, req)
+		}
+	}
+	if err := b.conn.send(ctx, b.reqs); err != nil {
+		for _, call := range b.calls {
+			if call.err == nil {
+				call.err = err
+			}
+		}
+		return err
+	}
+	y := yielderFor(ctx, b.conn)
+	y.pause()
+	defer y.resume(ctx)
+	for _, call := range b.calls {
+		if call.err == nil {
+			call.err = b.conn.pending.wait(ctx, call.ch, nil, call.result)
+		}
+	}
+	return nil
+}
+
+// WithAutoBatch gathers the calls and notifications made within window of
+// each other into one batch, trading up to window of latency for fewer round
+// trips.
+func WithAutoBatch(window time.Duration) ClientOption {
+	return func(c *Client) {
+		c.autoBatch = &autoBatcher{window: window}
+	}
+}
+
+type autoBatcher struct {
+	window time.Duration
+	conn   *Conn
+
+	mu      sync.Mutex
+	reqs    []*Request
+	waiters []chan error
+}
+
+// send queues req for the next batch. The returned channel receives the
+// error if the batch could not be written.
+func (b *autoBatcher) send(req *Request) <-chan error {
+	failed := make(chan error, 1)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reqs = append(b.reqs, req)
+	b.waiters = append(b.waiters, failed)
+	if len(b.reqs) == 1 {
+		time.AfterFunc(b.window, b.flush)
+	}
+	return failed
+}
+
+func (b *autoBatcher) flush() {
+	b.mu.Lock()
+	reqs, waiters := b.reqs, b.waiters
+	b.reqs, b.waiters = nil, nil
+	b.mu.Unlock()
+	var msg interface{} = reqs
+	if len(reqs) == 1 {
+		msg = reqs[0]
+	}
+	err := b.conn.send(context.Background(), msg)
+	for _, failed := range waiters {
+		if err != nil {
+			failed <- err
+		}
+		close(failed)
+	}
+}
+
+func (b *autoBatcher) call(ctx context.Context, method string, params, result interface{}) error {
+	req, err := newOutgoingRequest(method, params)
+	if err != nil {
+		return err
+	}
+	id, ch, err := b.conn.pending.add()
+	if err != nil {
+		return err
+	}
+	defer b.conn.pending.remove(id)
+	req.ID = &id
+	b.conn.stamp(ctx, req)
+	return b.conn.pending.wait(ctx, ch, b.send(req), result)
+}
+
+func (b *autoBatcher) notify(ctx context.Context, method string, params interface{}) error {
+	req, err := newOutgoingRequest(method, params)
+	if err != nil {
+		return err
+	}
+	select {
+	case err := <-b.send(req):
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
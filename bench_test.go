@@ -0,0 +1,139 @@
+package jsonrpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/jdxcode/jsonrpc"
+)
+
+// benchSocket replays raw requests and signals each write, so a benchmark
+// measures the server's own decode, dispatch and encode path.
+type benchSocket struct {
+	requests chan []byte
+	written  chan struct{}
+}
+
+func (s *benchSocket) ReadJSON(v interface{}) error {
+	msg, ok := <-s.requests
+	if !ok {
+		return &websocket.CloseError{Code: websocket.CloseNormalClosure}
+	}
+	return json.Unmarshal(msg, v)
+}
+
+func (s *benchSocket) WriteJSON(v interface{}) error {
+	if _, err := jsonrpc.JSON.Marshal(v); err != nil {
+		return err
+	}
+	s.written <- struct{}{}
+	return nil
+}
+
+func (s *benchSocket) Close() error {
+	return nil
+}
+
+func newBenchSocket() *benchSocket {
+	return &benchSocket{make(chan []byte), make(chan struct{})}
+}
+
+func benchmarkHandle(b *testing.B, s *jsonrpc.Server, msg string) {
+	sock := newBenchSocket()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Handle(context.Background(), sock)
+	}()
+	raw := []byte(msg)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sock.requests <- raw
+		<-sock.written
+	}
+	b.StopTimer()
+	close(sock.requests)
+	<-done
+}
+
+var quiet = jsonrpc.WithLogger(jsonrpc.DiscardLogger)
+
+func BenchmarkHandleReflect(b *testing.B) {
+	benchmarkHandle(b, jsonrpc.New(&TestRPC{}, quiet), `{"jsonrpc":"2.0","id":1,"method":"Foo","params":"abc"}`)
+}
+
+func BenchmarkHandlePositional(b *testing.B) {
+	benchmarkHandle(b, jsonrpc.New(&TestRPC{}, quiet), `{"jsonrpc":"2.0","id":1,"method":"FooPositional","params":[1,"a",{"foo":"b"}]}`)
+}
+
+func BenchmarkHandleTrampoline(b *testing.B) {
+	s := jsonrpc.New(&TestRPC{}, quiet)
+	_ = s.Register("echo", func(ctx context.Context, params string) (string, error) {
+		return params, nil
+	})
+	benchmarkHandle(b, s, `{"jsonrpc":"2.0","id":1,"method":"echo","params":"abc"}`)
+}
+
+func BenchmarkHandleGeneric(b *testing.B) {
+	s := jsonrpc.New(&TestRPC{}, quiet)
+	jsonrpc.Register(s, "echo", func(ctx context.Context, params string) (string, error) {
+		return params, nil
+	})
+	benchmarkHandle(b, s, `{"jsonrpc":"2.0","id":1,"method":"echo","params":"abc"}`)
+}
+
+func BenchmarkHandleBatch(b *testing.B) {
+	benchmarkHandle(b, jsonrpc.New(&TestRPC{}, quiet), `[`+
+		`{"jsonrpc":"2.0","id":1,"method":"Foo","params":"abc"},`+
+		`{"jsonrpc":"2.0","id":2,"method":"FooStruct","params":{"foo":"b"}},`+
+		`{"jsonrpc":"2.0","id":3,"method":"FooPositional","params":[1,"a",{"foo":"b"}]}]`)
+}
+
+// BenchmarkHandleParallel measures throughput with a connection per
+// goroutine.
+func BenchmarkHandleParallel(b *testing.B) {
+	s := jsonrpc.New(&TestRPC{}, quiet)
+	raw := []byte(`{"jsonrpc":"2.0","id":1,"method":"FooPositional","params":[1,"a",{"foo":"b"}]}`)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		sock := newBenchSocket()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			s.Handle(context.Background(), sock)
+		}()
+		for pb.Next() {
+			sock.requests <- raw
+			<-sock.written
+		}
+		close(sock.requests)
+		<-done
+	})
+}
+
+type benchItem struct {
+	ID    int               `json:"id"`
+	Name  string            `json:"name"`
+	Tags  []string          `json:"tags"`
+	Attrs map[string]string `json:"attrs"`
+}
+
+// BenchmarkLargeResult is dominated by encoding, so it shows the difference
+// SetJSONImplementation makes.
+func BenchmarkLargeResult(b *testing.B) {
+	items := make([]benchItem, 100)
+	for i := range items {
+		items[i] = benchItem{ID: i, Name: "item", Tags: []string{"a", "b"}, Attrs: map[string]string{"k": "v"}}
+	}
+	s := jsonrpc.New(&TestRPC{}, quiet)
+	jsonrpc.Register(s, "items", func(ctx context.Context, params []benchItem) ([]benchItem, error) {
+		return items, nil
+	})
+	params, _ := json.Marshal(items[:10])
+	b.Log(jsonrpc.JSONImplementation())
+	benchmarkHandle(b, s, `{"jsonrpc":"2.0","id":1,"method":"items","params":`+string(params)+`}`)
+}
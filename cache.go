@@ -0,0 +1,240 @@
+package jsonrpc
+
+import (
+	"container/list"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CacheStore holds the results cached by a ResultCache. Implementations must
+// be safe for concurrent use; NewLRUStore is an in-memory one, and a shared
+// store such as Redis lets several servers share a cache.
+type CacheStore interface {
+	// Get returns the value set for key, unless it expired.
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+	Delete(key string)
+}
+
+// ResultCache answers calls to cacheable methods with results stored by
+// earlier calls, so read-heavy methods don't reach their handlers each time:
+//
+//	cache := jsonrpc.NewResultCache(jsonrpc.NewLRUStore(10000))
+//	cache.Cache("getBlockByNumber", time.Minute, nil)
+//	rpc.Use(cache.Interceptor())
+//
+// Only successful results are cached, for each identity apart (see
+// IdentityFromContext). A cached result is sent back as the JSON it was
+// marshaled to. Calls are authorized and rate limited before the cache
+// answers them.
+type ResultCache struct {
+	store CacheStore
+
+	mu          sync.RWMutex
+	methods     map[string]*cachePolicy
+	generations map[string]uint64
+	// when Invalidate dropped the results for a method and key, kept until
+	// the results cached before have expired
+	invalidated map[string]invalidation
+	lastSweep   time.Time
+}
+
+type invalidation struct {
+	at, until time.Time
+}
+
+type cachePolicy struct {
+	ttl time.Duration
+	key func(req *Request) string
+}
+
+// NewResultCache returns a cache keeping results in store.
+func NewResultCache(store CacheStore) *ResultCache {
+	return &ResultCache{store: store, methods: map[string]*cachePolicy{}, generations: map[string]uint64{},
+		invalidated: map[string]invalidation{}}
+}
+
+// Cache makes the results of method cacheable for ttl. Calls to method are
+// answered from the cache when key maps them to the key of a cached result;
+// a nil key uses the params as sent. It may be called while serving.
+func (c *ResultCache) Cache(method string, ttl time.Duration, key func(req *Request) string) {
+	if key == nil {
+		key = paramsKey
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.methods[method] = &cachePolicy{ttl: ttl, key: key}
+}
+
+func paramsKey(req *Request) string {
+	if req.Params == nil {
+		return ""
+	}
+	return string(*req.Params)
+}
+
+// Invalidate drops the cached results of method for key, as returned by the
+// key func given to Cache, e.g. after a write makes them stale.
+func (c *ResultCache) Invalidate(method, key string) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var ttl time.Duration
+	if p := c.methods[method]; p != nil {
+		ttl = p.ttl
+	}
+	if now.Sub(c.lastSweep) >= ttl {
+		c.lastSweep = now
+		for k, inv := range c.invalidated {
+			if now.After(inv.until) {
+				delete(c.invalidated, k)
+			}
+		}
+	}
+	c.invalidated[method+"\x00"+key] = invalidation{at: now, until: now.Add(ttl)}
+}
+
+// InvalidateMethod drops every cached result of method. They stay in the
+// store until they expire or are evicted, but are never returned.
+func (c *ResultCache) InvalidateMethod(method string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generations[method]++
+}
+
+func (c *ResultCache) storeKey(ctx context.Context, method, key string) string {
+	c.mu.RLock()
+	gen := c.generations[method]
+	c.mu.RUnlock()
+	var identity string
+	if id := IdentityFromContext(ctx); id != nil {
+		identity = fmt.Sprintf("%T\x00%#v", id, id)
+	}
+	return fmt.Sprintf("%s\x00%d\x00%s\x00%s", method, gen, key, identity)
+}
+
+// get returns the result cached under storeKey, unless Invalidate dropped
+// it. Results are stored after the time they were cached.
+func (c *ResultCache) get(storeKey, method, key string) ([]byte, bool) {
+	b, ok := c.store.Get(storeKey)
+	if !ok || len(b) < 8 {
+		return nil, false
+	}
+	c.mu.RLock()
+	inv, invalidated := c.invalidated[method+"\x00"+key]
+	c.mu.RUnlock()
+	cached := time.Unix(0, int64(binary.BigEndian.Uint64(b)))
+	if invalidated && !cached.After(inv.at) {
+		return nil, false
+	}
+	return b[8:], true
+}
+
+func (c *ResultCache) set(storeKey string, result []byte, ttl time.Duration) {
+	b := make([]byte, 8, 8+len(result))
+	binary.BigEndian.PutUint64(b, uint64(time.Now().UnixNano()))
+	c.store.Set(storeKey, append(b, result...), ttl)
+}
+
+func (c *ResultCache) policy(method string) *cachePolicy {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.methods[method]
+}
+
+// Interceptor returns the interceptor that answers from and fills the cache.
+func (c *ResultCache) Interceptor() Interceptor {
+	return func(ctx context.Context, req *Request, next Handler) (*Response, error) {
+		p := c.policy(req.Method)
+		if p == nil || req.IsNotification() {
+			return next(ctx, req)
+		}
+		key := p.key(req)
+		storeKey := c.storeKey(ctx, req.Method, key)
+		if b, ok := c.get(storeKey, req.Method, key); ok {
+			return newResponse(req.ID, PreMarshaled(b)), nil
+		}
+		rsp, err := next(ctx, req)
+		if err != nil || rsp == nil || rsp.Error != nil {
+			return rsp, err
+		}
+		if _, streamed := rsp.Result.(StreamWriter); streamed {
+			return rsp, nil
+		}
+		if b, ok := marshaledResult(rsp.Result); ok {
+			c.set(storeKey, b, p.ttl)
+		} else if b, merr := json.Marshal(rsp.Result); merr == nil {
+			c.set(storeKey, b, p.ttl)
+		}
+		return rsp, nil
+	}
+}
+
+// NewLRUStore returns an in-memory CacheStore holding up to size values,
+// evicting the least recently used.
+func NewLRUStore(size int) CacheStore {
+	return &lruStore{size: size, entries: map[string]*list.Element{}, order: list.New()}
+}
+
+type lruStore struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// most recently used first
+	order *list.List
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func (l *lruStore) Get(key string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	el, ok := l.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*lruEntry)
+	if time.Now().After(e.expires) {
+		l.remove(el)
+		return nil, false
+	}
+	l.order.MoveToFront(el)
+	return e.value, true
+}
+
+func (l *lruStore) Set(key string, value []byte, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e := &lruEntry{key: key, value: value, expires: time.Now().Add(ttl)}
+	if el, ok := l.entries[key]; ok {
+		el.Value = e
+		l.order.MoveToFront(el)
+		return
+	}
+	l.entries[key] = l.order.PushFront(e)
+	for l.order.Len() > l.size {
+		l.remove(l.order.Back())
+	}
+}
+
+func (l *lruStore) Delete(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if el, ok := l.entries[key]; ok {
+		l.remove(el)
+	}
+}
+
+func (l *lruStore) remove(el *list.Element) {
+	l.order.Remove(el)
+	delete(l.entries, el.Value.(*lruEntry).key)
+}
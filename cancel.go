@@ -0,0 +1,88 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// CodeRequestCancelled is LSP's code for requests cancelled by the client.
+const CodeRequestCancelled = -32800
+
+var ErrRequestCancelled = NewError(CodeRequestCancelled, "request cancelled")
+
+const defaultCancelMethod = "$/cancelRequest"
+
+// WithCancelMethod sets the method clients use to cancel a pending request,
+// sent with params {"id": <request id>}. The handler's context is cancelled
+// and the original call fails with ErrRequestCancelled. Defaults to
+// "$/cancelRequest"; an empty name disables cancellation.
+func WithCancelMethod(method string) Option {
+	return func(s *Server) {
+		s.cancelMethod = method
+	}
+}
+
+type cancelParams struct {
+	ID ID `json:"id"`
+}
+
+type inflightRequest struct {
+	ctx       context.Context
+	req       *Request
+	cancel    context.CancelFunc
+	cancelled bool
+	abandoned bool
+}
+
+func (s *Server) isCancel(req *Request) bool {
+	return s.cancelMethod != "" && req.Method == s.cancelMethod
+}
+
+func (s *Server) handleCancel(ctx context.Context, req *Request) *Response {
+	var params cancelParams
+	if req.Params != nil {
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return newResponseError(req.ID, ErrInvalidParams.WithMessage(err.Error()))
+		}
+	}
+	if conn := ConnFromContext(ctx); conn != nil {
+		conn.cancelRequest(params.ID)
+	}
+	return newResponse(req.ID, nil)
+}
+
+// startRequest returns a context which is cancelled if the peer cancels req
+// or disconnects. done must be called when the request has been handled and
+// reports which of the two happened.
+func (c *Conn) startRequest(ctx context.Context, req *Request) (context.Context, func() (cancelled, abandoned bool)) {
+	ctx, cancel := context.WithCancel(ctx)
+	id := *req.ID
+	r := &inflightRequest{ctx: ctx, req: req, cancel: cancel}
+	c.mu.Lock()
+	c.inflight[id] = r
+	c.mu.Unlock()
+	return ctx, func() (bool, bool) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.inflight[id] == r {
+			delete(c.inflight, id)
+		}
+		cancel()
+		return r.cancelled, r.abandoned
+	}
+}
+
+// CancelRequest cancels the peer's pending request id as the cancel method
+// does, for protocols whose cancellation notifications look different.
+func (c *Conn) CancelRequest(id ID) {
+	c.cancelRequest(id)
+}
+
+func (c *Conn) cancelRequest(id ID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if r := c.inflight[id]; r != nil {
+		r.cancelled = true
+		r.cancel()
+	}
+}
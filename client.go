@@ -0,0 +1,204 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+var ErrClientClosed = errors.New("jsonrpc: client closed")
+
+// Client calls methods on a remote JSON-RPC server over a Socket. Requests
+// sent by the server are answered by the Server given with WithServer.
+type Client struct {
+	sock   Socket
+	conn   *Conn
+	server *Server
+	ctx    context.Context
+	cancel context.CancelFunc
+	logger Logger
+	// runs the notifications sent by the server, in order
+	notifications *orderedQueue
+
+	heartbeat *heartbeat
+	deadlines bool
+	autoBatch *autoBatcher
+	// interceptors wrap call to make invoke
+	interceptors []ClientInterceptor
+	invoke       Invoker
+	idGenerator  IDGenerator
+	pendingStore PendingStore
+
+	subscriptionMethod string
+	unsubscribeMethod  string
+	subsMu             sync.Mutex
+	subs               map[string]*ClientSubscription
+	early              map[string][]json.RawMessage
+	subscribing        int
+}
+
+type ClientOption func(*Client)
+
+// WithServer handles requests and notifications sent by the remote side
+// with the methods of s. Notifications are handled one at a time, in the
+// order they arrive, and requests concurrently.
+func WithServer(s *Server) ClientOption {
+	return func(c *Client) {
+		c.server = s
+	}
+}
+
+// WithClientLogger sets where the client logs. Defaults to the standard
+// logger at LevelInfo.
+func WithClientLogger(l Logger) ClientOption {
+	return func(c *Client) {
+		c.logger = l
+	}
+}
+
+// NewClient starts reading responses from sock. Close must be called to
+// release the socket.
+func NewClient(sock Socket, opts ...ClientOption) *Client {
+	c := &Client{
+		sock:               sock,
+		logger:             defaultLogger,
+		subscriptionMethod: defaultSubscriptionMethod,
+		unsubscribeMethod:  defaultUnsubscribeMethod,
+		subs:               map[string]*ClientSubscription{},
+		notifications:      newOrderedQueue(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.server == nil {
+		c.server = New(&struct{}{}, WithLogger(c.logger))
+	}
+	c.conn = newConn(func(ctx context.Context, msg interface{}) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return c.write(msg)
+	}, c.logger)
+	c.conn.pending.gen = c.idGenerator
+	c.conn.pending.useStore(c.pendingStore)
+	c.conn.closeFn = func() { c.Close() }
+	c.conn.deadlines = c.deadlines
+	c.conn.attachments, _ = sock.(AttachmentSocket)
+	if c.autoBatch != nil {
+		c.autoBatch.conn = c.conn
+	}
+	c.invoke = chainClientInterceptors(c.call, c.interceptors)
+	c.ctx, c.cancel = context.WithCancel(ctxWithConn(context.Background(), c.conn))
+	go c.read()
+	go c.heartbeat.run(c.ctx, c.conn, func() {
+		c.shutdown(ErrHeartbeatTimeout)
+		c.sock.Close()
+	})
+	return c
+}
+
+// Call invokes method with params and waits for the response, decoding the
+// result into result (which may be nil to discard it). Errors returned by the
+// server are of type *Error.
+func (c *Client) Call(ctx context.Context, method string, params, result interface{}) error {
+	if len(c.interceptors) > 0 {
+		ctx = context.WithValue(ctx, clientConnCtxKey{}, c.conn)
+	}
+	return c.invoke(ctx, method, params, result)
+}
+
+func (c *Client) call(ctx context.Context, method string, params, result interface{}) error {
+	if c.autoBatch != nil {
+		return c.autoBatch.call(ctx, method, params, result)
+	}
+	return c.conn.Call(ctx, method, params, result)
+}
+
+// Notify sends a notification. The server does not respond to notifications,
+// so this returns as soon as the message is written.
+func (c *Client) Notify(ctx context.Context, method string, params interface{}) error {
+	if c.autoBatch != nil {
+		return c.autoBatch.notify(ctx, method, params)
+	}
+	return c.conn.Notify(ctx, method, params)
+}
+
+// Conn returns the client's end of the connection.
+func (c *Client) Conn() *Conn {
+	return c.conn
+}
+
+func (c *Client) Close() error {
+	c.shutdown(ErrClientClosed)
+	return c.sock.Close()
+}
+
+func (c *Client) write(msg interface{}) error {
+	select {
+	case <-c.conn.pending.done:
+		return c.conn.pending.closeErr()
+	default:
+	}
+	c.conn.writeMu.Lock()
+	defer c.conn.writeMu.Unlock()
+	return c.sock.WriteJSON(msg)
+}
+
+func (c *Client) read() {
+	for {
+		var raw json.RawMessage
+		if err := c.sock.ReadJSON(&raw); err != nil {
+			if isSyntaxError(err) {
+				c.logger.Log(LevelWarn, "client decode error", "error", err)
+				continue
+			}
+			c.shutdown(err)
+			return
+		}
+		msg, err := decodeIncoming(raw)
+		if err != nil {
+			c.logger.Log(LevelWarn, "client decode error", "error", err)
+			continue
+		}
+		for _, rsp := range msg.rsps {
+			c.conn.pending.resolve(rsp)
+		}
+		if msg.reqs = c.routeEvents(msg.reqs); len(msg.reqs) == 0 {
+			continue
+		}
+		handle := func(msg *incoming) func() {
+			return func() {
+				if out := c.server.handleIncoming(c.ctx, msg); out != nil {
+					if err := c.write(out); err != nil {
+						c.logger.Log(LevelError, "client write error", "error", err)
+					}
+					c.conn.activateSubscriptions(out)
+				}
+			}
+		}(msg)
+		if onlyNotifications(msg) {
+			c.notifications.push(handle)
+		} else {
+			go handle()
+		}
+	}
+}
+
+// onlyNotifications reports whether msg holds nothing but notifications.
+func onlyNotifications(msg *incoming) bool {
+	for _, req := range msg.reqs {
+		if req.err != nil || !req.IsNotification() {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Client) shutdown(err error) {
+	c.notifications.close()
+	c.conn.shutdown(err)
+	c.endSubscriptions(err)
+	c.cancel()
+	c.conn.finish()
+}
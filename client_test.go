@@ -0,0 +1,988 @@
+package jsonrpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jdxcode/jsonrpc"
+	"github.com/jdxcode/jsonrpc/jsonrpctest"
+)
+
+func TestClientCall(t *testing.T) {
+	assert := assert.New(t)
+	client := newTestClient()
+	defer client.Close()
+
+	var result int
+	assert.NoError(client.Call(ctx, "Foo", "test-abc", &result))
+	assert.Equal(123, result)
+
+	var structResult FooStructResult
+	assert.NoError(client.Call(ctx, "FooStruct", &FooStructParams{Foo: "bar"}, &structResult))
+	assert.Equal("bar", structResult.Bar)
+}
+
+func TestClientCallErr(t *testing.T) {
+	assert := assert.New(t)
+	client := newTestClient()
+	defer client.Close()
+
+	err := client.Call(ctx, "FooCodedErr", "test-abc", nil)
+	rpcErr, ok := err.(*jsonrpc.Error)
+	assert.True(ok)
+	assert.Equal(4001, rpcErr.Code)
+	assert.Equal("test-abc", rpcErr.Data)
+
+	err = client.Call(ctx, "invalid_method", nil, nil)
+	assert.True(errors.Is(err, jsonrpc.ErrMethodNotFound))
+}
+
+func TestClientNotify(t *testing.T) {
+	assert := assert.New(t)
+	client := newTestClient()
+	defer client.Close()
+
+	assert.NoError(client.Notify(ctx, "FooNotify", "test-abc"))
+	assert.True(<-notified)
+}
+
+func TestClientNotificationOrder(t *testing.T) {
+	assert := assert.New(t)
+	srv := jsonrpc.New(&struct{}{})
+	assert.NoError(srv.Register("count", func(ctx context.Context, n int) error {
+		for i := 0; i < n; i++ {
+			jsonrpc.Notify(ctx, "n", i)
+		}
+		return nil
+	}))
+	got := make(chan int, 50)
+	handler := jsonrpc.New(&struct{}{})
+	assert.NoError(handler.Register("n", func(ctx context.Context, i int) error {
+		got <- i
+		return nil
+	}))
+	a, b := jsonrpctest.NewPipe()
+	go srv.Handle(ctx, b)
+	client := jsonrpc.NewClient(a, jsonrpc.WithServer(handler))
+	defer client.Close()
+
+	assert.NoError(client.Call(ctx, "count", 50, nil))
+	for i := 0; i < 50; i++ {
+		assert.Equal(i, <-got)
+	}
+}
+
+// countingSocket counts the messages written to it.
+type countingSocket struct {
+	jsonrpc.Socket
+	writes int32
+}
+
+func (s *countingSocket) WriteJSON(v interface{}) error {
+	atomic.AddInt32(&s.writes, 1)
+	return s.Socket.WriteJSON(v)
+}
+
+// overlapSocket records whether writes, attachments included, overlapped.
+type overlapSocket struct {
+	jsonrpc.Socket
+	writing, overlapped int32
+}
+
+func (s *overlapSocket) write(fn func() error) error {
+	if atomic.AddInt32(&s.writing, 1) > 1 {
+		atomic.StoreInt32(&s.overlapped, 1)
+	}
+	defer atomic.AddInt32(&s.writing, -1)
+	time.Sleep(time.Millisecond)
+	return fn()
+}
+
+func (s *overlapSocket) WriteJSON(v interface{}) error {
+	return s.write(func() error { return s.Socket.WriteJSON(v) })
+}
+
+func (s *overlapSocket) WriteAttachment(id string, data []byte) error {
+	return s.write(func() error { return nil })
+}
+
+func (s *overlapSocket) Attachment(id string) ([]byte, bool) {
+	return nil, false
+}
+
+func TestSerializedWrites(t *testing.T) {
+	assert := assert.New(t)
+	srv := jsonrpc.New(&struct{}{})
+	assert.NoError(srv.Register("attach", func(ctx context.Context) (string, error) {
+		return jsonrpc.ConnFromContext(ctx).Attach([]byte("data"))
+	}))
+	a, b := jsonrpctest.NewPipe()
+	sock := &overlapSocket{Socket: b}
+	go srv.Handle(ctx, sock)
+	client := jsonrpc.NewClient(jsonrpc.NewLockedSocket(a))
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var id string
+			assert.NoError(client.Call(ctx, "attach", nil, &id))
+		}()
+	}
+	wg.Wait()
+	assert.Zero(atomic.LoadInt32(&sock.overlapped))
+}
+
+func TestClientBatch(t *testing.T) {
+	assert := assert.New(t)
+	a, b := jsonrpctest.NewPipe()
+	go rpc.Handle(ctx, b)
+	sock := &countingSocket{Socket: a}
+	client := jsonrpc.NewClient(sock)
+	defer client.Close()
+
+	batch := client.Batch()
+	var n int
+	var structResult FooStructResult
+	foo := batch.Call("Foo", "test-abc", &n)
+	fooStruct := batch.Call("FooStruct", &FooStructParams{Foo: "bar"}, &structResult)
+	fooErr := batch.Call("FooErr", "test-abc", nil)
+	batch.Notify("FooNotify", "test-abc")
+	// the batch is answered once FooNotify has reported it ran
+	go func() { assert.True(<-notified) }()
+	assert.NoError(batch.Send(ctx))
+	assert.NoError(foo.Err())
+	assert.Equal(123, n)
+	assert.NoError(fooStruct.Err())
+	assert.Equal("bar", structResult.Bar)
+	assert.Equal("uh oh", fooErr.Err().(*jsonrpc.Error).Message)
+	assert.Equal(int32(1), atomic.LoadInt32(&sock.writes))
+}
+
+func TestClientAutoBatch(t *testing.T) {
+	assert := assert.New(t)
+	a, b := jsonrpctest.NewPipe()
+	go rpc.Handle(ctx, b)
+	sock := &countingSocket{Socket: a}
+	client := jsonrpc.NewClient(sock, jsonrpc.WithAutoBatch(50*time.Millisecond))
+	defer client.Close()
+
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			var n int
+			errs <- client.Call(ctx, "Foo", "test-abc", &n)
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		assert.NoError(<-errs)
+	}
+	assert.Equal(int32(1), atomic.LoadInt32(&sock.writes))
+}
+
+func TestClientCallCancel(t *testing.T) {
+	assert := assert.New(t)
+	a, b := jsonrpctest.NewPipe()
+	client := jsonrpc.NewClient(a)
+	defer client.Close()
+	go func() {
+		// the request is read but never answered
+		var raw json.RawMessage
+		_ = b.ReadJSON(&raw)
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(context.DeadlineExceeded, client.Call(ctx, "Foo", "test-abc", nil))
+}
+
+func TestClientClose(t *testing.T) {
+	assert := assert.New(t)
+	client := newTestClient()
+	assert.NoError(client.Close())
+	assert.Equal(jsonrpc.ErrClientClosed, client.Call(ctx, "Foo", "test-abc", nil))
+}
+
+func TestServerCallsClient(t *testing.T) {
+	assert := assert.New(t)
+	client := newTestClient(jsonrpc.WithServer(jsonrpc.New(&ClientRPC{})))
+	defer client.Close()
+
+	var result string
+	assert.NoError(client.Call(ctx, "FooCallback", "abc", &result))
+	assert.Equal("server:client:abc", result)
+}
+
+func TestProgress(t *testing.T) {
+	assert := assert.New(t)
+	reports := make(chan string, 2)
+	clientRPC := jsonrpc.New(&struct{}{})
+	jsonrpc.Register(clientRPC, "$/progress", func(ctx context.Context, params struct {
+		Token json.RawMessage `json:"token"`
+		Value int             `json:"value"`
+	}) (interface{}, error) {
+		reports <- fmt.Sprintf("%s:%d", params.Token, params.Value)
+		return nil, nil
+	})
+	client := newTestClient(jsonrpc.WithServer(clientRPC))
+	defer client.Close()
+
+	var result int
+	assert.NoError(client.Call(ctx, "FooProgress", map[string]string{"progressToken": "tok"}, &result))
+	assert.Equal(2, result)
+	assert.ElementsMatch([]string{`"tok":1`, `"tok":2`}, []string{<-reports, <-reports})
+}
+
+func TestSubscription(t *testing.T) {
+	assert := assert.New(t)
+	events := make(chan int, 3)
+	clientRPC := jsonrpc.New(&struct{}{})
+	jsonrpc.Register(clientRPC, "$/subscription", func(ctx context.Context, params struct {
+		Subscription string `json:"subscription"`
+		Result       int    `json:"result"`
+	}) (interface{}, error) {
+		events <- params.Result
+		return nil, nil
+	})
+	client := newTestClient(jsonrpc.WithServer(clientRPC))
+	defer client.Close()
+
+	var subID string
+	assert.NoError(client.Call(ctx, "FooSubscribe", 3, &subID))
+	assert.Contains(subID, "0x")
+	assert.ElementsMatch([]int{0, 1, 2}, []int{<-events, <-events, <-events})
+
+	var ok bool
+	assert.NoError(client.Call(ctx, "$/unsubscribe", []string{subID}, &ok))
+	assert.True(ok)
+	<-subClosed
+	assert.NoError(client.Call(ctx, "$/unsubscribe", subID, &ok))
+	assert.False(ok)
+}
+
+func TestSubscribe(t *testing.T) {
+	assert := assert.New(t)
+	srv := jsonrpc.New(&struct{}{})
+	closed := make(chan struct{}, 1)
+	assert.NoError(srv.Register("ticks", func(ctx context.Context, n int) (*jsonrpc.Subscription, error) {
+		sub, err := jsonrpc.NewSubscription(ctx)
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			for i := 0; i < n; i++ {
+				if sub.Notify(context.Background(), i) != nil {
+					break
+				}
+			}
+			<-sub.Done()
+			closed <- struct{}{}
+		}()
+		return sub, nil
+	}))
+	a, b := jsonrpctest.NewPipe()
+	go srv.Handle(ctx, b)
+	client := jsonrpc.NewClient(a)
+	defer client.Close()
+
+	events, sub, err := jsonrpc.Subscribe[int](ctx, client, "ticks", 3)
+	assert.NoError(err)
+	assert.Equal([]int{0, 1, 2}, []int{<-events, <-events, <-events})
+	assert.NoError(sub.Unsubscribe(ctx))
+	<-closed
+	_, open := <-events
+	assert.False(open)
+	assert.NoError(sub.Err())
+
+	events, sub, err = jsonrpc.Subscribe[int](ctx, client, "ticks", 5,
+		jsonrpc.WithEventBuffer(2, jsonrpc.SlowDropNewest))
+	assert.NoError(err)
+	for i := 0; i < 1000 && sub.Dropped() < 3; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(uint64(3), sub.Dropped())
+	assert.Equal([]int{0, 1}, []int{<-events, <-events})
+	assert.NoError(sub.Unsubscribe(ctx))
+	<-closed
+
+	subCtx, cancel := context.WithCancel(ctx)
+	events, sub, err = jsonrpc.Subscribe[int](subCtx, client, "ticks", 1)
+	assert.NoError(err)
+	assert.Equal(0, <-events)
+	cancel()
+	<-closed
+	<-sub.Done()
+
+	events, sub, err = jsonrpc.Subscribe[int](ctx, client, "ticks", 3,
+		jsonrpc.WithEventBuffer(1, jsonrpc.SlowUnsubscribe))
+	assert.NoError(err)
+	<-closed
+	assert.Equal(jsonrpc.ErrSlowConsumer, sub.Err())
+	assert.Equal(0, <-events)
+}
+
+func TestHello(t *testing.T) {
+	assert := assert.New(t)
+	srv := jsonrpc.New(&struct{}{}, jsonrpc.WithHello("codec:msgpack"), jsonrpc.WithDeadlines())
+	assert.NoError(srv.Register("supports", func(ctx context.Context, ext string) (bool, error) {
+		return jsonrpc.ConnFromContext(ctx).Supports(ext), nil
+	}))
+	a, b := jsonrpctest.NewPipe()
+	go srv.Handle(ctx, b)
+	client := jsonrpc.NewClient(a)
+	defer client.Close()
+
+	var ok bool
+	assert.NoError(client.Call(ctx, "supports", jsonrpc.ExtDeadlines, &ok))
+	assert.True(ok)
+	hello, err := client.Hello(ctx, "codec:msgpack")
+	assert.NoError(err)
+	assert.Equal(jsonrpc.ProtocolVersion, hello.Version)
+	assert.Equal([]string{jsonrpc.ExtCancel, jsonrpc.ExtProgress, jsonrpc.ExtSubscriptions, jsonrpc.ExtDeadlines,
+		"codec:msgpack"}, hello.Extensions)
+	assert.True(client.Conn().Supports("codec:msgpack"))
+	assert.False(client.Conn().Supports(jsonrpc.ExtDeadlines))
+	assert.NoError(client.Call(ctx, "supports", jsonrpc.ExtDeadlines, &ok))
+	assert.False(ok)
+	assert.NoError(client.Call(ctx, "supports", jsonrpc.ExtProgress, &ok))
+	assert.True(ok)
+
+	plain := newTestClient()
+	defer plain.Close()
+	_, err = plain.Hello(ctx)
+	assert.Error(err)
+	assert.True(plain.Conn().Supports(jsonrpc.ExtDeadlines))
+}
+
+func TestIDGenerators(t *testing.T) {
+	assert := assert.New(t)
+	srv := jsonrpc.New(&struct{}{})
+	assert.NoError(srv.Register("id", func(ctx context.Context) (string, error) {
+		return jsonrpc.RequestFromContext(ctx).ID.String(), nil
+	}))
+	a, b := jsonrpctest.NewPipe()
+	go srv.Handle(ctx, b)
+	client := jsonrpc.NewClient(a, jsonrpc.WithClientIDGenerator(jsonrpc.PrefixedIDs("c-")))
+	defer client.Close()
+
+	var id string
+	assert.NoError(client.Call(ctx, "id", nil, &id))
+	assert.Equal("c-1", id)
+	assert.NoError(client.Call(ctx, "id", nil, &id))
+	assert.Equal("c-2", id)
+
+	gen := jsonrpc.UUIDv7IDs()
+	first, second := gen(), gen()
+	assert.Regexp(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, first.String())
+	assert.NotEqual(first, second)
+	next := jsonrpc.SequentialIDs()
+	assert.Equal(jsonrpc.Int64ID(1), next())
+	assert.Equal(jsonrpc.Int64ID(2), next())
+}
+
+func TestPendingStore(t *testing.T) {
+	assert := assert.New(t)
+	store := jsonrpc.NewMemoryPendingStore()
+	a, upstreamA := jsonrpctest.NewPipe()
+	b, upstreamB := jsonrpctest.NewPipe()
+	sender := jsonrpc.NewClient(a, jsonrpc.WithClientPendingStore(store))
+	defer sender.Close()
+	other := jsonrpc.NewClient(b, jsonrpc.WithClientPendingStore(store))
+	defer other.Close()
+
+	// the response to a call sent over one connection comes back over the other
+	go func() {
+		var req jsonrpc.Request
+		assert.NoError(upstreamA.ReadJSON(&req))
+		assert.NoError(upstreamB.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": "routed"}))
+	}()
+	var result string
+	assert.NoError(sender.Call(ctx, "work", nil, &result))
+	assert.Equal("routed", result)
+	assert.False(store.Resolve(jsonrpc.StringID("gone"), []byte(`{}`)))
+}
+
+func TestConnLifecycle(t *testing.T) {
+	assert := assert.New(t)
+	type userKey struct{}
+	disconnected := make(chan error, 1)
+	rpc := jsonrpc.New(&struct{}{},
+		jsonrpc.WithOnConnect(func(ctx context.Context, conn *jsonrpc.Conn) {
+			conn.Set(userKey{}, "alice")
+		}),
+		jsonrpc.WithOnDisconnect(func(conn *jsonrpc.Conn, err error) {
+			user, _ := conn.Get(userKey{})
+			assert.Equal("alice", user)
+			disconnected <- err
+		}))
+	assert.NoError(rpc.Register("whoami", func(ctx context.Context) (interface{}, error) {
+		user, _ := jsonrpc.ConnFromContext(ctx).Get(userKey{})
+		return user, nil
+	}))
+	a, b := jsonrpctest.NewPipe()
+	go rpc.Handle(ctx, b)
+	client := jsonrpc.NewClient(a)
+
+	var user string
+	assert.NoError(client.Call(ctx, "whoami", nil, &user))
+	assert.Equal("alice", user)
+	client.Close()
+	assert.Equal(io.EOF, <-disconnected)
+}
+
+func TestNestedCalls(t *testing.T) {
+	// each side answers ping(n) by calling ping(n-1) on the other
+	ping := func(ctx context.Context, n int) (int, error) {
+		if n == 0 {
+			return 0, nil
+		}
+		var depth int
+		err := jsonrpc.ConnFromContext(ctx).Call(ctx, "ping", n-1, &depth)
+		return depth + 1, err
+	}
+	for name, opts := range map[string][]jsonrpc.Option{
+		"default":       nil,
+		"limit":         {jsonrpc.WithConcurrencyLimit(1, jsonrpc.BusyQueue)},
+		"priorities":    {jsonrpc.WithConcurrencyLimit(1, jsonrpc.BusyQueue), jsonrpc.WithPriorities(4)},
+		"ordered":       {jsonrpc.WithOrderedExecution()},
+		"ordered+limit": {jsonrpc.WithOrderedExecution(), jsonrpc.WithConcurrencyLimit(1, jsonrpc.BusyQueue)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			rpc := jsonrpc.New(&struct{}{}, opts...)
+			jsonrpc.Register(rpc, "ping", ping)
+			clientRPC := jsonrpc.New(&struct{}{}, opts...)
+			jsonrpc.Register(clientRPC, "ping", ping)
+			a, b := jsonrpctest.NewPipe()
+			go rpc.Handle(ctx, b)
+			client := jsonrpc.NewClient(a, jsonrpc.WithServer(clientRPC))
+			defer client.Close()
+
+			ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			var wg sync.WaitGroup
+			for i := 0; i < 3; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					var depth int
+					assert.NoError(client.Call(ctx, "ping", 6, &depth))
+					assert.Equal(6, depth)
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	assert := assert.New(t)
+	type roomKey struct{}
+	rpc := jsonrpc.New(&struct{}{})
+	assert.NoError(rpc.Register("join", func(ctx context.Context, room string) (interface{}, error) {
+		jsonrpc.ConnFromContext(ctx).Set(roomKey{}, room)
+		return nil, nil
+	}))
+
+	messages := make(chan string, 10)
+	var clients []*jsonrpc.Client
+	for _, room := range []string{"go", "go", "rust"} {
+		name := room
+		clientRPC := jsonrpc.New(&struct{}{})
+		jsonrpc.Register(clientRPC, "message", func(ctx context.Context, msg string) (interface{}, error) {
+			messages <- name + ":" + msg
+			return nil, nil
+		})
+		a, b := jsonrpctest.NewPipe()
+		go rpc.Handle(ctx, b)
+		client := jsonrpc.NewClient(a, jsonrpc.WithServer(clientRPC))
+		defer client.Close()
+		assert.NoError(client.Call(ctx, "join", room, nil))
+		clients = append(clients, client)
+	}
+	assert.Len(rpc.Connections(), 3)
+
+	assert.NoError(rpc.BroadcastFunc(ctx, func(c *jsonrpc.Conn) bool {
+		room, _ := c.Get(roomKey{})
+		return room == "go"
+	}, "message", "hi"))
+	assert.Equal([]string{"go:hi", "go:hi"}, []string{<-messages, <-messages})
+
+	assert.NoError(rpc.Broadcast(ctx, "message", "all"))
+	assert.ElementsMatch([]string{"go:all", "go:all", "rust:all"}, []string{<-messages, <-messages, <-messages})
+
+	clients[2].Close()
+	assert.Eventually(func() bool { return len(rpc.Connections()) == 2 }, time.Second, time.Millisecond)
+}
+
+func TestDeadlines(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&struct{}{}, jsonrpc.WithDeadlines(), jsonrpc.WithLogger(jsonrpc.DiscardLogger))
+	var ran int32
+	assert.NoError(rpc.Register("remaining", func(ctx context.Context) (time.Duration, error) {
+		atomic.AddInt32(&ran, 1)
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			return 0, nil
+		}
+		return time.Until(deadline), nil
+	}))
+	a, b := jsonrpctest.NewPipe()
+	go rpc.Handle(ctx, b)
+	client := jsonrpc.NewClient(a, jsonrpc.WithClientDeadlines())
+	defer client.Close()
+
+	var remaining time.Duration
+	assert.NoError(client.Call(ctx, "remaining", nil, &remaining))
+	assert.Zero(remaining)
+	callCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	assert.NoError(client.Call(callCtx, "remaining", nil, &remaining))
+	assert.InDelta(time.Minute, remaining, float64(time.Second))
+
+	// a call the client has already given up on doesn't run
+	srv := httptest.NewServer(jsonrpc.HTTPHandler(rpc))
+	defer srv.Close()
+	req, err := http.NewRequest(http.MethodPost, srv.URL,
+		strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"remaining"}`))
+	assert.NoError(err)
+	req.Header.Set(jsonrpc.DeadlineHeader, time.Now().Add(-time.Second).Format(time.RFC3339Nano))
+	rsp, err := http.DefaultClient.Do(req)
+	assert.NoError(err)
+	defer rsp.Body.Close()
+	var out struct{ Error *jsonrpc.Error }
+	assert.NoError(json.NewDecoder(rsp.Body).Decode(&out))
+	assert.Equal(jsonrpc.CodeRequestTimeout, out.Error.Code)
+	assert.Equal(int32(2), atomic.LoadInt32(&ran))
+}
+
+func TestClientInterceptors(t *testing.T) {
+	assert := assert.New(t)
+	srv := jsonrpc.New(&struct{}{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger))
+	var attempts int32
+	flaky := func(ctx context.Context, token string) (string, error) {
+		if atomic.AddInt32(&attempts, 1)%3 != 0 {
+			return "", jsonrpc.ErrServerBusy
+		}
+		return token, nil
+	}
+	assert.NoError(srv.Register("read", flaky))
+	assert.NoError(srv.Register("write", flaky))
+	a, b := jsonrpctest.NewPipe()
+	go srv.Handle(ctx, b)
+	var calls []string
+	client := jsonrpc.NewClient(a, jsonrpc.WithClientInterceptors(
+		func(ctx context.Context, method string, params, result interface{}, next jsonrpc.Invoker) error {
+			calls = append(calls, method)
+			return next(ctx, method, "secret", result)
+		},
+		jsonrpc.Retry(jsonrpc.RetryPolicy{
+			Backoff:    time.Millisecond,
+			Codes:      []int{jsonrpc.CodeServerBusy},
+			Idempotent: func(method string) bool { return method == "read" },
+		}),
+	))
+	defer client.Close()
+
+	var token string
+	assert.NoError(client.Call(ctx, "read", nil, &token))
+	assert.Equal("secret", token)
+	assert.EqualValues(3, atomic.LoadInt32(&attempts))
+	assert.Equal(jsonrpc.ErrServerBusy, client.Call(ctx, "write", nil, &token))
+	assert.EqualValues(4, atomic.LoadInt32(&attempts))
+	assert.NoError(client.Call(jsonrpc.WithIdempotencyKey(ctx, "k"), "write", nil, &token))
+	assert.EqualValues(6, atomic.LoadInt32(&attempts))
+	assert.Equal([]string{"read", "write", "write"}, calls)
+}
+
+func TestRetryPermanent(t *testing.T) {
+	assert := assert.New(t)
+	srv := jsonrpc.New(&struct{}{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger))
+	var attempts int32
+	assert.NoError(srv.Register("busy", func(ctx context.Context) error {
+		atomic.AddInt32(&attempts, 1)
+		return jsonrpc.ErrServerBusy
+	}))
+	a, b := jsonrpctest.NewPipe()
+	assert.NoError(srv.Register("hangup", func(ctx context.Context) error {
+		atomic.AddInt32(&attempts, 1)
+		return b.Close()
+	}))
+	go srv.Handle(ctx, b)
+	var sent int32
+	client := jsonrpc.NewClient(a, jsonrpc.WithClientInterceptors(
+		jsonrpc.Retry(jsonrpc.RetryPolicy{
+			Backoff: time.Millisecond,
+			Codes:   []int{jsonrpc.CodeServerBusy},
+		}),
+		func(ctx context.Context, method string, params, result interface{}, next jsonrpc.Invoker) error {
+			atomic.AddInt32(&sent, 1)
+			return next(ctx, method, params, result)
+		},
+	))
+	defer client.Close()
+
+	// without Idempotent, only calls with an idempotency key are retried
+	assert.Equal(jsonrpc.ErrServerBusy, client.Call(ctx, "busy", nil, nil))
+	assert.EqualValues(1, atomic.LoadInt32(&attempts))
+	assert.Equal(jsonrpc.ErrServerBusy, client.Call(jsonrpc.WithIdempotencyKey(ctx, "k"), "busy", nil, nil))
+	assert.EqualValues(4, atomic.LoadInt32(&attempts))
+
+	// nor are calls on a connection that has ended
+	atomic.StoreInt32(&sent, 0)
+	assert.Error(client.Call(jsonrpc.WithIdempotencyKey(ctx, "k2"), "hangup", nil, nil))
+	assert.EqualValues(1, atomic.LoadInt32(&sent))
+}
+
+func TestOnAbandoned(t *testing.T) {
+	assert := assert.New(t)
+	abandoned := make(chan string, 1)
+	stopped := make(chan error, 1)
+	rpc := jsonrpc.New(&struct{}{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger),
+		jsonrpc.WithOnAbandoned(func(ctx context.Context, req *jsonrpc.Request) {
+			abandoned <- req.Method
+		}))
+	started := make(chan struct{})
+	assert.NoError(rpc.Register("slow", func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return nil, ctx.Err()
+	}))
+	a, b := jsonrpctest.NewPipe()
+	go rpc.Handle(ctx, b)
+	client := jsonrpc.NewClient(a)
+	go client.Call(ctx, "slow", nil, nil)
+	<-started
+	client.Close()
+	assert.Equal("slow", <-abandoned)
+	assert.Equal(context.Canceled, <-stopped)
+}
+
+func TestHeartbeat(t *testing.T) {
+	assert := assert.New(t)
+	disconnected := make(chan error, 1)
+	rpc := jsonrpc.New(&struct{}{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger),
+		jsonrpc.WithHeartbeat(5*time.Millisecond, 2),
+		jsonrpc.WithOnDisconnect(func(conn *jsonrpc.Conn, err error) { disconnected <- err }))
+
+	// a client answers pings, even with method not found
+	a, b := jsonrpctest.NewPipe()
+	go rpc.Handle(ctx, b)
+	client := jsonrpc.NewClient(a, jsonrpc.WithClientLogger(jsonrpc.DiscardLogger))
+	time.Sleep(30 * time.Millisecond)
+	assert.True(errors.Is(client.Call(ctx, "missing", nil, nil), jsonrpc.ErrMethodNotFound))
+	client.Close()
+	assert.Equal(io.EOF, <-disconnected)
+
+	// a peer that never answers is dropped
+	a, b = jsonrpctest.NewPipe()
+	go rpc.Handle(ctx, b)
+	go func() {
+		var msg json.RawMessage
+		for a.ReadJSON(&msg) == nil {
+		}
+	}()
+	assert.Equal(jsonrpc.ErrHeartbeatTimeout, <-disconnected)
+}
+
+func TestConnCloseAndWait(t *testing.T) {
+	assert := assert.New(t)
+	conns := make(chan *jsonrpc.Conn, 1)
+	lateErr := make(chan error, 1)
+	rpc := jsonrpc.New(&struct{}{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger),
+		jsonrpc.WithOnConnect(func(ctx context.Context, conn *jsonrpc.Conn) { conns <- conn }))
+	assert.NoError(rpc.Register("bye", func(ctx context.Context) (string, error) {
+		conn := jsonrpc.ConnFromContext(ctx)
+		go func() {
+			// outlives the handler and the connection
+			for {
+				if err := conn.Notify(context.Background(), "late", nil); err != nil {
+					lateErr <- err
+					return
+				}
+			}
+		}()
+		return "bye", conn.Close()
+	}))
+	a, b := jsonrpctest.NewPipe()
+	go rpc.Handle(ctx, b)
+	client := jsonrpc.NewClient(a, jsonrpc.WithClientLogger(jsonrpc.DiscardLogger))
+	defer client.Close()
+
+	var result string
+	assert.NoError(client.Call(ctx, "bye", nil, &result))
+	assert.Equal("bye", result)
+	conn := <-conns
+	conn.Wait()
+	<-conn.Done()
+	assert.Equal(jsonrpc.ErrConnClosed, <-lateErr)
+}
+
+func TestServerShutdown(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&TestRPC{})
+	a, b := jsonrpctest.NewPipe()
+	handled := make(chan struct{})
+	go func() {
+		rpc.Handle(ctx, b)
+		close(handled)
+	}()
+	client := jsonrpc.NewClient(a)
+	defer client.Close()
+
+	called := make(chan error)
+	go func() {
+		called <- client.Call(ctx, "FooSlow", nil, nil)
+	}()
+	<-slowStarted
+
+	shutdown := make(chan error)
+	go func() {
+		shutdown <- rpc.Shutdown(ctx)
+	}()
+	slowRelease <- struct{}{}
+	assert.NoError(<-called)
+	assert.NoError(<-shutdown)
+	<-handled
+}
+
+var (
+	slowStarted = make(chan struct{})
+	slowRelease = make(chan struct{})
+)
+
+func (r *TestRPC) FooSlow(ctx context.Context) error {
+	slowStarted <- struct{}{}
+	<-slowRelease
+	return nil
+}
+
+func TestClientCancelRequest(t *testing.T) {
+	assert := assert.New(t)
+	client := newTestClient()
+	defer client.Close()
+
+	called := make(chan error)
+	go func() {
+		called <- client.Call(ctx, "FooBlock", nil, nil)
+	}()
+	<-blockStarted
+	assert.NoError(client.Notify(ctx, "$/cancelRequest", map[string]int{"id": 1}))
+	assert.True(errors.Is(<-called, jsonrpc.ErrRequestCancelled))
+}
+
+func TestConcurrencyLimitReject(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&TestRPC{}, jsonrpc.WithConcurrencyLimit(1, jsonrpc.BusyReject))
+	a, b := jsonrpctest.NewPipe()
+	go rpc.Handle(ctx, b)
+	client := jsonrpc.NewClient(a)
+	defer client.Close()
+
+	called := make(chan error)
+	go func() {
+		called <- client.Call(ctx, "FooBlock", nil, nil)
+	}()
+	<-blockStarted
+	assert.True(errors.Is(client.Call(ctx, "Foo", "test-abc", nil), jsonrpc.ErrServerBusy))
+	assert.NoError(client.Notify(ctx, "$/cancelRequest", map[string]int{"id": 1}))
+	assert.True(errors.Is(<-called, jsonrpc.ErrRequestCancelled))
+	assert.NoError(client.Call(ctx, "Foo", "test-abc", nil))
+}
+
+func TestPriorities(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&struct{}{}, jsonrpc.WithConcurrencyLimit(1, jsonrpc.BusyQueue),
+		jsonrpc.WithPriorities(10, jsonrpc.PriorityMethods(10, "health"), jsonrpc.ClientPriority(5)))
+	gate := make(chan struct{})
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, name)
+	}
+	assert.NoError(rpc.Register("block", func(ctx context.Context) error {
+		<-gate
+		return nil
+	}))
+	assert.NoError(rpc.Register("work", func(ctx context.Context, name string) error {
+		record(name)
+		return nil
+	}))
+	assert.NoError(rpc.Register("health", func(ctx context.Context) error {
+		record("health")
+		return nil
+	}))
+	a, b := jsonrpctest.NewPipe()
+	go rpc.Handle(ctx, b)
+	client := jsonrpc.NewClient(a)
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	call := func(ctx context.Context, method string, params interface{}) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(client.Call(ctx, method, params, nil))
+		}()
+		// let it be read before the next
+		time.Sleep(10 * time.Millisecond)
+	}
+	call(ctx, "block", nil)
+	call(ctx, "work", "first")
+	call(ctx, "work", "second")
+	call(jsonrpc.WithCallPriority(ctx, 100), "work", "urgent")
+	call(ctx, "health", nil)
+	close(gate)
+	wg.Wait()
+	assert.Equal([]string{"health", "urgent", "first", "second"}, order)
+}
+
+func TestOrderedExecution(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&TestRPC{}, jsonrpc.WithOrderedExecution())
+	a, b := jsonrpctest.NewPipe()
+	go rpc.Handle(ctx, b)
+	client := jsonrpc.NewClient(a)
+	defer client.Close()
+
+	blocked := make(chan error)
+	go func() {
+		blocked <- client.Call(ctx, "FooBlock", nil, nil)
+	}()
+	<-blockStarted
+	called := make(chan error)
+	go func() {
+		called <- client.Call(ctx, "Foo", "test-abc", nil)
+	}()
+	select {
+	case <-called:
+		t.Fatal("Foo ran before FooBlock finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+	assert.NoError(client.Notify(ctx, "$/cancelRequest", map[string]int{"id": 1}))
+	assert.True(errors.Is(<-blocked, jsonrpc.ErrRequestCancelled))
+	assert.NoError(<-called)
+}
+
+func TestReconnectingClient(t *testing.T) {
+	assert := assert.New(t)
+	var calls int32
+	started := make(chan struct{}, 1)
+	s := jsonrpc.New(&struct{}{})
+	assert.NoError(s.Register("flaky", func(ctx context.Context) (string, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			started <- struct{}{}
+			<-ctx.Done()
+		}
+		return "ok", nil
+	}))
+	socks := make(chan jsonrpc.Socket, 2)
+	dial := func(ctx context.Context) (jsonrpc.Socket, error) {
+		a, b := jsonrpctest.NewPipe()
+		socks <- b
+		go s.Handle(ctx, b)
+		return a, nil
+	}
+	reconnected := make(chan struct{}, 1)
+	for _, policy := range []jsonrpc.ReplayPolicy{jsonrpc.RetryPending, jsonrpc.FailPending} {
+		atomic.StoreInt32(&calls, 0)
+		client, err := jsonrpc.NewReconnectingClient(ctx, dial,
+			jsonrpc.WithReplayPolicy(policy),
+			jsonrpc.WithReconnectBackoff(time.Millisecond, 10*time.Millisecond),
+			jsonrpc.WithOnReconnect(func(ctx context.Context, c *jsonrpc.Client) { reconnected <- struct{}{} }),
+		)
+		assert.NoError(err)
+
+		result := make(chan error)
+		go func() {
+			var out string
+			result <- client.Call(ctx, "flaky", nil, &out)
+		}()
+		<-started
+		(<-socks).Close()
+		err = <-result
+		if policy == jsonrpc.RetryPending {
+			assert.NoError(err)
+		} else {
+			assert.Error(err)
+		}
+		<-reconnected
+		assert.NoError(client.Call(ctx, "flaky", nil, nil))
+		assert.NoError(client.Close())
+		<-socks
+	}
+}
+
+var blockStarted = make(chan struct{})
+
+func (r *TestRPC) FooBlock(ctx context.Context) error {
+	blockStarted <- struct{}{}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (r *TestRPC) FooProgress(ctx context.Context, params map[string]string) (int, error) {
+	p := jsonrpc.ProgressFromContext(ctx)
+	for i := 1; i <= 2; i++ {
+		if err := p.Report(ctx, i); err != nil {
+			return 0, err
+		}
+	}
+	return 2, nil
+}
+
+var subClosed = make(chan struct{})
+
+func (r *TestRPC) FooSubscribe(ctx context.Context, n int) (*jsonrpc.Subscription, error) {
+	sub, err := jsonrpc.NewSubscription(ctx)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for i := 0; i < n; i++ {
+			if err := sub.Notify(context.Background(), i); err != nil {
+				return
+			}
+		}
+		<-sub.Done()
+		subClosed <- struct{}{}
+	}()
+	return sub, nil
+}
+
+type ClientRPC struct{}
+
+func (r *ClientRPC) Echo(ctx context.Context, params string) (string, error) {
+	return "client:" + params, nil
+}
+
+func (r *TestRPC) FooCallback(ctx context.Context, params string) (string, error) {
+	var result string
+	if err := jsonrpc.ConnFromContext(ctx).Call(ctx, "Echo", params, &result); err != nil {
+		return "", err
+	}
+	return "server:" + result, nil
+}
+
+func newTestClient(opts ...jsonrpc.ClientOption) *jsonrpc.Client {
+	a, b := jsonrpctest.NewPipe()
+	go rpc.Handle(ctx, b)
+	return jsonrpc.NewClient(a, opts...)
+}
@@ -0,0 +1,110 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+type (
+	// Invoker makes a call from a client, see Client.Call.
+	Invoker func(ctx context.Context, method string, params, result interface{}) error
+
+	// ClientInterceptor wraps the calls made by a Client, as Interceptor does
+	// on the server. It may inspect or modify the call, e.g. to add
+	// credentials to the params or context, retry it, or short-circuit by
+	// returning without calling next.
+	ClientInterceptor func(ctx context.Context, method string, params, result interface{}, next Invoker) error
+)
+
+// WithClientInterceptors adds interceptors around the client's calls. They
+// run in the order given, the first being the outermost. Notifications and
+// batches don't go through them.
+func WithClientInterceptors(interceptors ...ClientInterceptor) ClientOption {
+	return func(c *Client) {
+		c.interceptors = append(c.interceptors, interceptors...)
+	}
+}
+
+func chainClientInterceptors(invoke Invoker, interceptors []ClientInterceptor) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoke
+		invoke = func(ctx context.Context, method string, params, result interface{}) error {
+			return interceptor(ctx, method, params, result, next)
+		}
+	}
+	return invoke
+}
+
+// RetryPolicy configures Retry.
+type RetryPolicy struct {
+	// MaxAttempts is how many times a call is sent at most, including the
+	// first. Defaults to 3.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, which doubles with
+	// jitter after each attempt up to MaxBackoff. Defaults to 100ms and 5s.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Codes are the error codes retried besides transport failures, e.g.
+	// CodeServerBusy or CodeRateLimited.
+	Codes []int
+	// Idempotent reports whether method can safely run twice. Others are
+	// only retried when the call carries a key from WithIdempotencyKey. Nil
+	// means none can.
+	Idempotent func(method string) bool
+}
+
+// Retry returns an interceptor that sends calls again after transient
+// failures: transport errors while the client's connection is still open,
+// and errors with one of the policy's codes.
+func Retry(p RetryPolicy) ClientInterceptor {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.Backoff <= 0 {
+		p.Backoff = 100 * time.Millisecond
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 5 * time.Second
+	}
+	codes := map[int]bool{}
+	for _, code := range p.Codes {
+		codes[code] = true
+	}
+	return func(ctx context.Context, method string, params, result interface{}, next Invoker) error {
+		retryable := (p.Idempotent != nil && p.Idempotent(method)) || idempotencyKeyFromContext(ctx) != ""
+		backoff := p.Backoff
+		for attempt := 1; ; attempt++ {
+			err := next(ctx, method, params, result)
+			if err == nil || !retryable || attempt >= p.MaxAttempts || !p.transient(ctx, err, codes) {
+				return err
+			}
+			timer := time.NewTimer(backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1)))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			}
+			if backoff *= 2; backoff > p.MaxBackoff {
+				backoff = p.MaxBackoff
+			}
+		}
+	}
+}
+
+func (p RetryPolicy) transient(ctx context.Context, err error, codes map[int]bool) bool {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return codes[rpcErr.Code]
+	}
+	// once the connection is gone, e.g. with io.EOF from the read loop,
+	// sending again can only fail
+	if conn, _ := ctx.Value(clientConnCtxKey{}).(*Conn); conn != nil && conn.pending.closeErr() != nil {
+		return false
+	}
+	return ctx.Err() == nil && !errors.Is(err, ErrClientClosed) && !errors.Is(err, ErrConnClosed)
+}
+
+type clientConnCtxKey struct{}
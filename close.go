@@ -5,10 +5,40 @@ import (
 	"sync"
 )
 
-func onClose(sock Socket, responses chan<- *Response, wg *sync.WaitGroup) {
+// teardown waits for the handlers to finish and their responses to be written
+// before closing the socket. The send queue is never closed, so goroutines
+// that outlive their handler get ErrConnClosed rather than a panic.
+func (c *Conn) teardown(wg *sync.WaitGroup, written <-chan struct{}) {
 	wg.Wait()
-	close(responses)
-	sock.Close()
+	close(c.closing)
+	<-written
+	c.sock.Close()
+}
+
+// finish marks the connection as torn down, releasing Wait.
+func (c *Conn) finish() {
+	c.doneOnce.Do(func() { close(c.done) })
+}
+
+// Close stops reading from the connection. Requests already read are still
+// handled and their responses written before the socket is closed, so Close
+// may be called from a handler; use Wait to block until the connection is
+// torn down. Unlike the package-level Close, it does not cancel handlers.
+func (c *Conn) Close() error {
+	if c.closeFn != nil {
+		c.closeFn()
+	}
+	return nil
+}
+
+// Wait blocks until the connection is closed and torn down.
+func (c *Conn) Wait() {
+	<-c.done
+}
+
+// Done is closed once the connection is closed and torn down.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
 }
 
 func Close(ctx context.Context) {
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/jdxcode/jsonrpc"
+	"github.com/jdxcode/jsonrpc/ws"
+)
+
+// dial connects to endpoint, see the package doc for the forms it takes.
+func dial(ctx context.Context, endpoint string, header http.Header, lsp bool) (jsonrpc.Socket, error) {
+	scheme, rest, _ := strings.Cut(endpoint, ":")
+	switch scheme {
+	case "ws", "wss":
+		return ws.Dial(ctx, endpoint, ws.WithHeader(header))
+	case "http", "https":
+		return newHTTPSocket(ctx, endpoint, header), nil
+	case "tcp", "unix":
+		return jsonrpc.DialFunc(scheme, strings.TrimPrefix(rest, "//"))(ctx)
+	case "stdio":
+		return spawn(rest, lsp)
+	}
+	return nil, fmt.Errorf("unsupported endpoint %q", endpoint)
+}
+
+// httpSocket POSTs each message written to it, reading back the responses.
+// The requests are canceled with ctx or on Close.
+type httpSocket struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	url    string
+	header http.Header
+	msgs   chan []byte
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newHTTPSocket(ctx context.Context, url string, header http.Header) *httpSocket {
+	ctx, cancel := context.WithCancel(ctx)
+	return &httpSocket{ctx: ctx, cancel: cancel, url: url, header: header, msgs: make(chan []byte),
+		done: make(chan struct{})}
+}
+
+// WriteJSON posts calls in the background, so that waiting for their
+// responses is bounded by the calls' contexts, and a failed post answers
+// them with its error. Notifications are posted before returning, to report
+// their errors.
+func (s *httpSocket) WriteJSON(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	ids := callIDs(b)
+	if len(ids) == 0 {
+		_, err := s.post(b)
+		return err
+	}
+	go func() {
+		body, err := s.post(b)
+		if err != nil {
+			body = errorResponses(b, ids, err)
+		}
+		if len(body) == 0 {
+			return
+		}
+		select {
+		case s.msgs <- body:
+		case <-s.done:
+		}
+	}()
+	return nil
+}
+
+// post POSTs msg and returns the response body, empty for notifications.
+func (s *httpSocket) post(msg []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, s.url, bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range s.header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	body, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode != http.StatusOK && rsp.StatusCode != http.StatusAccepted && rsp.StatusCode != http.StatusNoContent {
+		return nil, fmt.Errorf("%s: %s", rsp.Status, bytes.TrimSpace(body))
+	}
+	return bytes.TrimSpace(body), nil
+}
+
+// callIDs returns the ids of the calls in msg, a request or a batch.
+func callIDs(msg []byte) []json.RawMessage {
+	var entries []batchEntry
+	if json.Unmarshal(msg, &entries) != nil {
+		entries = make([]batchEntry, 1)
+		_ = json.Unmarshal(msg, &entries[0])
+	}
+	var ids []json.RawMessage
+	for _, e := range entries {
+		if e.ID != nil {
+			ids = append(ids, *e.ID)
+		}
+	}
+	return ids
+}
+
+// errorResponses answers the calls with ids in msg with err, as a batch if
+// msg is one.
+func errorResponses(msg []byte, ids []json.RawMessage, err error) []byte {
+	rsps := make([]jsonrpc.Response, len(ids))
+	for i, id := range ids {
+		rsps[i] = jsonrpc.Response{JSONRPC: "2.0",
+			Error: &jsonrpc.Error{Code: jsonrpc.CodeInternalError, Message: err.Error()}}
+		_ = json.Unmarshal(id, &rsps[i].ID)
+	}
+	var b []byte
+	if msg[0] == '[' {
+		b, _ = json.Marshal(rsps)
+	} else {
+		b, _ = json.Marshal(rsps[0])
+	}
+	return b
+}
+
+func (s *httpSocket) ReadJSON(v interface{}) error {
+	select {
+	case b := <-s.msgs:
+		return json.Unmarshal(b, v)
+	case <-s.done:
+		return io.EOF
+	}
+}
+
+func (s *httpSocket) Close() error {
+	s.once.Do(func() {
+		s.cancel()
+		close(s.done)
+	})
+	return nil
+}
+
+// process is a command's stdin and stdout.
+type process struct {
+	io.Reader
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+// Close closes the command's stdin and waits for it to exit.
+func (p *process) Close() error {
+	err := p.WriteCloser.Close()
+	if werr := p.cmd.Wait(); err == nil {
+		err = werr
+	}
+	return err
+}
+
+// spawn starts command, split on spaces, and talks to it over its stdin and
+// stdout.
+func spawn(command string, lsp bool) (jsonrpc.Socket, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("stdio: endpoint needs a command")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	p := &process{Reader: stdout, WriteCloser: stdin, cmd: cmd}
+	if lsp {
+		return jsonrpc.NewHeaderSocket(stdout, stdin, p), nil
+	}
+	return jsonrpc.NewStreamSocket(p), nil
+}
+
+// printer writes JSON to stdout, one value at a time.
+type printer struct {
+	mu  sync.Mutex
+	w   io.Writer
+	raw bool
+}
+
+// print writes v indented, or compact with -raw.
+func (p *printer) print(v json.RawMessage) error {
+	var buf bytes.Buffer
+	if len(v) == 0 {
+		v = json.RawMessage("null")
+	}
+	if p.raw {
+		_ = json.Compact(&buf, v)
+	} else {
+		_ = json.Indent(&buf, v, "", "  ")
+	}
+	return p.line(buf.Bytes())
+}
+
+// line writes b on a line of its own.
+func (p *printer) line(b []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := p.w.Write(append(b, '\n'))
+	return err
+}
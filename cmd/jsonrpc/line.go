@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// lineEditor reads the REPL's lines. On a terminal it edits them itself,
+// with history and tab completion, and output written to it meanwhile is
+// printed above the line being edited; otherwise it reads plain lines.
+type lineEditor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	restore  func()
+	complete func(line string) []string
+
+	mu      sync.Mutex
+	prompt  string
+	buf     []rune
+	history []string
+}
+
+// newLineEditor reads from in, editing the lines itself if in is a terminal.
+func newLineEditor(in io.Reader, out io.Writer, prompt string) *lineEditor {
+	e := &lineEditor{in: bufio.NewReader(in), out: out, prompt: prompt}
+	if f, ok := in.(*os.File); ok {
+		if restore, err := makeRaw(int(f.Fd())); err == nil {
+			e.restore = restore
+		}
+	}
+	return e
+}
+
+// Close restores the terminal.
+func (e *lineEditor) Close() error {
+	if e.restore != nil {
+		e.restore()
+	}
+	return nil
+}
+
+// Write prints p above the line being edited.
+func (e *lineEditor) Write(p []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.restore == nil {
+		return e.out.Write(p)
+	}
+	io.WriteString(e.out, "\r\x1b[K")
+	if _, err := e.out.Write(p); err != nil {
+		return 0, err
+	}
+	if len(p) > 0 && p[len(p)-1] != '\n' {
+		io.WriteString(e.out, "\n")
+	}
+	io.WriteString(e.out, e.prompt+string(e.buf))
+	return len(p), nil
+}
+
+// readLine returns the next line, or io.EOF once input ends or, on a
+// terminal, on ctrl-D at an empty line.
+func (e *lineEditor) readLine() (string, error) {
+	if e.restore == nil {
+		line, err := e.in.ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	e.mu.Lock()
+	e.buf = e.buf[:0]
+	e.redraw()
+	e.mu.Unlock()
+	hist := len(e.history)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		e.mu.Lock()
+		switch r {
+		case '\r', '\n':
+			line := string(e.buf)
+			e.buf = e.buf[:0]
+			io.WriteString(e.out, "\n")
+			if strings.TrimSpace(line) != "" {
+				e.history = append(e.history, line)
+			}
+			e.mu.Unlock()
+			return line, nil
+		case 3: // ctrl-C
+			io.WriteString(e.out, "^C\n")
+			e.buf = e.buf[:0]
+			hist = len(e.history)
+		case 4: // ctrl-D
+			if len(e.buf) == 0 {
+				io.WriteString(e.out, "\n")
+				e.mu.Unlock()
+				return "", io.EOF
+			}
+		case 8, 127: // backspace
+			if len(e.buf) > 0 {
+				e.buf = e.buf[:len(e.buf)-1]
+			}
+		case 21: // ctrl-U
+			e.buf = e.buf[:0]
+		case '\t':
+			e.tab()
+		case 27: // escape sequences: only the up and down arrows
+			e.mu.Unlock()
+			seq := make([]byte, 2)
+			if _, err := io.ReadFull(e.in, seq); err != nil {
+				return "", err
+			}
+			e.mu.Lock()
+			if seq[0] == '[' && seq[1] == 'A' && hist > 0 {
+				hist--
+				e.buf = []rune(e.history[hist])
+			} else if seq[0] == '[' && seq[1] == 'B' && hist < len(e.history) {
+				if hist++; hist == len(e.history) {
+					e.buf = e.buf[:0]
+				} else {
+					e.buf = []rune(e.history[hist])
+				}
+			}
+		default:
+			if r >= ' ' {
+				e.buf = append(e.buf, r)
+			}
+		}
+		e.redraw()
+		e.mu.Unlock()
+	}
+}
+
+func (e *lineEditor) redraw() {
+	io.WriteString(e.out, "\r\x1b[K"+e.prompt+string(e.buf))
+}
+
+// tab completes the word before the cursor: fully if one candidate matches,
+// else as far as the candidates agree, listing them if that adds nothing.
+func (e *lineEditor) tab() {
+	if e.complete == nil {
+		return
+	}
+	line := string(e.buf)
+	word := line[strings.LastIndexAny(line, " ")+1:]
+	var matches []string
+	for _, c := range e.complete(line) {
+		if strings.HasPrefix(c, word) {
+			matches = append(matches, c)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return
+	case 1:
+		completed := matches[0]
+		if !strings.HasSuffix(completed, "=") {
+			completed += " "
+		}
+		e.buf = append(e.buf, []rune(completed[len(word):])...)
+		return
+	}
+	prefix := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if len(prefix) > len(word) {
+		e.buf = append(e.buf, []rune(prefix[len(word):])...)
+		return
+	}
+	sort.Strings(matches)
+	io.WriteString(e.out, "\n"+strings.Join(matches, "  ")+"\n")
+}
@@ -0,0 +1,361 @@
+// Command jsonrpc calls JSON-RPC servers, for debugging them:
+//
+//	jsonrpc ws://localhost:8080/rpc add '[1, 2]'
+//	jsonrpc -n -p level=info -p msg=hello tcp://localhost:9000 log
+//	echo '{"a": 1}' | jsonrpc http://localhost:8080/rpc echo -
+//	jsonrpc -batch calls.json unix:///tmp/rpc.sock
+//	jsonrpc -listen ws://localhost:8080/rpc subscribe '["ticks"]'
+//	jsonrpc 'stdio:./server -v' ping
+//
+// The endpoint is a ws:// or wss:// URL, an http:// or https:// URL to POST
+// each message to, tcp://host:port or unix://path for servers started with
+// Serve, or stdio:command, which runs command and talks to it over its stdin
+// and stdout, newline-delimited or, with -lsp, with LSP framing.
+//
+// Params are JSON, "-" to read them from stdin, or an object built from
+// -p name=value flags, whose values are taken as JSON if they parse and as
+// strings otherwise. The result is pretty-printed to stdout; an error
+// response is printed to stderr and exits with status 1.
+//
+// -batch sends a file ("-" for stdin) holding a JSON-RPC batch: its members
+// with an id are calls, the others notifications. The results are printed in
+// order, with the ids from the file.
+//
+// -listen prints the notifications and requests the server sends, one JSON
+// object per line, after the call or without one, until interrupted.
+//
+// Given only an endpoint, jsonrpc starts a REPL on the connection: each line
+// is a method and its params, as JSON or name=value pairs, and .help lists
+// the other commands, e.g. .subscribe for subscriptions whose events print
+// as they come. On a terminal, tab completes the method names and param
+// names learned from rpc.discover, or rpc.methods.
+//
+// -record appends every message sent and received to a file in the format
+// jsonrpc.Recorder writes, and -replay sends the calls and notifications of
+// such a recording again:
+//
+//	jsonrpc -record session.jsonl ws://localhost:8080/rpc
+//	jsonrpc -replay session.jsonl ws://localhost:8080/rpc
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/jdxcode/jsonrpc"
+)
+
+type options struct {
+	notify  bool
+	batch   string
+	listen  bool
+	raw     bool
+	lsp     bool
+	record  string
+	replay  string
+	timeout time.Duration
+	params  multiFlag
+	headers multiFlag
+}
+
+// multiFlag collects the values of a flag given several times.
+type multiFlag []string
+
+func (f *multiFlag) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *multiFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+// stdin, stdout and stderr are the command's, replaced by tests.
+var (
+	stdin  io.Reader = os.Stdin
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+func main() {
+	opts, args, err := parseFlags(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	os.Exit(run(ctx, opts, args))
+}
+
+// parseFlags parses the command line, printing its errors and the usage to
+// output.
+func parseFlags(argv []string, output io.Writer) (options, []string, error) {
+	var opts options
+	fs := flag.NewFlagSet("jsonrpc", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.BoolVar(&opts.notify, "n", false, "send a notification rather than a call")
+	fs.StringVar(&opts.batch, "batch", "", "send the JSON-RPC batch in `file` (- for stdin)")
+	fs.BoolVar(&opts.listen, "listen", false, "print what the server sends until interrupted")
+	fs.BoolVar(&opts.raw, "raw", false, "print compact JSON")
+	fs.BoolVar(&opts.lsp, "lsp", false, "use LSP framing for stdio: endpoints")
+	fs.StringVar(&opts.record, "record", "", "record the session to `file`")
+	fs.StringVar(&opts.replay, "replay", "", "send the calls recorded in `file` again")
+	fs.DurationVar(&opts.timeout, "timeout", 30*time.Second, "how long to wait for responses")
+	fs.Var(&opts.params, "p", "set the param `name=value` (repeatable)")
+	fs.Var(&opts.headers, "H", "send the HTTP `header` \"Name: value\" (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintf(output, "usage: jsonrpc [flags] endpoint [method [params]]\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(argv); err != nil {
+		return opts, nil, err
+	}
+	args := fs.Args()
+	if len(args) == 0 || len(args) > 3 {
+		fs.Usage()
+		return opts, nil, errors.New("want an endpoint and at most a method and params")
+	}
+	return opts, args, nil
+}
+
+func run(ctx context.Context, opts options, args []string) int {
+	header := http.Header{}
+	for _, h := range opts.headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return fail(fmt.Errorf("invalid header %q", h))
+		}
+		header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	sock, err := dial(ctx, args[0], header, opts.lsp)
+	if err != nil {
+		return fail(err)
+	}
+	if opts.record != "" {
+		if sock, err = newRecordingSocket(sock, opts.record); err != nil {
+			return fail(err)
+		}
+	}
+	out := &printer{w: stdout, raw: opts.raw}
+	interactive := len(args) == 1 && opts.batch == "" && opts.replay == "" && !opts.listen
+	var editor *lineEditor
+	if interactive {
+		editor = newLineEditor(stdin, stdout, args[0]+"> ")
+		defer editor.Close()
+		out.w = editor
+	}
+	client := jsonrpc.NewClient(sock, jsonrpc.WithServer(listener(out, opts.listen || interactive)),
+		jsonrpc.WithClientLogger(jsonrpc.DiscardLogger))
+	defer client.Close()
+
+	code := 0
+	switch {
+	case interactive:
+		return runREPL(ctx, client, opts, out, editor)
+	case opts.batch != "":
+		code = sendBatch(ctx, client, opts, out)
+	case opts.replay != "":
+		code = replay(ctx, client, opts, out)
+	case len(args) > 1:
+		code = send(ctx, client, opts, args[1], args[2:], out)
+	}
+	if code == 0 && opts.listen {
+		select {
+		case <-ctx.Done():
+		case <-client.Conn().Done():
+		}
+	}
+	return code
+}
+
+// params returns the params given on the command line, or nil for none.
+func params(opts options, args []string) (json.RawMessage, error) {
+	if len(args) > 0 && len(opts.params) > 0 {
+		return nil, errors.New("params given both as JSON and with -p")
+	}
+	if len(opts.params) > 0 {
+		return paramObject(opts.params)
+	}
+	if len(args) == 0 {
+		return nil, nil
+	}
+	b := []byte(args[0])
+	if args[0] == "-" {
+		var err error
+		if b, err = io.ReadAll(stdin); err != nil {
+			return nil, err
+		}
+	}
+	if !json.Valid(b) {
+		return nil, fmt.Errorf("params are not valid JSON: %s", b)
+	}
+	return b, nil
+}
+
+// paramObject returns the object with the params in pairs, each name=value.
+func paramObject(pairs []string) (json.RawMessage, error) {
+	obj := map[string]json.RawMessage{}
+	for _, p := range pairs {
+		name, value, ok := strings.Cut(p, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid param %q, want name=value", p)
+		}
+		obj[name] = jsonValue(value)
+	}
+	return json.Marshal(obj)
+}
+
+// jsonValue returns value if it is JSON, or else value as a JSON string.
+func jsonValue(value string) json.RawMessage {
+	if json.Valid([]byte(value)) {
+		return json.RawMessage(value)
+	}
+	b, _ := json.Marshal(value)
+	return b
+}
+
+func send(ctx context.Context, client *jsonrpc.Client, opts options, method string, args []string, out *printer) int {
+	p, err := params(opts, args)
+	if err != nil {
+		return fail(err)
+	}
+	var v interface{}
+	if p != nil {
+		v = p
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+	if opts.notify {
+		return fail(client.Notify(ctx, method, v))
+	}
+	var result json.RawMessage
+	if err := client.Call(ctx, method, v, &result); err != nil {
+		return fail(err)
+	}
+	return fail(out.print(result))
+}
+
+type batchEntry struct {
+	ID     *json.RawMessage `json:"id"`
+	Method string           `json:"method"`
+	Params json.RawMessage  `json:"params"`
+}
+
+type batchResult struct {
+	ID     *json.RawMessage `json:"id"`
+	Result json.RawMessage  `json:"result,omitempty"`
+	Error  *jsonrpc.Error   `json:"error,omitempty"`
+}
+
+func sendBatch(ctx context.Context, client *jsonrpc.Client, opts options, out *printer) int {
+	var b []byte
+	var err error
+	if opts.batch == "-" {
+		b, err = io.ReadAll(stdin)
+	} else {
+		b, err = os.ReadFile(opts.batch)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	var entries []batchEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return fail(fmt.Errorf("%s: %w", opts.batch, err))
+	}
+	batch := client.Batch()
+	results := make([]batchResult, len(entries))
+	calls := make([]*jsonrpc.BatchCall, len(entries))
+	for i, e := range entries {
+		var params interface{}
+		if e.Params != nil {
+			params = e.Params
+		}
+		if e.ID == nil {
+			batch.Notify(e.Method, params)
+			continue
+		}
+		results[i].ID = e.ID
+		calls[i] = batch.Call(e.Method, params, &results[i].Result)
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+	if err := batch.Send(ctx); err != nil {
+		return fail(err)
+	}
+	printed := []batchResult{}
+	code := 0
+	for i, call := range calls {
+		if call == nil {
+			continue
+		}
+		if err := call.Err(); err != nil {
+			results[i].Error = toError(err)
+			code = 1
+		}
+		printed = append(printed, results[i])
+	}
+	b, _ = json.Marshal(printed)
+	if err := out.print(b); err != nil {
+		return fail(err)
+	}
+	return code
+}
+
+// listener handles what the server sends: printed with -listen, ignored
+// otherwise.
+func listener(out *printer, listen bool) *jsonrpc.Server {
+	return jsonrpc.New(&struct{}{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger),
+		jsonrpc.WithFallback(func(ctx context.Context, req *jsonrpc.Request) (*jsonrpc.Response, error) {
+			if listen {
+				msg := map[string]interface{}{"method": req.Method}
+				if req.Params != nil {
+					msg["params"] = json.RawMessage(*req.Params)
+				}
+				if !req.IsNotification() {
+					msg["id"] = req.ID
+				}
+				b, _ := json.Marshal(msg)
+				if err := out.line(b); err != nil {
+					return nil, err
+				}
+			}
+			return jsonrpc.MethodNotFound(ctx, req)
+		}))
+}
+
+func toError(err error) *jsonrpc.Error {
+	var rpcErr *jsonrpc.Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	return &jsonrpc.Error{Message: err.Error()}
+}
+
+// fail prints err, if any, and returns the exit status for it.
+func fail(err error) int {
+	if err == nil {
+		return 0
+	}
+	var rpcErr *jsonrpc.Error
+	if errors.As(err, &rpcErr) {
+		fmt.Fprintf(stderr, "error %d: %s\n", rpcErr.Code, rpcErr.Message)
+		if rpcErr.Data != nil {
+			b, _ := json.MarshalIndent(rpcErr.Data, "", "  ")
+			fmt.Fprintf(stderr, "%s\n", b)
+		}
+		return 1
+	}
+	fmt.Fprintf(stderr, "jsonrpc: %v\n", err)
+	return 1
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jdxcode/jsonrpc"
+)
+
+// capture replaces the command's stdin, stdout and stderr for the test.
+func capture(t *testing.T, in string) (out, errOut *bytes.Buffer) {
+	out, errOut = &bytes.Buffer{}, &bytes.Buffer{}
+	oldIn, oldOut, oldErr := stdin, stdout, stderr
+	stdin, stdout, stderr = strings.NewReader(in), out, errOut
+	t.Cleanup(func() { stdin, stdout, stderr = oldIn, oldOut, oldErr })
+	return out, errOut
+}
+
+func TestParseFlags(t *testing.T) {
+	assert := assert.New(t)
+	var usage bytes.Buffer
+	opts, args, err := parseFlags([]string{"http://localhost/rpc", "add", "[1, 2]"}, &usage)
+	assert.NoError(err)
+	assert.Equal([]string{"http://localhost/rpc", "add", "[1, 2]"}, args)
+	assert.Equal(30*time.Second, opts.timeout)
+	assert.False(opts.notify)
+
+	opts, args, err = parseFlags([]string{"-n", "-raw", "-timeout", "2s", "-p", "level=info", "-p", "msg=hello",
+		"-H", "Authorization: Bearer x", "tcp://localhost:9000", "log"}, &usage)
+	assert.NoError(err)
+	assert.Equal([]string{"tcp://localhost:9000", "log"}, args)
+	assert.True(opts.notify)
+	assert.True(opts.raw)
+	assert.Equal(2*time.Second, opts.timeout)
+	assert.Equal(multiFlag{"level=info", "msg=hello"}, opts.params)
+	assert.Equal(multiFlag{"Authorization: Bearer x"}, opts.headers)
+	assert.Empty(usage.String())
+
+	for _, argv := range [][]string{
+		{},
+		{"http://localhost/rpc", "add", "[1, 2]", "extra"},
+		{"-timeout", "soon", "http://localhost/rpc"},
+		{"-nope", "http://localhost/rpc"},
+	} {
+		usage.Reset()
+		_, _, err := parseFlags(argv, &usage)
+		assert.Error(err, argv)
+		assert.Contains(usage.String(), "usage: jsonrpc", argv)
+	}
+}
+
+func TestParams(t *testing.T) {
+	assert := assert.New(t)
+	p, err := params(options{params: multiFlag{"level=info", "n=2", "tags=[\"a\"]"}}, nil)
+	assert.NoError(err)
+	assert.JSONEq(`{"level":"info","n":2,"tags":["a"]}`, string(p))
+
+	p, err = params(options{}, []string{`[1, 2]`})
+	assert.NoError(err)
+	assert.Equal(`[1, 2]`, string(p))
+
+	capture(t, `{"a": 1}`)
+	p, err = params(options{}, []string{"-"})
+	assert.NoError(err)
+	assert.Equal(`{"a": 1}`, string(p))
+
+	p, err = params(options{}, nil)
+	assert.NoError(err)
+	assert.Nil(p)
+
+	_, err = params(options{}, []string{`[1,`})
+	assert.EqualError(err, "params are not valid JSON: [1,")
+	_, err = params(options{params: multiFlag{"a=1"}}, []string{`[1]`})
+	assert.EqualError(err, "params given both as JSON and with -p")
+	_, err = params(options{params: multiFlag{"a"}}, nil)
+	assert.EqualError(err, `invalid param "a", want name=value`)
+}
+
+func newTestServer(t *testing.T) *httptest.Server {
+	s := jsonrpc.New(&struct{}{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger))
+	jsonrpc.Register(s, "add", func(ctx context.Context, params []int) (int, error) {
+		return params[0] + params[1], nil
+	})
+	jsonrpc.Register(s, "auth", func(ctx context.Context, params struct{}) (string, error) {
+		return jsonrpc.HTTPRequestFromContext(ctx).Header.Get("Authorization"), nil
+	})
+	jsonrpc.Register(s, "wait", func(ctx context.Context, params struct{}) (bool, error) {
+		<-ctx.Done()
+		return false, ctx.Err()
+	})
+	srv := httptest.NewServer(jsonrpc.HTTPHandler(s))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRunHTTP(t *testing.T) {
+	assert := assert.New(t)
+	srv := newTestServer(t)
+	opts, _, _ := parseFlags([]string{srv.URL}, &bytes.Buffer{})
+
+	out, errOut := capture(t, "")
+	assert.Equal(0, run(context.Background(), opts, []string{srv.URL, "add", "[1, 2]"}))
+	assert.Equal("3\n", out.String())
+
+	out.Reset()
+	opts.headers = multiFlag{"Authorization: Bearer x"}
+	assert.Equal(0, run(context.Background(), opts, []string{srv.URL, "auth"}))
+	assert.Equal("\"Bearer x\"\n", out.String())
+
+	out.Reset()
+	assert.Equal(1, run(context.Background(), opts, []string{srv.URL, "nope"}))
+	assert.Empty(out.String())
+	assert.Equal("error -32601: method not found: nope\n", errOut.String())
+
+	opts.notify = true
+	assert.Equal(0, run(context.Background(), opts, []string{srv.URL, "add", "[1, 2]"}))
+	assert.Empty(out.String())
+}
+
+func TestRunHTTPError(t *testing.T) {
+	assert := assert.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	opts, _, _ := parseFlags([]string{srv.URL}, &bytes.Buffer{})
+
+	_, errOut := capture(t, "")
+	assert.Equal(1, run(context.Background(), opts, []string{srv.URL, "add", "[1, 2]"}))
+	assert.Equal("error -32603: 500 Internal Server Error: boom\n", errOut.String())
+
+	errOut.Reset()
+	opts.notify = true
+	assert.Equal(1, run(context.Background(), opts, []string{srv.URL, "add", "[1, 2]"}))
+	assert.Equal("jsonrpc: 500 Internal Server Error: boom\n", errOut.String())
+}
+
+func TestRunTimeout(t *testing.T) {
+	assert := assert.New(t)
+	srv := newTestServer(t)
+	opts, _, _ := parseFlags([]string{"-timeout", "50ms", srv.URL}, &bytes.Buffer{})
+
+	out, errOut := capture(t, "")
+	start := time.Now()
+	assert.Equal(1, run(context.Background(), opts, []string{srv.URL, "wait"}))
+	assert.Less(time.Since(start), 5*time.Second)
+	assert.Empty(out.String())
+	assert.Contains(errOut.String(), "deadline exceeded")
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jdxcode/jsonrpc"
+)
+
+// recordingSocket records the messages sent and received on a socket as
+// jsonrpc.RecordedMessage lines, the format jsonrpc.Recorder writes, from the
+// command's side: what it sends is DirSent.
+type recordingSocket struct {
+	jsonrpc.Socket
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+func newRecordingSocket(sock jsonrpc.Socket, path string) (*recordingSocket, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingSocket{Socket: sock, f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (s *recordingSocket) WriteJSON(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := s.Socket.WriteJSON(json.RawMessage(b)); err != nil {
+		return err
+	}
+	s.record(jsonrpc.DirSent, b)
+	return nil
+}
+
+func (s *recordingSocket) ReadJSON(v interface{}) error {
+	var b json.RawMessage
+	if err := s.Socket.ReadJSON(&b); err != nil {
+		return err
+	}
+	s.record(jsonrpc.DirReceived, b)
+	return json.Unmarshal(b, v)
+}
+
+func (s *recordingSocket) record(dir string, msg json.RawMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.enc.Encode(jsonrpc.RecordedMessage{Time: time.Now(), Dir: dir, Msg: msg})
+}
+
+func (s *recordingSocket) Close() error {
+	err := s.Socket.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ferr := s.f.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// replay sends the calls and notifications a -record recording sent again, in
+// order, printing the results.
+func replay(ctx context.Context, client *jsonrpc.Client, opts options, out *printer) int {
+	f, err := os.Open(opts.replay)
+	if err != nil {
+		return fail(err)
+	}
+	msgs, err := jsonrpc.ReadRecording(f)
+	f.Close()
+	if err != nil {
+		return fail(err)
+	}
+	code := 0
+	for _, msg := range msgs {
+		if msg.Dir != jsonrpc.DirSent || msg.Msg == nil {
+			continue
+		}
+		var entries []batchEntry
+		if err := json.Unmarshal(msg.Msg, &entries); err != nil {
+			var e batchEntry
+			if err := json.Unmarshal(msg.Msg, &e); err != nil {
+				return fail(fmt.Errorf("%s: %w", opts.replay, err))
+			}
+			entries = []batchEntry{e}
+		}
+		for _, e := range entries {
+			if e.Method == "" {
+				// an answer to the server
+				continue
+			}
+			var params interface{}
+			if e.Params != nil {
+				params = e.Params
+			}
+			callCtx, cancel := context.WithTimeout(ctx, opts.timeout)
+			if e.ID == nil {
+				err = client.Notify(callCtx, e.Method, params)
+			} else {
+				var result json.RawMessage
+				if err = client.Call(callCtx, e.Method, params, &result); err == nil {
+					err = out.print(result)
+				}
+			}
+			cancel()
+			if fail(err) != 0 {
+				code = 1
+			}
+		}
+	}
+	return code
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jdxcode/jsonrpc"
+)
+
+const replHelp = `method [params]        call method; params are JSON or name=value pairs
+.notify method [params] send a notification
+.subscribe method [params]
+                       subscribe, printing the events as they come
+.unsubscribe id        end a subscription
+.methods               list the server's methods
+.help                  show this help
+.quit                  leave (or ctrl-D)`
+
+var replCommands = []string{".help", ".methods", ".notify", ".quit", ".subscribe", ".unsubscribe"}
+
+type replMethod struct {
+	name   string
+	params []string
+	byName bool
+	doc    string
+}
+
+type repl struct {
+	client  *jsonrpc.Client
+	opts    options
+	out     *printer
+	methods []replMethod
+
+	mu   sync.Mutex
+	subs map[string]*jsonrpc.ClientSubscription
+}
+
+// runREPL reads commands from the editor until it is closed or ctx is done.
+func runREPL(ctx context.Context, client *jsonrpc.Client, opts options, out *printer, editor *lineEditor) int {
+	r := &repl{client: client, opts: opts, out: out, subs: map[string]*jsonrpc.ClientSubscription{}}
+	r.methods = discover(ctx, client, opts)
+	editor.complete = r.complete
+
+	// read in the background to notice the connection closing, but only once
+	// the last line has run, so its output comes before the next prompt
+	lines := make(chan string)
+	next := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			line, err := editor.readLine()
+			if err != nil {
+				errs <- err
+				return
+			}
+			lines <- line
+			<-next
+		}
+	}()
+	code := 0
+	for {
+		select {
+		case line := <-lines:
+			quit, failed := r.exec(ctx, line)
+			if failed {
+				code = 1
+			}
+			if quit {
+				return code
+			}
+			next <- struct{}{}
+		case err := <-errs:
+			if err != io.EOF {
+				return fail(err)
+			}
+			return code
+		case <-ctx.Done():
+			return code
+		case <-client.Conn().Done():
+			return fail(fmt.Errorf("connection closed"))
+		}
+	}
+}
+
+// discover fetches the server's methods with rpc.discover, falling back to
+// rpc.methods for servers that only list them.
+func discover(ctx context.Context, client *jsonrpc.Client, opts options) []replMethod {
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+	var methods []replMethod
+	var doc jsonrpc.OpenRPCDocument
+	if err := client.Call(ctx, "rpc.discover", nil, &doc); err == nil {
+		for _, m := range doc.Methods {
+			rm := replMethod{name: m.Name, byName: m.ParamStructure != "by-position", doc: m.Description}
+			for _, p := range m.Params {
+				rm.params = append(rm.params, p.Name)
+			}
+			methods = append(methods, rm)
+		}
+		return methods
+	}
+	var infos []struct {
+		Name string `json:"name"`
+	}
+	if err := client.Call(ctx, "rpc.methods", nil, &infos); err == nil {
+		for _, info := range infos {
+			methods = append(methods, replMethod{name: info.Name})
+		}
+	}
+	return methods
+}
+
+// exec runs a line, reporting whether to quit and whether it failed.
+func (r *repl) exec(ctx context.Context, line string) (quit, failed bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false, false
+	}
+	cmd, rest := fields[0], strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), fields[0]))
+	switch cmd {
+	case ".quit":
+		return true, false
+	case ".help":
+		fmt.Fprintln(r.out.w, replHelp)
+		return false, false
+	case ".methods":
+		for _, m := range r.methods {
+			fmt.Fprintf(r.out.w, "%s(%s)", m.name, strings.Join(m.params, ", "))
+			if m.doc != "" {
+				fmt.Fprintf(r.out.w, "  %s", m.doc)
+			}
+			fmt.Fprintln(r.out.w)
+		}
+		return false, false
+	case ".unsubscribe":
+		return false, fail(r.unsubscribe(ctx, rest)) != 0
+	case ".notify", ".subscribe":
+		if len(fields) < 2 {
+			fmt.Fprintf(r.out.w, "usage: %s method [params]\n", cmd)
+			return false, true
+		}
+		method := fields[1]
+		p, err := replParams(strings.TrimSpace(strings.TrimPrefix(rest, method)))
+		if err != nil {
+			return false, fail(err) != 0
+		}
+		if cmd == ".notify" {
+			return false, fail(r.client.Notify(ctx, method, p)) != 0
+		}
+		return false, fail(r.subscribe(ctx, method, p)) != 0
+	}
+	if strings.HasPrefix(cmd, ".") {
+		fmt.Fprintf(r.out.w, "unknown command %s, see .help\n", cmd)
+		return false, true
+	}
+	p, err := replParams(rest)
+	if err != nil {
+		return false, fail(err) != 0
+	}
+	callCtx, cancel := context.WithTimeout(ctx, r.opts.timeout)
+	defer cancel()
+	var result json.RawMessage
+	if err := r.client.Call(callCtx, cmd, p, &result); err != nil {
+		return false, fail(err) != 0
+	}
+	return false, fail(r.out.print(result)) != 0
+}
+
+// replParams parses the params typed after a method: JSON, name=value pairs or
+// nothing.
+func replParams(s string) (interface{}, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if json.Valid([]byte(s)) {
+		return json.RawMessage(s), nil
+	}
+	p, err := paramObject(strings.Fields(s))
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// subscribe prints the subscription's events until it ends.
+func (r *repl) subscribe(ctx context.Context, method string, params interface{}) error {
+	// lasting as long as the REPL, so the call can't have a timeout
+	events, sub, err := jsonrpc.Subscribe[json.RawMessage](ctx, r.client, method, params)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.subs[sub.ID] = sub
+	r.mu.Unlock()
+	fmt.Fprintf(r.out.w, "subscribed %s\n", sub.ID)
+	go func() {
+		for ev := range events {
+			b, _ := json.Marshal(map[string]interface{}{"subscription": sub.ID, "result": ev})
+			r.out.line(b)
+		}
+		r.mu.Lock()
+		delete(r.subs, sub.ID)
+		r.mu.Unlock()
+		if err := sub.Err(); err != nil {
+			fmt.Fprintf(r.out.w, "subscription %s ended: %v\n", sub.ID, err)
+		}
+	}()
+	return nil
+}
+
+func (r *repl) unsubscribe(ctx context.Context, id string) error {
+	r.mu.Lock()
+	sub := r.subs[id]
+	r.mu.Unlock()
+	if sub == nil {
+		return fmt.Errorf("no subscription %q", id)
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.opts.timeout)
+	defer cancel()
+	return sub.Unsubscribe(ctx)
+}
+
+// complete returns the candidates for the last word of line: commands and
+// method names first, then a method's param names, as name=.
+func (r *repl) complete(line string) []string {
+	fields := strings.Fields(line)
+	if !strings.HasSuffix(line, " ") && len(fields) > 0 {
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) == 0 {
+		names := append([]string{}, replCommands...)
+		for _, m := range r.methods {
+			names = append(names, m.name)
+		}
+		return names
+	}
+	switch fields[0] {
+	case ".notify", ".subscribe":
+		if len(fields) == 1 {
+			var names []string
+			for _, m := range r.methods {
+				names = append(names, m.name)
+			}
+			return names
+		}
+		fields = fields[1:]
+	case ".unsubscribe":
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		var ids []string
+		for id := range r.subs {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+	given := map[string]bool{}
+	for _, f := range fields[1:] {
+		name, _, _ := strings.Cut(f, "=")
+		given[name] = true
+	}
+	var names []string
+	for _, m := range r.methods {
+		if m.name != fields[0] || !m.byName {
+			continue
+		}
+		for _, p := range m.params {
+			if !given[p] {
+				names = append(names, p+"=")
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jdxcode/jsonrpc"
+)
+
+type greetParams struct {
+	Name string `json:"name"`
+	Loud bool   `json:"loud"`
+}
+
+func newREPLServer(t *testing.T) *httptest.Server {
+	s := jsonrpc.New(&struct{}{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger))
+	jsonrpc.Register(s, "greet", func(ctx context.Context, p greetParams) (string, error) {
+		if p.Loud {
+			return "HELLO " + strings.ToUpper(p.Name), nil
+		}
+		return "hello " + p.Name, nil
+	})
+	jsonrpc.Register(s, "add", func(ctx context.Context, params []int) (int, error) {
+		return params[0] + params[1], nil
+	})
+	srv := httptest.NewServer(jsonrpc.HTTPHandler(s))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestREPL(t *testing.T) {
+	assert := assert.New(t)
+	srv := newREPLServer(t)
+	opts, _, _ := parseFlags([]string{"-raw", srv.URL}, &bytes.Buffer{})
+
+	out, errOut := capture(t, strings.Join([]string{
+		"greet name=go",
+		`greet {"name": "go", "loud": true}`,
+		"",
+		"add [1, 2]",
+		".methods",
+		".bogus",
+		"nope",
+		".quit",
+		"add [3, 4]",
+	}, "\n"))
+	assert.Equal(1, run(context.Background(), opts, []string{srv.URL}))
+	assert.Contains(out.String(), "\"hello go\"\n\"HELLO GO\"\n3\n")
+	assert.Contains(out.String(), "greet(name, loud)\n")
+	assert.Contains(out.String(), "add(")
+	assert.Contains(out.String(), "unknown command .bogus, see .help\n")
+	assert.NotContains(out.String(), "7")
+	assert.Equal("error -32601: method not found: nope\n", errOut.String())
+
+	// without .quit, the end of input ends the REPL
+	out, _ = capture(t, "add [3, 4]\n")
+	assert.Equal(0, run(context.Background(), opts, []string{srv.URL}))
+	assert.Equal("7\n", out.String())
+}
+
+func TestREPLComplete(t *testing.T) {
+	assert := assert.New(t)
+	srv := newREPLServer(t)
+	opts, _, _ := parseFlags([]string{srv.URL}, &bytes.Buffer{})
+	client := jsonrpc.NewClient(newHTTPSocket(context.Background(), srv.URL, nil),
+		jsonrpc.WithClientLogger(jsonrpc.DiscardLogger))
+	defer client.Close()
+	r := &repl{client: client, opts: opts, subs: map[string]*jsonrpc.ClientSubscription{}}
+	r.methods = discover(context.Background(), client, opts)
+
+	names := r.complete("")
+	assert.Subset(names, []string{".help", ".quit", "add", "greet"})
+	assert.Equal([]string{"name=", "loud="}, r.complete("greet "))
+	assert.Equal([]string{"loud="}, r.complete("greet name=go "))
+	assert.Equal([]string{"name=", "loud="}, r.complete(".notify greet "))
+	assert.Contains(r.complete(".subscribe "), "greet")
+	assert.Empty(r.complete("nope "))
+
+	// tab on an editor in terminal mode, fed keys
+	edit := func(keys string) (string, string) {
+		var out bytes.Buffer
+		e := &lineEditor{in: bufio.NewReader(strings.NewReader(keys)), out: &out, prompt: "> ",
+			restore: func() {}, complete: r.complete}
+		line, err := e.readLine()
+		assert.NoError(err)
+		return line, out.String()
+	}
+	line, _ := edit("gr\tna\tgo\r")
+	assert.Equal("greet name=go", line)
+	line, _ = edit("greet name=go l\ttrue\r")
+	assert.Equal("greet name=go loud=true", line)
+	// ambiguous: listed
+	line, shown := edit(".\t\r")
+	assert.Equal(".", line)
+	assert.Contains(shown, ".help  .methods  .notify  .quit  .subscribe  .unsubscribe")
+}
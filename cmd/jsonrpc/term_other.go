@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+
+package main
+
+import "errors"
+
+// makeRaw isn't supported here, so the REPL reads plain lines.
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("raw mode not supported")
+}
@@ -0,0 +1,95 @@
+// Command jsonrpcgen writes a typed Go client for an OpenRPC document. The
+// document is read from a file, or fetched with rpc.discover when -in is an
+// http(s) URL:
+//
+//	//go:generate go run github.com/jdxcode/jsonrpc/cmd/jsonrpcgen -in openrpc.json -pkg api -o client.go
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/jdxcode/jsonrpc"
+	"github.com/jdxcode/jsonrpc/jsonrpcgen"
+)
+
+func main() {
+	in := flag.String("in", "", "OpenRPC document file or JSON-RPC over HTTP endpoint")
+	out := flag.String("o", "", "output file (defaults to stdout)")
+	pkg := flag.String("pkg", "client", "package name of the generated file")
+	typ := flag.String("type", "Client", "name of the generated client type")
+	flag.Parse()
+
+	if *in == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	doc, err := load(*in)
+	if err != nil {
+		fatal(err)
+	}
+	src, err := jsonrpcgen.Generate(doc, jsonrpcgen.Config{Package: *pkg, Type: *typ})
+	if err != nil {
+		fatal(err)
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(src)
+	} else {
+		err = os.WriteFile(*out, src, 0o644)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func load(in string) (*jsonrpc.OpenRPCDocument, error) {
+	if strings.HasPrefix(in, "http://") || strings.HasPrefix(in, "https://") {
+		return discover(in)
+	}
+	b, err := os.ReadFile(in)
+	if err != nil {
+		return nil, err
+	}
+	var doc jsonrpc.OpenRPCDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", in, err)
+	}
+	return &doc, nil
+}
+
+func discover(url string) (*jsonrpc.OpenRPCDocument, error) {
+	body := strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"rpc.discover"}`)
+	rsp, err := http.Post(url, "application/json", body)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	b, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var msg struct {
+		Result *jsonrpc.OpenRPCDocument `json:"result"`
+		Error  *jsonrpc.Error           `json:"error"`
+	}
+	if err := json.Unmarshal(b, &msg); err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", url, rsp.Status, err)
+	}
+	if msg.Error != nil {
+		return nil, msg.Error
+	}
+	if msg.Result == nil {
+		return nil, fmt.Errorf("%s: empty rpc.discover result", url)
+	}
+	return msg.Result, nil
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "jsonrpcgen:", err)
+	os.Exit(1)
+}
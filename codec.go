@@ -0,0 +1,70 @@
+package jsonrpc
+
+import "encoding/json"
+
+// Codec encodes messages on the wire. Messages are handled as JSON inside
+// the server, so codecs other than JSON translate to and from it.
+type Codec interface {
+	// Name identifies the codec, e.g. when negotiating it for a connection.
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// JSON is the default codec. It marshals messages with encoding/json, or
+	// the package set with SetJSONImplementation.
+	JSON Codec = jsonCodec{}
+	// MessagePack encodes messages as MessagePack. It is a binary format, so
+	// over a StreamSocket it must be used with WithLengthPrefix.
+	MessagePack Codec = msgpackCodec{}
+)
+
+var (
+	jsonImplementation = "encoding/json"
+	jsonMarshal        = json.Marshal
+	jsonUnmarshal      = json.Unmarshal
+)
+
+// JSONImplementation names the JSON package that marshals messages and
+// decodes params.
+func JSONImplementation() string {
+	return jsonImplementation
+}
+
+// SetJSONImplementation marshals messages and decodes params with the JSON
+// package called name instead of encoding/json, e.g. json-iterator or sonic,
+// which importing jsoniterjsonrpc or sonicjsonrpc sets. The errors of
+// unmarshal are replaced by those of encoding/json, so invalid params are
+// reported the same. It must be called before any server or client is used,
+// e.g. from an init func.
+func SetJSONImplementation(name string, marshal func(v interface{}) ([]byte, error),
+	unmarshal func(data []byte, v interface{}) error) {
+	jsonImplementation = name
+	jsonMarshal = marshal
+	jsonUnmarshal = stdErrors(unmarshal)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return jsonMarshal(v) }
+
+// Unmarshal sticks to encoding/json, since messages are read whole into a
+// json.RawMessage and parse errors must be told apart from invalid requests.
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// stdErrors makes unmarshal fail with the errors of encoding/json, so that
+// invalid params are reported the same whichever package decodes them.
+func stdErrors(unmarshal func(data []byte, v interface{}) error) func(data []byte, v interface{}) error {
+	return func(data []byte, v interface{}) error {
+		err := unmarshal(data, v)
+		if err != nil {
+			if stdErr := json.Unmarshal(data, v); stdErr != nil {
+				return stdErr
+			}
+		}
+		return err
+	}
+}
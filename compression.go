@@ -0,0 +1,94 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Compressor is a content coding for HTTP bodies, named as in
+// Accept-Encoding. Others, such as zstd, can be plugged in with WithCompression.
+type Compressor struct {
+	Name      string
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+var (
+	Gzip = Compressor{
+		Name:      "gzip",
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+		NewReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	}
+	Deflate = Compressor{
+		Name:      "deflate",
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) { return flate.NewWriter(w, flate.DefaultCompression) },
+		NewReader: func(r io.Reader) (io.ReadCloser, error) { return flate.NewReader(r), nil },
+	}
+)
+
+// WithCompression compresses HTTP responses of at least threshold bytes with
+// the first of compressors the client accepts, gzip and deflate by default,
+// and accepts request bodies encoded with them. Use ws.WithCompression for
+// websockets.
+func WithCompression(threshold int, compressors ...Compressor) Option {
+	if len(compressors) == 0 {
+		compressors = []Compressor{Gzip, Deflate}
+	}
+	return func(s *Server) {
+		s.compressThreshold = threshold
+		s.compressors = compressors
+	}
+}
+
+// negotiate returns the compressor to encode a response to r with, if any.
+func (s *Server) negotiate(r *http.Request) *Compressor {
+	accepted := map[string]bool{}
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		if strings.ReplaceAll(params, " ", "") != "q=0" {
+			accepted[strings.ToLower(name)] = true
+		}
+	}
+	for i, c := range s.compressors {
+		if accepted[c.Name] || accepted["*"] {
+			return &s.compressors[i]
+		}
+	}
+	return nil
+}
+
+func compress(c *Compressor, b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := c.NewWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeBody undoes the Content-Encoding of a request body.
+func (s *Server) decodeBody(r *http.Request) (io.ReadCloser, error) {
+	enc := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if enc == "" || enc == "identity" {
+		return r.Body, nil
+	}
+	for _, c := range s.compressors {
+		if c.Name == enc && c.NewReader != nil {
+			return c.NewReader(r.Body)
+		}
+	}
+	return nil, errUnsupportedEncoding
+}
@@ -0,0 +1,176 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+)
+
+// CodeServerBusy is returned when a request is rejected by the concurrency
+// limit.
+const CodeServerBusy = -32001
+
+var ErrServerBusy = NewError(CodeServerBusy, "server busy")
+
+// BusyPolicy decides what happens to requests arriving while a connection is
+// at its concurrency limit.
+type BusyPolicy int
+
+const (
+	// BusyQueue stops reading from the connection until a handler finishes.
+	BusyQueue BusyPolicy = iota
+	// BusyReject answers the requests with ErrServerBusy.
+	BusyReject
+)
+
+// WithConcurrencyLimit limits how many handlers run at once on each
+// connection. Cancellation requests are exempt so they can reach
+// long-running handlers, and handlers waiting for a call they made to the
+// peer on the connection don't count, so the peer can call back meanwhile.
+func WithConcurrencyLimit(limit int, policy BusyPolicy) Option {
+	return func(s *Server) {
+		s.concurrency = limit
+		s.busyPolicy = policy
+	}
+}
+
+var errBusy = errors.New("busy")
+
+type limiter struct {
+	sem    chan struct{}
+	policy BusyPolicy
+
+	// set with WithPriorities: slots replaces sem, and queue bounds the
+	// messages waiting for one
+	slots    *prioritySlots
+	queue    chan struct{}
+	priority func(msg *incoming) int
+}
+
+func (s *Server) newLimiter() *limiter {
+	if s.concurrency <= 0 {
+		return nil
+	}
+	l := &limiter{sem: make(chan struct{}, s.concurrency), policy: s.busyPolicy}
+	if len(s.priorities) > 0 {
+		l.slots = &prioritySlots{free: s.concurrency}
+		queue := s.priorityQueue
+		if queue < 1 {
+			queue = s.concurrency
+		}
+		l.queue = make(chan struct{}, queue)
+		l.priority = s.priorityOf
+	}
+	return l
+}
+
+// acquire takes one slot per request in msg, up to the limit, since a batch
+// never runs more than that many at once. It returns the number of slots to
+// release. With priorities, it only takes a place in the queue, and wait
+// takes the slots.
+func (l *limiter) acquire(ctx context.Context, msg *incoming) (int, error) {
+	if l == nil {
+		return 0, nil
+	}
+	n := len(msg.reqs)
+	if n > cap(l.sem) {
+		n = cap(l.sem)
+	}
+	if l.slots != nil {
+		if l.policy == BusyReject {
+			if !l.slots.tryAcquire(n) {
+				return 0, errBusy
+			}
+			return n, nil
+		}
+		// wait takes the slots
+		select {
+		case l.queue <- struct{}{}:
+			return n, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+	for i := 0; i < n; i++ {
+		if l.policy == BusyReject {
+			select {
+			case l.sem <- struct{}{}:
+				continue
+			default:
+				l.release(i)
+				return 0, errBusy
+			}
+		}
+		select {
+		case l.sem <- struct{}{}:
+		case <-ctx.Done():
+			l.release(i)
+			return 0, ctx.Err()
+		}
+	}
+	return n, nil
+}
+
+// wait takes the n slots of a queued msg once it is the highest priority
+// message waiting. If it fails, msg must not run.
+func (l *limiter) wait(ctx context.Context, msg *incoming, n int) error {
+	if l == nil || l.slots == nil || l.policy == BusyReject {
+		return nil
+	}
+	defer func() { <-l.queue }()
+	return l.slots.acquire(ctx, l.priority(msg), n)
+}
+
+// reacquire takes back the n slots a running msg gave up, waiting for them
+// whatever the busy policy.
+func (l *limiter) reacquire(ctx context.Context, msg *incoming, n int) error {
+	if l.slots != nil {
+		return l.slots.acquire(ctx, l.priority(msg), n)
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case l.sem <- struct{}{}:
+		case <-ctx.Done():
+			l.release(i)
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (l *limiter) release(n int) {
+	if l != nil && l.slots != nil {
+		l.slots.release(n)
+		return
+	}
+	for i := 0; i < n; i++ {
+		<-l.sem
+	}
+}
+
+// busyResponse rejects every request in msg.
+func busyResponse(msg *incoming) interface{} {
+	var rsps []*Response
+	for _, req := range msg.reqs {
+		if !req.IsNotification() {
+			rsps = append(rsps, newResponseError(req.ID, ErrServerBusy))
+		}
+	}
+	if len(rsps) == 0 {
+		return nil
+	}
+	if !msg.batch {
+		return rsps[0]
+	}
+	return rsps
+}
+
+// isCancelOnly reports whether msg holds nothing but cancellation requests,
+// which are handled without waiting for a free slot.
+func (s *Server) isCancelOnly(msg *incoming) bool {
+	for _, req := range msg.reqs {
+		if req.err != nil || !s.isCancel(req) {
+			return false
+		}
+	}
+	return true
+}
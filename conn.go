@@ -0,0 +1,127 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+var ErrConnClosed = errors.New("jsonrpc: connection closed")
+
+// Conn is one end of a connection. Handlers get it from ConnFromContext and
+// can use it to call methods on the remote peer, multiplexed with the
+// responses on the same socket.
+type Conn struct {
+	// 64-bit aligned for atomic access
+	id            uint64
+	attachmentSeq uint64
+
+	send    func(ctx context.Context, msg interface{}) error
+	pending *pendingCalls
+	logger  Logger
+
+	mu       sync.Mutex
+	inflight map[ID]*inflightRequest
+	subs     map[string]*Subscription
+	newSubs  map[ID][]*Subscription
+	values   map[interface{}]interface{}
+	// agreed on by rpc.hello, nil until then
+	extensions map[string]bool
+	// set by EnableMethods and DisableMethods after the server's gated ones
+	methodRules []methodRule
+	abortErr    error
+
+	// serializes writes to the socket
+	writeMu sync.Mutex
+	// the first write error, after which nothing more is written
+	writeErr  error
+	sendStats sendStats
+
+	closeFn  func()
+	done     chan struct{}
+	doneOnce sync.Once
+
+	// set for connections served by Handle
+	sock        Socket
+	queue       chan outgoing
+	cancel      context.CancelFunc
+	stopReading context.CancelFunc
+	closing     chan struct{}
+	rateLimit   *tokenBucket
+	connected   bool // guarded by the server's mu
+	deadlines   bool
+
+	attachments AttachmentSocket
+}
+
+var connSeq uint64
+
+func newConn(send func(ctx context.Context, msg interface{}) error, logger Logger) *Conn {
+	return &Conn{
+		id:       atomic.AddUint64(&connSeq, 1),
+		send:     send,
+		pending:  newPendingCalls(logger),
+		logger:   logger,
+		inflight: map[ID]*inflightRequest{},
+		subs:     map[string]*Subscription{},
+		newSubs:  map[ID][]*Subscription{},
+		done:     make(chan struct{}),
+	}
+}
+
+// shutdown fails pending calls with err and closes the subscriptions.
+func (c *Conn) shutdown(err error) {
+	c.pending.shutdown(err)
+	c.closeSubscriptions()
+}
+
+// Call invokes method on the peer and waits for the response, decoding the
+// result into result (which may be nil to discard it). Errors returned by the
+// peer are of type *Error.
+func (c *Conn) Call(ctx context.Context, method string, params, result interface{}) error {
+	req, err := newOutgoingRequest(method, params)
+	if err != nil {
+		return err
+	}
+	id, ch, err := c.pending.add()
+	if err != nil {
+		return err
+	}
+	defer c.pending.remove(id)
+	req.ID = &id
+	c.stamp(ctx, req)
+
+	if err := c.send(ctx, req); err != nil {
+		return err
+	}
+	// let the peer's requests through meanwhile, see nested.go
+	y := yielderFor(ctx, c)
+	y.pause()
+	defer y.resume(ctx)
+	return c.pending.wait(ctx, ch, nil, result)
+}
+
+// Notify sends a notification to the peer. Notifications are not answered,
+// so this returns as soon as the message is sent.
+func (c *Conn) Notify(ctx context.Context, method string, params interface{}) error {
+	req, err := newOutgoingRequest(method, params)
+	if err != nil {
+		return err
+	}
+	return c.send(ctx, req)
+}
+
+func newOutgoingRequest(method string, params interface{}) (*Request, error) {
+	req := &Request{Method: method, JSONRPC: "2.0"}
+	if params != nil {
+		b, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		raw := ParamsRaw(b)
+		req.Params = &raw
+	}
+	return req, nil
+}
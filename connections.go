@@ -0,0 +1,72 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ID returns a number identifying the connection, unique within the process.
+func (c *Conn) ID() uint64 {
+	return c.id
+}
+
+// Connections returns the connections served by Handle that are connected,
+// i.e. past AfterConnect and authentication, and have not yet closed. Use
+// Conn.Set and Conn.Get to keep metadata such as the user or joined rooms on
+// each of them.
+func (s *Server) Connections() []*Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conns := make([]*Conn, 0, len(s.conns))
+	for conn := range s.conns {
+		if conn.connected {
+			conns = append(conns, conn)
+		}
+	}
+	return conns
+}
+
+// Broadcast sends a notification to every connection in Connections. params
+// are marshaled once and the connections are written to concurrently, so a
+// slow peer doesn't hold up the others. It returns the first error other than
+// ErrConnClosed once every connection has been tried.
+func (s *Server) Broadcast(ctx context.Context, method string, params interface{}) error {
+	return s.BroadcastFunc(ctx, nil, method, params)
+}
+
+// BroadcastFunc is like Broadcast, but only notifies connections for which
+// filter reports true, e.g. those that joined a room:
+//
+//	rpc.BroadcastFunc(ctx, func(c *jsonrpc.Conn) bool {
+//		_, ok := c.Get(room)
+//		return ok
+//	}, "chat/message", msg)
+func (s *Server) BroadcastFunc(ctx context.Context, filter func(*Conn) bool, method string,
+	params interface{}) error {
+	req, err := newOutgoingRequest(method, params)
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	for _, conn := range s.Connections() {
+		if filter != nil && !filter(conn) {
+			continue
+		}
+		wg.Add(1)
+		go func(conn *Conn) {
+			defer wg.Done()
+			if err := conn.send(ctx, req); err != nil && !errors.Is(err, ErrConnClosed) {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(conn)
+	}
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,73 @@
+package jsonrpc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ConnErrorKind says what failed on a connection.
+type ConnErrorKind int
+
+const (
+	// ReadError is the socket failing to read, which ends the connection.
+	ReadError ConnErrorKind = iota
+	// WriteError is the socket failing to write, or timing out with
+	// WithWriteTimeout, which ends the connection.
+	WriteError
+	// DecodeError is a message that isn't valid JSON-RPC. Malformed JSON is
+	// answered with a parse error and the connection carries on; other
+	// messages the socket can't make sense of end it.
+	DecodeError
+)
+
+func (k ConnErrorKind) String() string {
+	switch k {
+	case ReadError:
+		return "read"
+	case WriteError:
+		return "write"
+	case DecodeError:
+		return "decode"
+	}
+	return fmt.Sprintf("ConnErrorKind(%d)", int(k))
+}
+
+// ConnError is an error on a connection, as passed to WithOnError.
+type ConnError struct {
+	Kind ConnErrorKind
+	Err  error
+}
+
+func (e *ConnError) Error() string {
+	return fmt.Sprintf("jsonrpc: %s error: %v", e.Kind, e.Err)
+}
+
+func (e *ConnError) Unwrap() error {
+	return e.Err
+}
+
+// WithOnError sets a function called with the errors of connections served
+// by Handle: for the one that ends a connection, unless the peer just hung up
+// or the server closed it, and for each malformed message. A write error
+// stops reading, cancels the connection's handlers and closes the socket,
+// rather than leaving the server talking to a broken connection.
+func WithOnError(fn func(conn *Conn, err *ConnError)) Option {
+	return func(s *Server) {
+		s.onError = fn
+	}
+}
+
+// fail aborts conn for err, reporting it unless conn had already been
+// aborted.
+func (s *Server) fail(conn *Conn, kind ConnErrorKind, err error) {
+	if conn.abort(err) {
+		s.reportError(conn, kind, err)
+	}
+}
+
+func (s *Server) reportError(conn *Conn, kind ConnErrorKind, err error) {
+	if s.onError != nil && !errors.Is(err, io.EOF) {
+		s.onError(conn, &ConnError{Kind: kind, Err: err})
+	}
+}
@@ -5,31 +5,62 @@ import (
 )
 
 type (
-	ctxNotifyFuncKey struct{}
-	ctxCloseFuncKey  struct{}
+	ctxConnKey      struct{}
+	ctxCloseFuncKey struct{}
+
+	ctxNotificationKey struct{}
+	ctxRequestKey      struct{}
 )
 
-func ctxGetNotifyFunc(ctx context.Context) func(method string, params interface{}) {
-	return ctx.Value(ctxNotifyFuncKey{}).(func(method string, params interface{}))
+// ConnFromContext returns the connection a handler was invoked on.
+func ConnFromContext(ctx context.Context) *Conn {
+	conn, _ := ctx.Value(ctxConnKey{}).(*Conn)
+	return conn
 }
 
-func ctxWithNotifyFunc(ctx context.Context, fn func(method string, params interface{})) context.Context {
-	return context.WithValue(ctx, ctxNotifyFuncKey{}, fn)
+func ctxWithConn(ctx context.Context, conn *Conn) context.Context {
+	return context.WithValue(ctx, ctxConnKey{}, conn)
 }
 
 func ctxGetCloseFunc(ctx context.Context) func() {
-	return ctx.Value(ctxCloseFuncKey{}).(func())
+	fn, _ := ctx.Value(ctxCloseFuncKey{}).(func())
+	if fn == nil {
+		return func() {}
+	}
+	return fn
 }
 
 func ctxWithCloseFunc(ctx context.Context, fn func()) context.Context {
 	return context.WithValue(ctx, ctxCloseFuncKey{}, fn)
 }
 
-func setupContext(ctx context.Context, responses chan<- *Response) context.Context {
+func ctxWithNotification(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxNotificationKey{}, true)
+}
+
+// IsNotification reports whether the handler was invoked by a notification.
+// The result of such a call is discarded, so handlers may skip computing it.
+func IsNotification(ctx context.Context) bool {
+	notification, _ := ctx.Value(ctxNotificationKey{}).(bool)
+	return notification
+}
+
+// RequestFromContext returns the request a handler was invoked by, with the
+// method as the client sent it, before any Mount prefix was trimmed, and the
+// raw params. It must not be modified.
+func RequestFromContext(ctx context.Context) *Request {
+	req, _ := ctx.Value(ctxRequestKey{}).(*Request)
+	return req
+}
+
+func ctxWithRequest(ctx context.Context, req *Request) context.Context {
+	return context.WithValue(ctx, ctxRequestKey{}, req)
+}
+
+func setupContext(ctx context.Context, conn *Conn) context.Context {
 	ctx, cancel := context.WithCancel(ctx)
+	conn.cancel = cancel
 	ctx = ctxWithCloseFunc(ctx, cancel)
-	ctx = ctxWithNotifyFunc(ctx, func(method string, params interface{}) {
-		responses <- newResponseNotification(method, params)
-	})
+	ctx = ctxWithConn(ctx, conn)
 	return ctx
 }
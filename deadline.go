@@ -0,0 +1,75 @@
+package jsonrpc
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// DeadlineHeader is the HTTP header carrying the deadline, as an RFC 3339
+// timestamp, for every request in the body that has no deadline member.
+const DeadlineHeader = "Jsonrpc-Deadline"
+
+// WithDeadlines honors the deadline clients send along with their calls:
+// the handler's context gets that deadline, and calls whose deadline has
+// already passed, which the client has given up on, get ErrRequestTimeout
+// without running. A shorter WithTimeout still applies. Calls made through
+// the server's connections carry their context's deadline in turn.
+func WithDeadlines() Option {
+	return func(s *Server) {
+		s.deadlines = true
+	}
+}
+
+// WithClientDeadlines sends the deadline of each call's context along with
+// it, for servers using WithDeadlines.
+func WithClientDeadlines() ClientOption {
+	return func(c *Client) {
+		c.deadlines = true
+	}
+}
+
+// stamp sets the extension members of an outgoing call taken from ctx.
+func (c *Conn) stamp(ctx context.Context, req *Request) {
+	req.IdempotencyKey = idempotencyKeyFromContext(ctx)
+	req.Priority = priorityFromContext(ctx)
+	if deadline, ok := ctx.Deadline(); ok && c.deadlines && c.Supports(ExtDeadlines) {
+		deadline = deadline.UTC()
+		req.Deadline = &deadline
+	}
+}
+
+// deadlineFor returns how long req may run, given the deadline it was sent
+// with and the server's timeouts, or zero for no limit.
+func (s *Server) deadlineFor(req *Request) time.Duration {
+	d := s.timeoutFor(req.Method)
+	if !s.deadlines || req.Deadline == nil {
+		return d
+	}
+	remaining := time.Until(*req.Deadline)
+	if remaining <= 0 {
+		return -1
+	}
+	if d == 0 || remaining < d {
+		return remaining
+	}
+	return d
+}
+
+// headerDeadline applies the DeadlineHeader of r to the requests in msg.
+func (s *Server) headerDeadline(r *http.Request, msg *incoming) {
+	h := r.Header.Get(DeadlineHeader)
+	if !s.deadlines || h == "" {
+		return
+	}
+	deadline, err := time.Parse(time.RFC3339Nano, h)
+	if err != nil {
+		s.logger.Log(LevelInfo, "invalid deadline header", "error", err)
+		return
+	}
+	for _, req := range msg.reqs {
+		if req.Deadline == nil {
+			req.Deadline = &deadline
+		}
+	}
+}
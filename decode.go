@@ -0,0 +1,187 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// DecodeOptions control how params are unmarshaled.
+type DecodeOptions struct {
+	// DisallowUnknownFields rejects object params with members the params
+	// type has no field for.
+	DisallowUnknownFields bool
+	// UseNumber decodes numbers into interface{} values as json.Number
+	// rather than float64, so that large integers such as int64 ids and
+	// amounts keep their precision.
+	UseNumber bool
+	// Unmarshal, if set, replaces json.Unmarshal, e.g. with a faster or more
+	// lenient decoder. The options above are then up to it; those below
+	// still apply.
+	Unmarshal func(data []byte, v interface{}) error
+	// Defaults sets the struct fields tagged default:"..." whose members are
+	// absent to the tag's value, e.g. default:"10" or default:"asc" for a
+	// string.
+	Defaults bool
+	// CoerceStrings accepts strings holding numbers and booleans, e.g. "42",
+	// for number and bool params and fields, for sloppy clients.
+	CoerceStrings bool
+	// RequireFields fails params objects missing members for struct fields
+	// without omitempty or a default, as the OpenRPC document marks them
+	// required, with invalid params whose data lists their names under
+	// "missing".
+	RequireFields bool
+}
+
+// WithDecodeOptions sets how params are unmarshaled for every method. By
+// default they are decoded with json.Unmarshal. Params types implementing
+// json.Unmarshaler decode themselves either way.
+func WithDecodeOptions(opts DecodeOptions) Option {
+	return func(s *Server) {
+		s.decodeOptions = &opts
+	}
+}
+
+// WithMethodDecodeOptions overrides the decode options for one method.
+func WithMethodDecodeOptions(method string, opts DecodeOptions) Option {
+	return func(s *Server) {
+		if s.methodDecodeOptions == nil {
+			s.methodDecodeOptions = map[string]*DecodeOptions{}
+		}
+		s.methodDecodeOptions[method] = &opts
+	}
+}
+
+func (s *Server) decodeOptionsFor(method string) *DecodeOptions {
+	if opts, ok := s.methodDecodeOptions[method]; ok {
+		return opts
+	}
+	return s.decodeOptions
+}
+
+func (o *DecodeOptions) unmarshal(data []byte, v interface{}) error {
+	if o != nil && (o.Defaults || o.CoerceStrings || o.RequireFields) {
+		var missing []string
+		data = o.prepare(reflect.TypeOf(v), data, "", &missing)
+		if missing != nil {
+			return ErrInvalidParams.WithMessage("missing params: " + strings.Join(missing, ", ")).
+				WithData(map[string][]string{"missing": missing})
+		}
+	}
+	switch {
+	case o == nil:
+		return jsonUnmarshal(data, v)
+	case o.Unmarshal != nil:
+		return o.Unmarshal(data, v)
+	case !o.DisallowUnknownFields && !o.UseNumber:
+		return jsonUnmarshal(data, v)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if o.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if o.UseNumber {
+		dec.UseNumber()
+	}
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("invalid data after params")
+	}
+	return nil
+}
+
+// prepare applies the defaults, coercion and required fields of o to data,
+// to be unmarshaled into t, adding the paths of missing members under path
+// to missing.
+func (o *DecodeOptions) prepare(t reflect.Type, data []byte, path string, missing *[]string) []byte {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if s, ok := o.coercible(data); ok {
+			if _, err := strconv.ParseFloat(s, 64); err == nil {
+				return []byte(s)
+			}
+		}
+		return data
+	case reflect.Bool:
+		if s, ok := o.coercible(data); ok {
+			if b, err := strconv.ParseBool(s); err == nil {
+				return []byte(strconv.FormatBool(b))
+			}
+		}
+		return data
+	case reflect.Struct:
+	default:
+		return data
+	}
+	if t == timeType || reflect.PtrTo(t).Implements(jsonUnmarshalerType) {
+		return data
+	}
+	var members map[string]json.RawMessage
+	if json.Unmarshal(data, &members) != nil || members == nil {
+		return data
+	}
+	for _, f := range structFields(t) {
+		key, ok := memberKey(members, f.name)
+		switch {
+		case ok && !f.asString:
+			members[key] = o.prepare(f.typ, members[key], path+f.name+".", missing)
+		case ok:
+		case o.Defaults && f.def != "":
+			members[f.name] = defaultValue(f)
+		case o.RequireFields && !f.omitempty && f.def == "":
+			*missing = append(*missing, path+f.name)
+		}
+	}
+	if b, err := json.Marshal(members); err == nil {
+		return b
+	}
+	return data
+}
+
+// memberKey returns the key of the member for the field called name, matched
+// as encoding/json does: exactly, or else ignoring case.
+func memberKey(members map[string]json.RawMessage, name string) (string, bool) {
+	if _, ok := members[name]; ok {
+		return name, true
+	}
+	for key := range members {
+		if strings.EqualFold(key, name) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// coercible returns the string data holds, if CoerceStrings is set.
+func (o *DecodeOptions) coercible(data []byte) (string, bool) {
+	var s string
+	if !o.CoerceStrings || len(data) == 0 || data[0] != '"' || json.Unmarshal(data, &s) != nil {
+		return "", false
+	}
+	return strings.TrimSpace(s), true
+}
+
+// defaultValue returns the JSON for f's default tag: the tag itself if it is
+// valid JSON other than for a string field, or else the tag as a string.
+func defaultValue(f structField) json.RawMessage {
+	t := f.typ
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.String && json.Valid([]byte(f.def)) {
+		return json.RawMessage(f.def)
+	}
+	b, _ := json.Marshal(f.def)
+	return b
+}
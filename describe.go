@@ -0,0 +1,121 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const listMethodsMethod = "rpc.methods"
+
+// MethodInfo describes a registered method.
+type MethodInfo struct {
+	Name string
+	Doc  string
+	// Service is the service that registered it, see RegisterService.
+	Service string
+	// Params are the types of the positional arguments, or the single params
+	// type, if any.
+	Params []reflect.Type
+	// Result is the result type, or nil for methods returning only an error.
+	Result reflect.Type
+	// Notification is set for handlers registered with RegisterNotification.
+	Notification bool
+}
+
+// MarshalJSON renders the types by name, as returned by rpc.methods.
+func (m MethodInfo) MarshalJSON() ([]byte, error) {
+	params := make([]string, len(m.Params))
+	for i, t := range m.Params {
+		params[i] = t.String()
+	}
+	var result string
+	if m.Result != nil {
+		result = m.Result.String()
+	}
+	return json.Marshal(struct {
+		Name         string   `json:"name"`
+		Doc          string   `json:"doc,omitempty"`
+		Service      string   `json:"service,omitempty"`
+		Params       []string `json:"params"`
+		Result       string   `json:"result,omitempty"`
+		Notification bool     `json:"notification,omitempty"`
+	}{m.Name, m.Doc, m.Service, params, result, m.Notification})
+}
+
+// WithMethodDoc documents method for Describe, rpc.methods and OpenRPC.
+func WithMethodDoc(method, doc string) Option {
+	return func(s *Server) {
+		s.Document(method, doc)
+	}
+}
+
+// Document sets the documentation of method, e.g. right after registering
+// it. It may be called while serving.
+func (s *Server) Document(method, doc string) {
+	s.docsMu.Lock()
+	defer s.docsMu.Unlock()
+	if s.docs == nil {
+		s.docs = map[string]string{}
+	}
+	s.docs[method] = doc
+}
+
+func (s *Server) doc(method string) string {
+	s.docsMu.RLock()
+	defer s.docsMu.RUnlock()
+	return s.docs[method]
+}
+
+// Describe lists the server's methods, including mounted ones, sorted by
+// name. Methods starting with "rpc." are left out. The built-in rpc.methods
+// method returns it to clients.
+func (s *Server) Describe() []MethodInfo {
+	infos := s.describe("")
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+func (s *Server) describe(prefix string) []MethodInfo {
+	infos := []MethodInfo{}
+	for name, m := range s.methodSet() {
+		if strings.HasPrefix(name, "rpc.") || (m.fn.IsValid() && checkFunc(m.fn) != nil) {
+			continue
+		}
+		info := MethodInfo{Name: prefix + name, Doc: s.doc(name), Service: m.service, Result: m.resultType,
+			Notification: m.notification}
+		switch {
+		case m.argTypes != nil:
+			info.Params = m.argTypes
+		case m.paramsType != nil:
+			info.Params = []reflect.Type{m.paramsType}
+		}
+		infos = append(infos, info)
+	}
+	for _, mnt := range s.mountSet() {
+		for _, info := range mnt.server.describe(prefix + mnt.prefix) {
+			if s.method(strings.TrimPrefix(info.Name, prefix)) == nil {
+				infos = append(infos, info)
+			}
+		}
+	}
+	return infos
+}
+
+func (s *Server) listMethods(ctx context.Context) ([]MethodInfo, error) {
+	infos := s.Describe()
+	if conn := ConnFromContext(ctx); conn != nil {
+		enabled := infos[:0]
+		for _, info := range infos {
+			if conn.MethodEnabled(info.Name) {
+				enabled = append(enabled, info)
+			}
+		}
+		infos = enabled
+	}
+	return infos, nil
+}
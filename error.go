@@ -0,0 +1,119 @@
+package jsonrpc
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+
+	// CodeServerError is used for plain errors returned by handlers.
+	// -32000 to -32099 are reserved for implementation-defined server errors.
+	CodeServerError = -32000
+)
+
+var (
+	ErrParse          = NewError(CodeParseError, "parse error")
+	ErrInvalidRequest = NewError(CodeInvalidRequest, "invalid request")
+	ErrMethodNotFound = NewError(CodeMethodNotFound, "method not found")
+	ErrInvalidParams  = NewError(CodeInvalidParams, "invalid params")
+	ErrInternal       = NewError(CodeInternalError, "internal error")
+)
+
+// Error is a JSON-RPC 2.0 error object. Handlers may return it (or wrap it)
+// to control the code and data sent to the client.
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// ErrorCoder is implemented by handler errors that choose their own code.
+type ErrorCoder interface {
+	ErrorCode() int
+}
+
+// ErrorDataProvider is implemented by handler errors that carry machine
+// readable details, such as the fields that failed validation. ErrorData is
+// sent as the error's data.
+type ErrorDataProvider interface {
+	ErrorData() interface{}
+}
+
+func NewError(code int, msg string) *Error {
+	return &Error{Code: code, Message: msg}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// Is reports whether target is an *Error with the same code, so
+// errors.Is(err, ErrInvalidParams) matches any invalid params error.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithMessage returns a copy of e with msg as its message.
+func (e *Error) WithMessage(msg string) *Error {
+	return &Error{Code: e.Code, Message: msg, Data: e.Data}
+}
+
+// WithData returns a copy of e carrying data.
+func (e *Error) WithData(data interface{}) *Error {
+	return &Error{Code: e.Code, Message: e.Message, Data: data}
+}
+
+// WithErrorMapper translates errors returned by handlers and interceptors,
+// such as sql.ErrNoRows or validation errors, in one place. When fn returns
+// nil the error is converted as usual. Panics are not passed to fn.
+func WithErrorMapper(fn func(error) *Error) Option {
+	return func(s *Server) {
+		s.errorMapper = fn
+	}
+}
+
+// toError is toError after applying the server's error mapper.
+func (s *Server) toError(err error) *Error {
+	var panicErr *PanicError
+	if s.errorMapper != nil && !errors.As(err, &panicErr) {
+		if rpcErr := s.errorMapper(err); rpcErr != nil {
+			return rpcErr
+		}
+	}
+	return toError(err)
+}
+
+func toError(err error) *Error {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		if panicErr.redact {
+			return ErrInternal
+		}
+		return ErrInternal.WithMessage(fmt.Sprintf("%+v", panicErr.Value))
+	}
+	rpcErr = NewError(CodeServerError, err.Error())
+	var userErr interface{ UserError() string }
+	if errors.As(err, &userErr) {
+		rpcErr.Message = userErr.UserError()
+	}
+	var coder ErrorCoder
+	if errors.As(err, &coder) {
+		rpcErr.Code = coder.ErrorCode()
+	}
+	var data ErrorDataProvider
+	if errors.As(err, &data) {
+		rpcErr.Data = data.ErrorData()
+	}
+	return rpcErr
+}
@@ -0,0 +1,226 @@
+package jsonrpc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// WithEthereum follows go-ethereum's conventions so that Ethereum tooling can
+// talk to the server: receivers registered with RegisterNamespace are named
+// namespace_method, with the method's first letter lowercased, and take
+// their params by position; "<namespace>_subscribe" calls with params
+// [name, args...] go to the subscription method namespace_name, whose events
+// are delivered as eth_subscription notifications until eth_unsubscribe.
+// Use HexUint64, HexBig and HexBytes for quantities and data.
+func WithEthereum() Option {
+	return func(s *Server) {
+		s.ethereum = true
+		s.subscriptionMethod = "eth_subscription"
+		s.unsubscribeMethod = "eth_unsubscribe"
+	}
+}
+
+// EthereumName names GetBalance "getBalance" and HTTPStatus "hTTPStatus", as
+// go-ethereum does.
+func EthereumName(goName string) string {
+	r, n := utf8.DecodeRuneInString(goName)
+	return string(unicode.ToLower(r)) + goName[n:]
+}
+
+// RegisterNamespace adds the handler methods of rcvr as namespace_method, as
+// go-ethereum's RegisterName does. Params are read by position, so a method
+// with a single argument is called with a one element array. Methods
+// returning a *Subscription are called by "namespace_subscribe" under
+// WithEthereum.
+func (s *Server) RegisterNamespace(namespace string, rcvr interface{}) error {
+	v := reflect.ValueOf(rcvr)
+	added := Methods{}
+	for i := 0; i < v.NumMethod(); i++ {
+		fn := v.Method(i)
+		if checkFunc(fn) != nil {
+			continue
+		}
+		goName := v.Type().Method(i).Name
+		name, ok := s.methodNames[goName]
+		if !ok {
+			name = EthereumName(goName)
+		} else if name == "-" {
+			continue
+		}
+		m := s.newMethod(fn)
+		m.service = namespace
+		byPosition(m)
+		added[namespace+"_"+name] = m
+	}
+	if len(added) == 0 {
+		return fmt.Errorf("jsonrpc: namespace %s has no handler methods", namespace)
+	}
+	var err error
+	s.updateMethods(func(methods Methods) {
+		for method := range added {
+			if methods[method] != nil {
+				err = fmt.Errorf("jsonrpc: namespace %s: method %s is already registered", namespace, method)
+				return
+			}
+		}
+		for method, m := range added {
+			methods[method] = m
+		}
+	})
+	return err
+}
+
+// byPosition makes a method with a single params argument take it as the
+// only element of array params too.
+func byPosition(m *Method) {
+	if m.paramsType == nil || m.paramsType == readerType {
+		return
+	}
+	parse := m.parse
+	m.parse = func(raw *ParamsRaw, opts *DecodeOptions) (interface{}, error) {
+		// an array, unless it is the params themselves
+		if raw != nil && isBatch(json.RawMessage(*raw)) {
+			var elems []json.RawMessage
+			if err := json.Unmarshal(*raw, &elems); err != nil {
+				return nil, err
+			}
+			switch len(elems) {
+			case 0:
+				raw = nil
+			case 1:
+				elem := ParamsRaw(elems[0])
+				raw = &elem
+			default:
+				return nil, fmt.Errorf("rpc [params unmarshal]: expected at most 1 positional param, got %d", len(elems))
+			}
+		}
+		return parse(raw, opts)
+	}
+}
+
+var subscriptionType = reflect.TypeOf((*Subscription)(nil))
+
+// ethSubscribe returns an eth_subscribe style call with params [name,
+// args...] as a call to the subscription method it names with params
+// [args...], or req if it isn't one.
+func (s *Server) ethSubscribe(req *Request) *Request {
+	namespace := strings.TrimSuffix(req.Method, "_subscribe")
+	if !s.ethereum || namespace == req.Method || req.Params == nil || s.method(req.Method) != nil {
+		return req
+	}
+	var params []json.RawMessage
+	var name string
+	if json.Unmarshal(*req.Params, &params) != nil || len(params) == 0 || json.Unmarshal(params[0], &name) != nil {
+		return req
+	}
+	method := namespace + "_" + name
+	if m := s.method(method); m == nil || m.resultType != subscriptionType {
+		return req
+	}
+	args, _ := json.Marshal(params[1:])
+	raw := ParamsRaw(args)
+	resolved := *req
+	resolved.Method = method
+	resolved.Params = &raw
+	return &resolved
+}
+
+var errHexSyntax = errors.New("jsonrpc: invalid hex string")
+
+// HexUint64 is marshalled as a hex quantity, e.g. "0x1a", as Ethereum
+// encodes numbers.
+type HexUint64 uint64
+
+func (q HexUint64) MarshalJSON() ([]byte, error) {
+	return json.Marshal("0x" + strconv.FormatUint(uint64(q), 16))
+}
+
+func (q *HexUint64) UnmarshalJSON(b []byte) error {
+	digits, err := quantityDigits(b)
+	if err != nil {
+		return err
+	}
+	n, err := strconv.ParseUint(digits, 16, 64)
+	if err != nil {
+		return fmt.Errorf("jsonrpc: hex quantity %s: %w", b, err)
+	}
+	*q = HexUint64(n)
+	return nil
+}
+
+// HexBig is a big.Int marshalled as a hex quantity, e.g. balances in wei.
+type HexBig big.Int
+
+func (q *HexBig) MarshalJSON() ([]byte, error) {
+	n := (*big.Int)(q)
+	if n.Sign() < 0 {
+		return json.Marshal("-0x" + new(big.Int).Neg(n).Text(16))
+	}
+	return json.Marshal("0x" + n.Text(16))
+}
+
+func (q *HexBig) UnmarshalJSON(b []byte) error {
+	digits, err := quantityDigits(b)
+	if err != nil {
+		return err
+	}
+	if _, ok := (*big.Int)(q).SetString(digits, 16); !ok {
+		return fmt.Errorf("jsonrpc: hex quantity %s: %w", b, errHexSyntax)
+	}
+	return nil
+}
+
+// Int returns q as a *big.Int.
+func (q *HexBig) Int() *big.Int {
+	return (*big.Int)(q)
+}
+
+// quantityDigits returns the digits of a quoted hex quantity, which must have
+// the 0x prefix and no leading zeros.
+func quantityDigits(b []byte) (string, error) {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return "", err
+	}
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	switch {
+	case len(digits) == len(s) || digits == "":
+		return "", fmt.Errorf("jsonrpc: hex quantity %q: %w", s, errHexSyntax)
+	case len(digits) > 1 && digits[0] == '0':
+		return "", fmt.Errorf("jsonrpc: hex quantity %q has leading zeros", s)
+	}
+	return digits, nil
+}
+
+// HexBytes is marshalled as 0x-prefixed hex data, e.g. "0xdeadbeef", as
+// Ethereum encodes hashes, addresses and call data.
+type HexBytes []byte
+
+func (d HexBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal("0x" + hex.EncodeToString(d))
+}
+
+func (d *HexBytes) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if len(digits) == len(s) {
+		return fmt.Errorf("jsonrpc: hex data %q: %w", s, errHexSyntax)
+	}
+	data, err := hex.DecodeString(digits)
+	if err != nil {
+		return fmt.Errorf("jsonrpc: hex data %q: %w", s, err)
+	}
+	*d = data
+	return nil
+}
@@ -6,8 +6,8 @@ import (
 	"log"
 	"net/http"
 
-	"github.com/gorilla/websocket"
 	"github.com/jdxcode/jsonrpc"
+	"github.com/jdxcode/jsonrpc/ws"
 )
 
 const PORT = ":8000"
@@ -15,16 +15,7 @@ const PORT = ":8000"
 // starts a json-rpc 2.0 websocket server
 func main() {
 	rpc := jsonrpc.New(&RPC{})
-	http.HandleFunc("/rpc", func(w http.ResponseWriter, r *http.Request) {
-		upgrader := &websocket.Upgrader{}
-		conn, err := upgrader.Upgrade(w, r, nil)
-		if err != nil {
-			log.Println(err)
-			return
-		}
-		ctx := r.Context()
-		rpc.Handle(ctx, conn)
-	})
+	http.Handle("/rpc", ws.Handler(rpc))
 
 	if err := http.ListenAndServe(PORT, nil); err != nil {
 		log.Fatal(err)
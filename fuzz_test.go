@@ -0,0 +1,186 @@
+package jsonrpc_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdxcode/jsonrpc"
+)
+
+type FuzzRPC struct{}
+
+func (r *FuzzRPC) Echo(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+	return params, nil
+}
+
+func (r *FuzzRPC) Add(ctx context.Context, a, b int) (int, error) {
+	return a + b, nil
+}
+
+func (r *FuzzRPC) Struct(ctx context.Context, params *FooStructParams) (*FooStructResult, error) {
+	return &FooStructResult{params.Foo}, nil
+}
+
+func (r *FuzzRPC) Panic(ctx context.Context) (interface{}, error) {
+	panic("uh oh")
+}
+
+type fuzzConn struct {
+	io.Reader
+	out bytes.Buffer
+}
+
+func (c *fuzzConn) Write(p []byte) (int, error) { return c.out.Write(p) }
+func (c *fuzzConn) Close() error                { return nil }
+
+var fuzzSeeds = []string{
+	`{"jsonrpc":"2.0","id":1,"method":"Echo","params":{"a":[1,2,3]}}`,
+	`{"jsonrpc":"2.0","id":"abc","method":"Add","params":[1,2]}`,
+	`{"jsonrpc":"2.0","id":null,"method":"Struct","params":{"foo":"bar"}}`,
+	`{"jsonrpc":"2.0","method":"Echo","params":"notify"}`,
+	`[{"jsonrpc":"2.0","id":1,"method":"Add","params":[1]},{"jsonrpc":"2.0","id":2,"method":"Panic"}]`,
+	`{"jsonrpc":"2.0","id":{"a":1},"method":"Echo"}`,
+	`{"jsonrpc":"2.0","id":1,"method":"Echo","params":[[[[[[[[[[[[[[[[1]]]]]]]]]]]]]]]]}`,
+	"{\"jsonrpc\":\"2.0\",\"id\":1,\"method\":\"Echo\",\"params\":\"\xff\xfe\"}",
+	`{"jsonrpc":"2.0","id":1,"method":"Ec`,
+	`[]`,
+	`[1,"x",null]`,
+	`{"id":1,"result":{}}`,
+}
+
+// FuzzHandle feeds arbitrary input to a server and checks that it never
+// panics, and that everything it writes back is a valid JSON-RPC response.
+func FuzzHandle(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed + "\n"))
+	}
+	rpc := jsonrpc.New(&FuzzRPC{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger))
+	f.Fuzz(func(t *testing.T, in []byte) {
+		conn := &fuzzConn{Reader: bytes.NewReader(in)}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		rpc.Handle(ctx, jsonrpc.NewStreamSocket(conn))
+
+		sc := bufio.NewScanner(&conn.out)
+		sc.Buffer(nil, len(in)+1<<20)
+		for sc.Scan() {
+			var batch []json.RawMessage
+			if err := json.Unmarshal(sc.Bytes(), &batch); err != nil {
+				batch = []json.RawMessage{sc.Bytes()}
+			} else if len(batch) == 0 {
+				t.Fatalf("empty batch response")
+			}
+			for _, raw := range batch {
+				checkResponse(t, raw)
+			}
+		}
+		if err := sc.Err(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// FuzzHandleMessagePack is FuzzHandle for a server reading length-prefixed
+// MessagePack messages, each input being one message.
+func FuzzHandleMessagePack(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		if b, err := jsonrpc.MessagePack.Marshal(json.RawMessage(seed)); err == nil {
+			f.Add(b)
+		}
+	}
+	f.Add(bytes.Repeat([]byte{0x91}, 100000))
+	rpc := jsonrpc.New(&FuzzRPC{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger))
+	f.Fuzz(func(t *testing.T, in []byte) {
+		var frame bytes.Buffer
+		_ = binary.Write(&frame, binary.BigEndian, uint32(len(in)))
+		frame.Write(in)
+		conn := &fuzzConn{Reader: &frame}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		rpc.Handle(ctx, jsonrpc.NewStreamSocket(conn, jsonrpc.WithLengthPrefix(), jsonrpc.WithCodec(jsonrpc.MessagePack)))
+
+		out := jsonrpc.NewStreamSocket(&fuzzConn{Reader: &conn.out}, jsonrpc.WithLengthPrefix(),
+			jsonrpc.WithCodec(jsonrpc.MessagePack))
+		for {
+			var msg json.RawMessage
+			if err := out.ReadJSON(&msg); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			var batch []json.RawMessage
+			if err := json.Unmarshal(msg, &batch); err != nil {
+				batch = []json.RawMessage{msg}
+			}
+			for _, raw := range batch {
+				checkResponse(t, raw)
+			}
+		}
+	})
+}
+
+func checkResponse(t *testing.T, raw json.RawMessage) {
+	var rsp map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &rsp); err != nil {
+		t.Fatalf("invalid response %s: %v", raw, err)
+	}
+	_, hasID := rsp["id"]
+	_, hasResult := rsp["result"]
+	var rspErr *struct {
+		Code    *int    `json:"code"`
+		Message *string `json:"message"`
+	}
+	if err := json.Unmarshal(rsp["error"], &rspErr); rsp["error"] != nil && err != nil {
+		t.Fatalf("invalid error %s: %v", raw, err)
+	}
+	switch {
+	case string(rsp["jsonrpc"]) != `"2.0"`:
+		t.Fatalf("response without jsonrpc 2.0: %s", raw)
+	case !hasID:
+		t.Fatalf("response without id: %s", raw)
+	case hasResult == (rspErr != nil):
+		t.Fatalf("response needs exactly one of result and error: %s", raw)
+	case rspErr != nil && (rspErr.Code == nil || rspErr.Message == nil):
+		t.Fatalf("error without code or message: %s", raw)
+	}
+}
+
+// FuzzFraming reads arbitrary bytes as length-prefixed and header-framed
+// messages, which must fail cleanly on truncated or oversized frames.
+func FuzzFraming(f *testing.F) {
+	f.Add([]byte("\x00\x00\x00\x02{}"))
+	f.Add([]byte("\xff\xff\xff\xff{}"))
+	f.Add([]byte("Content-Length: 2\r\n\r\n{}"))
+	f.Add([]byte("Content-Length: 99999999999\r\n\r\n{"))
+	f.Add([]byte("Content-Length: 4\r\n\r\n{\"a\""))
+	f.Add([]byte("{" + strings.Repeat(" ", 100)))
+	f.Add([]byte("Content-Length: 20\r\n\r\n" + strings.Repeat(" ", 18) + "{}"))
+	f.Fuzz(func(t *testing.T, in []byte) {
+		socks := []jsonrpc.Socket{
+			jsonrpc.NewStreamSocket(&fuzzConn{Reader: bytes.NewReader(in)}, jsonrpc.WithLengthPrefix()),
+			jsonrpc.NewStreamSocket(&fuzzConn{Reader: bytes.NewReader(in)}, jsonrpc.WithMaxMessageSize(16)),
+			jsonrpc.NewHeaderSocket(bytes.NewReader(in), nil, nil),
+			jsonrpc.NewHeaderSocket(bytes.NewReader(in), nil, nil, jsonrpc.WithMaxContentLength(16)),
+		}
+		for _, sock := range socks {
+			for i := 0; i <= len(in); i++ {
+				var v json.RawMessage
+				if err := sock.ReadJSON(&v); err != nil {
+					var syntaxErr *json.SyntaxError
+					if errors.As(err, &syntaxErr) {
+						continue
+					}
+					break
+				}
+			}
+		}
+	})
+}
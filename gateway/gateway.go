@@ -0,0 +1,222 @@
+// Package gateway forwards requests to pools of upstream JSON-RPC servers,
+// so one endpoint can front several services.
+package gateway
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jdxcode/jsonrpc"
+)
+
+// ErrNoUpstream is returned for requests that no healthy upstream can take.
+var ErrNoUpstream = jsonrpc.NewError(jsonrpc.CodeServerError, "no upstream available")
+
+// Router picks the pool to forward method to, or nil if there is none.
+type Router func(method string) *Pool
+
+// Prefixes routes each method to the pool of its longest matching prefix.
+func Prefixes(pools map[string]*Pool) Router {
+	prefixes := make([]string, 0, len(pools))
+	for prefix := range pools {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		return len(prefixes[i]) > len(prefixes[j])
+	})
+	return func(method string) *Pool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(method, prefix) {
+				return pools[prefix]
+			}
+		}
+		return nil
+	}
+}
+
+// New returns a server that forwards requests, with their method unchanged,
+// to the pool chosen by route. Responses are passed back as they arrive, so
+// requests on one connection can be answered out of order by different
+// upstreams. Forwarding is the server's fallback, so its own methods, such as
+// rpc.discover, are answered locally, and opts such as WithAuth and
+// WithRateLimit apply to forwarded requests too. Methods route returns nil
+// for get ErrMethodNotFound.
+func New(route Router, opts ...jsonrpc.Option) *jsonrpc.Server {
+	forward := func(ctx context.Context, req *jsonrpc.Request) (*jsonrpc.Response, error) {
+		pool := route(req.Method)
+		if pool == nil {
+			return jsonrpc.MethodNotFound(ctx, req)
+		}
+		return jsonrpc.Forward(pool)(ctx, req)
+	}
+	return jsonrpc.New(&struct{}{}, append([]jsonrpc.Option{jsonrpc.WithFallback(forward)}, opts...)...)
+}
+
+// Pool is a set of connections to one upstream, or to replicas of it. Calls
+// go round-robin to the connections that are up and passing health checks,
+// and dropped connections are redialed.
+type Pool struct {
+	size           int
+	reconnectOpts  []jsonrpc.ReconnectOption
+	healthMethod   string
+	healthInterval time.Duration
+	healthTimeout  time.Duration
+
+	members []*member
+	next    uint32
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+type member struct {
+	client    *jsonrpc.ReconnectingClient
+	unhealthy int32
+}
+
+type PoolOption func(*Pool)
+
+// WithSize sets how many connections the pool keeps open. Defaults to 1.
+func WithSize(n int) PoolOption {
+	return func(p *Pool) {
+		p.size = n
+	}
+}
+
+// WithHealthCheck calls method on every connection each interval, taking the
+// connection out of rotation while calls fail or take longer than timeout.
+// An error response still counts as healthy, so the method need not exist.
+func WithHealthCheck(method string, interval, timeout time.Duration) PoolOption {
+	return func(p *Pool) {
+		p.healthMethod, p.healthInterval, p.healthTimeout = method, interval, timeout
+	}
+}
+
+// WithReconnectOptions sets the options for each connection, such as its
+// backoff and client options.
+func WithReconnectOptions(opts ...jsonrpc.ReconnectOption) PoolOption {
+	return func(p *Pool) {
+		p.reconnectOpts = append(p.reconnectOpts, opts...)
+	}
+}
+
+// NewPool opens the pool's connections with dial, failing if any of the
+// first dials do.
+func NewPool(ctx context.Context, dial jsonrpc.Dialer, opts ...PoolOption) (*Pool, error) {
+	p := &Pool{size: 1}
+	for _, opt := range opts {
+		opt(p)
+	}
+	for i := 0; i < p.size; i++ {
+		c, err := jsonrpc.NewReconnectingClient(ctx, dial, p.reconnectOpts...)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.members = append(p.members, &member{client: c})
+	}
+	var healthCtx context.Context
+	healthCtx, p.cancel = context.WithCancel(context.Background())
+	if p.healthMethod != "" {
+		for _, m := range p.members {
+			p.wg.Add(1)
+			go p.check(healthCtx, m)
+		}
+	}
+	return p, nil
+}
+
+// Call invokes method on the next available connection.
+func (p *Pool) Call(ctx context.Context, method string, params, result interface{}) error {
+	c := p.pick()
+	if c == nil {
+		return ErrNoUpstream
+	}
+	return c.Call(ctx, method, params, result)
+}
+
+// Notify sends a notification on the next available connection.
+func (p *Pool) Notify(ctx context.Context, method string, params interface{}) error {
+	c := p.pick()
+	if c == nil {
+		return ErrNoUpstream
+	}
+	return c.Notify(ctx, method, params)
+}
+
+// Available returns how many connections are taking calls.
+func (p *Pool) Available() int {
+	n := 0
+	for _, m := range p.members {
+		if m.available() != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Close stops health checks and closes every connection.
+func (p *Pool) Close() error {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.wg.Wait()
+	var firstErr error
+	for _, m := range p.members {
+		if err := m.client.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (p *Pool) pick() *jsonrpc.Client {
+	start := atomic.AddUint32(&p.next, 1)
+	for i := range p.members {
+		m := p.members[(int(start)+i)%len(p.members)]
+		if c := m.available(); c != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+func (p *Pool) check(ctx context.Context, m *member) {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.healthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		callCtx, cancel := context.WithTimeout(ctx, p.healthTimeout)
+		err := m.client.Client().Call(callCtx, p.healthMethod, nil, nil)
+		cancel()
+		var rpcErr *jsonrpc.Error
+		if err == nil || errors.As(err, &rpcErr) {
+			atomic.StoreInt32(&m.unhealthy, 0)
+		} else if ctx.Err() == nil {
+			atomic.StoreInt32(&m.unhealthy, 1)
+		}
+	}
+}
+
+// available returns the member's client if it is connected and healthy.
+func (m *member) available() *jsonrpc.Client {
+	if atomic.LoadInt32(&m.unhealthy) != 0 {
+		return nil
+	}
+	c := m.client.Client()
+	select {
+	case <-c.Conn().Done():
+		return nil
+	default:
+		return c
+	}
+}
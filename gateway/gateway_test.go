@@ -0,0 +1,119 @@
+package gateway_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jdxcode/jsonrpc"
+	"github.com/jdxcode/jsonrpc/gateway"
+	"github.com/jdxcode/jsonrpc/jsonrpctest"
+)
+
+var quiet = jsonrpc.WithLogger(jsonrpc.DiscardLogger)
+
+func dialer(s *jsonrpc.Server) jsonrpc.Dialer {
+	return func(ctx context.Context) (jsonrpc.Socket, error) {
+		a, b := jsonrpctest.NewPipe()
+		go s.Handle(context.Background(), b)
+		return a, nil
+	}
+}
+
+func upstream(t *testing.T, name string, opts ...gateway.PoolOption) *gateway.Pool {
+	s := jsonrpc.New(&struct{}{}, quiet)
+	s.Register(name+".whoami", func(ctx context.Context) (interface{}, error) {
+		return name, nil
+	})
+	opts = append(opts, gateway.WithReconnectOptions(jsonrpc.WithClientOptions(jsonrpc.WithClientLogger(jsonrpc.DiscardLogger))))
+	p, err := gateway.NewPool(context.Background(), dialer(s), opts...)
+	assert.NoError(t, err)
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func TestGateway(t *testing.T) {
+	assert := assert.New(t)
+	users, orders := upstream(t, "users", gateway.WithSize(3)), upstream(t, "orders")
+	g := gateway.New(gateway.Prefixes(map[string]*gateway.Pool{
+		"users.":  users,
+		"orders.": orders,
+	}), quiet)
+	c := jsonrpctest.NewClient(t, g)
+
+	var name string
+	for i := 0; i < 5; i++ {
+		c.MustCall("users.whoami", nil, &name)
+		assert.Equal("users", name)
+	}
+	c.MustCall("orders.whoami", nil, &name)
+	assert.Equal("orders", name)
+	c.CallError("orders.missing", nil, jsonrpc.CodeMethodNotFound)
+	c.CallError("billing.whoami", nil, jsonrpc.CodeMethodNotFound)
+	c.MustCall("rpc.discover", nil, nil)
+	assert.Equal(3, users.Available())
+}
+
+func TestGatewayHealthCheck(t *testing.T) {
+	assert := assert.New(t)
+	var sick int32
+	s := jsonrpc.New(&struct{}{}, quiet)
+	s.Register("health", func(ctx context.Context) error {
+		if atomic.LoadInt32(&sick) != 0 {
+			<-ctx.Done()
+		}
+		return nil
+	})
+	pool, err := gateway.NewPool(context.Background(), dialer(s), gateway.WithHealthCheck("health", 10*time.Millisecond, 10*time.Millisecond))
+	assert.NoError(err)
+	defer pool.Close()
+	c := jsonrpctest.NewClient(t, gateway.New(func(string) *gateway.Pool { return pool }, quiet))
+
+	c.MustCall("health", nil, nil)
+	atomic.StoreInt32(&sick, 1)
+	assert.Eventually(func() bool { return pool.Available() == 0 }, time.Second, 5*time.Millisecond)
+	c.CallError("health", nil, jsonrpc.CodeServerError)
+	atomic.StoreInt32(&sick, 0)
+	assert.Eventually(func() bool { return pool.Available() == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestGatewayAuth(t *testing.T) {
+	assert := assert.New(t)
+	var calls int32
+	s := jsonrpc.New(&struct{}{}, quiet)
+	s.Register("echo", func(ctx context.Context, p map[string]string) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return p["msg"], nil
+	})
+	s.Register("admin", func(ctx context.Context, p map[string]string) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	})
+	pool, err := gateway.NewPool(context.Background(), dialer(s))
+	assert.NoError(err)
+	defer pool.Close()
+	g := gateway.New(func(string) *gateway.Pool { return pool }, quiet, jsonrpc.WithAuth(
+		func(ctx context.Context, token string) (interface{}, error) {
+			if token != "secret" {
+				return nil, jsonrpc.ErrUnauthorized
+			}
+			return "alice", nil
+		},
+		jsonrpc.AuthParam("token"),
+		jsonrpc.AuthACL("admin", func(identity interface{}) bool { return false }),
+	))
+	c := jsonrpctest.NewClient(t, g)
+
+	c.CallError("echo", map[string]string{"msg": "hi"}, jsonrpc.CodeUnauthorized)
+	c.CallError("echo", map[string]string{"msg": "hi", "token": "wrong"}, jsonrpc.CodeUnauthorized)
+	c.CallError("admin", map[string]string{"token": "secret"}, jsonrpc.CodeForbidden)
+	assert.Equal(int32(0), atomic.LoadInt32(&calls))
+
+	var msg string
+	c.MustCall("echo", map[string]string{"msg": "hi", "token": "secret"}, &msg)
+	assert.Equal("hi", msg)
+	assert.Equal(int32(1), atomic.LoadInt32(&calls))
+}
@@ -1,8 +1,15 @@
 module github.com/jdxcode/jsonrpc
 
-go 1.13
+go 1.18
 
 require (
 	github.com/gorilla/websocket v1.4.1
-	github.com/stretchr/testify v1.4.0
+	github.com/stretchr/testify v1.10.0
+	golang.org/x/sys v0.22.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -2,8 +2,8 @@ package jsonrpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"sync"
 )
 
@@ -11,49 +11,434 @@ func (s *Server) Handle(ctx context.Context, sock Socket) {
 	var err error
 	var wg sync.WaitGroup
 
-	responses := make(chan *Response)
-	go writeResponses(sock, responses)
-	defer onClose(sock, responses, &wg)
+	responses := make(chan outgoing, s.sendQueueSize)
+	written := make(chan struct{})
 
-	ctx = setupContext(ctx, responses)
+	conn := newConn(nil, s.logger)
+	conn.pending.gen = s.idGenerator
+	conn.pending.useStore(s.pendingStore)
+	conn.closing = make(chan struct{})
+	defer conn.finish()
+	conn.send = func(ctx context.Context, msg interface{}) error {
+		select {
+		case <-conn.pending.done:
+			return conn.pending.closeErr()
+		default:
+		}
+		return s.enqueue(ctx, conn.pending.done, conn, responses, msg)
+	}
+	// responses are always sent, even once the connection stops reading
+	respond := func(msg interface{}) {
+		_ = s.enqueue(context.Background(), nil, conn, responses, msg)
+	}
+	conn.sock = sock
+	conn.queue = responses
+	conn.attachments, _ = sock.(AttachmentSocket)
+	conn.deadlines = s.deadlines
+	conn.methodRules = append([]methodRule(nil), s.gatedMethods...)
+	if s.connRate > 0 || s.connBurst > 0 {
+		conn.rateLimit = newTokenBucket(s.connRate, s.connBurst)
+	}
+	ctx = setupContext(ctx, conn)
+	readCtx, stopReading := context.WithCancel(ctx)
+	conn.stopReading = stopReading
+	conn.closeFn = stopReading
+	go func() {
+		defer close(written)
+		s.writeResponses(conn, sock, responses)
+	}()
+	if !s.track(conn) {
+		stopReading()
+		conn.teardown(&wg, written)
+		return
+	}
+	var connected bool
+	var readErr, disconnectErr error
+	defer func() {
+		if connected && s.onDisconnect != nil {
+			conn.mu.Lock()
+			if conn.abortErr != nil {
+				disconnectErr = conn.abortErr
+			}
+			conn.mu.Unlock()
+			s.onDisconnect(conn, disconnectErr)
+		}
+	}()
+	defer s.untrack(conn)
+	defer conn.teardown(&wg, written)
+	defer conn.shutdown(ErrConnClosed)
+	defer stopReading()
 
 	ctx, err = s.afterConnect(ctx)
+	if err == nil {
+		ctx, err = s.authenticateConn(ctx)
+	}
 	if err != nil {
-		responses <- newResponseNotification("error", err.Error())
+		respond(newResponseNotification("error", err.Error()))
 		return
 	}
+	connected = true
+	s.mu.Lock()
+	conn.connected = true
+	s.mu.Unlock()
+	if s.onConnect != nil {
+		s.onConnect(ctx, conn)
+	}
+	go s.heartbeat.run(readCtx, conn, func() { conn.abort(ErrHeartbeatTimeout) })
 
-	for req := range readRequests(ctx, sock) {
+	limiter := s.newLimiter()
+	notifications := s.newNotificationRunner()
+	defer notifications.close()
+	var queue *orderedQueue
+	if s.ordered {
+		queue = newOrderedQueue()
+		defer queue.close()
+	}
+	onError := func(kind ConnErrorKind, err error) { s.reportError(conn, kind, err) }
+	for msg := range readRequests(readCtx, s.logger, sock, &readErr, onError) {
+		if s.metrics != nil {
+			s.metrics.MessageRead(msg.size)
+		}
+		if s.onReceiveRaw != nil && msg.raw != nil {
+			s.onReceiveRaw(conn, msg.raw)
+		}
+		if s.maxRequestSize > 0 && msg.size > s.maxRequestSize {
+			if rsp := s.oversized(msg); rsp != nil {
+				respond(rsp)
+			}
+			if s.closeOversized {
+				disconnectErr = ErrRequestTooLarge
+				return
+			}
+			continue
+		}
+		for _, rsp := range msg.rsps {
+			conn.pending.resolve(rsp)
+		}
+		if len(msg.reqs) == 0 {
+			continue
+		}
+		if s.isCancelOnly(msg) {
+			if out := s.handleIncoming(ctx, msg); out != nil {
+				respond(out)
+			}
+			continue
+		}
+		if s.isNotificationOnly(msg) {
+			wg.Add(1)
+			notifications.run(func(msg *incoming) func() {
+				return func() {
+					defer wg.Done()
+					s.handleIncoming(ctx, msg)
+				}
+			}(msg))
+			continue
+		}
+		slots, err := limiter.acquire(readCtx, msg)
+		if err == errBusy {
+			if out := busyResponse(msg); out != nil {
+				respond(out)
+			}
+			continue
+		} else if err != nil {
+			// the server stopped reading
+			return
+		}
+		s.reserveTurns(msg)
+		var runQueue *orderedQueue
+		if queue != nil && !s.bypassesQueue(msg) {
+			runQueue = queue
+		}
 		wg.Add(1)
-		go func(req *Request) {
-			var err error
-			defer wg.Done()
-			defer handlePanic(req, responses)
+		barrier := notifications.barrier()
+		run := func(msg *incoming) func() {
+			return func() {
+				defer wg.Done()
+				if barrier != nil {
+					<-barrier
+				}
+				if limiter.wait(readCtx, msg, slots) != nil {
+					return
+				}
+				y := newYielder(conn, limiter, msg, slots, runQueue)
+				out := s.handleIncoming(y.context(ctx), msg)
+				// free the slot before the client can see the response
+				if y != nil {
+					y.release()
+				}
+				if out != nil {
+					respond(out)
+					conn.activateSubscriptions(out)
+				}
+			}
+		}(msg)
+		if runQueue != nil {
+			queue.push(run)
+		} else {
+			go run()
+		}
+	}
+	disconnectErr = readErr
+	if readErr != nil {
+		// the peer is gone, so stop the handlers, notifications included
+		conn.abandon(s.onAbandoned)
+		conn.cancel()
+	}
+}
 
-			method := s.methods[req.Method]
-			if method == nil {
-				responses <- handleNotFound(req)
-				return
+// handleIncoming dispatches the requests in msg and returns what should be
+// written back: a *Response, a []*Response for batches, or nil.
+func (s *Server) handleIncoming(ctx context.Context, msg *incoming) interface{} {
+	if !msg.batch {
+		if rsp := s.handleRequest(ctx, msg.reqs[0]); rsp != nil {
+			return rsp
+		}
+		return nil
+	}
+	if rsps := s.handleBatch(ctx, msg.reqs); len(rsps) > 0 {
+		return rsps
+	}
+	return nil
+}
+
+// handleBatch dispatches the requests in a batch concurrently, up to the
+// concurrency limit, or sequentially with ordered execution, and collects the
+// responses. Requests that produce no
+// response are omitted, so the result is empty when nothing needs to be sent
+// back.
+func (s *Server) handleBatch(ctx context.Context, reqs []*Request) []*Response {
+	if s.ordered {
+		var rsps []*Response
+		for _, req := range reqs {
+			if rsp := s.handleRequest(ctx, req); rsp != nil {
+				rsps = append(rsps, rsp)
 			}
-			params, err := convertParams(method, req)
-			if err != nil {
-				responses <- newResponseError(req.ID, err.Error())
+		}
+		return rsps
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, len(reqs))
+	if s.concurrency > 0 && s.concurrency < len(reqs) {
+		sem = make(chan struct{}, s.concurrency)
+	}
+	rsps := make([]*Response, len(reqs))
+	for i, req := range reqs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, req *Request) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			rsps[i] = s.handleRequest(ctx, req)
+		}(i, req)
+	}
+	wg.Wait()
+
+	out := rsps[:0]
+	for _, rsp := range rsps {
+		if rsp != nil {
+			out = append(out, rsp)
+		}
+	}
+	return out
+}
+
+// handleRequest dispatches a single request. It returns nil when no response
+// should be sent, which is the case for every valid notification.
+func (s *Server) handleRequest(ctx context.Context, req *Request) *Response {
+	if t := s.takeTurn(req); t != nil {
+		defer t.release()
+	}
+	ack, err := s.logRequest(req)
+	if err != nil {
+		return newResponseError(req.ID, ErrInternal.WithMessage("request log unavailable"))
+	}
+	rsp := s.processRequest(ctx, req)
+	if rsp != nil && s.onResponse != nil {
+		rsp = s.onResponse(ctx, req, rsp)
+	}
+	if ack != nil {
+		if rsp == nil {
+			ack()
+		} else {
+			// copied, as the response may be shared with the idempotency cache
+			acked := *rsp
+			acked.written = ack
+			rsp = &acked
+		}
+	}
+	return rsp
+}
+
+func (s *Server) processRequest(ctx context.Context, req *Request) *Response {
+	if req.err == nil && s.strict {
+		req.err = checkStrict(req)
+	}
+	if req.err != nil {
+		return newResponseError(req.ID, requestError(req.err))
+	}
+	if s.isCancel(req) {
+		rsp := s.handleCancel(ctx, req)
+		if req.IsNotification() {
+			return nil
+		}
+		return rsp
+	}
+	if s.isUnsubscribe(req) {
+		rsp := s.handleUnsubscribe(ctx, req)
+		if req.IsNotification() {
+			return nil
+		}
+		return rsp
+	}
+	if req.IsNotification() {
+		if rsp := s.dispatchOnce(ctxWithNotification(ctx), req); rsp != nil && rsp.Error != nil {
+			s.logger.Log(LevelInfo, "notification error", "method", req.Method, "code", rsp.Error.Code,
+				"message", rsp.Error.Message)
+		}
+		return nil
+	}
+	conn := ConnFromContext(ctx)
+	if conn == nil {
+		return s.dispatchOnce(ctx, req)
+	}
+	ctx, done := conn.startRequest(ctx, req)
+	ctx = s.ctxWithProgress(ctx, conn, req)
+	ctx = s.ctxWithSubscriber(ctx, conn, req)
+	rsp := s.dispatchOnce(ctx, req)
+	if cancelled, abandoned := done(); abandoned {
+		// nobody is left to read the response
+		return nil
+	} else if cancelled {
+		return newResponseError(req.ID, ErrRequestCancelled)
+	}
+	return rsp
+}
+
+// dispatchOnce admits req and dispatches it unless it is a retransmission,
+// see WithIdempotency.
+func (s *Server) dispatchOnce(ctx context.Context, req *Request) *Response {
+	ctx, err := s.admit(ctx, req)
+	if err != nil {
+		return newResponseError(req.ID, s.toError(err))
+	}
+	if s.idempotency == nil || req.IsNotification() {
+		return s.dispatch(ctx, req)
+	}
+	return s.idempotency.do(idempotencyKey(ctx, req), req, func() *Response {
+		return s.dispatch(ctx, req)
+	})
+}
+
+func (s *Server) dispatch(ctx context.Context, req *Request) *Response {
+	d := s.deadlineFor(req)
+	if d < 0 {
+		s.logger.Log(LevelInfo, "deadline passed", "id", req.ID, "method", req.Method)
+		return newResponseError(req.ID, ErrRequestTimeout)
+	}
+	if d > 0 {
+		return s.dispatchWithTimeout(ctx, req, d)
+	}
+	return s.dispatchHandler(ctx, req)
+}
+
+func (s *Server) dispatchHandler(ctx context.Context, req *Request) (rsp *Response) {
+	req, notice := s.resolveMethod(req)
+	if notice != "" && s.deprecationNotices {
+		defer func() {
+			if rsp != nil {
+				rsp.Deprecated = notice
 			}
-			log.Printf("req: %d %s %+v", req.ID, req.Method, params)
+		}()
+	}
+	defer s.handlePanic(ctx, req, &rsp)
 
-			ctx, err = s.beforeRequest(ctx, req.Method, params)
-			if err != nil {
-				responses <- newResponseError(req.ID, err.Error())
-				return
+	if conn := ConnFromContext(ctx); conn != nil && !conn.MethodEnabled(req.Method) {
+		return handleNotFound(req)
+	}
+
+	release, err := s.waitTurn(ctx, req)
+	if err != nil {
+		return newResponseError(req.ID, s.toError(err))
+	}
+	defer release()
+
+	ctx = ctxWithRequest(ctx, req)
+	rsp, err = s.measure(req, func() (*Response, error) {
+		return s.handler(ctx, req)
+	})
+	if err != nil {
+		return newResponseError(req.ID, s.toError(err))
+	}
+	if rsp == nil {
+		return newResponse(req.ID, nil)
+	}
+	return rsp
+}
+
+// admit authorizes req and applies the rate limits, before anything can
+// answer it: the idempotency cache and the interceptors as well as the
+// handler.
+func (s *Server) admit(ctx context.Context, req *Request) (context.Context, error) {
+	resolved := s.resolve(req)
+	ctx, err := s.authorize(ctx, resolved)
+	if err != nil {
+		return ctx, err
+	}
+	return ctx, s.checkRateLimit(ctx, resolved)
+}
+
+// invoke is the innermost Handler, wrapped by the interceptors.
+func (s *Server) invoke(ctx context.Context, req *Request) (rsp *Response, err error) {
+	defer s.recoverPanic(ctx, req, &err)
+
+	method := s.method(req.Method)
+	if method != nil && method.notification && !IsNotification(ctx) {
+		err := ErrInvalidRequest.WithMessage(fmt.Sprintf("%s only takes notifications", req.Method))
+		return newResponseError(req.ID, err), nil
+	}
+	if method == nil {
+		if sub, name := s.lookupMount(req.Method); sub != nil {
+			subReq := *req
+			subReq.Method = name
+			if ctx, err = sub.admit(ctx, &subReq); err != nil {
+				return nil, err
 			}
+			return sub.handler(ctx, &subReq)
+		}
+		if s.fallback != nil {
+			return s.fallback(ctx, req)
+		}
+		return handleNotFound(req), nil
+	}
+	params, err := method.parse(req.Params, s.decodeOptionsFor(req.Method))
+	if err == nil {
+		err = s.validate(params)
+	}
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) || rpcErr.Code != CodeInvalidParams {
+			rpcErr = ErrInvalidParams.WithMessage(err.Error())
+		}
+		return newResponseError(req.ID, rpcErr), nil
+	}
+	s.logger.Log(LevelDebug, "req", "id", req.ID, "method", req.Method)
 
-			responses <- callMethod(ctx, s.rcvr, method, req, params)
-		}(req)
+	ctx, err = s.beforeRequest(ctx, req.Method, params)
+	if err != nil {
+		return nil, err
 	}
+
+	result, err := method.call(ctx, params)
+	if err == nil {
+		result, err = s.limitResult(req.Method, result)
+	}
+	if err != nil {
+		return newResponseError(req.ID, s.toError(err)), nil
+	}
+	return newResponse(req.ID, result), nil
 }
 
 func handleNotFound(req *Request) *Response {
-	rsp := newResponseError(req.ID, fmt.Errorf("method not found: %s", req.Method).Error())
-	log.Printf("rsp error: %s", rsp.Error)
-	return rsp
+	return newResponseError(req.ID, ErrMethodNotFound.WithMessage(fmt.Sprintf("method not found: %s", req.Method)))
 }
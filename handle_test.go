@@ -2,13 +2,23 @@ package jsonrpc_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/jdxcode/jsonrpc"
+	"github.com/jdxcode/jsonrpc/jsonrpctest"
 )
 
 var rpc = jsonrpc.New(&TestRPC{})
@@ -19,9 +29,9 @@ func TestHandleString(t *testing.T) {
 	go func() {
 		defer close(sock.requests)
 		params := jsonrpc.ParamsRaw("\"test-abc\"")
-		sock.requests <- &jsonrpc.Request{ID: 101, Method: "Foo", Params: &params}
+		sock.requests <- &jsonrpc.Request{ID: id(101), Method: "Foo", Params: &params}
 		rsp := <-sock.responses
-		assert.Equal(jsonrpc.ID(101), rsp.ID)
+		assert.Equal(id(101), rsp.ID)
 		assert.Equal(123, rsp.Result)
 		assert.Empty(rsp.Error)
 	}()
@@ -34,9 +44,9 @@ func TestHandleStruct(t *testing.T) {
 	go func() {
 		defer close(sock.requests)
 		params := jsonrpc.ParamsRaw("{\"foo\": \"test-abc\"}")
-		sock.requests <- &jsonrpc.Request{ID: 102, Method: "FooStruct", Params: &params}
+		sock.requests <- &jsonrpc.Request{ID: id(102), Method: "FooStruct", Params: &params}
 		rsp := <-sock.responses
-		assert.Equal(jsonrpc.ID(102), rsp.ID)
+		assert.Equal(id(102), rsp.ID)
 		result := rsp.Result.(*FooStructResult)
 		assert.Equal("test-abc", result.Bar)
 		assert.Empty(rsp.Error)
@@ -44,31 +54,1080 @@ func TestHandleStruct(t *testing.T) {
 	rpc.Handle(ctx, sock)
 }
 
+func TestDecodeOptions(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&TestRPC{},
+		jsonrpc.WithDecodeOptions(jsonrpc.DecodeOptions{DisallowUnknownFields: true}),
+		jsonrpc.WithMethodDecodeOptions("amount", jsonrpc.DecodeOptions{UseNumber: true}),
+	)
+	assert.NoError(rpc.Register("amount", func(ctx context.Context, p map[string]interface{}) (interface{}, error) {
+		return fmt.Sprintf("%T %v", p["n"], p["n"]), nil
+	}))
+	c := jsonrpctest.NewClient(t, rpc)
+
+	c.MustCall("FooStruct", map[string]string{"foo": "x"}, nil)
+	err := c.CallError("FooStruct", map[string]string{"foo": "x", "extra": "y"}, jsonrpc.CodeInvalidParams)
+	assert.Contains(err.Message, `unknown field "extra"`)
+
+	var result string
+	c.MustCall("amount", json.RawMessage(`{"n": 9007199254740993}`), &result)
+	assert.Equal("json.Number 9007199254740993", result)
+}
+
+type pageParams struct {
+	Query  string `json:"query"`
+	Limit  int    `json:"limit" default:"10"`
+	Order  string `json:"order" default:"asc"`
+	Strict bool   `json:"strict,omitempty"`
+	Filter struct {
+		Owner string `json:"owner"`
+		Min   int    `json:"min,omitempty"`
+	} `json:"filter"`
+}
+
+func TestDecodeDefaults(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&struct{}{}, jsonrpc.WithDecodeOptions(jsonrpc.DecodeOptions{
+		Defaults: true, CoerceStrings: true, RequireFields: true,
+	}))
+	assert.NoError(rpc.Register("search", func(ctx context.Context, p *pageParams) (*pageParams, error) { return p, nil }))
+	assert.NoError(rpc.Register("scale", func(ctx context.Context, n float64, up bool) (float64, error) {
+		if up {
+			return n * 2, nil
+		}
+		return n, nil
+	}))
+	c := jsonrpctest.NewClient(t, rpc)
+
+	var p pageParams
+	c.MustCall("search", json.RawMessage(`{"query":"go","strict":"true","filter":{"owner":"me","min":"3"}}`), &p)
+	assert.Equal(10, p.Limit)
+	assert.Equal("asc", p.Order)
+	assert.True(p.Strict)
+	assert.Equal(3, p.Filter.Min)
+	c.MustCall("search", json.RawMessage(`{"query":"go","limit":"25","filter":{"owner":"me"}}`), &p)
+	assert.Equal(25, p.Limit)
+	// members match fields ignoring case, as encoding/json does
+	p = pageParams{}
+	c.MustCall("search", json.RawMessage(`{"Query":"go","Limit":"25","FILTER":{"Owner":"me","MIN":"2"}}`), &p)
+	assert.Equal("go", p.Query)
+	assert.Equal(25, p.Limit)
+	assert.Equal(2, p.Filter.Min)
+
+	err := c.CallError("search", json.RawMessage(`{"filter":{}}`), jsonrpc.CodeInvalidParams)
+	assert.Equal("missing params: query, filter.owner", err.Message)
+	assert.Equal(map[string]interface{}{"missing": []interface{}{"query", "filter.owner"}}, err.Data)
+	c.CallError("search", json.RawMessage(`{"query":"go","limit":"ten","filter":{"owner":"me"}}`), jsonrpc.CodeInvalidParams)
+
+	var n float64
+	c.MustCall("scale", []string{"1.5", "true"}, &n)
+	assert.Equal(3.0, n)
+
+	schema := jsonrpc.SchemaOf(reflect.TypeOf(pageParams{}))
+	assert.Equal(10.0, schema["properties"].(jsonrpc.Schema)["limit"].(jsonrpc.Schema)["default"])
+	assert.Equal([]string{"query", "filter"}, schema["required"])
+	var required []string
+	for _, m := range rpc.OpenRPC().Methods {
+		for _, param := range m.Params {
+			if m.Name == "search" && param.Required {
+				required = append(required, param.Name)
+			}
+		}
+	}
+	assert.Equal([]string{"query", "filter"}, required)
+
+	// fields with a default aren't required even when it isn't applied
+	rpc = jsonrpc.New(&struct{}{}, jsonrpc.WithDecodeOptions(jsonrpc.DecodeOptions{RequireFields: true}))
+	assert.NoError(rpc.Register("search", func(ctx context.Context, p *pageParams) (*pageParams, error) { return p, nil }))
+	c = jsonrpctest.NewClient(t, rpc)
+	p = pageParams{}
+	c.MustCall("search", json.RawMessage(`{"query":"go","filter":{"owner":"me"}}`), &p)
+	assert.Equal(0, p.Limit)
+	err = c.CallError("search", json.RawMessage(`{"filter":{}}`), jsonrpc.CodeInvalidParams)
+	assert.Equal("missing params: query, filter.owner", err.Message)
+}
+
+func TestHandleValidate(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&TestRPC{}, jsonrpc.WithValidator(func(params interface{}) error {
+		if p, ok := params.(*FooStructParams); ok && p.Foo == "bad" {
+			return errors.New("foo is bad")
+		}
+		return nil
+	}))
+	sock := newFakeSocket()
+	go func() {
+		defer close(sock.requests)
+		params := jsonrpc.ParamsRaw("{}")
+		sock.requests <- &jsonrpc.Request{ID: id(101), Method: "FooStruct", Params: &params}
+		rsp := <-sock.responses
+		assert.Equal(jsonrpc.CodeInvalidParams, rsp.Error.Code)
+		assert.Equal("foo is required", rsp.Error.Message)
+
+		params = jsonrpc.ParamsRaw("{\"foo\": \"bad\"}")
+		sock.requests <- &jsonrpc.Request{ID: id(102), Method: "FooStruct", Params: &params}
+		rsp = <-sock.responses
+		assert.Equal(jsonrpc.CodeInvalidParams, rsp.Error.Code)
+		assert.Equal("foo is bad", rsp.Error.Message)
+	}()
+	rpc.Handle(ctx, sock)
+}
+
+func TestHandlePositional(t *testing.T) {
+	assert := assert.New(t)
+	sock := newFakeSocket()
+	go func() {
+		defer close(sock.requests)
+		params := jsonrpc.ParamsRaw(`[2, "x", {"foo": "y"}]`)
+		sock.requests <- &jsonrpc.Request{ID: id(101), Method: "FooPositional", Params: &params}
+		rsp := <-sock.responses
+		assert.Equal("xxy", rsp.Result)
+
+		params = jsonrpc.ParamsRaw(`[1]`)
+		sock.requests <- &jsonrpc.Request{ID: id(102), Method: "FooPositional", Params: &params}
+		rsp = <-sock.responses
+		assert.Equal("", rsp.Result)
+
+		params = jsonrpc.ParamsRaw(`[1, "x", {}, 4]`)
+		sock.requests <- &jsonrpc.Request{ID: id(103), Method: "FooPositional", Params: &params}
+		rsp = <-sock.responses
+		assert.Equal(jsonrpc.CodeInvalidParams, rsp.Error.Code)
+
+		params = jsonrpc.ParamsRaw(`{"n": 1}`)
+		sock.requests <- &jsonrpc.Request{ID: id(104), Method: "FooPositional", Params: &params}
+		rsp = <-sock.responses
+		assert.Equal(jsonrpc.CodeInvalidParams, rsp.Error.Code)
+	}()
+	rpc.Handle(ctx, sock)
+}
+
 func TestHandleErr(t *testing.T) {
 	assert := assert.New(t)
 	sock := newFakeSocket()
 	go func() {
 		defer close(sock.requests)
 		params := jsonrpc.ParamsRaw("\"test-abc\"")
-		sock.requests <- &jsonrpc.Request{ID: 102, Method: "FooErr", Params: &params}
+		sock.requests <- &jsonrpc.Request{ID: id(102), Method: "FooErr", Params: &params}
+		rsp := <-sock.responses
+		assert.Equal(id(102), rsp.ID)
+		assert.Nil(rsp.Result)
+		assert.Equal("uh oh", rsp.Error.Message)
+	}()
+	rpc.Handle(ctx, sock)
+}
+
+func TestHandleCodedErr(t *testing.T) {
+	assert := assert.New(t)
+	sock := newFakeSocket()
+	go func() {
+		defer close(sock.requests)
+		params := jsonrpc.ParamsRaw("\"test-abc\"")
+		sock.requests <- &jsonrpc.Request{ID: id(103), Method: "FooCodedErr", Params: &params}
 		rsp := <-sock.responses
-		assert.Equal(jsonrpc.ID(102), rsp.ID)
+		assert.Equal(id(103), rsp.ID)
 		assert.Nil(rsp.Result)
-		assert.Equal("uh oh", rsp.Error)
+		assert.Equal(4001, rsp.Error.Code)
+		assert.Equal("nope", rsp.Error.Message)
+		assert.Equal("test-abc", rsp.Error.Data)
 	}()
 	rpc.Handle(ctx, sock)
 }
 
+func TestHandleErrorData(t *testing.T) {
+	assert := assert.New(t)
+	sock := newFakeSocket()
+	go func() {
+		defer close(sock.requests)
+		params := jsonrpc.ParamsRaw(`{"foo":""}`)
+		sock.requests <- &jsonrpc.Request{ID: id(104), Method: "FooFieldErr", Params: &params}
+		rsp := <-sock.responses
+		assert.Equal(4220, rsp.Error.Code)
+		assert.Equal("invalid: foo", rsp.Error.Message)
+		assert.Equal(map[string]string{"foo": "required"}, rsp.Error.Data)
+	}()
+	rpc.Handle(ctx, sock)
+}
+
+func TestErrorMapper(t *testing.T) {
+	assert := assert.New(t)
+	errNotFound := errors.New("no rows")
+	rpc := jsonrpc.New(&struct{}{}, jsonrpc.WithErrorMapper(func(err error) *jsonrpc.Error {
+		if errors.Is(err, errNotFound) {
+			return jsonrpc.NewError(404, "not found")
+		}
+		return nil
+	}))
+	assert.NoError(rpc.Register("get", func(ctx context.Context, p string) (string, error) {
+		if p == "missing" {
+			return "", fmt.Errorf("get %s: %w", p, errNotFound)
+		}
+		return "", errors.New("boom")
+	}))
+	c := jsonrpctest.NewClient(t, rpc)
+
+	err := c.CallError("get", "missing", 404)
+	assert.Equal("not found", err.Message)
+	err = c.CallError("get", "other", jsonrpc.CodeServerError)
+	assert.Equal("boom", err.Message)
+}
+
 func TestHandlePanic(t *testing.T) {
 	assert := assert.New(t)
 	sock := newFakeSocket()
 	go func() {
 		defer close(sock.requests)
-		sock.requests <- &jsonrpc.Request{ID: 102, Method: "FooPanic"}
+		sock.requests <- &jsonrpc.Request{ID: id(102), Method: "FooPanic"}
 		rsp := <-sock.responses
-		assert.Equal(jsonrpc.ID(102), rsp.ID)
+		assert.Equal(id(102), rsp.ID)
 		assert.Nil(rsp.Result)
-		assert.Equal("uh oh", rsp.Error)
+		assert.Equal("uh oh", rsp.Error.Message)
+	}()
+	rpc.Handle(ctx, sock)
+}
+
+func TestHandlePanicProduction(t *testing.T) {
+	assert := assert.New(t)
+	var recovered interface{}
+	rpc := jsonrpc.New(&TestRPC{},
+		jsonrpc.WithLogger(jsonrpc.DiscardLogger),
+		jsonrpc.WithProductionMode(),
+		jsonrpc.WithPanicHandler(func(ctx context.Context, req *jsonrpc.Request, value interface{}, stack []byte) {
+			recovered = value
+			assert.NotEmpty(stack)
+		}))
+	sock := newFakeSocket()
+	go func() {
+		defer close(sock.requests)
+		sock.requests <- &jsonrpc.Request{ID: id(102), Method: "FooPanic"}
+		rsp := <-sock.responses
+		assert.Equal(jsonrpc.CodeInternalError, rsp.Error.Code)
+		assert.Equal("internal error", rsp.Error.Message)
+		assert.Equal("uh oh", recovered)
+	}()
+	rpc.Handle(ctx, sock)
+}
+
+type panicMetrics struct {
+	panics []string
+}
+
+func (m *panicMetrics) RequestStarted(method string)                                    {}
+func (m *panicMetrics) RequestFinished(method string, duration time.Duration, code int) {}
+func (m *panicMetrics) MessageRead(bytes int)                                           {}
+func (m *panicMetrics) MessageWritten(bytes int)                                        {}
+func (m *panicMetrics) Panic(method string)                                             { m.panics = append(m.panics, method) }
+
+func TestInterceptorPanic(t *testing.T) {
+	assert := assert.New(t)
+	metrics := &panicMetrics{}
+	var logged []string
+	rpc := jsonrpc.New(&TestRPC{},
+		jsonrpc.WithMetrics(metrics),
+		jsonrpc.WithLogger(jsonrpc.LoggerFunc(func(level jsonrpc.Level, msg string, keyvals ...interface{}) {
+			logged = append(logged, msg)
+		})),
+		jsonrpc.WithPanicHandler(func(ctx context.Context, req *jsonrpc.Request, value interface{}, stack []byte) {
+			panic("reporter down")
+		}))
+	rpc.Use(func(ctx context.Context, req *jsonrpc.Request, next jsonrpc.Handler) (*jsonrpc.Response, error) {
+		panic("in interceptor")
+	})
+	c := jsonrpctest.NewClient(t, rpc)
+	err := c.CallError("Foo", "abc", jsonrpc.CodeInternalError)
+	assert.Equal("in interceptor", err.Message)
+	assert.NotContains(fmt.Sprint(err.Data), "goroutine")
+	assert.Equal([]string{"Foo"}, metrics.panics)
+	assert.Contains(logged, "panic")
+	assert.Contains(logged, "panic handler panicked")
+}
+
+func TestRegister(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&TestRPC{})
+	jsonrpc.Register(rpc, "Add", func(ctx context.Context, params [2]int) (int, error) {
+		return params[0] + params[1], nil
+	})
+	jsonrpc.Register(rpc, "Fail", func(ctx context.Context, params *FooStructParams) (*FooStructResult, error) {
+		return nil, jsonrpc.ErrInvalidParams.WithMessage(params.Foo)
+	})
+	sock := newFakeSocket()
+	go func() {
+		defer close(sock.requests)
+		params := jsonrpc.ParamsRaw("[1, 2]")
+		sock.requests <- &jsonrpc.Request{ID: id(101), Method: "Add", Params: &params}
+		rsp := <-sock.responses
+		assert.Equal(id(101), rsp.ID)
+		assert.Equal(3, rsp.Result)
+
+		params = jsonrpc.ParamsRaw("\"x\"")
+		sock.requests <- &jsonrpc.Request{ID: id(102), Method: "Add", Params: &params}
+		rsp = <-sock.responses
+		assert.Equal(jsonrpc.CodeInvalidParams, rsp.Error.Code)
+
+		params = jsonrpc.ParamsRaw("{\"foo\": \"bad\"}")
+		sock.requests <- &jsonrpc.Request{ID: id(103), Method: "Fail", Params: &params}
+		rsp = <-sock.responses
+		assert.Equal(jsonrpc.CodeInvalidParams, rsp.Error.Code)
+		assert.Equal("bad", rsp.Error.Message)
+	}()
+	rpc.Handle(ctx, sock)
+}
+
+type UsersService struct{}
+
+func (UsersService) Get(ctx context.Context, id int) (string, error) {
+	return fmt.Sprint("user ", id), nil
+}
+
+type AdminService struct{}
+
+func (AdminService) Get(ctx context.Context) (string, error) { return "admin", nil }
+
+func TestRegisterService(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&struct{}{})
+	assert.NoError(rpc.RegisterService("users", "users.", UsersService{}))
+	assert.NoError(rpc.RegisterService("admin", "admin.", AdminService{}))
+	err := rpc.RegisterService("more-users", "users.", UsersService{})
+	assert.EqualError(err, "jsonrpc: service more-users: method users.Get is already registered by service users")
+	assert.Equal(map[string][]string{"users": {"users.Get"}, "admin": {"admin.Get"}}, rpc.Services())
+
+	c := jsonrpctest.NewClient(t, rpc)
+	var result string
+	c.MustCall("users.Get", 7, &result)
+	assert.Equal("user 7", result)
+	c.MustCall("admin.Get", nil, &result)
+	assert.Equal("admin", result)
+}
+
+func TestAlias(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&TestRPC{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger),
+		jsonrpc.WithAlias("foo/bar", "Foo"),
+		jsonrpc.WithDeprecated("foo/bar", "use Foo"),
+		jsonrpc.WithDeprecationNotices(),
+	)
+	sock := newFakeSocket()
+	go func() {
+		defer close(sock.requests)
+		params := jsonrpc.ParamsRaw(`"test-abc"`)
+		sock.requests <- &jsonrpc.Request{ID: id(1), Method: "foo/bar", Params: &params}
+		rsp := <-sock.responses
+		assert.Equal(123, rsp.Result)
+		assert.Equal("use Foo", rsp.Deprecated)
+
+		sock.requests <- &jsonrpc.Request{ID: id(2), Method: "Foo", Params: &params}
+		rsp = <-sock.responses
+		assert.Equal(123, rsp.Result)
+		assert.Empty(rsp.Deprecated)
+	}()
+	rpc.Handle(ctx, sock)
+}
+
+type namedRPC struct {
+	Hover  func(ctx context.Context, word string) (string, error) `rpc:"textDocument/hover"`
+	Helper func(ctx context.Context) error
+}
+
+func (namedRPC) GetUserByID(ctx context.Context, id int) (int, error) { return id, nil }
+func (namedRPC) Workspace_Symbol(ctx context.Context) (string, error) { return "sym", nil }
+func (namedRPC) Internal(ctx context.Context) error                   { return nil }
+
+func TestNaming(t *testing.T) {
+	assert := assert.New(t)
+	rcvr := namedRPC{
+		Hover:  func(ctx context.Context, word string) (string, error) { return "docs for " + word, nil },
+		Helper: func(ctx context.Context) error { return nil },
+	}
+	rpc := jsonrpc.New(rcvr, jsonrpc.WithNaming(jsonrpc.SlashCase), jsonrpc.WithHiddenMethods("Internal"),
+		jsonrpc.WithMethodName("GetUserByID", "users/get"))
+	c := jsonrpctest.NewClient(t, rpc)
+	var s string
+	c.MustCall("textDocument/hover", "go", &s)
+	assert.Equal("docs for go", s)
+	c.MustCall("workspace/symbol", nil, &s)
+	assert.Equal("sym", s)
+	var n int
+	c.MustCall("users/get", 7, &n)
+	assert.Equal(7, n)
+	for _, method := range []string{"Internal", "internal", "Helper", "GetUserByID", "Workspace_Symbol"} {
+		c.CallError(method, nil, jsonrpc.CodeMethodNotFound)
+	}
+
+	assert.Equal("getUserByID", jsonrpc.CamelCase("GetUserByID"))
+	assert.Equal("httpStatus", jsonrpc.CamelCase("HTTPStatus"))
+	assert.Equal("get_user_by_id", jsonrpc.SnakeCase("GetUserByID"))
+	assert.Equal("http_server", jsonrpc.SnakeCase("HTTPServer"))
+}
+
+func TestMount(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&TestRPC{})
+	rpc.Group("workspace", &TestRPC{})
+	eth := jsonrpc.New(&struct{}{})
+	jsonrpc.Register(eth, "getBalance", func(ctx context.Context, params []string) (int, error) {
+		return len(params), nil
+	})
+	rpc.Mount("eth_", eth)
+	sock := newFakeSocket()
+	go func() {
+		defer close(sock.requests)
+		params := jsonrpc.ParamsRaw("\"test-abc\"")
+		sock.requests <- &jsonrpc.Request{ID: id(101), Method: "workspace/Foo", Params: &params}
+		rsp := <-sock.responses
+		assert.Equal(123, rsp.Result)
+
+		params = jsonrpc.ParamsRaw("[\"a\", \"b\"]")
+		sock.requests <- &jsonrpc.Request{ID: id(102), Method: "eth_getBalance", Params: &params}
+		rsp = <-sock.responses
+		assert.Equal(id(102), rsp.ID)
+		assert.Equal(2, rsp.Result)
+
+		sock.requests <- &jsonrpc.Request{ID: id(103), Method: "eth_missing"}
+		rsp = <-sock.responses
+		assert.Equal(jsonrpc.CodeMethodNotFound, rsp.Error.Code)
+	}()
+	rpc.Handle(ctx, sock)
+}
+
+func TestRegisterFunc(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&struct{}{})
+	prefix := "hello "
+	assert.NoError(rpc.Register("greet", func(ctx context.Context, name string) (string, error) {
+		return prefix + name, nil
+	}))
+	assert.NoError(rpc.RegisterMap(map[string]interface{}{
+		"add":  func(ctx context.Context, a, b int) (int, error) { return a + b, nil },
+		"ping": func(ctx context.Context) error { return nil },
+	}))
+	assert.Error(rpc.Register("bad", func(name string) string { return name }))
+	assert.Error(rpc.Register("bad", 5))
+	assert.Error(rpc.RegisterMap(map[string]interface{}{"bad": func(ctx context.Context) (int, int) { return 0, 0 }}))
+
+	sock := newFakeSocket()
+	go func() {
+		defer close(sock.requests)
+		params := jsonrpc.ParamsRaw(`"abc"`)
+		sock.requests <- &jsonrpc.Request{ID: id(101), Method: "greet", Params: &params}
+		rsp := <-sock.responses
+		assert.Equal("hello abc", rsp.Result)
+
+		params = jsonrpc.ParamsRaw(`[1, 2]`)
+		sock.requests <- &jsonrpc.Request{ID: id(102), Method: "add", Params: &params}
+		rsp = <-sock.responses
+		assert.Equal(3, rsp.Result)
+
+		sock.requests <- &jsonrpc.Request{ID: id(103), Method: "ping"}
+		rsp = <-sock.responses
+		assert.Nil(rsp.Error)
+
+		sock.requests <- &jsonrpc.Request{ID: id(104), Method: "bad"}
+		rsp = <-sock.responses
+		assert.Equal(jsonrpc.CodeMethodNotFound, rsp.Error.Code)
+	}()
+	rpc.Handle(ctx, sock)
+}
+
+func TestRegisterWhileServing(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&struct{}{})
+	assert.NoError(rpc.Register("version", func(ctx context.Context) (int, error) { return 1, nil }))
+	c := jsonrpctest.NewClient(t, rpc)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				var v int
+				assert.NoError(c.Call("version", nil, &v))
+				assert.Contains([]int{1, 2}, v)
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		assert.NoError(rpc.Register("version", func(ctx context.Context) (int, error) { return 2, nil }))
+		jsonrpc.Register(rpc, "other", func(ctx context.Context, p string) (string, error) { return p, nil })
+		assert.True(rpc.Unregister("other"))
+	}
+	wg.Wait()
+
+	assert.False(rpc.Unregister("other"))
+	assert.True(rpc.Unregister("version"))
+	c.CallError("version", nil, jsonrpc.CodeMethodNotFound)
+}
+
+func TestRequestFromContext(t *testing.T) {
+	assert := assert.New(t)
+	sub := jsonrpc.New(&struct{}{})
+	assert.NoError(sub.Register("whoami", func(ctx context.Context, params map[string]int) (string, error) {
+		req := jsonrpc.RequestFromContext(ctx)
+		return fmt.Sprintf("%s %s %s", req.Method, req.ID, *req.Params), nil
+	}))
+	rpc := jsonrpc.New(&struct{}{})
+	rpc.Mount("sub/", sub)
+	sock := newFakeSocket()
+	go func() {
+		defer close(sock.requests)
+		params := jsonrpc.ParamsRaw(`{"a":1}`)
+		sock.requests <- &jsonrpc.Request{ID: id(7), Method: "sub/whoami", Params: &params}
+		assert.Equal(`sub/whoami 7 {"a":1}`, (<-sock.responses).Result)
+	}()
+	rpc.Handle(ctx, sock)
+}
+
+type greeter struct{ prefix string }
+
+func TestProvider(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&struct{}{}, jsonrpc.WithProvider(func(ctx context.Context) (*greeter, error) {
+		if jsonrpc.RequestFromContext(ctx).Method == "denied" {
+			return nil, errors.New("no greeter")
+		}
+		return &greeter{"hello"}, nil
+	}))
+	greet := func(ctx context.Context, g *greeter, name string, conn *jsonrpc.Conn, n int) (string, error) {
+		return fmt.Sprintf("%s %s %d %t", g.prefix, name, n, conn != nil), nil
+	}
+	assert.NoError(rpc.Register("greet", greet))
+	assert.NoError(rpc.Register("denied", greet))
+	assert.NoError(rpc.Register("single", func(ctx context.Context, g *greeter, name string) (string, error) {
+		return g.prefix + " " + name, nil
+	}))
+	c := jsonrpctest.NewClient(t, rpc)
+	var s string
+	c.MustCall("greet", []interface{}{"bob", 2}, &s)
+	assert.Equal("hello bob 2 true", s)
+	c.MustCall("single", "alice", &s)
+	assert.Equal("hello alice", s)
+	assert.EqualError(c.Call("denied", []interface{}{"bob", 2}, &s), "jsonrpc error -32000: no greeter")
+	for _, info := range rpc.Describe() {
+		if info.Name == "greet" {
+			assert.Equal([]reflect.Type{reflect.TypeOf(""), reflect.TypeOf(0)}, info.Params)
+		}
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	assert := assert.New(t)
+	var calls int32
+	rpc := jsonrpc.New(&struct{}{}, jsonrpc.WithIdempotency(time.Minute))
+	assert.NoError(rpc.Register("charge", func(ctx context.Context) (int32, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}))
+	assert.NoError(rpc.Register("refund", func(ctx context.Context) (int32, error) {
+		return -atomic.AddInt32(&calls, 1), nil
+	}))
+
+	c := jsonrpctest.NewClient(t, rpc)
+	keyed := jsonrpc.WithIdempotencyKey(context.Background(), "order-1")
+	var n int32
+	for i := 0; i < 3; i++ {
+		assert.NoError(c.Client.Call(keyed, "charge", nil, &n))
+		assert.Equal(int32(1), n)
+	}
+	c.MustCall("charge", nil, &n)
+	assert.Equal(int32(2), n)
+
+	// without a key, a request resent on the same connection with the same
+	// id gets the first response
+	sock := newFakeSocket()
+	go func() {
+		defer close(sock.requests)
+		for i := 0; i < 2; i++ {
+			sock.requests <- &jsonrpc.Request{ID: id(1), Method: "charge", JSONRPC: "2.0"}
+			rsp := <-sock.responses
+			assert.Equal(id(1), rsp.ID)
+			assert.Equal(int32(3), rsp.Result)
+		}
+		// but not a different call that reuses the id
+		sock.requests <- &jsonrpc.Request{ID: id(1), Method: "refund", JSONRPC: "2.0"}
+		rsp := <-sock.responses
+		assert.Equal(int32(-4), rsp.Result)
+	}()
+	rpc.Handle(ctx, sock)
+	assert.Equal(int32(4), atomic.LoadInt32(&calls))
+}
+
+func TestIdempotencyIdentity(t *testing.T) {
+	assert := assert.New(t)
+	var calls int32
+	rpc := jsonrpc.New(&struct{}{}, jsonrpc.WithIdempotency(time.Minute), jsonrpc.WithLogger(jsonrpc.DiscardLogger),
+		jsonrpc.WithAuth(func(ctx context.Context, token string) (interface{}, error) {
+			if token != "alice" && token != "bob" {
+				return nil, errors.New("bad token")
+			}
+			return token, nil
+		}, jsonrpc.AuthParam("token")))
+	assert.NoError(rpc.Register("charge", func(ctx context.Context, p map[string]string) (string, error) {
+		return fmt.Sprintf("%s %d", jsonrpc.IdentityFromContext(ctx), atomic.AddInt32(&calls, 1)), nil
+	}))
+
+	c := jsonrpctest.NewClient(t, rpc)
+	keyed := jsonrpc.WithIdempotencyKey(context.Background(), "order-1")
+	charge := func(token string) string {
+		var out string
+		assert.NoError(c.Client.Call(keyed, "charge", map[string]string{"token": token}, &out))
+		return out
+	}
+	assert.Equal("alice 1", charge("alice"))
+	assert.Equal("bob 2", charge("bob"), "same key, other identity")
+	assert.Equal("alice 1", charge("alice"))
+	assert.Equal("bob 2", charge("bob"))
+
+	// unauthenticated retransmissions are rejected, not answered from the cache
+	var out string
+	err := c.Client.Call(keyed, "charge", map[string]string{}, &out)
+	var rpcErr *jsonrpc.Error
+	assert.ErrorAs(err, &rpcErr)
+	assert.Equal(jsonrpc.CodeUnauthorized, rpcErr.Code)
+	assert.Equal(int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestRequestLog(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "requests.log")
+	log, err := jsonrpc.OpenFileLog(path)
+	assert.NoError(err)
+	stuck := make(chan struct{})
+	defer close(stuck)
+	rpc := jsonrpc.New(&struct{}{}, jsonrpc.WithRequestLog(log, "job"), jsonrpc.WithLogger(jsonrpc.DiscardLogger))
+	assert.NoError(rpc.Register("job", func(ctx context.Context, n int) (int, error) {
+		if n == 2 {
+			<-stuck
+		}
+		return n, nil
+	}))
+	c := jsonrpctest.NewClient(t, rpc)
+	var n int
+	c.MustCall("job", 1, &n)
+	assert.NoError(c.Notify("job", 2))
+	assert.Eventually(func() bool {
+		pending, _ := log.Pending()
+		return len(pending) == 1
+	}, time.Second, time.Millisecond)
+	// crash with the second job unfinished
+	assert.NoError(log.Close())
+
+	log, err = jsonrpc.OpenFileLog(path)
+	assert.NoError(err)
+	defer log.Close()
+	var ran []int
+	rpc = jsonrpc.New(&struct{}{}, jsonrpc.WithRequestLog(log, "job"))
+	assert.NoError(rpc.Register("job", func(ctx context.Context, n int) (int, error) {
+		ran = append(ran, n)
+		return n, nil
+	}))
+	assert.NoError(rpc.Replay(ctx))
+	assert.Equal([]int{2}, ran)
+	pending, err := log.Pending()
+	assert.NoError(err)
+	assert.Empty(pending)
+}
+
+func TestHandleTimeout(t *testing.T) {
+	assert := assert.New(t)
+	release := make(chan struct{})
+	rpc := jsonrpc.New(&TestRPC{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger),
+		jsonrpc.WithTimeout(10*time.Millisecond), jsonrpc.WithMethodTimeout("Foo", 0))
+	assert.NoError(rpc.Register("stuck", func(ctx context.Context) (bool, error) {
+		_, hasDeadline := ctx.Deadline()
+		<-release
+		return hasDeadline, nil
+	}))
+	assert.NoError(rpc.Register("deadline", func(ctx context.Context) (bool, error) {
+		_, hasDeadline := ctx.Deadline()
+		return hasDeadline, nil
+	}))
+	sock := newFakeSocket()
+	go func() {
+		defer close(sock.requests)
+		defer close(release)
+		sock.requests <- &jsonrpc.Request{ID: id(101), Method: "stuck"}
+		rsp := <-sock.responses
+		assert.Equal(jsonrpc.CodeRequestTimeout, rsp.Error.Code)
+
+		sock.requests <- &jsonrpc.Request{ID: id(102), Method: "deadline"}
+		rsp = <-sock.responses
+		assert.Equal(true, rsp.Result)
+
+		params := jsonrpc.ParamsRaw(`"abc"`)
+		sock.requests <- &jsonrpc.Request{ID: id(103), Method: "Foo", Params: &params}
+		rsp = <-sock.responses
+		assert.Equal(123, rsp.Result)
+	}()
+	rpc.Handle(ctx, sock)
+}
+
+func TestSerializationKey(t *testing.T) {
+	assert := assert.New(t)
+	gate := make(chan struct{})
+	rpc := jsonrpc.New(&struct{}{}, jsonrpc.WithSerializationKey(func(req *jsonrpc.Request) string {
+		var p []interface{}
+		_ = json.Unmarshal(*req.Params, &p)
+		return p[0].(string)
+	}), jsonrpc.WithMethodConcurrency("single", 1))
+	var mu sync.Mutex
+	var order []int
+	save := func(ctx context.Context, doc string, n int) (int, error) {
+		if n == 1 {
+			<-gate
+		}
+		mu.Lock()
+		order = append(order, n)
+		mu.Unlock()
+		return n, nil
+	}
+	assert.NoError(rpc.Register("save", save))
+	assert.NoError(rpc.Register("single", save))
+	sock := newFakeSocket()
+	go func() {
+		defer close(sock.requests)
+		send := func(method, doc string, n int) {
+			params := jsonrpc.ParamsRaw(fmt.Sprintf(`[%q,%d]`, doc, n))
+			sock.requests <- &jsonrpc.Request{ID: id(n), Method: method, Params: &params}
+		}
+		send("save", "a", 1)
+		send("save", "a", 2)
+		send("save", "b", 3)
+		assert.Equal(3, (<-sock.responses).Result)
+		gate <- struct{}{}
+		assert.Equal(1, (<-sock.responses).Result)
+		assert.Equal(2, (<-sock.responses).Result)
+
+		send("single", "c", 1)
+		time.Sleep(10 * time.Millisecond)
+		send("single", "d", 4)
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		assert.Equal([]int{3, 1, 2}, order)
+		mu.Unlock()
+		gate <- struct{}{}
+		assert.Equal(1, (<-sock.responses).Result)
+		assert.Equal(4, (<-sock.responses).Result)
+	}()
+	rpc.Handle(ctx, sock)
+}
+
+func TestResultCache(t *testing.T) {
+	assert := assert.New(t)
+	cache := jsonrpc.NewResultCache(jsonrpc.NewLRUStore(2))
+	cache.Cache("block", time.Minute, nil)
+	cache.Cache("short", time.Millisecond, nil)
+	rpc := jsonrpc.New(&struct{}{})
+	rpc.Use(cache.Interceptor())
+	calls := 0
+	handler := func(ctx context.Context, n int) (map[string]int, error) {
+		calls++
+		return map[string]int{"n": n, "calls": calls}, nil
+	}
+	assert.NoError(rpc.Register("block", handler))
+	assert.NoError(rpc.Register("short", handler))
+	c := jsonrpctest.NewClient(t, rpc)
+	call := func(method string, n int) int {
+		var rsp map[string]int
+		c.MustCall(method, n, &rsp)
+		assert.Equal(n, rsp["n"])
+		return rsp["calls"]
+	}
+	assert.Equal(1, call("block", 1))
+	assert.Equal(1, call("block", 1))
+	assert.Equal(2, call("block", 2))
+	cache.Invalidate("block", "1")
+	assert.Equal(3, call("block", 1))
+	assert.Equal(3, call("block", 1), "cached again")
+	cache.InvalidateMethod("block")
+	assert.Equal(4, call("block", 2))
+	assert.Equal(5, call("short", 1))
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(6, call("short", 1))
+}
+
+func TestPreMarshaled(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&struct{}{}, jsonrpc.WithMaxResponseSize(20))
+	assert.NoError(rpc.Register("pre", func(ctx context.Context, s string) (jsonrpc.PreMarshaled, error) {
+		return jsonrpc.PreMarshaled(s), nil
+	}))
+	assert.NoError(rpc.Register("raw", func(ctx context.Context) (json.RawMessage, error) {
+		return json.RawMessage(`{"a":[1,2]}`), nil
+	}))
+	c := jsonrpctest.NewClient(t, rpc)
+	var rsp map[string][]int
+	c.MustCall("raw", nil, &rsp)
+	assert.Equal(map[string][]int{"a": {1, 2}}, rsp)
+	var n int
+	c.MustCall("pre", "42", &n)
+	assert.Equal(42, n)
+	var v interface{}
+	c.MustCall("pre", "", &v)
+	assert.Nil(v)
+	c.CallError("pre", `["too long to be written"]`, jsonrpc.CodeInternalError)
+}
+
+type EthAPI struct{}
+
+func (EthAPI) BlockNumber(ctx context.Context) (jsonrpc.HexUint64, error) {
+	return 0x1b4, nil
+}
+
+func (EthAPI) GetBalance(ctx context.Context, address jsonrpc.HexBytes, block string) (*jsonrpc.HexBig, error) {
+	if len(address) != 2 || block != "latest" {
+		return nil, errors.New("bad params")
+	}
+	wei, _ := new(big.Int).SetString("1000000000000000000000", 10)
+	return (*jsonrpc.HexBig)(wei), nil
+}
+
+func (EthAPI) GetBlockByNumber(ctx context.Context, number jsonrpc.HexUint64) (map[string]jsonrpc.HexUint64, error) {
+	return map[string]jsonrpc.HexUint64{"number": number}, nil
+}
+
+func (EthAPI) NewHeads(ctx context.Context) (*jsonrpc.Subscription, error) {
+	sub, err := jsonrpc.NewSubscription(ctx)
+	if err != nil {
+		return nil, err
+	}
+	go func() { _ = sub.Notify(context.Background(), map[string]string{"number": "0x1"}) }()
+	return sub, nil
+}
+
+func TestEthereum(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&struct{}{}, jsonrpc.WithEthereum())
+	assert.NoError(rpc.RegisterNamespace("eth", EthAPI{}))
+	c := jsonrpctest.NewClient(t, rpc)
+
+	var raw json.RawMessage
+	c.MustCall("eth_blockNumber", []interface{}{}, &raw)
+	assert.Equal(`"0x1b4"`, string(raw))
+	c.MustCall("eth_getBalance", []string{"0xabcd", "latest"}, &raw)
+	assert.Equal(`"0x3635c9adc5dea00000"`, string(raw))
+	var block map[string]jsonrpc.HexUint64
+	c.MustCall("eth_getBlockByNumber", []string{"0x10"}, &block)
+	assert.Equal(jsonrpc.HexUint64(16), block["number"])
+	c.CallError("eth_getBlockByNumber", []string{"0x010"}, jsonrpc.CodeInvalidParams)
+
+	var id string
+	c.MustCall("eth_subscribe", []string{"newHeads"}, &id)
+	assert.True(strings.HasPrefix(id, "0x"))
+	var event struct {
+		Subscription string            `json:"subscription"`
+		Result       map[string]string `json:"result"`
+	}
+	assert.NoError(c.WaitNotifications("eth_subscription", 1)[0].Decode(&event))
+	assert.Equal(id, event.Subscription)
+	assert.Equal("0x1", event.Result["number"])
+	var ok bool
+	c.MustCall("eth_unsubscribe", []string{id}, &ok)
+	assert.True(ok)
+	c.CallError("eth_subscribe", []string{"blockNumber"}, jsonrpc.CodeMethodNotFound)
+}
+
+func TestSlowConsumer(t *testing.T) {
+	for _, opt := range []jsonrpc.Option{
+		jsonrpc.WithSendQueue(1, jsonrpc.SendClose),
+		jsonrpc.WithWriteTimeout(10 * time.Millisecond),
+	} {
+		assert := assert.New(t)
+		rpc := jsonrpc.New(&struct{}{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger), opt)
+		assert.NoError(rpc.Register("spam", func(ctx context.Context) error {
+			for i := 0; i < 3; i++ {
+				if err := jsonrpc.ConnFromContext(ctx).Notify(ctx, "event", i); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+		sock := newStuckSocket(`{"jsonrpc":"2.0","id":1,"method":"spam"}`)
+		done := make(chan struct{})
+		go func() {
+			rpc.Handle(ctx, sock)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Handle did not return")
+		}
+	}
+}
+
+func TestOnError(t *testing.T) {
+	assert := assert.New(t)
+	errs := make(chan *jsonrpc.ConnError, 3)
+	var disconnectErr error
+	rpc := jsonrpc.New(&struct{}{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger),
+		jsonrpc.WithOnError(func(conn *jsonrpc.Conn, err *jsonrpc.ConnError) { errs <- err }),
+		jsonrpc.WithOnDisconnect(func(conn *jsonrpc.Conn, err error) { disconnectErr = err }))
+	cancelled := make(chan struct{})
+	assert.NoError(rpc.Register("wait", func(ctx context.Context) error {
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	}))
+	assert.NoError(rpc.Register("ping", func(ctx context.Context) (string, error) { return "pong", nil }))
+	msgs := make(chan string, 3)
+	msgs <- `{"jsonrpc":"2.0","id":1,"method":"wait"}`
+	msgs <- `{"jsonrpc":"2.0","id":2,"method":"wait"`
+	msgs <- `{"jsonrpc":"2.0","id":3,"method":"ping"}`
+	sock := &brokenSocket{&stuckSocket{msgs: msgs, closed: make(chan struct{})}}
+
+	done := make(chan struct{})
+	go func() {
+		rpc.Handle(ctx, sock)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Handle did not return")
+	}
+	<-cancelled
+	err := <-errs
+	assert.Equal(jsonrpc.DecodeError, err.Kind)
+	err = <-errs
+	assert.Equal(jsonrpc.WriteError, err.Kind)
+	assert.EqualError(err, "jsonrpc: write error: broken pipe")
+	assert.Equal(err.Err, disconnectErr)
+	assert.Len(errs, 0)
+}
+
+func TestSlowConsumerCallback(t *testing.T) {
+	assert := assert.New(t)
+	errSlow := errors.New("too slow")
+	var stats jsonrpc.SendStats
+	var disconnectErr error
+	rpc := jsonrpc.New(&struct{}{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger),
+		jsonrpc.WithSendQueue(8, jsonrpc.SendBlock),
+		jsonrpc.WithSlowConsumer(20*time.Millisecond, func(conn *jsonrpc.Conn, lag time.Duration) {
+			stats = conn.SendStats()
+			conn.Disconnect(errSlow)
+		}),
+		jsonrpc.WithOnDisconnect(func(conn *jsonrpc.Conn, err error) {
+			disconnectErr = err
+		}))
+	assert.NoError(rpc.Register("spam", func(ctx context.Context) error {
+		for i := 0; i < 8; i++ {
+			if err := jsonrpc.ConnFromContext(ctx).Notify(ctx, "event", i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	sock := &slowSocket{newStuckSocket(`{"jsonrpc":"2.0","id":1,"method":"spam"}`)}
+	done := make(chan struct{})
+	go func() {
+		rpc.Handle(ctx, sock)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Handle did not return")
+	}
+	assert.Equal(errSlow, disconnectErr)
+	assert.True(stats.Written > 0)
+	assert.True(stats.MaxLag > 20*time.Millisecond, stats.MaxLag)
+	assert.True(stats.WriteTime >= time.Duration(stats.Written)*10*time.Millisecond, stats.WriteTime)
+}
+
+func TestHandleRateLimit(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&TestRPC{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger),
+		jsonrpc.WithConnRateLimit(1, 2), jsonrpc.WithMethodRateLimit("FooStruct", 1, 1))
+	sock := newFakeSocket()
+	go func() {
+		defer close(sock.requests)
+		params := jsonrpc.ParamsRaw(`{"foo": "x"}`)
+		sock.requests <- &jsonrpc.Request{ID: id(101), Method: "FooStruct", Params: &params}
+		rsp := <-sock.responses
+		assert.Nil(rsp.Error)
+		sock.requests <- &jsonrpc.Request{ID: id(102), Method: "FooStruct", Params: &params}
+		rsp = <-sock.responses
+		assert.Equal(jsonrpc.CodeRateLimited, rsp.Error.Code)
+		retryAfter := rsp.Error.Data.(map[string]interface{})["retryAfter"].(float64)
+		assert.True(retryAfter > 0 && retryAfter <= 1, retryAfter)
+
+		params = jsonrpc.ParamsRaw(`"abc"`)
+		sock.requests <- &jsonrpc.Request{ID: id(103), Method: "Foo", Params: &params}
+		rsp = <-sock.responses
+		assert.Nil(rsp.Error)
+		sock.requests <- &jsonrpc.Request{ID: id(104), Method: "Foo", Params: &params}
+		rsp = <-sock.responses
+		assert.Equal(jsonrpc.CodeRateLimited, rsp.Error.Code)
+	}()
+	rpc.Handle(ctx, sock)
+}
+
+func TestHandleRateLimitShared(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&TestRPC{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger),
+		jsonrpc.WithRateLimit(0, 3), jsonrpc.WithConnRateLimit(0, 2), jsonrpc.WithMethodRateLimit("Foo", 0, 1))
+	// calls counts the requests that got through out of n on a new connection
+	calls := func(method string, n int) int {
+		ok := 0
+		sock := newFakeSocket()
+		go func() {
+			defer close(sock.requests)
+			params := jsonrpc.ParamsRaw(`"abc"`)
+			if method == "FooStruct" {
+				params = jsonrpc.ParamsRaw(`{"foo": "x"}`)
+			}
+			for i := 0; i < n; i++ {
+				sock.requests <- &jsonrpc.Request{ID: id(i), Method: method, Params: &params}
+				if rsp := <-sock.responses; rsp.Error == nil {
+					ok++
+				} else {
+					assert.Equal(jsonrpc.CodeRateLimited, rsp.Error.Code)
+				}
+			}
+		}()
+		rpc.Handle(ctx, sock)
+		return ok
+	}
+	// requests over the connection's or the method's limit leave the
+	// server's budget alone
+	assert.Equal(2, calls("FooStruct", 10))
+	assert.Equal(1, calls("Foo", 10))
+	assert.Equal(0, calls("FooStruct", 10), "server budget used up")
+}
+
+func TestHandleSizeLimits(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&TestRPC{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger),
+		jsonrpc.WithMaxRequestSize(100, false), jsonrpc.WithMaxResponseSize(20))
+	sock := newFakeSocket()
+	go func() {
+		defer close(sock.requests)
+		params := jsonrpc.ParamsRaw(`[3, "ab"]`)
+		sock.requests <- &jsonrpc.Request{ID: id(1), Method: "FooPositional", Params: &params}
+		rsp := <-sock.responses
+		assert.Equal(json.RawMessage(`"ababab"`), rsp.Result)
+
+		params = jsonrpc.ParamsRaw(`[30, "ab"]`)
+		sock.requests <- &jsonrpc.Request{ID: id(2), Method: "FooPositional", Params: &params}
+		rsp = <-sock.responses
+		assert.Equal(jsonrpc.CodeInternalError, rsp.Error.Code)
+		assert.Equal("response too large", rsp.Error.Message)
+
+		params = jsonrpc.ParamsRaw(`"` + strings.Repeat("a", 100) + `"`)
+		sock.requests <- &jsonrpc.Request{ID: id(3), Method: "Foo", Params: &params}
+		rsp = <-sock.responses
+		assert.Equal(id(3), rsp.ID)
+		assert.Equal(jsonrpc.CodeInvalidRequest, rsp.Error.Code)
+	}()
+	rpc.Handle(ctx, sock)
+
+	// the connection is closed after answering when closeConn is set
+	rpc = jsonrpc.New(&TestRPC{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger), jsonrpc.WithMaxRequestSize(10, true))
+	sock = newFakeSocket()
+	go func() {
+		params := jsonrpc.ParamsRaw(`"abc"`)
+		sock.requests <- &jsonrpc.Request{ID: id(4), Method: "Foo", Params: &params}
+		assert.Equal(jsonrpc.CodeInvalidRequest, (<-sock.responses).Error.Code)
 	}()
 	rpc.Handle(ctx, sock)
 }
@@ -77,42 +1136,311 @@ func TestMethodNotFound(t *testing.T) {
 	assert := assert.New(t)
 	sock := newFakeSocket()
 	go func() {
-		sock.requests <- &jsonrpc.Request{ID: 101, Method: "invalid_method", Params: nil}
+		sock.requests <- &jsonrpc.Request{ID: id(101), Method: "invalid_method", Params: nil}
 		rsp := <-sock.responses
-		assert.Equal(jsonrpc.ID(101), rsp.ID)
+		assert.Equal(id(101), rsp.ID)
 		assert.Nil(rsp.Result)
-		assert.Equal("method not found: invalid_method", rsp.Error)
+		assert.Equal("method not found: invalid_method", rsp.Error.Message)
+		assert.Equal(jsonrpc.CodeMethodNotFound, rsp.Error.Code)
 		close(sock.requests)
 	}()
 	rpc.Handle(ctx, sock)
 }
 
+func TestFallback(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&struct{}{}, jsonrpc.WithFallback(func(ctx context.Context, req *jsonrpc.Request) (*jsonrpc.Response, error) {
+		if !strings.HasPrefix(req.Method, "dyn.") {
+			return jsonrpc.MethodNotFound(ctx, req)
+		}
+		if req.Method == "dyn.fail" {
+			return nil, jsonrpc.NewError(4040, "no such thing").WithData(req.Method)
+		}
+		return &jsonrpc.Response{ID: req.ID, Result: strings.TrimPrefix(req.Method, "dyn."), JSONRPC: "2.0"}, nil
+	}))
+	c := jsonrpctest.NewClient(t, rpc)
+	var name string
+	c.MustCall("dyn.widget", nil, &name)
+	assert.Equal("widget", name)
+	assert.Equal("no such thing", c.CallError("dyn.fail", nil, 4040).Message)
+	c.CallError("other", nil, jsonrpc.CodeMethodNotFound)
+}
+
+func TestGatedMethods(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&struct{}{}, jsonrpc.WithGatedMethods("admin.*"))
+	assert.NoError(rpc.Register("login", func(ctx context.Context, password string) (bool, error) {
+		conn := jsonrpc.ConnFromContext(ctx)
+		if password == "secret" {
+			conn.EnableMethods("admin.*")
+			conn.DisableMethods("admin.drop", "login")
+		}
+		return true, nil
+	}))
+	assert.NoError(rpc.Register("admin.stats", func(ctx context.Context) (int, error) { return 42, nil }))
+	assert.NoError(rpc.Register("admin.drop", func(ctx context.Context) (int, error) { return 0, nil }))
+	methods := func(c *jsonrpctest.Client) []string {
+		var infos []struct{ Name string }
+		c.MustCall("rpc.methods", nil, &infos)
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.Name)
+		}
+		return names
+	}
+
+	plain, admin := jsonrpctest.NewClient(t, rpc), jsonrpctest.NewClient(t, rpc)
+	plain.CallError("admin.stats", nil, jsonrpc.CodeMethodNotFound)
+	assert.Equal([]string{"login"}, methods(plain))
+	admin.MustCall("login", "secret", nil)
+	var stats int
+	admin.MustCall("admin.stats", nil, &stats)
+	assert.Equal(42, stats)
+	admin.CallError("admin.drop", nil, jsonrpc.CodeMethodNotFound)
+	admin.CallError("login", "secret", jsonrpc.CodeMethodNotFound)
+	assert.Equal([]string{"admin.stats"}, methods(admin))
+	plain.CallError("admin.stats", nil, jsonrpc.CodeMethodNotFound)
+}
+
+func TestRegisterNotification(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&struct{}{}, jsonrpc.WithNotificationConcurrency(1), jsonrpc.WithConcurrencyLimit(1, jsonrpc.BusyQueue))
+	changes := make(chan int, 20)
+	var applied int32
+	assert.NoError(rpc.RegisterNotification("didChange", func(ctx context.Context, version int) {
+		time.Sleep(time.Millisecond)
+		atomic.StoreInt32(&applied, int32(version))
+		changes <- version
+	}))
+	assert.NoError(rpc.Register("version", func(ctx context.Context) (int32, error) {
+		return atomic.LoadInt32(&applied), nil
+	}))
+	assert.Error(rpc.RegisterNotification("bad", func(ctx context.Context) (int, error) { return 0, nil }))
+	c := jsonrpctest.NewClient(t, rpc)
+	for i := 0; i < 20; i++ {
+		assert.NoError(c.Notify("didChange", i))
+	}
+	// a request waits for the notifications read before it
+	var version int32
+	c.MustCall("version", nil, &version)
+	assert.Equal(int32(19), version)
+	for i := 0; i < 20; i++ {
+		assert.Equal(i, <-changes)
+	}
+	c.CallError("didChange", 1, jsonrpc.CodeInvalidRequest)
+	assert.True(rpc.Describe()[0].Notification)
+}
+
+func TestStatusMethods(t *testing.T) {
+	assert := assert.New(t)
+	var down error
+	rpc := jsonrpc.New(&TestRPC{}, jsonrpc.WithStatusMethods("1.2.3"), jsonrpc.WithHealthCheck(func(ctx context.Context) error {
+		return down
+	}))
+	c := jsonrpctest.NewClient(t, rpc)
+	var health jsonrpc.Health
+	c.MustCall("rpc.health", nil, &health)
+	assert.Equal("ok", health.Status)
+	var version jsonrpc.Version
+	c.MustCall("rpc.version", nil, &version)
+	assert.Equal("1.2.3", version.Version)
+	c.CallError("FooErr", "x", jsonrpc.CodeServerError)
+	c.CallError("Foo", 5, jsonrpc.CodeInvalidParams)
+	c.MustCall("Foo", "x", nil)
+	var stats jsonrpc.Stats
+	c.MustCall("rpc.stats", nil, &stats)
+	assert.Equal(uint64(2), stats.Calls["Foo"].Calls)
+	assert.Equal(uint64(1), stats.Calls["Foo"].Errors)
+	assert.Equal(uint64(1), stats.Calls["FooErr"].Errors)
+	assert.Equal(int64(1), stats.InFlight)
+	down = errors.New("database unreachable")
+	c.CallError("rpc.health", nil, jsonrpc.CodeServerError)
+}
+
+func TestHandleBatch(t *testing.T) {
+	assert := assert.New(t)
+	sock := newFakeSocket()
+	go func() {
+		defer close(sock.requests)
+		params := jsonrpc.ParamsRaw("\"test-abc\"")
+		sock.requests <- []interface{}{
+			&jsonrpc.Request{ID: id(201), Method: "Foo", Params: &params},
+			&jsonrpc.Request{ID: id(202), Method: "FooErr", Params: &params},
+			5,
+		}
+		rsps := <-sock.batches
+		assert.Len(rsps, 3)
+		byID := map[string]*jsonrpc.Response{}
+		for _, rsp := range rsps {
+			byID[rsp.ID.String()] = rsp
+		}
+		assert.Equal(123, byID["201"].Result)
+		assert.Equal("uh oh", byID["202"].Error.Message)
+		assert.Equal(jsonrpc.CodeInvalidRequest, byID["null"].Error.Code)
+	}()
+	rpc.Handle(ctx, sock)
+}
+
+func TestHandleEmptyBatch(t *testing.T) {
+	assert := assert.New(t)
+	sock := newFakeSocket()
+	go func() {
+		defer close(sock.requests)
+		sock.requests <- []interface{}{}
+		rsp := <-sock.responses
+		assert.Equal(jsonrpc.CodeInvalidRequest, rsp.Error.Code)
+	}()
+	rpc.Handle(ctx, sock)
+}
+
+func TestHandleNotification(t *testing.T) {
+	assert := assert.New(t)
+	sock := newFakeSocket()
+	go func() {
+		defer close(sock.requests)
+		params := jsonrpc.ParamsRaw("\"test-abc\"")
+		sock.requests <- &jsonrpc.Request{Method: "FooNotify", Params: &params}
+		assert.True(<-notified)
+		sock.requests <- []*jsonrpc.Request{
+			{Method: "FooNotify", Params: &params},
+			{Method: "invalid_method"},
+		}
+		assert.True(<-notified)
+		sock.requests <- &jsonrpc.Request{ID: id(301), Method: "FooNotify", Params: &params}
+		assert.False(<-notified)
+		rsp := <-sock.responses
+		assert.Equal(id(301), rsp.ID)
+	}()
+	rpc.Handle(ctx, sock)
+}
+
+func TestHandleLogger(t *testing.T) {
+	assert := assert.New(t)
+	var mu sync.Mutex
+	levels := map[string]jsonrpc.Level{}
+	logger := jsonrpc.LoggerFunc(func(level jsonrpc.Level, msg string, keyvals ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		levels[msg] = level
+	})
+	rpc := jsonrpc.New(&TestRPC{}, jsonrpc.WithLogger(logger))
+	sock := newFakeSocket()
+	go func() {
+		defer close(sock.requests)
+		sock.requests <- &jsonrpc.Request{ID: id(401), Method: "invalid_method"}
+		<-sock.responses
+	}()
+	rpc.Handle(ctx, sock)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(jsonrpc.LevelInfo, levels["rsp error"])
+	assert.Equal(jsonrpc.LevelInfo, levels["read error"])
+}
+
+func TestAccessLog(t *testing.T) {
+	assert := assert.New(t)
+	records := make(chan map[string]interface{}, 1)
+	logger := jsonrpc.LoggerFunc(func(level jsonrpc.Level, msg string, keyvals ...interface{}) {
+		record := map[string]interface{}{}
+		for i := 0; i < len(keyvals); i += 2 {
+			record[keyvals[i].(string)] = keyvals[i+1]
+		}
+		assert.Equal("access", msg)
+		records <- record
+	})
+	rpc := jsonrpc.New(&struct{}{})
+	rpc.Use(jsonrpc.AccessLog(logger, jsonrpc.WithLogParams()))
+	assert.NoError(rpc.Register("login", func(ctx context.Context, p map[string]interface{}) (interface{}, error) {
+		if p["user"] == "" {
+			return nil, jsonrpc.ErrInvalidParams
+		}
+		return "ok", nil
+	}))
+	c := jsonrpctest.NewClient(t, rpc)
+
+	c.MustCall("login", map[string]interface{}{"user": "jdx", "Password": "hunter2", "nested": map[string]string{"token": "t"}}, nil)
+	record := <-records
+	assert.Equal("login", record["method"])
+	assert.Equal("ok", record["outcome"])
+	assert.Equal(0, record["code"])
+	assert.Equal(4, record["result_size"])
+	assert.Equal(`{"Password":"[REDACTED]","nested":{"token":"[REDACTED]"},"user":"jdx"}`, record["params"])
+
+	c.CallError("login", map[string]string{"user": ""}, jsonrpc.CodeInvalidParams)
+	record = <-records
+	assert.Equal("error", record["outcome"])
+	assert.Equal(jsonrpc.CodeInvalidParams, record["code"])
+}
+
+func TestHandleInterceptors(t *testing.T) {
+	assert := assert.New(t)
+	var calls []string
+	rpc := jsonrpc.New(&TestRPC{})
+	rpc.Use(
+		func(ctx context.Context, req *jsonrpc.Request, next jsonrpc.Handler) (*jsonrpc.Response, error) {
+			calls = append(calls, "first")
+			return next(ctx, req)
+		},
+		func(ctx context.Context, req *jsonrpc.Request, next jsonrpc.Handler) (*jsonrpc.Response, error) {
+			calls = append(calls, "second")
+			if req.Method == "FooErr" {
+				return nil, jsonrpc.NewError(401, "unauthorized")
+			}
+			return next(ctx, req)
+		},
+	)
+	sock := newFakeSocket()
+	go func() {
+		defer close(sock.requests)
+		params := jsonrpc.ParamsRaw("\"test-abc\"")
+		sock.requests <- &jsonrpc.Request{ID: id(501), Method: "Foo", Params: &params}
+		rsp := <-sock.responses
+		assert.Equal(123, rsp.Result)
+		sock.requests <- &jsonrpc.Request{ID: id(502), Method: "FooErr", Params: &params}
+		rsp = <-sock.responses
+		assert.Equal(401, rsp.Error.Code)
+	}()
+	rpc.Handle(ctx, sock)
+	assert.Equal([]string{"first", "second", "first", "second"}, calls)
+}
+
 type FakeSocket struct {
-	requests  chan *jsonrpc.Request
+	requests  chan interface{}
 	responses chan *jsonrpc.Response
+	batches   chan []*jsonrpc.Response
 }
 
 func newFakeSocket() *FakeSocket {
-	return &FakeSocket{make(chan *jsonrpc.Request), make(chan *jsonrpc.Response)}
+	return &FakeSocket{
+		make(chan interface{}),
+		make(chan *jsonrpc.Response),
+		make(chan []*jsonrpc.Response),
+	}
 }
 
 func (f *FakeSocket) ReadJSON(raw interface{}) error {
-	cur := <-f.requests
-	if cur == nil {
+	cur, ok := <-f.requests
+	if !ok {
 		return &websocket.CloseError{
 			Code: websocket.CloseNormalClosure,
 			Text: "closed normally",
 		}
 	}
-	request := raw.(*jsonrpc.Request)
-	request.ID = cur.ID
-	request.Method = cur.Method
-	request.Params = cur.Params
-	return nil
+	b, err := json.Marshal(cur)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, raw)
 }
 
 func (f *FakeSocket) WriteJSON(response interface{}) error {
-	f.responses <- response.(*jsonrpc.Response)
+	switch response := response.(type) {
+	case *jsonrpc.Response:
+		f.responses <- response
+	case []*jsonrpc.Response:
+		f.batches <- response
+	}
 	return nil
 }
 
@@ -120,6 +1448,61 @@ func (f *FakeSocket) Close() error {
 	return nil
 }
 
+// stuckSocket reads one message, then blocks reads and writes until closed.
+type stuckSocket struct {
+	msgs   chan string
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newStuckSocket(msg string) *stuckSocket {
+	msgs := make(chan string, 1)
+	msgs <- msg
+	return &stuckSocket{msgs: msgs, closed: make(chan struct{})}
+}
+
+func (s *stuckSocket) ReadJSON(v interface{}) error {
+	select {
+	case msg := <-s.msgs:
+		return json.Unmarshal([]byte(msg), v)
+	case <-s.closed:
+		return errors.New("closed")
+	}
+}
+
+func (s *stuckSocket) WriteJSON(v interface{}) error {
+	<-s.closed
+	return errors.New("closed")
+}
+
+func (s *stuckSocket) Close() error {
+	s.once.Do(func() { close(s.closed) })
+	return nil
+}
+
+// slowSocket takes 10ms to write each message.
+type slowSocket struct {
+	*stuckSocket
+}
+
+func (s *slowSocket) WriteJSON(v interface{}) error {
+	select {
+	case <-time.After(10 * time.Millisecond):
+		return nil
+	case <-s.closed:
+		return errors.New("closed")
+	}
+}
+
+// brokenSocket fails every write.
+type brokenSocket struct {
+	*stuckSocket
+}
+
+func (s *brokenSocket) WriteJSON(v interface{}) error {
+	return errors.New("broken pipe")
+}
+
 type TestRPC struct{}
 
 func (r *TestRPC) Foo(ctx context.Context, params string) (int, error) {
@@ -130,6 +1513,13 @@ type FooStructParams struct {
 	Foo string `json:"foo"`
 }
 
+func (p *FooStructParams) Validate() error {
+	if p.Foo == "" {
+		return errors.New("foo is required")
+	}
+	return nil
+}
+
 type FooStructResult struct {
 	Bar string
 }
@@ -139,12 +1529,47 @@ func (r *TestRPC) FooStruct(
 	return &FooStructResult{params.Foo}, nil
 }
 
+func (r *TestRPC) FooPositional(ctx context.Context, n int, s string, p *FooStructParams) (string, error) {
+	out := strings.Repeat(s, n)
+	if p != nil {
+		out += p.Foo
+	}
+	return out, nil
+}
+
 func (r *TestRPC) FooErr(ctx context.Context, params string) (interface{}, error) {
 	return nil, errors.New("uh oh")
 }
 
+func (r *TestRPC) FooCodedErr(ctx context.Context, params string) (interface{}, error) {
+	return nil, fmt.Errorf("wrapped: %w", jsonrpc.NewError(4001, "nope").WithData(params))
+}
+
+type fieldError map[string]string
+
+func (e fieldError) Error() string          { return "invalid fields" }
+func (e fieldError) UserError() string      { return "invalid: foo" }
+func (e fieldError) ErrorCode() int         { return 4220 }
+func (e fieldError) ErrorData() interface{} { return map[string]string(e) }
+
+func (r *TestRPC) FooFieldErr(ctx context.Context, params map[string]string) (interface{}, error) {
+	return nil, fmt.Errorf("wrapped: %w", fieldError{"foo": "required"})
+}
+
+var notified = make(chan bool)
+
+func (r *TestRPC) FooNotify(ctx context.Context, params string) error {
+	notified <- jsonrpc.IsNotification(ctx)
+	return nil
+}
+
 func (r *TestRPC) FooPanic(ctx context.Context) (interface{}, error) {
 	panic("uh oh")
 }
 
 var ctx = context.Background()
+
+func id(i int) *jsonrpc.ID {
+	id := jsonrpc.Int64ID(int64(i))
+	return &id
+}
@@ -0,0 +1,92 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const defaultHeartbeatMethod = "$/ping"
+
+// ErrHeartbeatTimeout is the disconnect error of connections closed for
+// missing heartbeats.
+var ErrHeartbeatTimeout = errors.New("jsonrpc: heartbeat timeout")
+
+type heartbeat struct {
+	method    string
+	interval  time.Duration
+	maxMissed int
+}
+
+// WithHeartbeat calls "$/ping" on every connection each interval and closes
+// the connection once maxMissed calls in a row got no response within
+// interval. Any response counts, including method not found, so peers need
+// not implement the method. WithOnDisconnect sees ErrHeartbeatTimeout.
+// Websockets can use ws.WithPingInterval for transport-level pings instead.
+func WithHeartbeat(interval time.Duration, maxMissed int) Option {
+	return func(s *Server) {
+		s.heartbeat = newHeartbeat(s.heartbeat, interval, maxMissed)
+	}
+}
+
+// WithHeartbeatMethod sets the method called by WithHeartbeat.
+func WithHeartbeatMethod(method string) Option {
+	return func(s *Server) {
+		s.heartbeat = newHeartbeat(s.heartbeat, 0, 0)
+		s.heartbeat.method = method
+	}
+}
+
+// WithClientHeartbeat is WithHeartbeat for the client's connection, which is
+// shut down with ErrHeartbeatTimeout.
+func WithClientHeartbeat(interval time.Duration, maxMissed int) ClientOption {
+	return func(c *Client) {
+		c.heartbeat = newHeartbeat(c.heartbeat, interval, maxMissed)
+	}
+}
+
+func newHeartbeat(h *heartbeat, interval time.Duration, maxMissed int) *heartbeat {
+	if h == nil {
+		h = &heartbeat{method: defaultHeartbeatMethod, maxMissed: 1}
+	}
+	if interval > 0 {
+		h.interval = interval
+	}
+	if maxMissed > 0 {
+		h.maxMissed = maxMissed
+	}
+	return h
+}
+
+// run pings conn until ctx is done, calling dead once too many pings missed.
+func (h *heartbeat) run(ctx context.Context, conn *Conn, dead func()) {
+	if h == nil || h.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	missed := 0
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, h.interval)
+		err := conn.Call(pingCtx, h.method, nil, nil)
+		cancel()
+		var rpcErr *Error
+		if err == nil || errors.As(err, &rpcErr) {
+			missed = 0
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if missed++; missed >= h.maxMissed {
+			conn.logger.Log(LevelWarn, "heartbeat timeout", "missed", missed)
+			dead()
+			return
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package jsonrpc
+
+import (
+	"context"
+	"reflect"
+)
+
+const helloMethod = "rpc.hello"
+
+// ProtocolVersion is the version of this package's protocol extensions,
+// exchanged by rpc.hello.
+const ProtocolVersion = "1"
+
+// Protocol extensions negotiated by rpc.hello.
+const (
+	ExtCancel        = "cancel"
+	ExtProgress      = "progress"
+	ExtSubscriptions = "subscriptions"
+	ExtDeadlines     = "deadlines"
+	ExtAttachments   = "attachments"
+)
+
+// Hello is what each side sends in the rpc.hello handshake: its protocol
+// version and the extensions it supports.
+type Hello struct {
+	Version    string   `json:"version"`
+	Extensions []string `json:"extensions"`
+}
+
+// WithHello adds the built-in rpc.hello method, with which clients calling
+// Client.Hello and the server agree on the protocol extensions to use on the
+// connection: those both support. Until then everything is assumed to be.
+// The server offers the extensions it is configured for and extensions, e.g.
+// codecs or compression schemes for the application to check with
+// Conn.Supports.
+func WithHello(extensions ...string) Option {
+	return func(s *Server) {
+		s.hello = true
+		s.helloExtensions = append(s.helloExtensions, extensions...)
+	}
+}
+
+func (s *Server) helloMethods(methods Methods) {
+	if s.hello {
+		methods[helloMethod] = newReflectMethod(reflect.ValueOf(s.handleHello), nil)
+	}
+}
+
+func (s *Server) handleHello(ctx context.Context, peer Hello) (*Hello, error) {
+	conn := ConnFromContext(ctx)
+	var exts []string
+	if s.cancelMethod != "" {
+		exts = append(exts, ExtCancel)
+	}
+	if s.progressMethod != "" {
+		exts = append(exts, ExtProgress)
+	}
+	if s.subscriptionMethod != "" && conn != nil {
+		exts = append(exts, ExtSubscriptions)
+	}
+	if s.deadlines {
+		exts = append(exts, ExtDeadlines)
+	}
+	if conn != nil && conn.attachments != nil {
+		exts = append(exts, ExtAttachments)
+	}
+	exts = append(exts, s.helloExtensions...)
+	if conn != nil {
+		conn.negotiate(exts, peer.Extensions)
+	}
+	return &Hello{Version: ProtocolVersion, Extensions: exts}, nil
+}
+
+// Hello calls rpc.hello, offering the extensions the client supports and
+// extensions, and limits the connection to those the server supports too.
+// It returns what the server offered. If the call fails, e.g. because the
+// server doesn't have WithHello, nothing changes.
+func (c *Client) Hello(ctx context.Context, extensions ...string) (*Hello, error) {
+	exts := []string{ExtCancel, ExtProgress, ExtSubscriptions}
+	if c.deadlines {
+		exts = append(exts, ExtDeadlines)
+	}
+	if c.conn.attachments != nil {
+		exts = append(exts, ExtAttachments)
+	}
+	exts = append(exts, extensions...)
+	var peer Hello
+	if err := c.Call(ctx, helloMethod, &Hello{Version: ProtocolVersion, Extensions: exts}, &peer); err != nil {
+		return nil, err
+	}
+	c.conn.negotiate(exts, peer.Extensions)
+	return &peer, nil
+}
+
+// negotiate limits the connection to the extensions both sides support.
+func (c *Conn) negotiate(ours, theirs []string) {
+	peer := map[string]bool{}
+	for _, ext := range theirs {
+		peer[ext] = true
+	}
+	both := map[string]bool{}
+	for _, ext := range ours {
+		if peer[ext] {
+			both[ext] = true
+		}
+	}
+	c.mu.Lock()
+	c.extensions = both
+	c.mu.Unlock()
+}
+
+// Supports reports whether ext was agreed on by rpc.hello, or true if the
+// connection didn't negotiate extensions.
+func (c *Conn) Supports(ext string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.extensions == nil || c.extensions[ext]
+}
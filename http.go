@@ -0,0 +1,137 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// HTTPHandler serves JSON-RPC over HTTP POST. The body may hold a single
+// request or a batch. Handlers receive the HTTP request's context; there is
+// no Conn, so notifications to the client are not available.
+func HTTPHandler(s *Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var body io.Reader = r.Body
+		if len(s.compressors) > 0 {
+			decoded, err := s.decodeBody(r)
+			if err != nil {
+				s.writeHTTP(w, r, http.StatusUnsupportedMediaType, newResponseError(nil, ErrParse.WithMessage(err.Error())))
+				return
+			}
+			defer decoded.Close()
+			body = decoded
+		}
+		if s.maxRequestSize > 0 {
+			// after decompression, so the limit applies to what's decoded
+			body = io.LimitReader(body, int64(s.maxRequestSize)+1)
+		}
+		b, err := ioutil.ReadAll(body)
+		if err != nil {
+			s.writeHTTP(w, r, http.StatusBadRequest, newResponseError(nil, ErrParse.WithMessage(err.Error())))
+			return
+		}
+		if s.maxRequestSize > 0 && len(b) > s.maxRequestSize {
+			s.logger.Log(LevelWarn, "request too large", "limit", s.maxRequestSize)
+			s.writeHTTP(w, r, http.StatusRequestEntityTooLarge, newResponseError(nil, ErrRequestTooLarge))
+			return
+		}
+		if s.metrics != nil {
+			s.metrics.MessageRead(len(b))
+		}
+		if s.onReceiveRaw != nil {
+			s.onReceiveRaw(nil, b)
+		}
+		msg, err := decodeIncoming(b)
+		if err != nil {
+			s.writeHTTP(w, r, http.StatusBadRequest, newResponseError(nil, ErrParse.WithMessage(err.Error())))
+			return
+		}
+
+		s.headerDeadline(r, msg)
+
+		ctx, err := s.afterConnect(ContextWithHTTPRequest(r.Context(), r))
+		if err != nil {
+			s.writeHTTP(w, r, http.StatusForbidden, newResponseError(nil, s.toError(err)))
+			return
+		}
+		ctx, err = s.authenticateConn(ctx)
+		if err != nil {
+			s.writeHTTP(w, r, http.StatusUnauthorized, newResponseError(nil, s.toError(err)))
+			return
+		}
+
+		out := s.handleIncoming(ctx, msg)
+		if out == nil {
+			// only notifications were sent
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		s.writeHTTP(w, r, http.StatusOK, out)
+	})
+}
+
+func (s *Server) writeHTTP(w http.ResponseWriter, r *http.Request, status int, msg interface{}) {
+	if rsp, sw := streamedResult(msg); sw != nil && s.compressThreshold <= 0 && s.onSendRaw == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := writeStreamed(w, rsp, sw); err != nil {
+			s.logger.Log(LevelError, "write error", "error", err)
+		} else {
+			acknowledge(msg)
+		}
+		return
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		s.logger.Log(LevelError, "marshal error", "error", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if s.metrics != nil {
+		s.metrics.MessageWritten(len(b))
+	}
+	raw := b
+	if s.compressThreshold > 0 && len(b) >= s.compressThreshold {
+		if c := s.negotiate(r); c != nil {
+			if compressed, err := compress(c, b); err == nil {
+				b = compressed
+				w.Header().Set("Content-Encoding", c.Name)
+			} else {
+				s.logger.Log(LevelError, "compress error", "error", err)
+			}
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(b); err != nil {
+		s.logger.Log(LevelError, "write error", "error", err)
+	} else {
+		acknowledge(msg)
+		if s.onSendRaw != nil {
+			s.onSendRaw(nil, raw)
+		}
+	}
+}
+
+type ctxHTTPRequestKey struct{}
+
+// ContextWithHTTPRequest records the HTTP request a connection was made with,
+// e.g. a websocket upgrade, so that WithAuth can read its headers.
+func ContextWithHTTPRequest(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, ctxHTTPRequestKey{}, r)
+}
+
+// HTTPRequestFromContext returns the HTTP request the connection or request
+// was made with, or nil.
+func HTTPRequestFromContext(ctx context.Context) *http.Request {
+	r, _ := ctx.Value(ctxHTTPRequestKey{}).(*http.Request)
+	return r
+}
@@ -0,0 +1,664 @@
+package jsonrpc_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jdxcode/jsonrpc"
+	"github.com/jdxcode/jsonrpc/jsonrpctest"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	assert := assert.New(t)
+	srv := httptest.NewServer(jsonrpc.HTTPHandler(rpc))
+	defer srv.Close()
+
+	post := func(body string) *http.Response {
+		rsp, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+		assert.NoError(err)
+		return rsp
+	}
+
+	rsp := post(`{"jsonrpc":"2.0","id":1,"method":"Foo","params":"abc"}`)
+	assert.Equal(http.StatusOK, rsp.StatusCode)
+	assert.Equal("application/json", rsp.Header.Get("Content-Type"))
+	var single map[string]interface{}
+	assert.NoError(json.NewDecoder(rsp.Body).Decode(&single))
+	assert.Equal(float64(123), single["result"])
+	rsp.Body.Close()
+
+	rsp = post(`[{"jsonrpc":"2.0","id":1,"method":"Foo","params":"abc"},{"jsonrpc":"2.0","method":"Foo","params":"abc"}]`)
+	var batch []map[string]interface{}
+	assert.NoError(json.NewDecoder(rsp.Body).Decode(&batch))
+	assert.Len(batch, 1)
+	rsp.Body.Close()
+
+	rsp = post(`{"jsonrpc":"2.0","method":"Foo","params":"abc"}`)
+	assert.Equal(http.StatusNoContent, rsp.StatusCode)
+	rsp.Body.Close()
+
+	rsp = post(`{"jsonrpc":`)
+	assert.Equal(http.StatusBadRequest, rsp.StatusCode)
+	rsp.Body.Close()
+
+	rsp, err := http.Get(srv.URL)
+	assert.NoError(err)
+	assert.Equal(http.StatusMethodNotAllowed, rsp.StatusCode)
+	rsp.Body.Close()
+}
+
+func TestOnResponse(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&struct{}{}, jsonrpc.WithOnResponse(
+		func(ctx context.Context, req *jsonrpc.Request, rsp *jsonrpc.Response) *jsonrpc.Response {
+			switch {
+			case req.Method == "drop":
+				return nil
+			case rsp.Error != nil:
+				rsp.Error = jsonrpc.ErrInternal
+			default:
+				rsp.Result = map[string]interface{}{"data": rsp.Result, "method": req.Method}
+			}
+			return rsp
+		}))
+	assert.NoError(rpc.Register("get", func(ctx context.Context, fail bool) (string, error) {
+		if fail {
+			return "", errors.New("db password leaked")
+		}
+		return "ok", nil
+	}))
+	assert.NoError(rpc.Register("drop", func(ctx context.Context) (string, error) {
+		return "unseen", nil
+	}))
+	srv := httptest.NewServer(jsonrpc.HTTPHandler(rpc))
+	defer srv.Close()
+
+	post := func(body string) (int, string) {
+		rsp, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+		assert.NoError(err)
+		defer rsp.Body.Close()
+		var buf bytes.Buffer
+		_, err = buf.ReadFrom(rsp.Body)
+		assert.NoError(err)
+		return rsp.StatusCode, strings.TrimSpace(buf.String())
+	}
+	_, body := post(`{"jsonrpc":"2.0","id":1,"method":"get","params":false}`)
+	assert.JSONEq(`{"jsonrpc":"2.0","id":1,"result":{"data":"ok","method":"get"}}`, body)
+	_, body = post(`{"jsonrpc":"2.0","id":1,"method":"get","params":true}`)
+	assert.NotContains(body, "password")
+	status, _ := post(`{"jsonrpc":"2.0","id":1,"method":"drop"}`)
+	assert.Equal(http.StatusNoContent, status)
+}
+
+func TestRawTap(t *testing.T) {
+	assert := assert.New(t)
+	var mu sync.Mutex
+	var received, sent []string
+	rpc := jsonrpc.New(&struct{}{},
+		jsonrpc.WithOnReceiveRaw(func(conn *jsonrpc.Conn, msg json.RawMessage) {
+			mu.Lock()
+			defer mu.Unlock()
+			received = append(received, string(msg))
+		}),
+		jsonrpc.WithOnSendRaw(func(conn *jsonrpc.Conn, msg json.RawMessage) {
+			mu.Lock()
+			defer mu.Unlock()
+			sent = append(sent, string(msg))
+		}))
+	assert.NoError(rpc.Register("echo", func(ctx context.Context, s string) (string, error) {
+		return s, nil
+	}))
+	srv := httptest.NewServer(jsonrpc.HTTPHandler(rpc))
+	defer srv.Close()
+	req := `{"jsonrpc":"2.0","id":1,"method":"echo","params":"hi"}`
+	rsp, err := http.Post(srv.URL, "application/json", strings.NewReader(req))
+	assert.NoError(err)
+	rsp.Body.Close()
+
+	c := jsonrpctest.NewClient(t, rpc)
+	var s string
+	c.MustCall("echo", "there", &s)
+	// the hook runs once the write returns, which may be after the client
+	// has read it
+	assert.Eventually(func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(sent) == 2
+	}, time.Second, time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(received, 2)
+	assert.Equal(req, received[0])
+	assert.Contains(received[1], `"there"`)
+	assert.Len(sent, 2)
+	assert.JSONEq(`{"jsonrpc":"2.0","id":1,"result":"hi"}`, sent[0])
+	assert.Contains(sent[1], `"result":"there"`)
+}
+
+func TestRecording(t *testing.T) {
+	assert := assert.New(t)
+	newServer := func(opts ...jsonrpc.Option) *jsonrpc.Server {
+		rpc := jsonrpc.New(&struct{}{}, opts...)
+		assert.NoError(rpc.Register("add", func(ctx context.Context, a, b int) (int, error) {
+			return a + b, nil
+		}))
+		return rpc
+	}
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	rec, err := jsonrpc.CreateRecording(path)
+	assert.NoError(err)
+	c := jsonrpctest.NewClient(t, newServer(jsonrpc.WithRecorder(rec)))
+	var sum int
+	c.MustCall("add", []int{1, 2}, &sum)
+	c.MustCall("add", []int{3, 4}, &sum)
+	assert.NoError(c.Notify("add", []int{0, 0}))
+	assert.Eventually(func() bool {
+		b, _ := ioutil.ReadFile(path)
+		return bytes.Count(b, []byte("\n")) == 5
+	}, time.Second, time.Millisecond)
+	assert.NoError(rec.Close())
+
+	f, err := os.Open(path)
+	assert.NoError(err)
+	defer f.Close()
+	msgs, err := jsonrpc.ReadRecording(f)
+	assert.NoError(err)
+	var recorded []string
+	for _, msg := range msgs {
+		if msg.Dir == jsonrpc.DirSent {
+			recorded = append(recorded, string(msg.Msg))
+		}
+	}
+	sent, err := jsonrpc.ReplayRecording(ctx, newServer(jsonrpc.WithLogger(jsonrpc.DiscardLogger)), msgs)
+	assert.NoError(err)
+	// the calls run concurrently, so they may be answered in another order
+	var replayed []string
+	for _, msg := range sent {
+		replayed = append(replayed, string(msg.Msg))
+	}
+	assert.ElementsMatch(recorded, replayed)
+
+	client := jsonrpc.NewClient(jsonrpc.NewPlaybackSocket(msgs), jsonrpc.WithClientLogger(jsonrpc.DiscardLogger))
+	defer client.Close()
+	assert.NoError(client.Call(ctx, "add", []int{1, 2}, &sum))
+	assert.Equal(3, sum)
+	assert.NoError(client.Call(ctx, "add", []int{3, 4}, &sum))
+	assert.Equal(7, sum)
+}
+
+func TestLongPoll(t *testing.T) {
+	assert := assert.New(t)
+	srv := httptest.NewServer(jsonrpc.LongPollHandler(rpc, jsonrpc.WithPollTimeout(20*time.Millisecond)))
+	defer srv.Close()
+
+	sock, err := jsonrpc.DialLongPoll(ctx, srv.URL)
+	assert.NoError(err)
+	client := jsonrpc.NewClient(sock, jsonrpc.WithServer(jsonrpc.New(&ClientRPC{})))
+
+	// outlive a few polls
+	time.Sleep(50 * time.Millisecond)
+	var n int
+	assert.NoError(client.Call(ctx, "Foo", "abc", &n))
+	assert.Equal(123, n)
+	var result string
+	assert.NoError(client.Call(ctx, "FooCallback", "abc", &result))
+	assert.Equal("server:client:abc", result)
+	assert.NoError(client.Close())
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	assert.NoError(err)
+	req.Header.Set(jsonrpc.SessionHeader, "unknown")
+	rsp, err := http.DefaultClient.Do(req)
+	assert.NoError(err)
+	rsp.Body.Close()
+	assert.Equal(http.StatusNotFound, rsp.StatusCode)
+}
+
+func TestSSE(t *testing.T) {
+	assert := assert.New(t)
+	srv := httptest.NewServer(jsonrpc.SSEHandler(rpc, jsonrpc.WithPollTimeout(10*time.Millisecond)))
+	defer srv.Close()
+
+	sock, err := jsonrpc.DialSSE(ctx, srv.URL)
+	assert.NoError(err)
+	client := jsonrpc.NewClient(sock, jsonrpc.WithServer(jsonrpc.New(&ClientRPC{})))
+	defer client.Close()
+
+	// outlive a few keepalives
+	time.Sleep(50 * time.Millisecond)
+	var result string
+	assert.NoError(client.Call(ctx, "FooCallback", "abc", &result))
+	assert.Equal("server:client:abc", result)
+
+	rsp, err := http.Post(srv.URL+"?session=unknown", "application/json", strings.NewReader(`{}`))
+	assert.NoError(err)
+	rsp.Body.Close()
+	assert.Equal(http.StatusNotFound, rsp.StatusCode)
+}
+
+func TestSSESubscribe(t *testing.T) {
+	assert := assert.New(t)
+	s := jsonrpc.New(&struct{}{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger))
+	closed := make(chan struct{}, 1)
+	assert.NoError(s.Register("ticks", func(ctx context.Context, n int) (*jsonrpc.Subscription, error) {
+		sub, err := jsonrpc.NewSubscription(ctx)
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			for i := 0; i < n; i++ {
+				if sub.Notify(context.Background(), i) != nil {
+					break
+				}
+			}
+			<-sub.Done()
+			closed <- struct{}{}
+		}()
+		return sub, nil
+	}))
+	srv := httptest.NewServer(jsonrpc.SSEHandler(s, jsonrpc.WithPollTimeout(10*time.Millisecond)))
+	defer srv.Close()
+
+	sock, err := jsonrpc.DialSSE(ctx, srv.URL)
+	assert.NoError(err)
+	client := jsonrpc.NewClient(sock, jsonrpc.WithClientLogger(jsonrpc.DiscardLogger))
+	events, sub, err := jsonrpc.Subscribe[int](ctx, client, "ticks", 3)
+	assert.NoError(err)
+	assert.Equal([]int{0, 1, 2}, []int{<-events, <-events, <-events})
+	assert.NoError(sub.Unsubscribe(ctx))
+	<-closed
+
+	// closing the stream closes the session, ending its subscriptions
+	_, _, err = jsonrpc.Subscribe[int](ctx, client, "ticks", 0)
+	assert.NoError(err)
+	assert.Len(s.Connections(), 1)
+	client.Close()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription still open")
+	}
+	assert.Eventually(func() bool { return len(s.Connections()) == 0 }, time.Second, time.Millisecond)
+}
+
+func TestSSEConcurrentPosts(t *testing.T) {
+	assert := assert.New(t)
+	s := jsonrpc.New(&struct{}{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger))
+	assert.NoError(s.Register("double", func(ctx context.Context, n int) (int, error) { return 2 * n, nil }))
+	srv := httptest.NewServer(jsonrpc.SSEHandler(s))
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL)
+	assert.NoError(err)
+	events := bufio.NewReader(rsp.Body)
+	next := func() string {
+		for {
+			line, err := events.ReadString('\n')
+			if !assert.NoError(err) {
+				return ""
+			}
+			if data := strings.TrimPrefix(line, "data: "); data != line {
+				return strings.TrimSpace(data)
+			}
+		}
+	}
+	var created struct{ Session string }
+	assert.NoError(json.Unmarshal([]byte(next()), &created))
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rsp, err := http.Post(srv.URL+"?session="+created.Session, "application/json",
+				strings.NewReader(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"double","params":%d}`, i, i)))
+			if assert.NoError(err) {
+				rsp.Body.Close()
+				assert.Equal(http.StatusAccepted, rsp.StatusCode)
+			}
+		}(i)
+	}
+	wg.Wait()
+	results := map[int]int{}
+	for i := 0; i < n; i++ {
+		var msg struct{ ID, Result int }
+		assert.NoError(json.Unmarshal([]byte(next()), &msg))
+		results[msg.ID] = msg.Result
+	}
+	for i := 0; i < n; i++ {
+		assert.Equal(2*i, results[i])
+	}
+
+	rsp.Body.Close()
+	assert.Eventually(func() bool {
+		rsp, err := http.Post(srv.URL+"?session="+created.Session, "application/json", strings.NewReader(`{}`))
+		if err != nil {
+			return false
+		}
+		rsp.Body.Close()
+		return rsp.StatusCode == http.StatusNotFound
+	}, time.Second, time.Millisecond)
+}
+
+func TestHTTPRequestIDs(t *testing.T) {
+	assert := assert.New(t)
+	srv := httptest.NewServer(jsonrpc.HTTPHandler(rpc))
+	defer srv.Close()
+
+	for _, tc := range []struct{ id, expected string }{
+		{`"abc"`, `"abc"`},
+		{`1.5`, `1.5`},
+		{`12345678901234567890`, `12345678901234567890`},
+		{`null`, `null`},
+	} {
+		rsp, err := http.Post(srv.URL, "application/json",
+			strings.NewReader(`{"jsonrpc":"2.0","id":`+tc.id+`,"method":"Foo","params":"abc"}`))
+		assert.NoError(err)
+		var body struct {
+			ID     json.RawMessage `json:"id"`
+			Result int             `json:"result"`
+		}
+		assert.NoError(json.NewDecoder(rsp.Body).Decode(&body))
+		assert.Equal(tc.expected, string(body.ID))
+		assert.Equal(123, body.Result)
+		rsp.Body.Close()
+	}
+
+	rsp, err := http.Post(srv.URL, "application/json",
+		strings.NewReader(`{"jsonrpc":"2.0","id":{},"method":"Foo","params":"abc"}`))
+	assert.NoError(err)
+	var body struct {
+		ID    json.RawMessage `json:"id"`
+		Error *jsonrpc.Error  `json:"error"`
+	}
+	assert.NoError(json.NewDecoder(rsp.Body).Decode(&body))
+	assert.Equal("null", string(body.ID))
+	assert.Equal(jsonrpc.CodeInvalidRequest, body.Error.Code)
+	rsp.Body.Close()
+}
+
+func TestHTTPStrict(t *testing.T) {
+	assert := assert.New(t)
+	srv := httptest.NewServer(jsonrpc.HTTPHandler(jsonrpc.New(&TestRPC{}, jsonrpc.WithStrict())))
+	defer srv.Close()
+
+	for body, code := range map[string]int{
+		`{"jsonrpc":"2.0","id":1,"method":"FooStruct","params":{"foo":"abc"}}`: 0,
+		`{"id":1,"method":"FooStruct","params":{"foo":"abc"}}`:                 jsonrpc.CodeInvalidRequest,
+		`{"jsonrpc":"2.0","id":1,"method":"Foo","params":"abc"}`:               jsonrpc.CodeInvalidRequest,
+	} {
+		rsp, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+		assert.NoError(err)
+		var out struct {
+			JSONRPC string         `json:"jsonrpc"`
+			Error   *jsonrpc.Error `json:"error"`
+		}
+		assert.NoError(json.NewDecoder(rsp.Body).Decode(&out))
+		assert.Equal("2.0", out.JSONRPC)
+		if code == 0 {
+			assert.Nil(out.Error, body)
+		} else if assert.NotNil(out.Error, body) {
+			assert.Equal(code, out.Error.Code)
+		}
+		rsp.Body.Close()
+	}
+}
+
+func TestHTTPAuth(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&TestRPC{}, jsonrpc.WithAuth(func(ctx context.Context, token string) (interface{}, error) {
+		if token != "admin" && token != "guest" {
+			return nil, errors.New("bad token")
+		}
+		return token, nil
+	}, jsonrpc.AuthParam("token"), jsonrpc.AuthPublic("Foo"), jsonrpc.AuthACL("FooStruct", func(identity interface{}) bool {
+		return identity == "admin"
+	})))
+	srv := httptest.NewServer(jsonrpc.HTTPHandler(rpc))
+	defer srv.Close()
+
+	call := func(token, body string) (int, *jsonrpc.Error) {
+		req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+		assert.NoError(err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		assert.NoError(err)
+		defer rsp.Body.Close()
+		var out struct {
+			Error *jsonrpc.Error `json:"error"`
+		}
+		assert.NoError(json.NewDecoder(rsp.Body).Decode(&out))
+		return rsp.StatusCode, out.Error
+	}
+	structCall := `{"jsonrpc":"2.0","id":1,"method":"FooStruct","params":{"foo":"x"}}`
+
+	_, rpcErr := call("", `{"jsonrpc":"2.0","id":1,"method":"Foo","params":"abc"}`)
+	assert.Nil(rpcErr)
+	_, rpcErr = call("", structCall)
+	assert.Equal(jsonrpc.CodeUnauthorized, rpcErr.Code)
+	_, rpcErr = call("guest", structCall)
+	assert.Equal(jsonrpc.CodeForbidden, rpcErr.Code)
+	_, rpcErr = call("admin", structCall)
+	assert.Nil(rpcErr)
+	_, rpcErr = call("", `{"jsonrpc":"2.0","id":1,"method":"FooStruct","params":{"foo":"x","token":"admin"}}`)
+	assert.Nil(rpcErr)
+	status, rpcErr := call("nope", structCall)
+	assert.Equal(http.StatusUnauthorized, status)
+	assert.Equal(jsonrpc.CodeUnauthorized, rpcErr.Code)
+}
+
+func TestHTTPAuthResultCache(t *testing.T) {
+	assert := assert.New(t)
+	cache := jsonrpc.NewResultCache(jsonrpc.NewLRUStore(10))
+	cache.Cache("secret", time.Minute, nil)
+	rpc := jsonrpc.New(&struct{}{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger),
+		jsonrpc.WithAuth(func(ctx context.Context, token string) (interface{}, error) {
+			if token != "alice" && token != "bob" {
+				return nil, errors.New("bad token")
+			}
+			return token, nil
+		}))
+	rpc.Use(cache.Interceptor())
+	calls := 0
+	assert.NoError(rpc.Register("secret", func(ctx context.Context) (string, error) {
+		calls++
+		return fmt.Sprintf("top secret for %s, %d", jsonrpc.IdentityFromContext(ctx), calls), nil
+	}))
+	srv := httptest.NewServer(jsonrpc.HTTPHandler(rpc))
+	defer srv.Close()
+
+	call := func(token string) (string, *jsonrpc.Error) {
+		req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"secret"}`))
+		assert.NoError(err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		assert.NoError(err)
+		defer rsp.Body.Close()
+		var out struct {
+			Result string         `json:"result"`
+			Error  *jsonrpc.Error `json:"error"`
+		}
+		assert.NoError(json.NewDecoder(rsp.Body).Decode(&out))
+		return out.Result, out.Error
+	}
+
+	result, rpcErr := call("alice")
+	assert.Nil(rpcErr)
+	assert.Equal("top secret for alice, 1", result)
+	result, _ = call("alice")
+	assert.Equal("top secret for alice, 1", result, "cached")
+	result, rpcErr = call("")
+	assert.Empty(result)
+	if assert.NotNil(rpcErr) {
+		assert.Equal(jsonrpc.CodeUnauthorized, rpcErr.Code)
+	}
+	result, _ = call("bob")
+	assert.Equal("top secret for bob, 2", result, "cached for each identity")
+	assert.Equal(2, calls)
+}
+
+func TestHTTPMaxRequestSize(t *testing.T) {
+	assert := assert.New(t)
+	s := jsonrpc.New(&TestRPC{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger), jsonrpc.WithMaxRequestSize(64, false))
+	srv := httptest.NewServer(jsonrpc.HTTPHandler(s))
+	defer srv.Close()
+
+	rsp, err := http.Post(srv.URL, "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"Foo","params":"abc"}`))
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, rsp.StatusCode)
+	rsp.Body.Close()
+
+	body := `{"jsonrpc":"2.0","id":1,"method":"Foo","params":"` + strings.Repeat("a", 64) + `"}`
+	rsp, err = http.Post(srv.URL, "application/json", strings.NewReader(body))
+	assert.NoError(err)
+	assert.Equal(http.StatusRequestEntityTooLarge, rsp.StatusCode)
+	rsp.Body.Close()
+}
+
+func TestHTTPCompression(t *testing.T) {
+	assert := assert.New(t)
+	s := jsonrpc.New(&TestRPC{}, jsonrpc.WithCompression(10))
+	assert.NoError(s.Register("echo", func(ctx context.Context, s string) (string, error) { return s, nil }))
+	srv := httptest.NewServer(jsonrpc.HTTPHandler(s))
+	defer srv.Close()
+
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	_, _ = zw.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"echo","params":"` + strings.Repeat("a", 100) + `"}`))
+	assert.NoError(zw.Close())
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, &body)
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Accept-Encoding", "br;q=1, gzip")
+	rsp, err := http.DefaultClient.Do(req)
+	assert.NoError(err)
+	defer rsp.Body.Close()
+	assert.Equal("gzip", rsp.Header.Get("Content-Encoding"))
+	zr, err := gzip.NewReader(rsp.Body)
+	assert.NoError(err)
+	var out map[string]interface{}
+	assert.NoError(json.NewDecoder(zr).Decode(&out))
+	assert.Equal(strings.Repeat("a", 100), out["result"])
+}
+
+func TestHTTPCompressionMaxRequestSize(t *testing.T) {
+	assert := assert.New(t)
+	s := jsonrpc.New(&TestRPC{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger), jsonrpc.WithCompression(10),
+		jsonrpc.WithMaxRequestSize(128, false))
+	assert.NoError(s.Register("echo", func(ctx context.Context, s string) (string, error) { return s, nil }))
+	srv := httptest.NewServer(jsonrpc.HTTPHandler(s))
+	defer srv.Close()
+
+	post := func(params string) *http.Response {
+		var body bytes.Buffer
+		zw := gzip.NewWriter(&body)
+		_, _ = zw.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"echo","params":"` + params + `"}`))
+		assert.NoError(zw.Close())
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, &body)
+		req.Header.Set("Content-Encoding", "gzip")
+		rsp, err := http.DefaultClient.Do(req)
+		assert.NoError(err)
+		return rsp
+	}
+	rsp := post("abc")
+	var out map[string]interface{}
+	assert.NoError(json.NewDecoder(rsp.Body).Decode(&out))
+	rsp.Body.Close()
+	assert.Equal("abc", out["result"])
+
+	// compresses to well under the limit, but not once decoded
+	rsp = post(strings.Repeat("a", 10000))
+	rsp.Body.Close()
+	assert.Equal(http.StatusRequestEntityTooLarge, rsp.StatusCode)
+}
+
+func TestHTTPDiscover(t *testing.T) {
+	assert := assert.New(t)
+	s := jsonrpc.New(&TestRPC{}, jsonrpc.WithOpenRPCInfo(jsonrpc.OpenRPCInfo{Title: "test", Version: "1.0.0"}))
+	s.Group("sub", &TestRPC{})
+	srv := httptest.NewServer(jsonrpc.HTTPHandler(s))
+	defer srv.Close()
+
+	rsp, err := http.Post(srv.URL, "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"rpc.discover"}`))
+	assert.NoError(err)
+	defer rsp.Body.Close()
+	var body struct {
+		Result jsonrpc.OpenRPCDocument `json:"result"`
+	}
+	assert.NoError(json.NewDecoder(rsp.Body).Decode(&body))
+	doc := body.Result
+	assert.Equal("1.2.6", doc.OpenRPC)
+	assert.Equal("test", doc.Info.Title)
+
+	methods := map[string]jsonrpc.OpenRPCMethod{}
+	for _, m := range doc.Methods {
+		methods[m.Name] = m
+	}
+	assert.NotContains(methods, "rpc.discover")
+	assert.Contains(methods, "sub/Foo")
+	assert.Equal("string", methods["Foo"].Params[0].Schema["type"])
+	assert.Equal("integer", methods["Foo"].Result.Schema["type"])
+
+	fooStruct := methods["FooStruct"]
+	assert.Equal("by-name", fooStruct.ParamStructure)
+	assert.Equal("foo", fooStruct.Params[0].Name)
+	assert.True(fooStruct.Params[0].Required)
+	assert.Equal("#/components/schemas/FooStructResult", fooStruct.Result.Schema["$ref"])
+	assert.Contains(doc.Components.Schemas, "FooStructResult")
+
+	positional := methods["FooPositional"]
+	assert.Equal("by-position", positional.ParamStructure)
+	assert.Len(positional.Params, 3)
+	assert.Equal("null", methods["FooNotify"].Result.Schema["type"])
+}
+
+func TestDescribe(t *testing.T) {
+	assert := assert.New(t)
+	s := jsonrpc.New(&TestRPC{}, jsonrpc.WithMethodDoc("Foo", "Foo returns 123."))
+	s.Group("sub", &TestRPC{})
+	methods := map[string]jsonrpc.MethodInfo{}
+	for _, m := range s.Describe() {
+		methods[m.Name] = m
+	}
+	assert.NotContains(methods, "rpc.methods")
+	assert.Contains(methods, "sub/Foo")
+	assert.Equal("Foo returns 123.", methods["Foo"].Doc)
+	assert.Equal(reflect.TypeOf(0), methods["Foo"].Result)
+	assert.Len(methods["FooPositional"].Params, 3)
+	assert.Nil(methods["FooNotify"].Result)
+	assert.Equal("Foo returns 123.", s.OpenRPC().Methods[0].Description)
+
+	c := jsonrpctest.NewClient(t, s)
+	var listed []struct {
+		Name   string   `json:"name"`
+		Doc    string   `json:"doc"`
+		Params []string `json:"params"`
+		Result string   `json:"result"`
+	}
+	c.MustCall("rpc.methods", nil, &listed)
+	assert.Equal("Foo", listed[0].Name)
+	assert.Equal("Foo returns 123.", listed[0].Doc)
+	assert.Equal([]string{"string"}, listed[0].Params)
+	assert.Equal("int", listed[0].Result)
+}
@@ -0,0 +1,123 @@
+package jsonrpc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// ID identifies a request. It may be a string, a number or null, and keeps
+// the JSON it was decoded from so it is echoed back exactly as sent.
+type ID struct {
+	raw string
+}
+
+// Int64ID returns a numeric ID.
+func Int64ID(n int64) ID {
+	return ID{strconv.FormatInt(n, 10)}
+}
+
+// StringID returns a string ID.
+func StringID(s string) ID {
+	b, _ := json.Marshal(s)
+	return ID{string(b)}
+}
+
+// IsNull reports whether the id was sent as null.
+func (id ID) IsNull() bool {
+	return id.raw == "" || id.raw == "null"
+}
+
+// String returns the id as text, without quotes for string ids.
+func (id *ID) String() string {
+	if id == nil || id.IsNull() {
+		return "null"
+	}
+	if id.raw[0] == '"' {
+		var s string
+		if json.Unmarshal([]byte(id.raw), &s) == nil {
+			return s
+		}
+	}
+	return id.raw
+}
+
+func (id ID) MarshalJSON() ([]byte, error) {
+	if id.IsNull() {
+		return []byte("null"), nil
+	}
+	return []byte(id.raw), nil
+}
+
+func (id *ID) UnmarshalJSON(b []byte) error {
+	switch {
+	case string(b) == "null":
+		*id = ID{}
+	case len(b) > 0 && (b[0] == '"' || b[0] == '-' || b[0] >= '0' && b[0] <= '9'):
+		*id = ID{string(b)}
+	default:
+		return fmt.Errorf("invalid id: %s", b)
+	}
+	return nil
+}
+
+// IDGenerator returns the ids of calls made from one end of a connection, to
+// the other end. It is shared by the connections it is set for, so it must be
+// safe for concurrent use, and must not return an id still pending.
+type IDGenerator func() ID
+
+// WithIDGenerator sets how the ids of calls from the server to its clients
+// are made, e.g. PrefixedIDs so they can't be mistaken for the client's.
+// By default each connection numbers them from 1.
+func WithIDGenerator(gen IDGenerator) Option {
+	return func(s *Server) {
+		s.idGenerator = gen
+	}
+}
+
+// WithClientIDGenerator sets how the ids of the client's calls are made,
+// e.g. UUIDv7IDs to trace them across the logs of several systems. By
+// default they are numbered from 1.
+func WithClientIDGenerator(gen IDGenerator) ClientOption {
+	return func(c *Client) {
+		c.idGenerator = gen
+	}
+}
+
+// SequentialIDs returns a generator of the numeric ids 1, 2, 3, ...
+func SequentialIDs() IDGenerator {
+	var n int64
+	return func() ID {
+		return Int64ID(atomic.AddInt64(&n, 1))
+	}
+}
+
+// PrefixedIDs returns a generator of the string ids prefix+"1", prefix+"2",
+// and so on.
+func PrefixedIDs(prefix string) IDGenerator {
+	var n int64
+	return func() ID {
+		return StringID(prefix + strconv.FormatInt(atomic.AddInt64(&n, 1), 10))
+	}
+}
+
+// UUIDv7IDs returns a generator of string ids that are UUIDv7s, unique
+// across processes and ordered by creation time.
+func UUIDv7IDs() IDGenerator {
+	return func() ID {
+		var b [16]byte
+		ms := uint64(time.Now().UnixMilli())
+		for i := 0; i < 6; i++ {
+			b[i] = byte(ms >> (40 - 8*i))
+		}
+		_, _ = rand.Read(b[6:])
+		b[6] = b[6]&0x0f | 0x70 // version 7
+		b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+		h := hex.EncodeToString(b[:])
+		return StringID(h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:])
+	}
+}
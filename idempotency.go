@@ -0,0 +1,121 @@
+package jsonrpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WithIdempotency caches each response for ttl and answers retransmitted
+// requests with it instead of running the handler again, so that methods
+// run at most once over transports that resend. A request is a retransmission
+// if it has the same idempotencyKey member as an earlier one from the same
+// authenticated identity, which clients set with WithIdempotencyKey, or else
+// the same id, method and params on the same connection. Requests are
+// authorized before their cached response is looked up.
+// A retransmission that arrives while the first is running waits for it.
+func WithIdempotency(ttl time.Duration) Option {
+	return func(s *Server) {
+		s.idempotency = &responseCache{ttl: ttl, entries: map[string]*cachedResponse{}}
+	}
+}
+
+type idempotencyKeyCtxKey struct{}
+
+// WithIdempotencyKey returns a context whose calls carry key as their
+// idempotencyKey, so a server using WithIdempotency runs them once even if
+// they are retried, e.g. by a ReconnectingClient with RetryPending.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtxKey{}, key)
+}
+
+func idempotencyKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyCtxKey{}).(string)
+	return key
+}
+
+type responseCache struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*cachedResponse
+	lastSweep time.Time
+}
+
+type cachedResponse struct {
+	done    chan struct{}
+	rsp     *Response
+	expires time.Time
+}
+
+// idempotencyKey returns the key req is cached under, if any.
+func idempotencyKey(ctx context.Context, req *Request) string {
+	if req.IdempotencyKey != "" {
+		// keys are picked by clients, so one caller must not get another's
+		// response by reusing its key
+		var identity string
+		if id := IdentityFromContext(ctx); id != nil {
+			identity = fmt.Sprintf("%T\x00%#v", id, id)
+		}
+		return fmt.Sprintf("key:%s\x00%s\x00%s", req.Method, req.IdempotencyKey, identity)
+	}
+	if conn := ConnFromContext(ctx); conn != nil {
+		// a client reusing ids for different calls must not get cached answers
+		var params []byte
+		if req.Params != nil {
+			params = *req.Params
+		}
+		sum := sha256.Sum256(params)
+		return fmt.Sprintf("id:%d:%s:%s:%x", conn.id, req.ID.raw, req.Method, sum)
+	}
+	return ""
+}
+
+// do returns the cached response for key, or calls fn and caches its
+// response. The cached response is given req's id.
+func (c *responseCache) do(key string, req *Request, fn func() *Response) *Response {
+	if key == "" {
+		return fn()
+	}
+	now := time.Now()
+	c.mu.Lock()
+	c.sweep(now)
+	e, ok := c.entries[key]
+	if ok && e.rsp != nil && now.After(e.expires) {
+		ok = false
+	}
+	if !ok {
+		e = &cachedResponse{done: make(chan struct{})}
+		c.entries[key] = e
+	}
+	c.mu.Unlock()
+	if ok {
+		<-e.done
+		rsp := *e.rsp
+		rsp.ID = req.ID
+		return &rsp
+	}
+
+	rsp := fn()
+	c.mu.Lock()
+	e.rsp = rsp
+	e.expires = time.Now().Add(c.ttl)
+	c.mu.Unlock()
+	close(e.done)
+	return rsp
+}
+
+// sweep drops expired responses at most once per ttl.
+func (c *responseCache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < c.ttl {
+		return
+	}
+	c.lastSweep = now
+	for key, e := range c.entries {
+		if e.rsp != nil && now.After(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package jsonrpc
+
+import (
+	"context"
+	"reflect"
+)
+
+var (
+	connType   = reflect.TypeOf((*Conn)(nil))
+	loggerType = reflect.TypeOf((*Logger)(nil)).Elem()
+)
+
+// provider resolves an injected handler argument for a call.
+type provider func(ctx context.Context) (reflect.Value, error)
+
+// WithProvider makes fn supply handler arguments of type T, so handlers can
+// take a service as an argument after the context instead of fetching it
+// from a context value. fn runs on every call; if it fails, the call fails
+// with its error. Injected arguments aren't read from params, so the rest
+// keep their positions.
+//
+// Handlers can always take the *Conn they were called on, which is nil for
+// HTTP requests, and the server's Logger.
+func WithProvider[T any](fn func(ctx context.Context) (T, error)) Option {
+	return func(s *Server) {
+		if s.providers == nil {
+			s.providers = map[reflect.Type]provider{}
+		}
+		s.providers[reflect.TypeOf((*T)(nil)).Elem()] = func(ctx context.Context) (reflect.Value, error) {
+			v, err := fn(ctx)
+			return reflect.ValueOf(&v).Elem(), err
+		}
+	}
+}
+
+// provider returns what resolves arguments of type t, or nil if they are
+// params.
+func (s *Server) provider(t reflect.Type) provider {
+	if p := s.providers[t]; p != nil {
+		return p
+	}
+	switch t {
+	case connType:
+		return func(ctx context.Context) (reflect.Value, error) {
+			return reflect.ValueOf(ConnFromContext(ctx)), nil
+		}
+	case loggerType:
+		return func(ctx context.Context) (reflect.Value, error) {
+			return reflect.ValueOf(&s.logger).Elem(), nil
+		}
+	}
+	return nil
+}
+
+// newMethod builds the method for fn, injecting the arguments s provides.
+func (s *Server) newMethod(fn reflect.Value) *Method {
+	return newReflectMethod(fn, s.provider)
+}
+
+// injection is an argument resolved by a provider, at index in.
+type injection struct {
+	in      int
+	provide provider
+}
@@ -0,0 +1,110 @@
+package interop_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/rpc"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jdxcode/jsonrpc"
+	"github.com/jdxcode/jsonrpc/interop"
+	"github.com/jdxcode/jsonrpc/jsonrpctest"
+)
+
+type Args struct {
+	A, B int
+}
+
+type Arith int
+
+func (t *Arith) Multiply(args *Args, reply *int) error {
+	*reply = args.A * args.B
+	return nil
+}
+
+func (t *Arith) Divide(args *Args, reply *int) error {
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	*reply = args.A / args.B
+	return nil
+}
+
+func TestNetRPC(t *testing.T) {
+	assert := assert.New(t)
+	legacy := rpc.NewServer()
+	assert.NoError(legacy.Register(new(Arith)))
+	s := jsonrpc.New(&struct{}{})
+	s.Mount("legacy/", interop.NetRPC(legacy))
+	c := jsonrpctest.NewClient(t, s)
+
+	var product int
+	c.MustCall("legacy/Arith.Multiply", Args{6, 7}, &product)
+	assert.Equal(42, product)
+	c.MustCall("legacy/Arith.Multiply", []Args{{2, 3}}, &product)
+	assert.Equal(6, product)
+
+	err := c.CallError("legacy/Arith.Divide", Args{1, 0}, jsonrpc.CodeServerError)
+	assert.Equal("divide by zero", err.Message)
+	c.CallError("legacy/Arith.Missing", Args{}, jsonrpc.CodeMethodNotFound)
+	c.CallError("legacy/Arith.Multiply", "nope", jsonrpc.CodeInvalidParams)
+}
+
+// message stands in for jsonrpc2.Message.
+type message map[string]interface{}
+
+type chanStream chan message
+
+func (c chanStream) Read(ctx context.Context) (message, int64, error) {
+	select {
+	case msg, ok := <-c:
+		if !ok {
+			return nil, 0, io.EOF
+		}
+		return msg, 0, nil
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	}
+}
+
+func (c chanStream) Write(ctx context.Context, msg message) (int64, error) {
+	select {
+	case c <- msg:
+		return 0, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func TestSocket(t *testing.T) {
+	assert := assert.New(t)
+	encode := func(m message) ([]byte, error) { return json.Marshal(m) }
+	decode := func(b []byte) (message, error) {
+		var m message
+		return m, json.Unmarshal(b, &m)
+	}
+	in, out := make(chanStream), make(chanStream)
+	server := interop.NewSocket(interop.Stream[message]{Reader: in, Writer: out, Encode: encode, Decode: decode})
+	client := interop.NewSocket(interop.Stream[message]{Reader: out, Writer: in, Encode: encode, Decode: decode})
+
+	s := jsonrpc.New(&struct{}{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger))
+	assert.NoError(s.Register("upper", func(ctx context.Context, s string) (string, error) {
+		return s + "!", nil
+	}))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Handle(context.Background(), server)
+	}()
+	c := jsonrpc.NewClient(client, jsonrpc.WithClientLogger(jsonrpc.DiscardLogger))
+	var result string
+	assert.NoError(c.Call(context.Background(), "upper", "hi", &result))
+	assert.Equal("hi!", result)
+	c.Close()
+	server.Close()
+	<-done
+}
@@ -0,0 +1,79 @@
+package interop
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+)
+
+// Stream is the reading and writing half of a golang.org/x/exp/jsonrpc2
+// connection, such as what a jsonrpc2.Framer returns, with M being
+// jsonrpc2.Message. Encode and Decode are jsonrpc2.EncodeMessage and
+// jsonrpc2.DecodeMessage. It is generic so this package need not depend on
+// x/exp:
+//
+//	sock := interop.NewSocket(interop.Stream[jsonrpc2.Message]{
+//		Reader: framer.Reader(conn),
+//		Writer: framer.Writer(conn),
+//		Encode: jsonrpc2.EncodeMessage,
+//		Decode: jsonrpc2.DecodeMessage,
+//		Closer: conn,
+//	})
+type Stream[M any] struct {
+	Reader interface {
+		Read(context.Context) (M, int64, error)
+	}
+	Writer interface {
+		Write(context.Context, M) (int64, error)
+	}
+	Encode func(M) ([]byte, error)
+	Decode func([]byte) (M, error)
+	Closer io.Closer
+}
+
+// NewSocket returns a jsonrpc.Socket reading and writing messages on s.
+// jsonrpc2 has no batches, so writing one fails to decode.
+func NewSocket[M any](s Stream[M]) *Socket[M] {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Socket[M]{s, ctx, cancel}
+}
+
+type Socket[M any] struct {
+	stream Stream[M]
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (s *Socket[M]) ReadJSON(v interface{}) error {
+	msg, _, err := s.stream.Reader.Read(s.ctx)
+	if err != nil {
+		return err
+	}
+	b, err := s.stream.Encode(msg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func (s *Socket[M]) WriteJSON(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	msg, err := s.stream.Decode(b)
+	if err != nil {
+		return err
+	}
+	_, err = s.stream.Writer.Write(s.ctx, msg)
+	return err
+}
+
+// Close cancels reads and writes in progress and closes the stream's Closer.
+func (s *Socket[M]) Close() error {
+	s.cancel()
+	if s.stream.Closer == nil {
+		return nil
+	}
+	return s.stream.Closer.Close()
+}
@@ -0,0 +1,93 @@
+// Package interop adapts net/rpc services and golang.org/x/exp/jsonrpc2
+// streams to this package, for migrating to it incrementally.
+package interop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/rpc"
+	"strings"
+
+	"github.com/jdxcode/jsonrpc"
+)
+
+// NetRPC returns a server that calls the services registered on srv by their
+// net/rpc names, e.g. "Arith.Multiply", so they can be mounted next to native
+// methods:
+//
+//	rpc.Mount("legacy/", interop.NetRPC(legacy))
+//
+// Params may be given bare or wrapped in a one element array, as sent by
+// net/rpc/jsonrpc clients.
+func NetRPC(srv *rpc.Server) *jsonrpc.Server {
+	s := jsonrpc.New(&struct{}{})
+	s.Use(func(ctx context.Context, req *jsonrpc.Request, next jsonrpc.Handler) (*jsonrpc.Response, error) {
+		var params json.RawMessage
+		if req.Params != nil {
+			params = json.RawMessage(*req.Params)
+		}
+		codec := &netRPCCodec{method: req.Method, params: params}
+		err := srv.ServeRequest(codec)
+		switch {
+		case codec.bodyErr != nil:
+			return nil, jsonrpc.ErrInvalidParams.WithMessage(codec.bodyErr.Error())
+		case codec.errMsg != "":
+			if strings.HasPrefix(codec.errMsg, "rpc: can't find") {
+				return nil, jsonrpc.ErrMethodNotFound.WithMessage(codec.errMsg)
+			}
+			return nil, errors.New(codec.errMsg)
+		case err != nil:
+			return nil, err
+		}
+		return &jsonrpc.Response{ID: req.ID, Result: codec.reply, JSONRPC: "2.0"}, nil
+	})
+	return s
+}
+
+// netRPCCodec feeds a single request to a net/rpc server and keeps its reply.
+type netRPCCodec struct {
+	method  string
+	params  json.RawMessage
+	read    bool
+	bodyErr error
+	reply   interface{}
+	errMsg  string
+}
+
+func (c *netRPCCodec) ReadRequestHeader(r *rpc.Request) error {
+	if c.read {
+		return errors.New("interop: one request per codec")
+	}
+	c.read = true
+	r.ServiceMethod = c.method
+	return nil
+}
+
+func (c *netRPCCodec) ReadRequestBody(body interface{}) error {
+	if body == nil || len(c.params) == 0 {
+		return nil
+	}
+	params := c.params
+	var elems []json.RawMessage
+	if params[0] == '[' && json.Unmarshal(params, &elems) == nil && len(elems) == 1 {
+		params = elems[0]
+	}
+	if err := json.Unmarshal(params, body); err != nil {
+		c.bodyErr = err
+		return err
+	}
+	return nil
+}
+
+func (c *netRPCCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	c.errMsg = r.Error
+	if r.Error == "" {
+		c.reply = body
+	}
+	return nil
+}
+
+func (c *netRPCCodec) Close() error {
+	return nil
+}
@@ -0,0 +1,46 @@
+package jsonrpc
+
+import (
+	"context"
+	"time"
+)
+
+// ContextSocket is a Socket whose reads can be interrupted. Handle reads
+// with ReadJSONContext when the socket implements it, so a read waiting on a
+// quiet peer returns once ctx is done or the connection stops reading, e.g.
+// on Shutdown, rather than lingering until the socket is closed. It should
+// return ctx.Err() when interrupted.
+type ContextSocket interface {
+	Socket
+	ReadJSONContext(ctx context.Context, v interface{}) error
+}
+
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// readWithContext runs read, interrupting it when ctx is done by moving the
+// read deadline of r into the past if r has one, as net.Conn and pipes do.
+// Otherwise read runs to completion.
+func readWithContext(ctx context.Context, r interface{}, read func() error) error {
+	d, ok := r.(readDeadliner)
+	if !ok || ctx.Done() == nil {
+		return read()
+	}
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			_ = d.SetReadDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+	err := read()
+	close(stop)
+	<-stopped
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
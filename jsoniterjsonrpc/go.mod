@@ -0,0 +1,19 @@
+module github.com/jdxcode/jsonrpc/jsoniterjsonrpc
+
+go 1.18
+
+require (
+	github.com/jdxcode/jsonrpc v0.0.0
+	github.com/json-iterator/go v1.1.12
+	github.com/stretchr/testify v1.10.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/modern-go/concurrent v0.0.0-20180228061459-e0a39a4cb421 // indirect
+	github.com/modern-go/reflect2 v1.0.2 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/jdxcode/jsonrpc => ../
@@ -0,0 +1,16 @@
+// Package jsoniterjsonrpc makes jsonrpc marshal messages and decode params
+// with json-iterator when imported:
+//
+//	import _ "github.com/jdxcode/jsonrpc/jsoniterjsonrpc"
+package jsoniterjsonrpc
+
+import (
+	jsoniter "github.com/json-iterator/go"
+
+	"github.com/jdxcode/jsonrpc"
+)
+
+func init() {
+	json := jsoniter.ConfigCompatibleWithStandardLibrary
+	jsonrpc.SetJSONImplementation("github.com/json-iterator/go", json.Marshal, json.Unmarshal)
+}
@@ -0,0 +1,34 @@
+package jsoniterjsonrpc_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jdxcode/jsonrpc"
+	_ "github.com/jdxcode/jsonrpc/jsoniterjsonrpc"
+	"github.com/jdxcode/jsonrpc/jsonrpctest"
+)
+
+type item struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestImplementation(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("github.com/json-iterator/go", jsonrpc.JSONImplementation())
+
+	s := jsonrpc.New(&struct{}{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger))
+	jsonrpc.Register(s, "items", func(ctx context.Context, items []item) ([]item, error) {
+		return append(items, item{ID: 2, Name: "b"}), nil
+	})
+	c := jsonrpctest.NewClient(t, s)
+	var items []item
+	c.MustCall("items", []item{{ID: 1, Name: "a"}}, &items)
+	assert.Equal([]item{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}}, items)
+	// invalid params are reported as with encoding/json
+	err := c.CallError("items", map[string]int{"id": 1}, jsonrpc.CodeInvalidParams)
+	assert.Contains(err.Message, "cannot unmarshal object")
+}
@@ -0,0 +1,343 @@
+// Package jsonrpcgen generates typed Go clients from OpenRPC documents, such
+// as the one a jsonrpc.Server returns from rpc.discover.
+package jsonrpcgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jdxcode/jsonrpc"
+)
+
+// Config controls the generated code.
+type Config struct {
+	// Package is the package name of the generated file. Defaults to "client".
+	Package string
+	// Type is the name of the generated client type. Defaults to "Client".
+	Type string
+}
+
+// FromServer generates a client for the methods registered on s.
+func FromServer(s *jsonrpc.Server, cfg Config) ([]byte, error) {
+	return Generate(s.OpenRPC(), cfg)
+}
+
+// Generate returns the gofmt'd source of a client with one method per RPC in
+// doc, a type for each schema in its components and an Err variable for each
+// documented error, which matches returned errors with errors.Is.
+func Generate(doc *jsonrpc.OpenRPCDocument, cfg Config) ([]byte, error) {
+	if cfg.Package == "" {
+		cfg.Package = "client"
+	}
+	if cfg.Type == "" {
+		cfg.Type = "Client"
+	}
+	// round trip so schemas built in process look like decoded ones
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var d jsonrpc.OpenRPCDocument
+	if err := json.Unmarshal(b, &d); err != nil {
+		return nil, err
+	}
+	g := &generator{doc: &d, cfg: cfg, imports: map[string]bool{"context": true}, names: map[string]bool{},
+		methods: map[string]bool{}}
+	src := g.generate()
+	out, err := format.Source(src)
+	if err != nil {
+		return nil, fmt.Errorf("jsonrpcgen: formatting generated code: %w\n%s", err, src)
+	}
+	return out, nil
+}
+
+type generator struct {
+	doc     *jsonrpc.OpenRPCDocument
+	cfg     Config
+	imports map[string]bool
+	names   map[string]bool
+	methods map[string]bool
+	body    bytes.Buffer
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.body, format, args...)
+}
+
+func (g *generator) generate() []byte {
+	g.names[g.cfg.Type] = true
+	g.names["Caller"] = true
+	g.names["New"+g.cfg.Type] = true
+
+	g.printf("// Caller is implemented by *jsonrpc.Client and *jsonrpc.Conn.\n")
+	g.printf("type Caller interface {\n")
+	g.printf("\tCall(ctx context.Context, method string, params, result interface{}) error\n}\n\n")
+	g.printf("// %s calls the methods of %s.\n", g.cfg.Type, g.doc.Info.Title)
+	g.printf("type %s struct {\n\tc Caller\n}\n\n", g.cfg.Type)
+	g.printf("func New%s(c Caller) *%s {\n\treturn &%s{c}\n}\n\n", g.cfg.Type, g.cfg.Type, g.cfg.Type)
+
+	g.generateErrors()
+	g.generateComponents()
+	for _, m := range g.doc.Methods {
+		g.generateMethod(m)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by jsonrpcgen. DO NOT EDIT.\n\npackage %s\n\nimport (\n", g.cfg.Package)
+	var imports []string
+	for imp := range g.imports {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+	for _, imp := range imports {
+		fmt.Fprintf(&out, "\t%q\n", imp)
+	}
+	out.WriteString(")\n\n")
+	out.Write(g.body.Bytes())
+	return out.Bytes()
+}
+
+func (g *generator) generateErrors() {
+	seen := map[int]bool{}
+	var errs []*jsonrpc.Error
+	for _, m := range g.doc.Methods {
+		for _, e := range m.Errors {
+			if !seen[e.Code] {
+				seen[e.Code] = true
+				errs = append(errs, e)
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Code < errs[j].Code })
+	g.imports["github.com/jdxcode/jsonrpc"] = true
+	g.printf("var (\n")
+	for _, e := range errs {
+		g.printf("\t%s = jsonrpc.NewError(%d, %q)\n", unique(g.names, "Err"+goName(e.Message)), e.Code, e.Message)
+	}
+	g.printf(")\n\n")
+}
+
+func (g *generator) generateComponents() {
+	if g.doc.Components == nil {
+		return
+	}
+	var names []string
+	for name := range g.doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		g.names[goName(name)] = true
+	}
+	for _, name := range names {
+		g.printf("type %s %s\n\n", goName(name), g.goType(g.doc.Components.Schemas[name]))
+	}
+}
+
+func (g *generator) generateMethod(m jsonrpc.OpenRPCMethod) {
+	name := unique(g.methods, goName(m.Name))
+	var args []string
+	params := "nil"
+	switch m.ParamStructure {
+	case "by-name":
+		typ := unique(g.names, name+"Params")
+		g.printf("type %s struct {\n", typ)
+		for _, p := range m.Params {
+			g.printf("\t%s\n", g.field(p.Name, p.Schema, p.Required))
+		}
+		g.printf("}\n\n")
+		args = append(args, "params *"+typ)
+		params = "params"
+	case "by-position":
+		var names []string
+		for i, p := range m.Params {
+			arg := paramName(p.Name, i)
+			args = append(args, arg+" "+g.goType(p.Schema))
+			names = append(names, arg)
+		}
+		params = "[]interface{}{" + strings.Join(names, ", ") + "}"
+	default:
+		if len(m.Params) == 1 {
+			args = append(args, "params "+g.goType(m.Params[0].Schema))
+			params = "params"
+		}
+	}
+
+	sig := strings.Join(append([]string{"ctx context.Context"}, args...), ", ")
+	g.printf("// %s calls %q.\n", name, m.Name)
+	if m.Result == nil || m.Result.Schema["type"] == "null" {
+		g.printf("func (c *%s) %s(%s) error {\n", g.cfg.Type, name, sig)
+		g.printf("\treturn c.c.Call(ctx, %q, %s, nil)\n}\n\n", m.Name, params)
+		return
+	}
+	result := g.goType(m.Result.Schema)
+	if g.isStruct(m.Result.Schema) {
+		g.printf("func (c *%s) %s(%s) (*%s, error) {\n", g.cfg.Type, name, sig, result)
+		g.printf("\tvar result %s\n", result)
+		g.printf("\tif err := c.c.Call(ctx, %q, %s, &result); err != nil {\n\t\treturn nil, err\n\t}\n", m.Name, params)
+		g.printf("\treturn &result, nil\n}\n\n")
+		return
+	}
+	g.printf("func (c *%s) %s(%s) (%s, error) {\n", g.cfg.Type, name, sig, result)
+	g.printf("\tvar result %s\n", result)
+	g.printf("\terr := c.c.Call(ctx, %q, %s, &result)\n", m.Name, params)
+	g.printf("\treturn result, err\n}\n\n")
+}
+
+// goType returns the Go type for a JSON Schema.
+func (g *generator) goType(s jsonrpc.Schema) string {
+	if ref, ok := s["$ref"].(string); ok {
+		return goName(ref[strings.LastIndex(ref, "/")+1:])
+	}
+	switch schemaType(s) {
+	case "boolean":
+		return "bool"
+	case "integer":
+		return "int64"
+	case "number":
+		return "float64"
+	case "string":
+		switch {
+		case s["format"] == "date-time":
+			g.imports["time"] = true
+			return "time.Time"
+		case s["contentEncoding"] == "base64":
+			return "[]byte"
+		}
+		return "string"
+	case "array":
+		return "[]" + g.goType(asSchema(s["items"]))
+	case "object":
+		if props, ok := s["properties"].(map[string]interface{}); ok {
+			required := map[string]bool{}
+			if req, ok := s["required"].([]interface{}); ok {
+				for _, r := range req {
+					required[fmt.Sprint(r)] = true
+				}
+			}
+			var names []string
+			for name := range props {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			var b strings.Builder
+			b.WriteString("struct {\n")
+			for _, name := range names {
+				b.WriteString(g.field(name, asSchema(props[name]), required[name]) + "\n")
+			}
+			b.WriteString("}")
+			return b.String()
+		}
+		if additional, ok := s["additionalProperties"].(map[string]interface{}); ok {
+			return "map[string]" + g.goType(additional)
+		}
+		return "map[string]interface{}"
+	}
+	return "interface{}"
+}
+
+func (g *generator) field(name string, s jsonrpc.Schema, required bool) string {
+	tag := name
+	if !required {
+		tag += ",omitempty"
+	}
+	return fmt.Sprintf("%s %s `json:%s`", goName(name), g.goType(s), strconv.Quote(tag))
+}
+
+func (g *generator) isStruct(s jsonrpc.Schema) bool {
+	if ref, ok := s["$ref"].(string); ok && g.doc.Components != nil {
+		s = g.doc.Components.Schemas[ref[strings.LastIndex(ref, "/")+1:]]
+	}
+	_, ok := s["properties"]
+	return ok
+}
+
+// unique returns name, suffixed with a number if it is already taken.
+func unique(taken map[string]bool, name string) string {
+	n := name
+	for i := 2; taken[n]; i++ {
+		n = fmt.Sprintf("%s%d", name, i)
+	}
+	taken[n] = true
+	return n
+}
+
+// schemaType returns the first non-null type of s.
+func schemaType(s jsonrpc.Schema) string {
+	switch t := s["type"].(type) {
+	case string:
+		return t
+	case []interface{}:
+		for _, t := range t {
+			if t != "null" {
+				return fmt.Sprint(t)
+			}
+		}
+	}
+	return ""
+}
+
+func asSchema(v interface{}) jsonrpc.Schema {
+	s, _ := v.(map[string]interface{})
+	return s
+}
+
+var initialisms = map[string]bool{
+	"API": true, "HTTP": true, "ID": true, "IP": true, "JSON": true, "RPC": true,
+	"URI": true, "URL": true, "UUID": true,
+}
+
+// goName turns an RPC or property name such as "sub/get_user_id" into an
+// exported identifier such as "SubGetUserID".
+func goName(s string) string {
+	var b strings.Builder
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		if initialisms[strings.ToUpper(w)] {
+			b.WriteString(strings.ToUpper(w))
+			continue
+		}
+		r := []rune(w)
+		r[0] = unicode.ToUpper(r[0])
+		b.WriteString(string(r))
+	}
+	name := b.String()
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "X" + name
+	}
+	return name
+}
+
+func paramName(name string, i int) string {
+	n := goName(name)
+	if n == "X" {
+		return fmt.Sprintf("arg%d", i)
+	}
+	r := []rune(n)
+	r[0] = unicode.ToLower(r[0])
+	if n := string(r); !isKeyword(n) && n != "ctx" && n != "c" {
+		return n
+	}
+	return fmt.Sprintf("arg%d", i)
+}
+
+func isKeyword(s string) bool {
+	switch s {
+	case "break", "case", "chan", "const", "continue", "default", "defer", "else", "fallthrough",
+		"for", "func", "go", "goto", "if", "import", "interface", "map", "package", "range",
+		"return", "select", "struct", "switch", "type", "var", "params", "result", "err":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package jsonrpcgen_test
+
+import (
+	"context"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jdxcode/jsonrpc"
+	"github.com/jdxcode/jsonrpc/jsonrpcgen"
+)
+
+type Service struct{}
+
+type User struct {
+	ID      int64     `json:"id"`
+	Name    string    `json:"name"`
+	Friends []*User   `json:"friends,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+type GetUserParams struct {
+	ID int64 `json:"id"`
+}
+
+func (s *Service) GetUser(ctx context.Context, params *GetUserParams) (*User, error) {
+	return nil, nil
+}
+
+func (s *Service) Add(ctx context.Context, a, b int) (int, error) {
+	return a + b, nil
+}
+
+func (s *Service) Echo(ctx context.Context, params string) (string, error) {
+	return params, nil
+}
+
+func (s *Service) Ping(ctx context.Context) error {
+	return nil
+}
+
+func TestGenerate(t *testing.T) {
+	assert := assert.New(t)
+	s := jsonrpc.New(&Service{})
+	s.Group("admin", &Service{})
+	src, err := jsonrpcgen.FromServer(s, jsonrpcgen.Config{Package: "api"})
+	if !assert.NoError(err) {
+		return
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "client.go", src, 0)
+	if !assert.NoError(err) {
+		return
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := conf.Check("api", fset, []*ast.File{f}, nil)
+	if !assert.NoError(err, string(src)) {
+		return
+	}
+
+	client := types.NewPointer(pkg.Scope().Lookup("Client").Type())
+	method := func(name string) string {
+		obj, _, _ := types.LookupFieldOrMethod(client, true, pkg, name)
+		if obj == nil {
+			return ""
+		}
+		return types.TypeString(obj.Type(), types.RelativeTo(pkg))
+	}
+	assert.Equal("func(ctx context.Context, params *GetUserParams) (*User, error)", method("GetUser"))
+	assert.Equal("func(ctx context.Context, arg0 int64, arg1 int64) (int64, error)", method("Add"))
+	assert.Equal("func(ctx context.Context, params string) (string, error)", method("Echo"))
+	assert.Equal("func(ctx context.Context) error", method("Ping"))
+	assert.Equal("func(ctx context.Context) error", method("AdminPing"))
+}
+
+func TestGenerateErrors(t *testing.T) {
+	assert := assert.New(t)
+	s := jsonrpc.New(&Service{}, jsonrpc.WithMethodErrors("GetUser", jsonrpc.NewError(404, "user not found")))
+	src, err := jsonrpcgen.FromServer(s, jsonrpcgen.Config{})
+	assert.NoError(err)
+	assert.Contains(string(src), `ErrUserNotFound = jsonrpc.NewError(404, "user not found")`)
+	assert.Contains(string(src), `"github.com/jdxcode/jsonrpc"`)
+}
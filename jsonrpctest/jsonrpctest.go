@@ -0,0 +1,218 @@
+// Package jsonrpctest provides in-memory sockets and a synchronous client for
+// testing jsonrpc handlers without a network, and a mock server for testing
+// clients.
+package jsonrpctest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jdxcode/jsonrpc"
+)
+
+// NewPipe returns two connected in-memory sockets. Closing either closes both.
+func NewPipe() (jsonrpc.Socket, jsonrpc.Socket) {
+	ab := make(chan []byte)
+	ba := make(chan []byte)
+	closed := make(chan struct{})
+	once := &sync.Once{}
+	return &pipeSocket{ba, ab, closed, once}, &pipeSocket{ab, ba, closed, once}
+}
+
+type pipeSocket struct {
+	in     <-chan []byte
+	out    chan<- []byte
+	closed chan struct{}
+	once   *sync.Once
+}
+
+func (p *pipeSocket) ReadJSON(v interface{}) error {
+	select {
+	case b := <-p.in:
+		return json.Unmarshal(b, v)
+	case <-p.closed:
+		return io.EOF
+	}
+}
+
+func (p *pipeSocket) WriteJSON(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	select {
+	case p.out <- b:
+		return nil
+	case <-p.closed:
+		return io.ErrClosedPipe
+	}
+}
+
+func (p *pipeSocket) Close() error {
+	p.once.Do(func() { close(p.closed) })
+	return nil
+}
+
+// Notification is a notification the server sent to a Client.
+type Notification struct {
+	Method string
+	Params json.RawMessage
+}
+
+// Decode unmarshals the notification's params into v.
+func (n Notification) Decode(v interface{}) error {
+	return json.Unmarshal(n.Params, v)
+}
+
+// Client calls a server over a pipe and records the notifications it sends.
+// Every call is bounded by Timeout, so a stuck handler fails the test instead
+// of hanging it.
+type Client struct {
+	// Client is the underlying client, for calls that need their own context.
+	Client  *jsonrpc.Client
+	Timeout time.Duration
+
+	t        testing.TB
+	handlers *jsonrpc.Server
+	mu       sync.Mutex
+	handled  map[string]bool
+	received []Notification
+	changed  chan struct{}
+}
+
+// NewClient connects a client to s over a pipe. Both ends are closed when the
+// test finishes.
+func NewClient(t testing.TB, s *jsonrpc.Server, opts ...jsonrpc.ClientOption) *Client {
+	c := &Client{
+		Timeout: 5 * time.Second,
+		t:       t,
+		handled: map[string]bool{},
+		changed: make(chan struct{}),
+	}
+	c.handlers = jsonrpc.New(&struct{}{})
+	c.handlers.Use(c.record)
+
+	a, b := NewPipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Handle(context.Background(), b)
+	}()
+	c.Client = jsonrpc.NewClient(a, append([]jsonrpc.ClientOption{jsonrpc.WithServer(c.handlers)}, opts...)...)
+	t.Cleanup(func() {
+		c.Client.Close()
+		<-done
+	})
+	return c
+}
+
+// Handle answers requests and notifications for method sent by the server
+// with fn, which has the shape accepted by Server.Register.
+func (c *Client) Handle(method string, fn interface{}) {
+	c.t.Helper()
+	if err := c.handlers.Register(method, fn); err != nil {
+		c.t.Fatalf("jsonrpctest: handle %s: %v", method, err)
+	}
+	c.mu.Lock()
+	c.handled[method] = true
+	c.mu.Unlock()
+}
+
+func (c *Client) record(ctx context.Context, req *jsonrpc.Request, next jsonrpc.Handler) (*jsonrpc.Response, error) {
+	if req.ID != nil {
+		return next(ctx, req)
+	}
+	n := Notification{Method: req.Method}
+	if req.Params != nil {
+		n.Params = json.RawMessage(*req.Params)
+	}
+	c.mu.Lock()
+	c.received = append(c.received, n)
+	close(c.changed)
+	c.changed = make(chan struct{})
+	handled := c.handled[req.Method]
+	c.mu.Unlock()
+	if !handled {
+		return nil, nil
+	}
+	return next(ctx, req)
+}
+
+// Call calls method, waiting at most Timeout.
+func (c *Client) Call(method string, params, result interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+	return c.Client.Call(ctx, method, params, result)
+}
+
+// Notify sends a notification to the server.
+func (c *Client) Notify(method string, params interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+	return c.Client.Notify(ctx, method, params)
+}
+
+// MustCall calls method and fails the test if it returns an error.
+func (c *Client) MustCall(method string, params, result interface{}) {
+	c.t.Helper()
+	if err := c.Call(method, params, result); err != nil {
+		c.t.Fatalf("jsonrpctest: %s: %v", method, err)
+	}
+}
+
+// CallError calls method and fails the test unless it returns an error with
+// code, which it returns.
+func (c *Client) CallError(method string, params interface{}, code int) *jsonrpc.Error {
+	c.t.Helper()
+	err := c.Call(method, params, nil)
+	var rpcErr *jsonrpc.Error
+	if !errors.As(err, &rpcErr) {
+		c.t.Fatalf("jsonrpctest: %s: expected error %d, got %v", method, code, err)
+		return nil
+	}
+	if rpcErr.Code != code {
+		c.t.Fatalf("jsonrpctest: %s: expected error %d, got %v", method, code, rpcErr)
+	}
+	return rpcErr
+}
+
+// Notifications returns the notifications received so far for method, or
+// all of them if method is empty.
+func (c *Client) Notifications(method string) []Notification {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var ns []Notification
+	for _, n := range c.received {
+		if method == "" || n.Method == method {
+			ns = append(ns, n)
+		}
+	}
+	return ns
+}
+
+// WaitNotifications waits up to Timeout until n notifications for method have
+// been received and returns them, failing the test otherwise.
+func (c *Client) WaitNotifications(method string, n int) []Notification {
+	c.t.Helper()
+	timeout := time.NewTimer(c.Timeout)
+	defer timeout.Stop()
+	for {
+		c.mu.Lock()
+		changed := c.changed
+		c.mu.Unlock()
+		if ns := c.Notifications(method); len(ns) >= n {
+			return ns
+		}
+		select {
+		case <-changed:
+		case <-timeout.C:
+			c.t.Fatalf("jsonrpctest: expected %d %s notifications, got %d", n, method, len(c.Notifications(method)))
+			return nil
+		}
+	}
+}
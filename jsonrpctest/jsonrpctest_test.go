@@ -0,0 +1,87 @@
+package jsonrpctest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jdxcode/jsonrpc"
+	"github.com/jdxcode/jsonrpc/jsonrpctest"
+)
+
+type Service struct{}
+
+func (s *Service) Greet(ctx context.Context, name string) (string, error) {
+	jsonrpc.Notify(ctx, "greeted", name)
+	return "hello " + name, nil
+}
+
+func (s *Service) Ask(ctx context.Context, question string) (string, error) {
+	var answer string
+	err := jsonrpc.ConnFromContext(ctx).Call(ctx, "answer", question, &answer)
+	return answer, err
+}
+
+func TestClient(t *testing.T) {
+	assert := assert.New(t)
+	c := jsonrpctest.NewClient(t, jsonrpc.New(&Service{}))
+
+	var greeting string
+	c.MustCall("Greet", "bob", &greeting)
+	assert.Equal("hello bob", greeting)
+
+	ns := c.WaitNotifications("greeted", 1)
+	var name string
+	assert.NoError(ns[0].Decode(&name))
+	assert.Equal("bob", name)
+
+	err := c.CallError("Missing", nil, jsonrpc.CodeMethodNotFound)
+	assert.Contains(err.Message, "Missing")
+}
+
+func TestClientHandle(t *testing.T) {
+	assert := assert.New(t)
+	c := jsonrpctest.NewClient(t, jsonrpc.New(&Service{}))
+	c.Handle("answer", func(ctx context.Context, question string) (string, error) {
+		return "42", nil
+	})
+
+	var answer string
+	c.MustCall("Ask", "life?", &answer)
+	assert.Equal("42", answer)
+	assert.Empty(c.Notifications(""))
+}
+
+func TestMockServer(t *testing.T) {
+	assert := assert.New(t)
+	m := jsonrpctest.NewMockServer(t)
+	m.Expect("users.get").WithParams(map[string]int{"id": 1}).Return(map[string]string{"name": "bob"}).Once()
+	m.Expect("users.get").ReturnError(jsonrpc.ErrInvalidParams)
+	m.Expect("log")
+	m.Expect("slow").Delay(time.Second).Return("late")
+	m.Expect("crash").CloseConn()
+
+	ctx := context.Background()
+	c := jsonrpc.NewClient(m.Dial(), jsonrpc.WithClientLogger(jsonrpc.DiscardLogger))
+	var user map[string]string
+	assert.NoError(c.Call(ctx, "users.get", map[string]int{"id": 1}, &user))
+	assert.Equal("bob", user["name"])
+	assert.Equal(jsonrpc.ErrInvalidParams, c.Call(ctx, "users.get", map[string]int{"id": 1}, &user))
+	assert.NoError(c.Notify(ctx, "log", "hi"))
+	m.WaitCalls(3)
+
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(c.Call(short, "slow", nil, nil), context.DeadlineExceeded)
+	assert.Error(c.Call(ctx, "crash", nil, nil))
+
+	calls := m.WaitCalls(5)
+	assert.True(calls[2].Notification)
+	var msg string
+	assert.NoError(calls[2].Decode(&msg))
+	assert.Equal("hi", msg)
+	m.AssertCalls("users.get", "users.get", "log", "slow", "crash")
+	m.AssertExpectations()
+}
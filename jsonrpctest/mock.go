@@ -0,0 +1,281 @@
+package jsonrpctest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jdxcode/jsonrpc"
+)
+
+// Call is a request or notification a MockServer received.
+type Call struct {
+	Method       string
+	Params       json.RawMessage
+	Notification bool
+}
+
+// Decode unmarshals the call's params into v.
+func (c Call) Decode(v interface{}) error {
+	return json.Unmarshal(c.Params, v)
+}
+
+// Expectation is a call a MockServer expects, with how to answer it. Its
+// methods configure it and return it, for chaining.
+type Expectation struct {
+	method    string
+	params    interface{}
+	hasParams bool
+	result    interface{}
+	err       *jsonrpc.Error
+	delay     time.Duration
+	closeConn bool
+	times     int
+	calls     int
+}
+
+// WithParams only matches calls whose params are params, compared as JSON.
+func (e *Expectation) WithParams(params interface{}) *Expectation {
+	e.params = params
+	e.hasParams = true
+	return e
+}
+
+// Return answers with result, which defaults to null.
+func (e *Expectation) Return(result interface{}) *Expectation {
+	e.result = result
+	return e
+}
+
+// ReturnError answers with err instead of a result.
+func (e *Expectation) ReturnError(err *jsonrpc.Error) *Expectation {
+	e.err = err
+	return e
+}
+
+// Delay waits d before answering, or until the call is canceled.
+func (e *Expectation) Delay(d time.Duration) *Expectation {
+	e.delay = d
+	return e
+}
+
+// CloseConn drops the connection instead of answering, after any Delay.
+func (e *Expectation) CloseConn() *Expectation {
+	e.closeConn = true
+	return e
+}
+
+// Times only matches the first n calls; later ones go to the next matching
+// expectation, and AssertExpectations fails unless there were exactly n.
+// Without it the expectation matches any number of calls, but at least one.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// Once is Times(1).
+func (e *Expectation) Once() *Expectation {
+	return e.Times(1)
+}
+
+// MockServer answers calls with canned responses declared by the test, to
+// test client code without a real service. Calls nothing expects fail the
+// test and get ErrMethodNotFound, except for built-in methods like
+// rpc.discover.
+type MockServer struct {
+	// Server is the underlying server, e.g. to serve over HTTP or send
+	// notifications.
+	Server *jsonrpc.Server
+	// Timeout bounds WaitCalls.
+	Timeout time.Duration
+
+	t            testing.TB
+	mu           sync.Mutex
+	expectations []*Expectation
+	calls        []Call
+	changed      chan struct{}
+}
+
+// NewMockServer returns a MockServer expecting nothing yet.
+func NewMockServer(t testing.TB) *MockServer {
+	m := &MockServer{
+		Server:  jsonrpc.New(&struct{}{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger)),
+		Timeout: 5 * time.Second,
+		t:       t,
+		changed: make(chan struct{}),
+	}
+	m.Server.Use(m.handle)
+	return m
+}
+
+// Expect expects calls of method and returns the expectation to configure.
+// Calls match the first expectation declared for their method and params
+// with calls left under Times.
+func (m *MockServer) Expect(method string) *Expectation {
+	e := &Expectation{method: method}
+	m.mu.Lock()
+	m.expectations = append(m.expectations, e)
+	m.mu.Unlock()
+	return e
+}
+
+// Dial returns a socket connected to the mock over a pipe, for a client
+// under test. It is closed when the test finishes.
+func (m *MockServer) Dial() jsonrpc.Socket {
+	a, b := NewPipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Server.Handle(context.Background(), b)
+	}()
+	m.t.Cleanup(func() {
+		a.Close()
+		<-done
+	})
+	return a
+}
+
+func (m *MockServer) handle(ctx context.Context, req *jsonrpc.Request, next jsonrpc.Handler) (
+	*jsonrpc.Response, error) {
+	call := Call{Method: req.Method, Notification: req.IsNotification()}
+	if req.Params != nil {
+		call.Params = json.RawMessage(*req.Params)
+	}
+	m.mu.Lock()
+	e := m.match(call)
+	if e != nil {
+		e.calls++
+	}
+	if e != nil || !strings.HasPrefix(req.Method, "rpc.") {
+		m.calls = append(m.calls, call)
+		close(m.changed)
+		m.changed = make(chan struct{})
+	}
+	m.mu.Unlock()
+
+	if e == nil {
+		if strings.HasPrefix(req.Method, "rpc.") {
+			return next(ctx, req)
+		}
+		m.t.Errorf("jsonrpctest: unexpected call %s %s", req.Method, call.Params)
+		return jsonrpc.MethodNotFound(ctx, req)
+	}
+	if e.delay > 0 {
+		timer := time.NewTimer(e.delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+	if e.closeConn {
+		if conn := jsonrpc.ConnFromContext(ctx); conn != nil {
+			conn.Disconnect(errors.New("jsonrpctest: CloseConn"))
+		}
+		return nil, nil
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return &jsonrpc.Response{ID: req.ID, Result: e.result, JSONRPC: "2.0"}, nil
+}
+
+// match returns the expectation for call, if any. m.mu must be held.
+func (m *MockServer) match(call Call) *Expectation {
+	for _, e := range m.expectations {
+		if e.method != call.Method || e.times > 0 && e.calls >= e.times {
+			continue
+		}
+		if e.hasParams && !jsonEqual(e.params, call.Params) {
+			continue
+		}
+		return e
+	}
+	return nil
+}
+
+// jsonEqual reports whether v marshals to the same JSON value as raw.
+func jsonEqual(v interface{}, raw json.RawMessage) bool {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return false
+	}
+	var want, got interface{}
+	if json.Unmarshal(b, &want) != nil {
+		return false
+	}
+	if len(raw) > 0 && json.Unmarshal(raw, &got) != nil {
+		return false
+	}
+	return reflect.DeepEqual(want, got)
+}
+
+// Calls returns the calls received so far, in order.
+func (m *MockServer) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// WaitCalls waits up to Timeout until n calls have been received and
+// returns them, failing the test otherwise.
+func (m *MockServer) WaitCalls(n int) []Call {
+	m.t.Helper()
+	timeout := time.NewTimer(m.Timeout)
+	defer timeout.Stop()
+	for {
+		m.mu.Lock()
+		changed := m.changed
+		m.mu.Unlock()
+		if calls := m.Calls(); len(calls) >= n {
+			return calls
+		}
+		select {
+		case <-changed:
+		case <-timeout.C:
+			m.t.Fatalf("jsonrpctest: expected %d calls, got %d", n, len(m.Calls()))
+			return nil
+		}
+	}
+}
+
+// AssertCalls fails the test unless the methods called so far are exactly
+// methods, in order.
+func (m *MockServer) AssertCalls(methods ...string) bool {
+	m.t.Helper()
+	var got []string
+	for _, c := range m.Calls() {
+		got = append(got, c.Method)
+	}
+	if len(got) == len(methods) && (len(got) == 0 || reflect.DeepEqual(got, methods)) {
+		return true
+	}
+	m.t.Errorf("jsonrpctest: expected calls %v, got %v", methods, got)
+	return false
+}
+
+// AssertExpectations fails the test unless every expectation was called:
+// exactly Times times if set, else at least once.
+func (m *MockServer) AssertExpectations() bool {
+	m.t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ok := true
+	for _, e := range m.expectations {
+		switch {
+		case e.times > 0 && e.calls != e.times:
+			m.t.Errorf("jsonrpctest: expected %s %d times, got %d", e.method, e.times, e.calls)
+			ok = false
+		case e.times == 0 && e.calls == 0:
+			m.t.Errorf("jsonrpctest: expected %s to be called", e.method)
+			ok = false
+		}
+	}
+	return ok
+}
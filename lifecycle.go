@@ -0,0 +1,88 @@
+package jsonrpc
+
+import (
+	"context"
+)
+
+// WithOnConnect sets a function called for each connection served by Handle,
+// after AfterConnect and before any request is read. ctx is the connection's
+// context.
+func WithOnConnect(fn func(ctx context.Context, conn *Conn)) Option {
+	return func(s *Server) {
+		s.onConnect = fn
+	}
+}
+
+// WithOnDisconnect sets a function called once a connection served by Handle
+// has closed and all of its requests have finished. err is the read error that
+// ended the connection, or nil if the server stopped reading, e.g. on Close
+// or Shutdown.
+func WithOnDisconnect(fn func(conn *Conn, err error)) Option {
+	return func(s *Server) {
+		s.onDisconnect = fn
+	}
+}
+
+// WithOnAbandoned sets a function called for each call still running when
+// the peer disconnects, with the call's context, which is cancelled right
+// after, so handlers can stop early. Their responses are dropped.
+// Connections the server closes itself, e.g. on Shutdown, are not
+// abandoned: their calls finish and are answered.
+func WithOnAbandoned(fn func(ctx context.Context, req *Request)) Option {
+	return func(s *Server) {
+		s.onAbandoned = fn
+	}
+}
+
+// abandon cancels the calls still running once the peer is gone.
+func (c *Conn) abandon(fn func(ctx context.Context, req *Request)) {
+	c.mu.Lock()
+	var abandoned []*inflightRequest
+	for _, r := range c.inflight {
+		r.abandoned = true
+		abandoned = append(abandoned, r)
+	}
+	c.mu.Unlock()
+	for _, r := range abandoned {
+		if fn != nil {
+			fn(r.ctx, r.req)
+		}
+		r.cancel()
+	}
+}
+
+// WithOnResponse sets a function called with each request and its final
+// response, errors included, before the response is written. It may modify
+// rsp, e.g. to redact the result, return a different response, or return nil
+// to send nothing. Notifications have no response and are not passed to it.
+func WithOnResponse(fn func(ctx context.Context, req *Request, rsp *Response) *Response) Option {
+	return func(s *Server) {
+		s.onResponse = fn
+	}
+}
+
+// Set stores a value on the connection, e.g. the authenticated user, for
+// later requests to read with Get.
+func (c *Conn) Set(key, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values == nil {
+		c.values = map[interface{}]interface{}{}
+	}
+	c.values[key] = value
+}
+
+// Get returns the value stored for key with Set.
+func (c *Conn) Get(key interface{}) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, ok := c.values[key]
+	return value, ok
+}
+
+// Delete removes the value stored for key.
+func (c *Conn) Delete(key interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.values, key)
+}
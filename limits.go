@@ -0,0 +1,70 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+var (
+	ErrRequestTooLarge  = NewError(CodeInvalidRequest, "request too large")
+	ErrResponseTooLarge = NewError(CodeInternalError, "response too large")
+)
+
+// WithMaxRequestSize rejects incoming messages larger than size bytes with
+// ErrRequestTooLarge, and closes the connection too if closeConn is set. Over
+// HTTP the body is not read past size and the status is 413.
+func WithMaxRequestSize(size int, closeConn bool) Option {
+	return func(s *Server) {
+		s.maxRequestSize = size
+		s.closeOversized = closeConn
+	}
+}
+
+// MaxRequestSize returns the limit set with WithMaxRequestSize, or 0 if there
+// is none, for transports that read requests themselves.
+func (s *Server) MaxRequestSize() int {
+	return s.maxRequestSize
+}
+
+// WithMaxResponseSize replaces results that marshal to more than size bytes
+// with ErrResponseTooLarge, logging the method and size. Interceptors see the
+// error, so it reaches metrics and tracing.
+func WithMaxResponseSize(size int) Option {
+	return func(s *Server) {
+		s.maxResponseSize = size
+	}
+}
+
+// oversized returns the response to an incoming message larger than the
+// limit, which is only addressed to the request when there is a single one.
+func (s *Server) oversized(msg *incoming) *Response {
+	err := ErrRequestTooLarge.WithData(map[string]int{"size": msg.size, "limit": s.maxRequestSize})
+	s.logger.Log(LevelWarn, "request too large", "size", msg.size, "limit", s.maxRequestSize)
+	if !msg.batch && len(msg.reqs) == 1 {
+		if msg.reqs[0].IsNotification() {
+			return nil
+		}
+		return newResponseError(msg.reqs[0].ID, err)
+	}
+	return newResponseError(nil, err)
+}
+
+// limitResult marshals result ahead of the socket when responses are
+// limited, so that it is only marshalled once.
+func (s *Server) limitResult(method string, result interface{}) (interface{}, error) {
+	if s.maxResponseSize <= 0 {
+		return result, nil
+	}
+	b, ok := marshaledResult(result)
+	if !ok {
+		var err error
+		if b, err = jsonMarshal(result); err != nil {
+			return nil, fmt.Errorf("marshal result: %w", err)
+		}
+	}
+	if len(b) > s.maxResponseSize {
+		s.logger.Log(LevelError, "response too large", "method", method, "size", len(b), "limit", s.maxResponseSize)
+		return nil, ErrResponseTooLarge.WithData(map[string]int{"size": len(b), "limit": s.maxResponseSize})
+	}
+	return json.RawMessage(b), nil
+}
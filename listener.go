@@ -0,0 +1,151 @@
+package jsonrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+)
+
+type netConfig struct {
+	maxConns   int
+	streamOpts []StreamOption
+	clientOpts []ClientOption
+	tls        *tls.Config
+}
+
+// NetOption configures Serve, Dial and DialFunc.
+type NetOption func(*netConfig)
+
+// WithMaxConns limits Serve to n connections at a time; further connections
+// wait to be accepted until one closes.
+func WithMaxConns(n int) NetOption {
+	return func(c *netConfig) {
+		c.maxConns = n
+	}
+}
+
+// WithFraming sets how messages are framed on each connection, e.g.
+// WithLengthPrefix. Defaults to newline-delimited JSON.
+func WithFraming(opts ...StreamOption) NetOption {
+	return func(c *netConfig) {
+		c.streamOpts = append(c.streamOpts, opts...)
+	}
+}
+
+// WithDialClientOptions sets the options for clients created by Dial.
+func WithDialClientOptions(opts ...ClientOption) NetOption {
+	return func(c *netConfig) {
+		c.clientOpts = append(c.clientOpts, opts...)
+	}
+}
+
+func newNetConfig(opts []NetOption) *netConfig {
+	c := &netConfig{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Serve accepts connections on l, such as a TCP or Unix socket listener, and
+// handles each as a StreamSocket until ctx is done, when it closes l and
+// returns nil once the connections have been torn down. Otherwise it returns
+// the error that stopped l.
+//
+//	l, err := net.Listen("unix", "/run/app.sock")
+//	...
+//	err = rpc.Serve(ctx, l, jsonrpc.WithMaxConns(100))
+func (s *Server) Serve(ctx context.Context, l net.Listener, opts ...NetOption) error {
+	cfg := newNetConfig(opts)
+	if cfg.tls != nil {
+		l = tls.NewListener(l, cfg.tls)
+	}
+	var sem chan struct{}
+	if cfg.maxConns > 0 {
+		sem = make(chan struct{}, cfg.maxConns)
+	}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.Close()
+		case <-stop:
+		}
+	}()
+	for {
+		if sem != nil {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		nc, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				s.logger.Log(LevelWarn, "accept error", "error", err)
+				if sem != nil {
+					<-sem
+				}
+				continue
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if sem != nil {
+				defer func() { <-sem }()
+			}
+			connCtx := ctx
+			if tc, ok := nc.(*tls.Conn); ok {
+				if err := tc.HandshakeContext(ctx); err != nil {
+					s.logger.Log(LevelInfo, "tls handshake error", "error", err)
+					nc.Close()
+					return
+				}
+				connCtx = ctxWithTLSState(ctx, tc.ConnectionState())
+			}
+			s.Handle(connCtx, NewStreamSocket(nc, cfg.streamOpts...))
+		}()
+	}
+}
+
+// DialFunc returns a Dialer connecting to address on network, e.g. "tcp" or
+// "unix", for use with NewReconnectingClient.
+func DialFunc(network, address string, opts ...NetOption) Dialer {
+	cfg := newNetConfig(opts)
+	return func(ctx context.Context) (Socket, error) {
+		var nc net.Conn
+		var err error
+		if cfg.tls != nil {
+			d := tls.Dialer{Config: cfg.tls}
+			nc, err = d.DialContext(ctx, network, address)
+		} else {
+			var d net.Dialer
+			nc, err = d.DialContext(ctx, network, address)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return NewStreamSocket(nc, cfg.streamOpts...), nil
+	}
+}
+
+// Dial connects a client to a server started with Serve.
+func Dial(ctx context.Context, network, address string, opts ...NetOption) (*Client, error) {
+	sock, err := DialFunc(network, address, opts...)(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(sock, newNetConfig(opts).clientOpts...), nil
+}
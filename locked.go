@@ -0,0 +1,51 @@
+package jsonrpc
+
+import (
+	"context"
+	"sync"
+)
+
+// LockedSocket makes a socket safe for concurrent use by serializing its
+// reads and, separately, its writes, for sockets such as a *websocket.Conn
+// that allow one reader and one writer at a time but are shared, e.g. by a
+// Client and code writing to them directly.
+type LockedSocket struct {
+	sock    Socket
+	readMu  sync.Mutex
+	writeMu sync.Mutex
+}
+
+var _ ContextSocket = (*LockedSocket)(nil)
+
+// NewLockedSocket wraps sock.
+func NewLockedSocket(sock Socket) *LockedSocket {
+	return &LockedSocket{sock: sock}
+}
+
+func (s *LockedSocket) ReadJSON(v interface{}) error {
+	s.readMu.Lock()
+	defer s.readMu.Unlock()
+	return s.sock.ReadJSON(v)
+}
+
+// ReadJSONContext reads with the wrapped socket's ReadJSONContext if it is a
+// ContextSocket, and ReadJSON otherwise.
+func (s *LockedSocket) ReadJSONContext(ctx context.Context, v interface{}) error {
+	cs, ok := s.sock.(ContextSocket)
+	if !ok {
+		return s.ReadJSON(v)
+	}
+	s.readMu.Lock()
+	defer s.readMu.Unlock()
+	return cs.ReadJSONContext(ctx, v)
+}
+
+func (s *LockedSocket) WriteJSON(v interface{}) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.sock.WriteJSON(v)
+}
+
+func (s *LockedSocket) Close() error {
+	return s.sock.Close()
+}
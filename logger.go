@@ -0,0 +1,79 @@
+package jsonrpc
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+}
+
+// Logger receives everything the package logs. keyvals are alternating keys
+// and values so implementations can emit structured records.
+type Logger interface {
+	Log(level Level, msg string, keyvals ...interface{})
+}
+
+// LoggerFunc adapts a function to the Logger interface.
+type LoggerFunc func(level Level, msg string, keyvals ...interface{})
+
+func (f LoggerFunc) Log(level Level, msg string, keyvals ...interface{}) {
+	f(level, msg, keyvals...)
+}
+
+// DiscardLogger drops all log records.
+var DiscardLogger Logger = LoggerFunc(func(Level, string, ...interface{}) {})
+
+// NewStdLogger writes records at or above min to l as "level msg key=value".
+func NewStdLogger(l *log.Logger, min Level) Logger {
+	return &stdLogger{l, min}
+}
+
+type stdLogger struct {
+	logger *log.Logger
+	min    Level
+}
+
+func (l *stdLogger) Log(level Level, msg string, keyvals ...interface{}) {
+	if level < l.min {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		b.WriteByte(' ')
+		fmt.Fprint(&b, keyvals[i])
+		b.WriteByte('=')
+		if i+1 < len(keyvals) {
+			fmt.Fprintf(&b, "%+v", keyvals[i+1])
+		}
+	}
+	l.logger.Print(b.String())
+}
+
+var defaultLogger = NewStdLogger(log.New(os.Stderr, "", log.LstdFlags), LevelInfo)
@@ -0,0 +1,433 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SessionHeader carries the long-poll or SSE session a request belongs to.
+const SessionHeader = "Jsonrpc-Session"
+
+var errSessionClosed = errors.New("jsonrpc: session closed")
+
+type longPollConfig struct {
+	pollTimeout    time.Duration
+	sessionTimeout time.Duration
+	client         *http.Client
+}
+
+// LongPollOption configures the long-poll and SSE transports.
+type LongPollOption func(*longPollConfig)
+
+// WithPollTimeout sets how long a poll waits for messages before returning
+// empty. Defaults to 30 seconds.
+func WithPollTimeout(d time.Duration) LongPollOption {
+	return func(c *longPollConfig) {
+		c.pollTimeout = d
+	}
+}
+
+// WithSessionTimeout sets how long a session is kept without being polled
+// before it is closed. Defaults to two minutes.
+func WithSessionTimeout(d time.Duration) LongPollOption {
+	return func(c *longPollConfig) {
+		c.sessionTimeout = d
+	}
+}
+
+// WithHTTPClient sets the client DialLongPoll makes requests with. Defaults
+// to http.DefaultClient.
+func WithHTTPClient(client *http.Client) LongPollOption {
+	return func(c *longPollConfig) {
+		c.client = client
+	}
+}
+
+func newLongPollConfig(opts []LongPollOption) *longPollConfig {
+	c := &longPollConfig{
+		pollTimeout:    30 * time.Second,
+		sessionTimeout: 2 * time.Minute,
+		client:         http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// LongPollHandler serves s over HTTP long polling, for clients that can't
+// use websockets but still need server notifications and calls. Each
+// session is a connection handled like any other Socket:
+//
+//   - POST without a SessionHeader opens a session and returns
+//     {"session": id}; the request's headers are used for WithAuth
+//   - POST with the header sends the message in the body
+//   - GET with the header waits for messages and returns them as a JSON
+//     array, or 204 No Content once the poll timeout passes
+//   - DELETE with the header closes the session
+//
+// Messages taken by a poll whose response fails to arrive are lost.
+func LongPollHandler(s *Server, opts ...LongPollOption) http.Handler {
+	return &longPollHandler{newHTTPSessions(s, opts)}
+}
+
+// httpSessions are the connections of the HTTP transports, which receive
+// messages by POST and send them back by other means.
+type httpSessions struct {
+	s   *Server
+	cfg *longPollConfig
+
+	mu       sync.Mutex
+	sessions map[string]*pollSession
+}
+
+func newHTTPSessions(s *Server, opts []LongPollOption) *httpSessions {
+	return &httpSessions{s: s, cfg: newLongPollConfig(opts), sessions: map[string]*pollSession{}}
+}
+
+type longPollHandler struct {
+	*httpSessions
+}
+
+func (h *longPollHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(SessionHeader) == "" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "missing "+SessionHeader, http.StatusBadRequest)
+			return
+		}
+		sess, err := h.open(r, h.cfg.sessionTimeout)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]string{"session": sess.id})
+		return
+	}
+	sess := h.lookup(r)
+	if sess == nil {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		h.poll(w, r, sess)
+	case http.MethodPost:
+		h.send(w, r, sess)
+	case http.MethodDelete:
+		sess.Close()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// open starts handling a new session, closing it if it goes unused for
+// timeout, unless timeout is zero.
+func (h *httpSessions) open(r *http.Request, timeout time.Duration) (*pollSession, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	sess := &pollSession{
+		id:    hex.EncodeToString(b),
+		inbox: make(chan json.RawMessage),
+		ready: make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+	sess.onClose = func() {
+		h.mu.Lock()
+		delete(h.sessions, sess.id)
+		h.mu.Unlock()
+	}
+	if timeout > 0 {
+		sess.expiry = time.AfterFunc(timeout, func() { sess.Close() })
+	}
+	h.mu.Lock()
+	h.sessions[sess.id] = sess
+	h.mu.Unlock()
+	go h.s.Handle(ContextWithHTTPRequest(context.Background(), r), sess)
+	return sess, nil
+}
+
+// lookup returns the session named by the SessionHeader, or the session
+// query parameter for clients that can't set headers.
+func (h *httpSessions) lookup(r *http.Request) *pollSession {
+	id := r.Header.Get(SessionHeader)
+	if id == "" {
+		id = r.URL.Query().Get("session")
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.sessions[id]
+}
+
+func (h *httpSessions) send(w http.ResponseWriter, r *http.Request, sess *pollSession) {
+	body := io.Reader(r.Body)
+	if h.s.maxRequestSize > 0 {
+		body = io.LimitReader(r.Body, int64(h.s.maxRequestSize)+1)
+	}
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	select {
+	case sess.inbox <- b:
+		w.WriteHeader(http.StatusAccepted)
+	case <-sess.done:
+		http.Error(w, "session closed", http.StatusGone)
+	case <-r.Context().Done():
+	}
+}
+
+func (h *longPollHandler) poll(w http.ResponseWriter, r *http.Request, sess *pollSession) {
+	sess.expiry.Reset(h.cfg.sessionTimeout + h.cfg.pollTimeout)
+	defer sess.expiry.Reset(h.cfg.sessionTimeout)
+	timer := time.NewTimer(h.cfg.pollTimeout)
+	defer timer.Stop()
+	for {
+		if msgs := sess.take(); len(msgs) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(msgs)
+			return
+		}
+		select {
+		case <-sess.ready:
+		case <-sess.done:
+			http.Error(w, "session closed", http.StatusGone)
+			return
+		case <-timer.C:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// pollSession is the server end of a long-poll session.
+type pollSession struct {
+	id      string
+	inbox   chan json.RawMessage
+	ready   chan struct{}
+	done    chan struct{}
+	expiry  *time.Timer
+	onClose func()
+
+	mu        sync.Mutex
+	outbox    []json.RawMessage
+	closeOnce sync.Once
+}
+
+func (p *pollSession) ReadJSON(v interface{}) error {
+	return p.ReadJSONContext(context.Background(), v)
+}
+
+func (p *pollSession) ReadJSONContext(ctx context.Context, v interface{}) error {
+	select {
+	case msg := <-p.inbox:
+		return json.Unmarshal(msg, v)
+	case <-p.done:
+		return io.EOF
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *pollSession) WriteJSON(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-p.done:
+		return errSessionClosed
+	default:
+	}
+	p.mu.Lock()
+	p.outbox = append(p.outbox, b)
+	p.mu.Unlock()
+	select {
+	case p.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (p *pollSession) take() []json.RawMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	msgs := p.outbox
+	p.outbox = nil
+	return msgs
+}
+
+func (p *pollSession) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.done)
+		if p.expiry != nil {
+			p.expiry.Stop()
+		}
+		p.onClose()
+	})
+	return nil
+}
+
+// DialLongPoll opens a session with a LongPollHandler at url and returns it
+// as a Socket, which polls for messages until closed.
+func DialLongPoll(ctx context.Context, url string, opts ...LongPollOption) (Socket, error) {
+	cfg := newLongPollConfig(opts)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	rsp, err := cfg.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("jsonrpc: open long-poll session: %s", rsp.Status)
+	}
+	var created struct {
+		Session string `json:"session"`
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(&created); err != nil {
+		return nil, err
+	}
+	sock := &pollSocket{
+		url:     url,
+		session: created.Session,
+		client:  cfg.client,
+		msgs:    make(chan json.RawMessage),
+		failed:  make(chan struct{}),
+	}
+	sock.ctx, sock.cancel = context.WithCancel(context.Background())
+	go sock.poll()
+	return sock, nil
+}
+
+// pollSocket is the client end of a long-poll session.
+type pollSocket struct {
+	url     string
+	session string
+	client  *http.Client
+	msgs    chan json.RawMessage
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	failed  chan struct{}
+	readErr error
+
+	writeMu   sync.Mutex
+	closeOnce sync.Once
+}
+
+func (p *pollSocket) request(ctx context.Context, method string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, p.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(SessionHeader, p.session)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return p.client.Do(req)
+}
+
+func (p *pollSocket) poll() {
+	defer close(p.failed)
+	for {
+		msgs, err := p.pollOnce()
+		if err != nil {
+			if p.ctx.Err() != nil {
+				err = io.EOF
+			}
+			p.readErr = err
+			return
+		}
+		for _, msg := range msgs {
+			select {
+			case p.msgs <- msg:
+			case <-p.ctx.Done():
+				p.readErr = io.EOF
+				return
+			}
+		}
+	}
+}
+
+func (p *pollSocket) pollOnce() ([]json.RawMessage, error) {
+	rsp, err := p.request(p.ctx, http.MethodGet, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	switch rsp.StatusCode {
+	case http.StatusOK:
+		var msgs []json.RawMessage
+		err := json.NewDecoder(rsp.Body).Decode(&msgs)
+		return msgs, err
+	case http.StatusNoContent:
+		return nil, nil
+	case http.StatusNotFound, http.StatusGone:
+		return nil, io.EOF
+	}
+	return nil, fmt.Errorf("jsonrpc: long poll: %s", rsp.Status)
+}
+
+func (p *pollSocket) ReadJSON(v interface{}) error {
+	select {
+	case msg := <-p.msgs:
+		return json.Unmarshal(msg, v)
+	case <-p.failed:
+		return p.readErr
+	}
+}
+
+func (p *pollSocket) WriteJSON(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	// one at a time, so messages arrive in order
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	rsp, err := p.request(p.ctx, http.MethodPost, b)
+	if err != nil {
+		return err
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("jsonrpc: long-poll send: %s", rsp.Status)
+	}
+	return nil
+}
+
+// Close closes the session on the server and stops polling.
+func (p *pollSocket) Close() error {
+	var err error
+	p.closeOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		var rsp *http.Response
+		if rsp, err = p.request(ctx, http.MethodDelete, nil); err == nil {
+			rsp.Body.Close()
+		}
+		p.cancel()
+	})
+	return err
+}
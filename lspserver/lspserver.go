@@ -0,0 +1,299 @@
+// Package lspserver is a skeleton for language servers: a jsonrpc.Server
+// that speaks the Language Server Protocol over stdio and implements its
+// lifecycle, so that only the language features are left to register.
+package lspserver
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/jdxcode/jsonrpc"
+)
+
+// CodeServerNotInitialized is LSP's code for requests sent before
+// initialize.
+const CodeServerNotInitialized = -32002
+
+var (
+	ErrServerNotInitialized = jsonrpc.NewError(CodeServerNotInitialized, "server not initialized")
+	ErrShutdown             = jsonrpc.ErrInvalidRequest.WithMessage("server is shutting down")
+)
+
+// InitializeParams are the params of initialize. Capabilities and
+// InitializationOptions are left for the server to decode into the parts it
+// cares about.
+type InitializeParams struct {
+	ProcessID             *int              `json:"processId"`
+	ClientInfo            *Info             `json:"clientInfo,omitempty"`
+	Locale                string            `json:"locale,omitempty"`
+	RootURI               *string           `json:"rootUri"`
+	Capabilities          json.RawMessage   `json:"capabilities"`
+	InitializationOptions json.RawMessage   `json:"initializationOptions,omitempty"`
+	Trace                 string            `json:"trace,omitempty"`
+	WorkspaceFolders      []WorkspaceFolder `json:"workspaceFolders,omitempty"`
+}
+
+// Info names a client or server.
+type Info struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type WorkspaceFolder struct {
+	URI  string `json:"uri"`
+	Name string `json:"name"`
+}
+
+// InitializeResult is the result of initialize.
+type InitializeResult struct {
+	Capabilities interface{} `json:"capabilities"`
+	ServerInfo   *Info       `json:"serverInfo,omitempty"`
+}
+
+// InitializeFunc answers initialize with the server's capabilities, e.g. a
+// struct with a hoverProvider field, given the client's.
+type InitializeFunc func(ctx context.Context, params *InitializeParams) (capabilities interface{}, err error)
+
+type Option func(*Server)
+
+// WithServerInfo sets the serverInfo returned by initialize.
+func WithServerInfo(name, version string) Option {
+	return func(s *Server) {
+		s.info = &Info{Name: name, Version: version}
+	}
+}
+
+// WithOnInitialized is called when the client sends initialized, after which
+// the server may send it requests, e.g. to register capabilities
+// dynamically.
+func WithOnInitialized(fn func(ctx context.Context, conn *jsonrpc.Conn)) Option {
+	return func(s *Server) {
+		s.onInitialized = fn
+	}
+}
+
+// WithOnShutdown is called when the client requests shutdown, to release
+// resources before exit. Its error is the response to shutdown.
+func WithOnShutdown(fn func(ctx context.Context) error) Option {
+	return func(s *Server) {
+		s.onShutdown = fn
+	}
+}
+
+// WithRPCOptions configures the underlying jsonrpc.Server.
+func WithRPCOptions(opts ...jsonrpc.Option) Option {
+	return func(s *Server) {
+		s.rpcOpts = append(s.rpcOpts, opts...)
+	}
+}
+
+type state int
+
+const (
+	stateNew state = iota
+	stateInitialized
+	stateShutdown
+)
+
+// Server is a jsonrpc.Server for one LSP client. Register the language
+// features on it, and document synchronization notifications such as
+// textDocument/didChange with RegisterNotification, which applies them in
+// the order they arrive.
+type Server struct {
+	*jsonrpc.Server
+
+	initialize    InitializeFunc
+	info          *Info
+	onInitialized func(ctx context.Context, conn *jsonrpc.Conn)
+	onShutdown    func(ctx context.Context) error
+	rpcOpts       []jsonrpc.Option
+
+	mu     sync.Mutex
+	state  state
+	params *InitializeParams
+}
+
+// New returns a server that answers initialize with initialize, enforces
+// the lifecycle (requests before initialize fail with
+// ErrServerNotInitialized, and after shutdown with ErrShutdown) and handles
+// initialized, shutdown and exit. $/cancelRequest cancels the context of the
+// request it names, and handlers report progress with WorkDoneFromContext.
+func New(initialize InitializeFunc, opts ...Option) *Server {
+	s := &Server{initialize: initialize}
+	for _, opt := range opts {
+		opt(s)
+	}
+	rpcOpts := append([]jsonrpc.Option{
+		jsonrpc.WithNotificationConcurrency(1),
+		jsonrpc.WithCancelMethod("$/cancelRequest"),
+	}, s.rpcOpts...)
+	s.Server = jsonrpc.New(&struct{}{}, rpcOpts...)
+	s.Use(s.lifecycle)
+	_ = s.Register("initialize", s.handleInitialize)
+	_ = s.Register("shutdown", s.handleShutdown)
+	_ = s.RegisterNotification("initialized", s.handleInitialized)
+	_ = s.RegisterNotification("exit", s.handleExit)
+	return s
+}
+
+// Run serves the client over stdin and stdout, as editors start language
+// servers, and returns the exit code it should exit with.
+func (s *Server) Run(ctx context.Context) int {
+	return s.Serve(ctx, jsonrpc.NewStdioSocket())
+}
+
+// Serve serves the client over sock until it sends exit or disconnects, and
+// returns the exit code LSP calls for: 0 if it asked to shut down first, 1
+// otherwise.
+func (s *Server) Serve(ctx context.Context, sock jsonrpc.Socket) int {
+	s.Handle(ctx, sock)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == stateShutdown {
+		return 0
+	}
+	return 1
+}
+
+// InitializeParams returns the params the client initialized the server with,
+// or nil before initialize.
+func (s *Server) InitializeParams() *InitializeParams {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.params
+}
+
+func (s *Server) lifecycle(ctx context.Context, req *jsonrpc.Request, next jsonrpc.Handler) (*jsonrpc.Response, error) {
+	s.mu.Lock()
+	st := s.state
+	s.mu.Unlock()
+	var err error
+	switch {
+	case req.Method == "exit":
+	case st == stateNew && req.Method != "initialize":
+		err = ErrServerNotInitialized
+	case st == stateShutdown:
+		err = ErrShutdown
+	}
+	if err == nil {
+		return next(ctx, req)
+	}
+	if req.IsNotification() {
+		// dropped, as LSP asks
+		return nil, nil
+	}
+	return nil, err
+}
+
+func (s *Server) handleInitialize(ctx context.Context, params *InitializeParams) (*InitializeResult, error) {
+	s.mu.Lock()
+	if s.params != nil {
+		s.mu.Unlock()
+		return nil, jsonrpc.ErrInvalidRequest.WithMessage("already initialized")
+	}
+	s.params = params
+	s.mu.Unlock()
+	capabilities, err := s.initialize(ctx, params)
+	if err != nil {
+		s.mu.Lock()
+		s.params = nil
+		s.mu.Unlock()
+		return nil, err
+	}
+	s.mu.Lock()
+	s.state = stateInitialized
+	s.mu.Unlock()
+	if capabilities == nil {
+		capabilities = struct{}{}
+	}
+	return &InitializeResult{Capabilities: capabilities, ServerInfo: s.info}, nil
+}
+
+func (s *Server) handleInitialized(ctx context.Context) {
+	if s.onInitialized != nil {
+		s.onInitialized(ctx, jsonrpc.ConnFromContext(ctx))
+	}
+}
+
+func (s *Server) handleShutdown(ctx context.Context) (interface{}, error) {
+	s.mu.Lock()
+	s.state = stateShutdown
+	s.mu.Unlock()
+	if s.onShutdown != nil {
+		if err := s.onShutdown(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (s *Server) handleExit(ctx context.Context) {
+	if conn := jsonrpc.ConnFromContext(ctx); conn != nil {
+		_ = conn.Close()
+	}
+}
+
+// WorkDone reports the progress of a request as LSP work done progress,
+// with $/progress notifications carrying the request's workDoneToken.
+type WorkDone struct {
+	conn  *jsonrpc.Conn
+	token json.RawMessage
+}
+
+type progressParams struct {
+	Token json.RawMessage `json:"token"`
+	Value progressValue   `json:"value"`
+}
+
+type progressValue struct {
+	Kind       string `json:"kind"`
+	Title      string `json:"title,omitempty"`
+	Message    string `json:"message,omitempty"`
+	Percentage *int   `json:"percentage,omitempty"`
+}
+
+// WorkDoneFromContext returns the WorkDone of the request being handled, or
+// nil if the client sent no workDoneToken, in which case its methods do
+// nothing.
+func WorkDoneFromContext(ctx context.Context) *WorkDone {
+	req := jsonrpc.RequestFromContext(ctx)
+	conn := jsonrpc.ConnFromContext(ctx)
+	if req == nil || req.Params == nil || conn == nil {
+		return nil
+	}
+	var params struct {
+		WorkDoneToken json.RawMessage `json:"workDoneToken"`
+	}
+	if json.Unmarshal(*req.Params, &params) != nil || params.WorkDoneToken == nil {
+		return nil
+	}
+	return &WorkDone{conn: conn, token: params.WorkDoneToken}
+}
+
+// Begin starts reporting progress under title.
+func (w *WorkDone) Begin(ctx context.Context, title string) error {
+	return w.send(ctx, progressValue{Kind: "begin", Title: title})
+}
+
+// Report updates the progress with message and, unless it is negative, a
+// percentage.
+func (w *WorkDone) Report(ctx context.Context, message string, percentage int) error {
+	v := progressValue{Kind: "report", Message: message}
+	if percentage >= 0 {
+		v.Percentage = &percentage
+	}
+	return w.send(ctx, v)
+}
+
+// End finishes reporting progress.
+func (w *WorkDone) End(ctx context.Context, message string) error {
+	return w.send(ctx, progressValue{Kind: "end", Message: message})
+}
+
+func (w *WorkDone) send(ctx context.Context, v progressValue) error {
+	if w == nil {
+		return nil
+	}
+	return w.conn.Notify(ctx, "$/progress", &progressParams{Token: w.token, Value: v})
+}
@@ -0,0 +1,88 @@
+package lspserver_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jdxcode/jsonrpc"
+	"github.com/jdxcode/jsonrpc/lspserver"
+)
+
+type capabilities struct {
+	HoverProvider bool `json:"hoverProvider"`
+}
+
+func TestServer(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	initialized := make(chan struct{})
+	shutdown := false
+	s := lspserver.New(func(ctx context.Context, params *lspserver.InitializeParams) (interface{}, error) {
+		assert.Equal("editor", params.ClientInfo.Name)
+		return capabilities{HoverProvider: true}, nil
+	},
+		lspserver.WithServerInfo("test-ls", "1.0"),
+		lspserver.WithOnInitialized(func(ctx context.Context, conn *jsonrpc.Conn) { close(initialized) }),
+		lspserver.WithOnShutdown(func(ctx context.Context) error {
+			shutdown = true
+			return nil
+		}),
+		lspserver.WithRPCOptions(jsonrpc.WithLogger(jsonrpc.DiscardLogger)))
+	assert.NoError(s.Register("textDocument/hover", func(ctx context.Context, params json.RawMessage) (string, error) {
+		w := lspserver.WorkDoneFromContext(ctx)
+		assert.NoError(w.Begin(ctx, "hovering"))
+		assert.NoError(w.Report(ctx, "halfway", 50))
+		assert.NoError(w.End(ctx, ""))
+		return "docs", nil
+	}))
+
+	a, b := net.Pipe()
+	exit := make(chan int)
+	go func() { exit <- s.Serve(ctx, jsonrpc.NewHeaderSocket(b, b, b)) }()
+	progress := make(chan map[string]interface{}, 3)
+	client := jsonrpc.New(&struct{}{})
+	assert.NoError(client.RegisterNotification("$/progress", func(ctx context.Context, p map[string]interface{}) {
+		progress <- p
+	}))
+	c := jsonrpc.NewClient(jsonrpc.NewHeaderSocket(a, a, a), jsonrpc.WithServer(client),
+		jsonrpc.WithClientLogger(jsonrpc.DiscardLogger))
+	defer c.Close()
+
+	err := c.Call(ctx, "textDocument/hover", nil, nil)
+	assert.Equal(lspserver.CodeServerNotInitialized, err.(*jsonrpc.Error).Code)
+
+	var result struct {
+		Capabilities capabilities   `json:"capabilities"`
+		ServerInfo   lspserver.Info `json:"serverInfo"`
+	}
+	init := map[string]interface{}{"processId": nil, "rootUri": nil, "capabilities": map[string]interface{}{},
+		"clientInfo": map[string]string{"name": "editor"}}
+	assert.NoError(c.Call(ctx, "initialize", init, &result))
+	assert.True(result.Capabilities.HoverProvider)
+	assert.Equal(lspserver.Info{Name: "test-ls", Version: "1.0"}, result.ServerInfo)
+	assert.Equal("editor", s.InitializeParams().ClientInfo.Name)
+	err = c.Call(ctx, "initialize", init, nil)
+	assert.Equal(jsonrpc.CodeInvalidRequest, err.(*jsonrpc.Error).Code)
+	assert.NoError(c.Notify(ctx, "initialized", map[string]interface{}{}))
+	<-initialized
+
+	var hover string
+	assert.NoError(c.Call(ctx, "textDocument/hover", map[string]string{"workDoneToken": "t1"}, &hover))
+	assert.Equal("docs", hover)
+	for _, kind := range []string{"begin", "report", "end"} {
+		p := <-progress
+		assert.Equal("t1", p["token"])
+		assert.Equal(kind, p["value"].(map[string]interface{})["kind"])
+	}
+
+	assert.NoError(c.Call(ctx, "shutdown", nil, nil))
+	assert.True(shutdown)
+	err = c.Call(ctx, "textDocument/hover", nil, nil)
+	assert.Equal(jsonrpc.CodeInvalidRequest, err.(*jsonrpc.Error).Code)
+	assert.NoError(c.Notify(ctx, "exit", nil))
+	assert.Equal(0, <-exit)
+}
@@ -0,0 +1,529 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jdxcode/jsonrpc"
+)
+
+// SessionHeader carries the session of streamable HTTP requests, set by the
+// server on the response to initialize.
+const SessionHeader = "Mcp-Session-Id"
+
+// ProtocolVersionHeader carries the protocol version negotiated by
+// initialize on the requests that follow.
+const ProtocolVersionHeader = "Mcp-Protocol-Version"
+
+var errSessionClosed = errors.New("mcp: session closed")
+
+type httpConfig struct {
+	sessionTimeout time.Duration
+	origins        map[string]bool
+}
+
+// HTTPOption configures HTTPHandler.
+type HTTPOption func(*httpConfig)
+
+// WithSessionTimeout closes sessions that have had no request or open stream
+// for d. By default sessions last until the client deletes them.
+func WithSessionTimeout(d time.Duration) HTTPOption {
+	return func(c *httpConfig) {
+		c.sessionTimeout = d
+	}
+}
+
+// WithAllowedOrigins allows requests from browsers on origins, e.g.
+// "https://app.example.com", besides those on the server's own host. Other
+// requests with an Origin header are forbidden, against DNS rebinding.
+func WithAllowedOrigins(origins ...string) HTTPOption {
+	return func(c *httpConfig) {
+		for _, origin := range origins {
+			c.origins[origin] = true
+		}
+	}
+}
+
+// HTTPHandler serves s over MCP's streamable HTTP transport, at a single
+// endpoint:
+//
+//   - POST sends a message. initialize opens a session, returned in the
+//     SessionHeader, which the client sends with everything after. Responses
+//     and notifications get 202 Accepted; requests get their responses, as
+//     JSON, or as an event stream carrying the server's requests and
+//     notifications meanwhile if the client accepts text/event-stream
+//   - GET opens an event stream for the server's messages while no request
+//     is in progress
+//   - DELETE closes the session
+//
+// Each session is a connection handled like any other Socket. Bodies longer
+// than a jsonrpc.WithMaxRequestSize given with WithRPCOptions get 413.
+func HTTPHandler(s *Server, opts ...HTTPOption) http.Handler {
+	cfg := &httpConfig{origins: map[string]bool{}}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return &httpHandler{s: s, cfg: cfg, sessions: map[string]*httpSession{}}
+}
+
+type httpHandler struct {
+	s   *Server
+	cfg *httpConfig
+
+	mu       sync.Mutex
+	sessions map[string]*httpSession
+}
+
+func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.allowed(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	if v := r.Header.Get(ProtocolVersionHeader); v != "" && !supported(v) {
+		http.Error(w, "unsupported protocol version "+v, http.StatusBadRequest)
+		return
+	}
+	if r.Method == http.MethodPost && r.Header.Get(SessionHeader) == "" {
+		h.initialize(w, r)
+		return
+	}
+	h.mu.Lock()
+	sess := h.sessions[r.Header.Get(SessionHeader)]
+	h.mu.Unlock()
+	if sess == nil {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		body, ok := h.readBody(w, r)
+		if !ok {
+			return
+		}
+		h.send(w, r, sess, body)
+	case http.MethodGet:
+		h.listen(w, r, sess)
+	case http.MethodDelete:
+		sess.Close()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *httpHandler) allowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || h.cfg.origins[origin] {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+func supported(version string) bool {
+	for _, v := range SupportedProtocolVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// readBody reads a POST body of up to the server's WithMaxRequestSize,
+// answering 413 for longer ones, or 400 if it fails.
+func (h *httpHandler) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	limit := h.s.MaxRequestSize()
+	body := r.Body
+	if limit > 0 {
+		body = http.MaxBytesReader(w, r.Body, int64(limit))
+	}
+	b, err := ioutil.ReadAll(body)
+	switch {
+	case err != nil && limit > 0 && len(b) >= limit:
+		http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+		return nil, false
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return b, true
+}
+
+// initialize opens a session for a POST without one, which must be
+// initialize.
+func (h *httpHandler) initialize(w http.ResponseWriter, r *http.Request) {
+	body, ok := h.readBody(w, r)
+	if !ok {
+		return
+	}
+	msgs, _ := peek(body)
+	if len(msgs) != 1 || msgs[0].Method != "initialize" {
+		http.Error(w, "missing "+SessionHeader, http.StatusBadRequest)
+		return
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	sess := &httpSession{
+		id:      hex.EncodeToString(b),
+		inbox:   make(chan []byte),
+		done:    make(chan struct{}),
+		waiting: map[string]*httpStream{},
+	}
+	sess.onClose = func() {
+		h.mu.Lock()
+		delete(h.sessions, sess.id)
+		h.mu.Unlock()
+	}
+	if h.cfg.sessionTimeout > 0 {
+		sess.timeout = h.cfg.sessionTimeout
+		sess.expiry = time.AfterFunc(sess.timeout, func() { sess.Close() })
+	}
+	h.mu.Lock()
+	h.sessions[sess.id] = sess
+	h.mu.Unlock()
+	go func() {
+		h.s.Handle(jsonrpc.ContextWithHTTPRequest(context.Background(), r), sess)
+		sess.Close()
+	}()
+	w.Header().Set(SessionHeader, sess.id)
+	h.send(w, r, sess, body)
+}
+
+// send passes the message in body to the session and writes the responses
+// to its requests.
+func (h *httpHandler) send(w http.ResponseWriter, r *http.Request, sess *httpSession, body []byte) {
+	msgs, batch := peek(body)
+	var ids []string
+	for _, msg := range msgs {
+		if msg.Method != "" && msg.ID != nil {
+			ids = append(ids, string(msg.ID))
+		}
+	}
+	sse := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	st := sess.open(ids, sse)
+	defer sess.closeStream(st)
+	select {
+	case sess.inbox <- body:
+	case <-sess.done:
+		http.Error(w, "session closed", http.StatusNotFound)
+		return
+	case <-r.Context().Done():
+		return
+	}
+	if st == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if sse {
+		h.stream(w, r, sess, st)
+		return
+	}
+	var rsps []json.RawMessage
+	for !st.finished() {
+		select {
+		case <-st.ready:
+			rsps = append(rsps, st.take()...)
+		case <-sess.done:
+			http.Error(w, "session closed", http.StatusNotFound)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+	rsps = append(rsps, st.take()...)
+	w.Header().Set("Content-Type", "application/json")
+	if batch {
+		_ = json.NewEncoder(w).Encode(flatten(rsps))
+	} else if len(rsps) > 0 {
+		_, _ = w.Write(rsps[0])
+	}
+}
+
+// listen streams the session's messages that aren't part of a POST.
+func (h *httpHandler) listen(w http.ResponseWriter, r *http.Request, sess *httpSession) {
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		http.Error(w, "must accept text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+	st, ok := sess.listen()
+	if !ok {
+		http.Error(w, "session already has a stream", http.StatusConflict)
+		return
+	}
+	defer sess.closeStream(st)
+	h.stream(w, r, sess, st)
+}
+
+func (h *httpHandler) stream(w http.ResponseWriter, r *http.Request, sess *httpSession, st *httpStream) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		for _, msg := range st.take() {
+			// marshaled JSON has no raw newlines, so it fits one data line
+			if _, err := fmt.Fprintf(w, "event: message\ndata: %s\n\n", msg); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+		if st.finished() {
+			return
+		}
+		select {
+		case <-st.ready:
+		case <-sess.done:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+type peeked struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+}
+
+// peek returns the ids and methods of the messages in b, and whether it is
+// a batch.
+func peek(b []byte) ([]peeked, bool) {
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '[' {
+		var msgs []peeked
+		_ = json.Unmarshal(b, &msgs)
+		return msgs, true
+	}
+	var msg peeked
+	if json.Unmarshal(b, &msg) != nil {
+		return nil, false
+	}
+	return []peeked{msg}, false
+}
+
+// flatten joins the responses to a batch, which the server may have sent in
+// several messages.
+func flatten(msgs []json.RawMessage) []json.RawMessage {
+	out := []json.RawMessage{}
+	for _, msg := range msgs {
+		var batch []json.RawMessage
+		if json.Unmarshal(msg, &batch) == nil {
+			out = append(out, batch...)
+		} else {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
+
+// httpSession is the server end of a streamable HTTP session. The responses
+// it writes go to the stream of the POST with their request, and other
+// messages to the latest POST streaming events, or else the GET stream, or
+// else wait for one.
+type httpSession struct {
+	id      string
+	inbox   chan []byte
+	done    chan struct{}
+	timeout time.Duration
+	expiry  *time.Timer
+	onClose func()
+
+	mu        sync.Mutex
+	waiting   map[string]*httpStream
+	streams   []*httpStream
+	listener  *httpStream
+	backlog   []json.RawMessage
+	active    int
+	closeOnce sync.Once
+}
+
+// httpStream is where the messages for one HTTP response go.
+type httpStream struct {
+	sse   bool
+	ready chan struct{}
+
+	mu      sync.Mutex
+	pending int
+	outbox  []json.RawMessage
+}
+
+func (st *httpStream) push(msg json.RawMessage, answered int) {
+	st.mu.Lock()
+	st.outbox = append(st.outbox, msg)
+	st.pending -= answered
+	st.mu.Unlock()
+	select {
+	case st.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (st *httpStream) take() []json.RawMessage {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	msgs := st.outbox
+	st.outbox = nil
+	return msgs
+}
+
+// finished reports whether every request of a POST has been answered and
+// the responses taken.
+func (st *httpStream) finished() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.pending <= 0 && len(st.outbox) == 0
+}
+
+// open returns the stream for the responses to the requests ids, or nil if
+// there are none.
+func (p *httpSession) open(ids []string, sse bool) *httpStream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.touch(1)
+	if len(ids) == 0 {
+		return nil
+	}
+	st := &httpStream{sse: sse, ready: make(chan struct{}, 1), pending: len(ids)}
+	for _, id := range ids {
+		p.waiting[id] = st
+	}
+	if sse {
+		p.streams = append(p.streams, st)
+	}
+	return st
+}
+
+// listen returns the GET stream, with the messages that were waiting for
+// one, unless the session already has one.
+func (p *httpSession) listen() (*httpStream, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.listener != nil {
+		return nil, false
+	}
+	p.touch(1)
+	st := &httpStream{sse: true, ready: make(chan struct{}, 1), pending: 1, outbox: p.backlog}
+	p.backlog = nil
+	p.listener = st
+	return st, true
+}
+
+func (p *httpSession) closeStream(st *httpStream) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.touch(-1)
+	if st == nil {
+		return
+	}
+	for id, waiting := range p.waiting {
+		if waiting == st {
+			delete(p.waiting, id)
+		}
+	}
+	for i, s := range p.streams {
+		if s == st {
+			p.streams = append(p.streams[:i], p.streams[i+1:]...)
+			break
+		}
+	}
+	if p.listener == st {
+		p.listener = nil
+		p.backlog = append(st.take(), p.backlog...)
+	}
+}
+
+// touch counts the HTTP requests in progress, only letting the session
+// expire while there are none.
+func (p *httpSession) touch(delta int) {
+	p.active += delta
+	if p.expiry == nil {
+		return
+	}
+	if p.active == 0 {
+		p.expiry.Reset(p.timeout)
+	} else {
+		p.expiry.Stop()
+	}
+}
+
+func (p *httpSession) ReadJSON(v interface{}) error {
+	select {
+	case msg := <-p.inbox:
+		return json.Unmarshal(msg, v)
+	case <-p.done:
+		return io.EOF
+	}
+}
+
+func (p *httpSession) WriteJSON(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-p.done:
+		return errSessionClosed
+	default:
+	}
+	msgs, _ := peek(b)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(msgs) > 0 && msgs[0].Method == "" {
+		// responses, which go with their request or are dropped if its POST
+		// has gone
+		var st *httpStream
+		for _, msg := range msgs {
+			if waiting := p.waiting[string(msg.ID)]; waiting != nil {
+				st = waiting
+				delete(p.waiting, string(msg.ID))
+			}
+		}
+		if st != nil {
+			st.push(b, len(msgs))
+		}
+		return nil
+	}
+	switch {
+	case len(p.streams) > 0:
+		p.streams[len(p.streams)-1].push(b, 0)
+	case p.listener != nil:
+		p.listener.push(b, 0)
+	default:
+		p.backlog = append(p.backlog, b)
+	}
+	return nil
+}
+
+func (p *httpSession) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.done)
+		p.mu.Lock()
+		if p.expiry != nil {
+			p.expiry.Stop()
+		}
+		p.mu.Unlock()
+		p.onClose()
+	})
+	return nil
+}
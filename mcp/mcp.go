@@ -0,0 +1,407 @@
+// Package mcp serves the Model Context Protocol: a jsonrpc.Server that
+// implements MCP's lifecycle and tools, over stdio or streamable HTTP.
+// Resources, prompts and other features are plain methods to register on it,
+// advertised with WithCapability.
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/jdxcode/jsonrpc"
+)
+
+// LatestProtocolVersion is the MCP revision offered to clients asking for
+// one the server doesn't support.
+const LatestProtocolVersion = "2025-06-18"
+
+// SupportedProtocolVersions are the MCP revisions the server accepts, latest
+// first.
+var SupportedProtocolVersions = []string{LatestProtocolVersion, "2025-03-26", "2024-11-05"}
+
+var ErrNotInitialized = jsonrpc.ErrInvalidRequest.WithMessage("server not initialized")
+
+// Implementation names a client or server.
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// InitializeParams are the params of initialize. Capabilities are left for
+// the server to decode into the parts it cares about.
+type InitializeParams struct {
+	ProtocolVersion string          `json:"protocolVersion"`
+	Capabilities    json.RawMessage `json:"capabilities"`
+	ClientInfo      Implementation  `json:"clientInfo"`
+}
+
+// InitializeResult is the result of initialize.
+type InitializeResult struct {
+	ProtocolVersion string                 `json:"protocolVersion"`
+	Capabilities    map[string]interface{} `json:"capabilities"`
+	ServerInfo      Implementation         `json:"serverInfo"`
+	Instructions    string                 `json:"instructions,omitempty"`
+}
+
+// Tool describes a tool in the result of tools/list.
+type Tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema jsonrpc.Schema `json:"inputSchema"`
+}
+
+// Content is a piece of a tool's result.
+type Content struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Data     string `json:"data,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+// TextContent returns text as Content.
+func TextContent(text string) Content {
+	return Content{Type: "text", Text: text}
+}
+
+// CallToolResult is the result of tools/call.
+type CallToolResult struct {
+	Content []Content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+type Option func(*Server)
+
+// WithServerInfo sets the serverInfo returned by initialize.
+func WithServerInfo(name, version string) Option {
+	return func(s *Server) {
+		s.info = Implementation{Name: name, Version: version}
+	}
+}
+
+// WithInstructions sets the instructions returned by initialize, hints for
+// the model on how to use the server.
+func WithInstructions(instructions string) Option {
+	return func(s *Server) {
+		s.instructions = instructions
+	}
+}
+
+// WithCapability advertises the capability name with value, e.g.
+// "resources" with {"subscribe": true} for a server that registers
+// resources/list, resources/read and resources/subscribe itself. The tools
+// capability is advertised once a tool is added.
+func WithCapability(name string, value interface{}) Option {
+	return func(s *Server) {
+		s.capabilities[name] = value
+	}
+}
+
+// WithOnInitialized is called when a client sends notifications/initialized,
+// after which the server may send it requests, e.g. sampling/createMessage.
+func WithOnInitialized(fn func(ctx context.Context, conn *jsonrpc.Conn)) Option {
+	return func(s *Server) {
+		s.onInitialized = fn
+	}
+}
+
+// WithRPCOptions configures the underlying jsonrpc.Server.
+func WithRPCOptions(opts ...jsonrpc.Option) Option {
+	return func(s *Server) {
+		s.rpcOpts = append(s.rpcOpts, opts...)
+	}
+}
+
+// Server is a jsonrpc.Server for MCP clients, each of which goes through
+// the lifecycle on its own connection.
+type Server struct {
+	*jsonrpc.Server
+
+	info          Implementation
+	instructions  string
+	capabilities  map[string]interface{}
+	onInitialized func(ctx context.Context, conn *jsonrpc.Conn)
+	rpcOpts       []jsonrpc.Option
+
+	mu    sync.Mutex
+	tools map[string]*tool
+}
+
+type tool struct {
+	Tool
+	call func(ctx context.Context, args json.RawMessage) (*CallToolResult, error)
+}
+
+// session is the lifecycle state of a connection.
+type session struct {
+	mu          sync.Mutex
+	params      *InitializeParams
+	initialized bool
+}
+
+type sessionKey struct{}
+
+// sessionsMu keeps concurrent first requests from creating two sessions.
+var sessionsMu sync.Mutex
+
+// New returns a server that handles initialize, ping and
+// notifications/initialized, and until a client initializes fails its other
+// requests with ErrNotInitialized. notifications/cancelled cancels the
+// context of the request it names, and handlers report progress with
+// ProgressFromContext.
+func New(opts ...Option) *Server {
+	s := &Server{capabilities: map[string]interface{}{}, tools: map[string]*tool{}}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.Server = jsonrpc.New(&struct{}{}, append([]jsonrpc.Option{jsonrpc.WithCancelMethod("")}, s.rpcOpts...)...)
+	s.Use(s.lifecycle)
+	_ = s.Register("initialize", s.handleInitialize)
+	_ = s.Register("ping", func(ctx context.Context) (struct{}, error) { return struct{}{}, nil })
+	_ = s.Register("tools/list", s.listTools)
+	_ = s.Register("tools/call", s.callTool)
+	_ = s.RegisterNotification("notifications/initialized", s.handleInitialized)
+	_ = s.RegisterNotification("notifications/cancelled", s.handleCancelled)
+	return s
+}
+
+// Run serves a client over stdin and stdout as newline-delimited JSON, as
+// MCP hosts start local servers, until stdin is closed.
+func (s *Server) Run(ctx context.Context) {
+	s.Handle(ctx, jsonrpc.NewStreamSocket(stdio{}))
+}
+
+type stdio struct{}
+
+func (stdio) Read(b []byte) (int, error)  { return os.Stdin.Read(b) }
+func (stdio) Write(b []byte) (int, error) { return os.Stdout.Write(b) }
+func (stdio) Close() error                { return os.Stdin.Close() }
+
+// AddTool adds the tool name, called with arguments decoded into T, whose
+// input schema is reflected from T. Errors returned by fn are reported to the
+// model as a result with isError set, except *jsonrpc.Error, which fails the
+// call. Clients are told the tool list changed.
+func AddTool[T any](s *Server, name, description string,
+	fn func(ctx context.Context, args T) (*CallToolResult, error)) {
+	t := &tool{
+		Tool: Tool{Name: name, Description: description, InputSchema: jsonrpc.SchemaOf(reflect.TypeOf((*T)(nil)).Elem())},
+		call: func(ctx context.Context, raw json.RawMessage) (*CallToolResult, error) {
+			var args T
+			if raw != nil {
+				if err := json.Unmarshal(raw, &args); err != nil {
+					return nil, jsonrpc.ErrInvalidParams.WithMessage(err.Error())
+				}
+			}
+			return fn(ctx, args)
+		},
+	}
+	s.mu.Lock()
+	s.tools[name] = t
+	s.capabilities["tools"] = map[string]bool{"listChanged": true}
+	s.mu.Unlock()
+	s.toolsChanged()
+}
+
+// RemoveTool removes the tool name, telling clients the tool list changed.
+func (s *Server) RemoveTool(name string) {
+	s.mu.Lock()
+	delete(s.tools, name)
+	s.mu.Unlock()
+	s.toolsChanged()
+}
+
+func (s *Server) toolsChanged() {
+	_ = s.BroadcastFunc(context.Background(), func(conn *jsonrpc.Conn) bool {
+		sess := sessionOf(conn)
+		sess.mu.Lock()
+		defer sess.mu.Unlock()
+		return sess.initialized
+	}, "notifications/tools/list_changed", nil)
+}
+
+// InitializeParams returns the params conn's client initialized with, or nil
+// before initialize.
+func (s *Server) InitializeParams(conn *jsonrpc.Conn) *InitializeParams {
+	sess := sessionOf(conn)
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.params
+}
+
+func sessionOf(conn *jsonrpc.Conn) *session {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	if v, ok := conn.Get(sessionKey{}); ok {
+		return v.(*session)
+	}
+	sess := &session{}
+	conn.Set(sessionKey{}, sess)
+	return sess
+}
+
+func (s *Server) lifecycle(ctx context.Context, req *jsonrpc.Request, next jsonrpc.Handler) (*jsonrpc.Response, error) {
+	conn := jsonrpc.ConnFromContext(ctx)
+	if conn == nil || req.Method == "initialize" || req.Method == "ping" {
+		return next(ctx, req)
+	}
+	sess := sessionOf(conn)
+	sess.mu.Lock()
+	ok := sess.params != nil
+	sess.mu.Unlock()
+	switch {
+	case ok:
+		return next(ctx, req)
+	case req.IsNotification():
+		return nil, nil
+	}
+	return nil, ErrNotInitialized
+}
+
+func (s *Server) handleInitialize(ctx context.Context, params *InitializeParams) (*InitializeResult, error) {
+	if conn := jsonrpc.ConnFromContext(ctx); conn != nil {
+		sess := sessionOf(conn)
+		sess.mu.Lock()
+		defer sess.mu.Unlock()
+		if sess.params != nil {
+			return nil, jsonrpc.ErrInvalidRequest.WithMessage("already initialized")
+		}
+		sess.params = params
+	}
+	version := LatestProtocolVersion
+	for _, v := range SupportedProtocolVersions {
+		if v == params.ProtocolVersion {
+			version = v
+		}
+	}
+	s.mu.Lock()
+	capabilities := make(map[string]interface{}, len(s.capabilities))
+	for name, v := range s.capabilities {
+		capabilities[name] = v
+	}
+	s.mu.Unlock()
+	return &InitializeResult{
+		ProtocolVersion: version,
+		Capabilities:    capabilities,
+		ServerInfo:      s.info,
+		Instructions:    s.instructions,
+	}, nil
+}
+
+func (s *Server) handleInitialized(ctx context.Context) {
+	conn := jsonrpc.ConnFromContext(ctx)
+	if conn == nil {
+		return
+	}
+	sess := sessionOf(conn)
+	sess.mu.Lock()
+	sess.initialized = true
+	sess.mu.Unlock()
+	if s.onInitialized != nil {
+		s.onInitialized(ctx, conn)
+	}
+}
+
+type cancelledParams struct {
+	RequestID jsonrpc.ID `json:"requestId"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+func (s *Server) handleCancelled(ctx context.Context, params cancelledParams) {
+	if conn := jsonrpc.ConnFromContext(ctx); conn != nil {
+		conn.CancelRequest(params.RequestID)
+	}
+}
+
+type listToolsResult struct {
+	Tools []Tool `json:"tools"`
+}
+
+func (s *Server) listTools(ctx context.Context, params json.RawMessage) (*listToolsResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := &listToolsResult{Tools: []Tool{}}
+	for _, t := range s.tools {
+		result.Tools = append(result.Tools, t.Tool)
+	}
+	sort.Slice(result.Tools, func(i, j int) bool {
+		return result.Tools[i].Name < result.Tools[j].Name
+	})
+	return result, nil
+}
+
+type callToolParams struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+func (s *Server) callTool(ctx context.Context, params callToolParams) (*CallToolResult, error) {
+	s.mu.Lock()
+	t := s.tools[params.Name]
+	s.mu.Unlock()
+	if t == nil {
+		return nil, jsonrpc.ErrInvalidParams.WithMessage(fmt.Sprintf("unknown tool %q", params.Name))
+	}
+	result, err := t.call(ctx, params.Arguments)
+	if err != nil {
+		if _, ok := err.(*jsonrpc.Error); ok {
+			return nil, err
+		}
+		return &CallToolResult{Content: []Content{TextContent(err.Error())}, IsError: true}, nil
+	}
+	if result == nil {
+		result = &CallToolResult{}
+	}
+	if result.Content == nil {
+		result.Content = []Content{}
+	}
+	return result, nil
+}
+
+// Progress reports the progress of a request with notifications/progress,
+// carrying the progressToken the client sent in the request's _meta.
+type Progress struct {
+	conn  *jsonrpc.Conn
+	token json.RawMessage
+}
+
+type progressParams struct {
+	ProgressToken json.RawMessage `json:"progressToken"`
+	Progress      float64         `json:"progress"`
+	Total         float64         `json:"total,omitempty"`
+	Message       string          `json:"message,omitempty"`
+}
+
+// ProgressFromContext returns the Progress of the request being handled, or
+// nil if the client sent no progressToken, in which case Report does
+// nothing.
+func ProgressFromContext(ctx context.Context) *Progress {
+	req := jsonrpc.RequestFromContext(ctx)
+	conn := jsonrpc.ConnFromContext(ctx)
+	if req == nil || req.Params == nil || conn == nil {
+		return nil
+	}
+	var params struct {
+		Meta struct {
+			ProgressToken json.RawMessage `json:"progressToken"`
+		} `json:"_meta"`
+	}
+	if json.Unmarshal(*req.Params, &params) != nil || params.Meta.ProgressToken == nil {
+		return nil
+	}
+	return &Progress{conn: conn, token: params.Meta.ProgressToken}
+}
+
+// Report tells the client how far along the request is: progress out of
+// total, which is 0 if unknown, with an optional message.
+func (p *Progress) Report(ctx context.Context, progress, total float64, message string) error {
+	if p == nil {
+		return nil
+	}
+	return p.conn.Notify(ctx, "notifications/progress", &progressParams{
+		ProgressToken: p.token, Progress: progress, Total: total, Message: message,
+	})
+}
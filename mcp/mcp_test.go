@@ -0,0 +1,210 @@
+package mcp_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jdxcode/jsonrpc"
+	"github.com/jdxcode/jsonrpc/mcp"
+)
+
+type addArgs struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+func newServer(assert *assert.Assertions) *mcp.Server {
+	s := mcp.New(mcp.WithServerInfo("calc", "1.0"), mcp.WithInstructions("adds numbers"),
+		mcp.WithRPCOptions(jsonrpc.WithLogger(jsonrpc.DiscardLogger)))
+	mcp.AddTool(s, "add", "adds a and b", func(ctx context.Context, args addArgs) (*mcp.CallToolResult, error) {
+		p := mcp.ProgressFromContext(ctx)
+		assert.NoError(p.Report(ctx, 1, 2, "halfway"))
+		if args.A < 0 {
+			return nil, errors.New("negative")
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{mcp.TextContent(jsonString(args.A + args.B))}}, nil
+	})
+	return s
+}
+
+func jsonString(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+var initParams = map[string]interface{}{
+	"protocolVersion": "2025-03-26",
+	"capabilities":    map[string]interface{}{},
+	"clientInfo":      map[string]string{"name": "host", "version": "1"},
+}
+
+func TestServer(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	s := newServer(assert)
+
+	a, b := net.Pipe()
+	go s.Handle(ctx, jsonrpc.NewStreamSocket(b))
+	progress := make(chan map[string]interface{}, 1)
+	client := jsonrpc.New(&struct{}{})
+	assert.NoError(client.RegisterNotification("notifications/progress", func(ctx context.Context, p map[string]interface{}) {
+		progress <- p
+	}))
+	c := jsonrpc.NewClient(jsonrpc.NewStreamSocket(a), jsonrpc.WithServer(client),
+		jsonrpc.WithClientLogger(jsonrpc.DiscardLogger))
+	defer c.Close()
+
+	err := c.Call(ctx, "tools/list", nil, nil)
+	assert.Equal(mcp.ErrNotInitialized, err)
+	assert.NoError(c.Call(ctx, "ping", nil, nil))
+
+	var result mcp.InitializeResult
+	assert.NoError(c.Call(ctx, "initialize", initParams, &result))
+	assert.Equal("2025-03-26", result.ProtocolVersion)
+	assert.Equal(mcp.Implementation{Name: "calc", Version: "1.0"}, result.ServerInfo)
+	assert.Equal("adds numbers", result.Instructions)
+	assert.Equal(map[string]interface{}{"listChanged": true}, result.Capabilities["tools"])
+	assert.NoError(c.Notify(ctx, "notifications/initialized", nil))
+
+	var tools struct {
+		Tools []mcp.Tool `json:"tools"`
+	}
+	assert.NoError(c.Call(ctx, "tools/list", nil, &tools))
+	assert.Len(tools.Tools, 1)
+	assert.Equal("add", tools.Tools[0].Name)
+	assert.Equal("object", tools.Tools[0].InputSchema["type"])
+
+	var called mcp.CallToolResult
+	assert.NoError(c.Call(ctx, "tools/call", map[string]interface{}{
+		"name": "add", "arguments": addArgs{A: 1, B: 2}, "_meta": map[string]string{"progressToken": "p1"},
+	}, &called))
+	assert.Equal([]mcp.Content{mcp.TextContent("3")}, called.Content)
+	p := <-progress
+	assert.Equal("p1", p["progressToken"])
+	assert.Equal("halfway", p["message"])
+
+	assert.NoError(c.Call(ctx, "tools/call", map[string]interface{}{"name": "add", "arguments": addArgs{A: -1}}, &called))
+	assert.True(called.IsError)
+	assert.Equal("negative", called.Content[0].Text)
+	err = c.Call(ctx, "tools/call", map[string]interface{}{"name": "sub"}, nil)
+	assert.Equal(jsonrpc.CodeInvalidParams, err.(*jsonrpc.Error).Code)
+}
+
+func TestHTTPHandler(t *testing.T) {
+	assert := assert.New(t)
+	s := newServer(assert)
+	srv := httptest.NewServer(mcp.HTTPHandler(s))
+	defer srv.Close()
+
+	post := func(session, accept, body string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+		req.Header.Set("Accept", accept)
+		if session != "" {
+			req.Header.Set(mcp.SessionHeader, session)
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		assert.NoError(err)
+		return rsp
+	}
+
+	rsp := post("", "application/json", `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	assert.Equal(http.StatusBadRequest, rsp.StatusCode)
+	rsp.Body.Close()
+
+	rsp = post("", "application/json", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":`+jsonString(initParams)+`}`)
+	assert.Equal(http.StatusOK, rsp.StatusCode)
+	session := rsp.Header.Get(mcp.SessionHeader)
+	assert.NotEmpty(session)
+	var init struct {
+		Result mcp.InitializeResult `json:"result"`
+	}
+	assert.NoError(json.NewDecoder(rsp.Body).Decode(&init))
+	rsp.Body.Close()
+	assert.Equal("2025-03-26", init.Result.ProtocolVersion)
+
+	rsp = post(session, "application/json", `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	assert.Equal(http.StatusAccepted, rsp.StatusCode)
+	rsp.Body.Close()
+
+	// the progress notification comes on the stream before the response
+	rsp = post(session, "application/json, text/event-stream", `{"jsonrpc":"2.0","id":"c1","method":"tools/call",`+
+		`"params":{"name":"add","arguments":{"a":2,"b":3},"_meta":{"progressToken":1}}}`)
+	assert.Equal("text/event-stream", rsp.Header.Get("Content-Type"))
+	var events []map[string]interface{}
+	scanner := bufio.NewScanner(rsp.Body)
+	for scanner.Scan() {
+		if data := strings.TrimPrefix(scanner.Text(), "data: "); data != scanner.Text() {
+			var event map[string]interface{}
+			assert.NoError(json.Unmarshal([]byte(data), &event))
+			events = append(events, event)
+		}
+	}
+	rsp.Body.Close()
+	assert.Len(events, 2)
+	assert.Equal("notifications/progress", events[0]["method"])
+	assert.Equal("c1", events[1]["id"])
+	assert.Equal("5", events[1]["result"].(map[string]interface{})["content"].([]interface{})[0].(map[string]interface{})["text"])
+
+	// a GET stream gets the notifications unrelated to requests
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set(mcp.SessionHeader, session)
+	rsp, err := http.DefaultClient.Do(req)
+	assert.NoError(err)
+	lines := bufio.NewScanner(rsp.Body)
+	mcp.AddTool(s, "sub", "", func(ctx context.Context, args addArgs) (*mcp.CallToolResult, error) { return nil, nil })
+	for lines.Scan() && !strings.HasPrefix(lines.Text(), "data: ") {
+	}
+	assert.Contains(lines.Text(), "notifications/tools/list_changed")
+	rsp.Body.Close()
+
+	req, _ = http.NewRequest(http.MethodDelete, srv.URL, nil)
+	req.Header.Set(mcp.SessionHeader, session)
+	rsp, err = http.DefaultClient.Do(req)
+	assert.NoError(err)
+	assert.Equal(http.StatusNoContent, rsp.StatusCode)
+	rsp = post(session, "application/json", `{"jsonrpc":"2.0","id":2,"method":"ping"}`)
+	assert.Equal(http.StatusNotFound, rsp.StatusCode)
+	rsp.Body.Close()
+}
+
+func TestHTTPHandlerMaxRequestSize(t *testing.T) {
+	assert := assert.New(t)
+	s := mcp.New(mcp.WithRPCOptions(jsonrpc.WithLogger(jsonrpc.DiscardLogger), jsonrpc.WithMaxRequestSize(300, false)))
+	srv := httptest.NewServer(mcp.HTTPHandler(s))
+	defer srv.Close()
+
+	post := func(session, body string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		if session != "" {
+			req.Header.Set(mcp.SessionHeader, session)
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		assert.NoError(err)
+		rsp.Body.Close()
+		return rsp
+	}
+	padding := strings.Repeat(" ", 1000)
+
+	rsp := post("", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":`+jsonString(initParams)+padding+`}`)
+	assert.Equal(http.StatusRequestEntityTooLarge, rsp.StatusCode)
+	assert.Empty(rsp.Header.Get(mcp.SessionHeader))
+
+	rsp = post("", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":`+jsonString(initParams)+`}`)
+	assert.Equal(http.StatusOK, rsp.StatusCode)
+	session := rsp.Header.Get(mcp.SessionHeader)
+	rsp = post(session, `{"jsonrpc":"2.0","id":2,"method":"ping"`+padding+`}`)
+	assert.Equal(http.StatusRequestEntityTooLarge, rsp.StatusCode)
+	rsp = post(session, `{"jsonrpc":"2.0","id":3,"method":"ping"}`)
+	assert.Equal(http.StatusOK, rsp.StatusCode)
+}
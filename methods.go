@@ -1,7 +1,11 @@
 package jsonrpc
 
 import (
+	"context"
+	"fmt"
 	"reflect"
+	"sort"
+	"sync"
 )
 
 type Methods map[string]*Method
@@ -9,4 +13,162 @@ type Methods map[string]*Method
 type Method struct {
 	fn         reflect.Value
 	paramsType reflect.Type
+	// set instead of paramsType for methods taking several arguments, which
+	// are read from array params by position
+	argTypes   []reflect.Type
+	resultType reflect.Type
+	// the arguments resolved by providers, and where the params go
+	inject   []injection
+	paramsIn []int
+	// argument slices reused across reflective calls
+	args sync.Pool
+	// the service that registered it, see RegisterService
+	service string
+	// registered with RegisterNotification
+	notification bool
+
+	parse func(params *ParamsRaw, opts *DecodeOptions) (interface{}, error)
+	call  func(ctx context.Context, params interface{}) (interface{}, error)
+}
+
+// Register adds a method called name backed by fn, which may be any function
+// or closure shaped like a handler method without the receiver:
+//
+//	func(ctx context.Context[, params...]) ([result, ][error])
+//
+// It may be called while the server is handling connections. A method already
+// called name is replaced atomically: each request runs either the old or the
+// new handler.
+func (s *Server) Register(name string, fn interface{}) error {
+	v := reflect.ValueOf(fn)
+	if err := checkFunc(v); err != nil {
+		return err
+	}
+	s.updateMethods(func(methods Methods) {
+		methods[name] = s.newMethod(v)
+	})
+	return nil
+}
+
+// Unregister removes the method called name, reporting whether there was
+// one. Requests already running it are not affected.
+func (s *Server) Unregister(name string) bool {
+	var found bool
+	s.updateMethods(func(methods Methods) {
+		_, found = methods[name]
+		delete(methods, name)
+	})
+	return found
+}
+
+// RegisterMap registers each function in methods under its key. Nothing is
+// registered if any of them is not a valid handler.
+func (s *Server) RegisterMap(methods map[string]interface{}) error {
+	for name, fn := range methods {
+		if err := checkFunc(reflect.ValueOf(fn)); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	s.updateMethods(func(m Methods) {
+		for name, fn := range methods {
+			m[name] = s.newMethod(reflect.ValueOf(fn))
+		}
+	})
+	return nil
+}
+
+// RegisterService registers the handler methods of rcvr, a service, as prefix
+// followed by the method name, e.g. "users.Get" for the prefix "users.",
+// named and tagged as for New. Unlike Register, it fails without registering
+// anything if one of them already exists, naming the service that owns it.
+func (s *Server) RegisterService(name, prefix string, rcvr interface{}) error {
+	added := Methods{}
+	for method, m := range s.receiverMethods(reflect.ValueOf(rcvr), true) {
+		m.service = name
+		added[prefix+method] = m
+	}
+	if len(added) == 0 {
+		return fmt.Errorf("jsonrpc: service %s has no handler methods", name)
+	}
+	var err error
+	s.updateMethods(func(methods Methods) {
+		for method := range added {
+			if existing := methods[method]; existing != nil {
+				owner := "the server"
+				if existing.service != "" {
+					owner = "service " + existing.service
+				}
+				err = fmt.Errorf("jsonrpc: service %s: method %s is already registered by %s", name, method, owner)
+				return
+			}
+		}
+		for method, m := range added {
+			methods[method] = m
+		}
+	})
+	return err
+}
+
+// Services lists the methods registered by each service, sorted.
+func (s *Server) Services() map[string][]string {
+	services := map[string][]string{}
+	for name, m := range s.methodSet() {
+		if m.service != "" {
+			services[m.service] = append(services[m.service], name)
+		}
+	}
+	for _, methods := range services {
+		sort.Strings(methods)
+	}
+	return services
+}
+
+// Register adds a method backed by fn. Unlike the methods found on the
+// receiver passed to New, it is called without reflection. Like
+// Server.Register, it may be called while serving and replaces atomically.
+func Register[P, R any](s *Server, name string, fn func(ctx context.Context, params P) (R, error)) {
+	m := &Method{
+		paramsType: reflect.TypeOf((*P)(nil)).Elem(),
+		resultType: reflect.TypeOf((*R)(nil)).Elem(),
+		parse: func(raw *ParamsRaw, opts *DecodeOptions) (interface{}, error) {
+			var params P
+			if raw == nil {
+				return params, nil
+			}
+			if err := opts.unmarshal(*raw, &params); err != nil {
+				return nil, fmt.Errorf("rpc [params unmarshal]: %w", err)
+			}
+			return params, nil
+		},
+		call: func(ctx context.Context, params interface{}) (interface{}, error) {
+			p, _ := params.(P)
+			return fn(ctx, p)
+		},
+	}
+	s.updateMethods(func(methods Methods) {
+		methods[name] = m
+	})
+}
+
+func (s *Server) method(name string) *Method {
+	return s.methodSet()[name]
+}
+
+// methodSet returns the current methods, which must not be modified.
+func (s *Server) methodSet() Methods {
+	return s.methods.Load().(Methods)
+}
+
+// updateMethods applies fn to a copy of the methods and swaps it in, so
+// readers never lock.
+func (s *Server) updateMethods(fn func(methods Methods)) {
+	s.methodsMu.Lock()
+	defer s.methodsMu.Unlock()
+	old := s.methodSet()
+	methods := make(Methods, len(old)+1)
+	for name, m := range old {
+		methods[name] = m
+	}
+	fn(methods)
+	s.methods.Store(methods)
 }
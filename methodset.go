@@ -0,0 +1,64 @@
+package jsonrpc
+
+import "strings"
+
+// WithGatedMethods hides methods from every connection until it enables
+// them with Conn.EnableMethods, e.g. once the client has authenticated as an
+// admin. A name ending in "*" matches every method starting with the rest,
+// e.g. "admin.*".
+func WithGatedMethods(methods ...string) Option {
+	return func(s *Server) {
+		for _, method := range methods {
+			s.gatedMethods = append(s.gatedMethods, methodRule{pattern: method})
+		}
+	}
+}
+
+// methodRule enables or disables the methods matching pattern.
+type methodRule struct {
+	pattern string
+	enabled bool
+}
+
+func (r methodRule) matches(method string) bool {
+	if prefix := strings.TrimSuffix(r.pattern, "*"); prefix != r.pattern {
+		return strings.HasPrefix(method, prefix)
+	}
+	return method == r.pattern
+}
+
+// EnableMethods exposes methods, which may end in "*" as for
+// WithGatedMethods, on the connection, including gated ones.
+func (c *Conn) EnableMethods(methods ...string) {
+	c.addMethodRules(methods, true)
+}
+
+// DisableMethods hides methods, which may end in "*" as for
+// WithGatedMethods, from the connection: calls to them fail with
+// ErrMethodNotFound as if they weren't registered, and rpc.methods leaves
+// them out.
+func (c *Conn) DisableMethods(methods ...string) {
+	c.addMethodRules(methods, false)
+}
+
+func (c *Conn) addMethodRules(methods []string, enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, method := range methods {
+		c.methodRules = append(c.methodRules, methodRule{pattern: method, enabled: enabled})
+	}
+}
+
+// MethodEnabled reports whether method is exposed on the connection: the
+// last call to EnableMethods or DisableMethods matching it decides, or else
+// whether it is gated.
+func (c *Conn) MethodEnabled(method string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := len(c.methodRules) - 1; i >= 0; i-- {
+		if r := c.methodRules[i]; r.matches(method) {
+			return r.enabled
+		}
+	}
+	return true
+}
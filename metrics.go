@@ -0,0 +1,62 @@
+package jsonrpc
+
+import (
+	"time"
+)
+
+// Metrics receives measurements from the server. Implementations must be
+// safe for concurrent use. Requests for unregistered methods are reported
+// with the method UnknownMethod, so clients cannot create arbitrary labels.
+type Metrics interface {
+	RequestStarted(method string)
+	// RequestFinished is called with the error code of the response, or 0
+	// if it succeeded.
+	RequestFinished(method string, duration time.Duration, code int)
+	// Panic is called for every recovered panic, in interceptors too.
+	Panic(method string)
+	MessageRead(bytes int)
+	MessageWritten(bytes int)
+}
+
+const UnknownMethod = "(unknown)"
+
+// WithMetrics reports request counts, latencies, panics and message sizes to
+// m.
+func WithMetrics(m Metrics) Option {
+	return func(s *Server) {
+		s.metrics = m
+	}
+}
+
+func (s *Server) metricsMethod(method string) string {
+	if s.method(method) == nil {
+		return UnknownMethod
+	}
+	return method
+}
+
+// measure wraps a call to the handler chain.
+func (s *Server) measure(req *Request, call func() (*Response, error)) (*Response, error) {
+	if s.metrics == nil && s.stats == nil {
+		return call()
+	}
+	method := s.metricsMethod(req.Method)
+	if s.metrics != nil {
+		s.metrics.RequestStarted(method)
+	}
+	s.stats.started()
+	start := time.Now()
+	rsp, err := call()
+
+	code := 0
+	if err != nil {
+		code = s.toError(err).Code
+	} else if rsp != nil && rsp.Error != nil {
+		code = rsp.Error.Code
+	}
+	if s.metrics != nil {
+		s.metrics.RequestFinished(method, time.Since(start), code)
+	}
+	s.stats.finished(method, time.Since(start), code)
+	return rsp, err
+}
@@ -41,3 +41,31 @@ func beforeRequestNoop(ctx context.Context, method string, params interface{}) (
 	context.Context, error) {
 	return ctx, nil
 }
+
+type (
+	// Handler dispatches a request to its method.
+	Handler func(ctx context.Context, req *Request) (*Response, error)
+
+	// Interceptor wraps method dispatch. It may inspect or modify the request,
+	// short-circuit by returning without calling next, or alter the response.
+	// A returned error is sent to the client as an error response.
+	Interceptor func(ctx context.Context, req *Request, next Handler) (*Response, error)
+)
+
+// Use adds interceptors around method dispatch. They run in the order they
+// were added, the first being the outermost. Use must not be called once the
+// server is handling connections.
+func (s *Server) Use(interceptors ...Interceptor) {
+	s.interceptors = append(s.interceptors, interceptors...)
+	s.handler = chainInterceptors(s.invoke, s.interceptors)
+}
+
+func chainInterceptors(h Handler, interceptors []Interceptor) Handler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], h
+		h = func(ctx context.Context, req *Request) (*Response, error) {
+			return interceptor(ctx, req, next)
+		}
+	}
+	return h
+}
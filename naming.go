@@ -0,0 +1,136 @@
+package jsonrpc
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// NamingStrategy maps the Go name of a receiver's method to the name it is
+// called by, see WithNaming.
+type NamingStrategy func(goName string) string
+
+// WithNaming exposes the methods of the receivers passed to New and
+// RegisterService under the names strategy maps them to, e.g. CamelCase,
+// instead of their Go names. WithMethodName takes precedence.
+func WithNaming(strategy NamingStrategy) Option {
+	return func(s *Server) {
+		s.naming = strategy
+	}
+}
+
+// WithMethodName exposes the receiver method goName as name, e.g.
+// "textDocument/hover" for Hover.
+func WithMethodName(goName, name string) Option {
+	return func(s *Server) {
+		if s.methodNames == nil {
+			s.methodNames = map[string]string{}
+		}
+		s.methodNames[goName] = name
+	}
+}
+
+// WithHiddenMethods keeps the receiver methods named goNames from being
+// exposed, e.g. exported helpers that aren't meant to be called remotely.
+func WithHiddenMethods(goNames ...string) Option {
+	return func(s *Server) {
+		for _, name := range goNames {
+			WithMethodName(name, "-")(s)
+		}
+	}
+}
+
+// CamelCase names GetUserByID "getUserByID" and HTTPStatus "httpStatus".
+func CamelCase(goName string) string {
+	r := []rune(goName)
+	for i := 0; i < len(r) && unicode.IsUpper(r[i]); i++ {
+		// keep the last capital of an initialism that starts a word
+		if i > 0 && i+1 < len(r) && unicode.IsLower(r[i+1]) {
+			break
+		}
+		r[i] = unicode.ToLower(r[i])
+	}
+	return string(r)
+}
+
+// SnakeCase names GetUserByID "get_user_by_id".
+func SnakeCase(goName string) string {
+	r := []rune(goName)
+	var b strings.Builder
+	for i, c := range r {
+		if unicode.IsUpper(c) && i > 0 && r[i-1] != '_' &&
+			(unicode.IsLower(r[i-1]) || i+1 < len(r) && unicode.IsLower(r[i+1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(c))
+	}
+	return b.String()
+}
+
+// SlashCase treats underscores as namespace separators, naming
+// TextDocument_Hover "textDocument/hover" as in the Language Server
+// Protocol.
+func SlashCase(goName string) string {
+	parts := strings.Split(goName, "_")
+	for i, part := range parts {
+		parts[i] = CamelCase(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// methodName returns the name to expose the receiver method goName as, or
+// "" if it is hidden.
+func (s *Server) methodName(goName string) string {
+	name, ok := s.methodNames[goName]
+	switch {
+	case name == "-":
+		return ""
+	case ok:
+		return name
+	case s.naming != nil:
+		return s.naming(goName)
+	}
+	return goName
+}
+
+// receiverMethods builds the methods of rcvr: its exported methods, named by
+// methodName, and the handlers in its struct fields tagged with the name to
+// expose them as, e.g.
+//
+//	Hover func(ctx context.Context, p HoverParams) (*Hover, error) `rpc:"textDocument/hover"`
+//
+// Fields without a tag, or tagged "-", aren't exposed. With handlersOnly,
+// methods that aren't shaped like handlers are skipped.
+func (s *Server) receiverMethods(rcvr reflect.Value, handlersOnly bool) Methods {
+	methods := Methods{}
+	for i := 0; i < rcvr.NumMethod(); i++ {
+		fn := rcvr.Method(i)
+		if handlersOnly && checkFunc(fn) != nil {
+			continue
+		}
+		if name := s.methodName(rcvr.Type().Method(i).Name); name != "" {
+			methods[name] = s.newMethod(fn)
+		}
+	}
+	v := rcvr
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return methods
+	}
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := field.Tag.Get("rpc")
+		if name == "" || name == "-" || field.PkgPath != "" {
+			continue
+		}
+		fn := v.Field(i)
+		if err := checkFunc(fn); err != nil || fn.IsNil() {
+			s.logger.Log(LevelWarn, "rpc field is not a handler", "field", field.Name, "error", err)
+			continue
+		}
+		methods[name] = s.newMethod(fn)
+	}
+	return methods
+}
@@ -0,0 +1,101 @@
+package jsonrpc
+
+import (
+	"context"
+	"sync"
+)
+
+// A handler calling the peer on its own connection, e.g. a server handler
+// calling back a client whose handler calls the server again before
+// answering, must not hold up the requests the peer sends meanwhile. So
+// while it waits for the answer, its message gives up its slots under
+// WithConcurrencyLimit and its place in the queue of WithOrderedExecution,
+// and it takes slots again once answered.
+
+type yieldCtxKey struct{}
+
+// yielder lets the handlers of a message give way while they wait on the
+// peer.
+type yielder struct {
+	conn    *Conn
+	limiter *limiter
+	msg     *incoming
+	slots   int
+
+	mu      sync.Mutex
+	waiting int
+	held    bool
+	// set while msg runs on the ordered queue
+	queue *orderedQueue
+}
+
+// newYielder returns the yielder of msg, which holds slots and runs on queue
+// if it isn't nil, or nil if it has nothing to give up.
+func newYielder(conn *Conn, l *limiter, msg *incoming, slots int, queue *orderedQueue) *yielder {
+	if slots == 0 && queue == nil {
+		return nil
+	}
+	return &yielder{conn: conn, limiter: l, msg: msg, slots: slots, held: slots > 0, queue: queue}
+}
+
+func (y *yielder) context(ctx context.Context) context.Context {
+	if y == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, yieldCtxKey{}, y)
+}
+
+// yielderFor returns the yielder of the handler ctx belongs to if it runs on
+// conn.
+func yielderFor(ctx context.Context, conn *Conn) *yielder {
+	y, _ := ctx.Value(yieldCtxKey{}).(*yielder)
+	if y == nil || y.conn != conn {
+		return nil
+	}
+	return y
+}
+
+// pause gives up the message's slots and place in the queue, if the first of
+// its handlers to wait.
+func (y *yielder) pause() {
+	if y == nil {
+		return
+	}
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if y.waiting++; y.waiting > 1 {
+		return
+	}
+	if y.queue != nil {
+		y.queue.yield()
+		y.queue = nil
+	}
+	if y.held {
+		y.limiter.release(y.slots)
+		y.held = false
+	}
+}
+
+// resume takes the slots back once no handler of the message waits, unless
+// ctx is done first.
+func (y *yielder) resume(ctx context.Context) {
+	if y == nil {
+		return
+	}
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if y.waiting--; y.waiting > 0 || y.held || y.slots == 0 {
+		return
+	}
+	y.held = y.limiter.reacquire(ctx, y.msg, y.slots) == nil
+}
+
+// release frees the slots the message holds.
+func (y *yielder) release() {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if y.held {
+		y.limiter.release(y.slots)
+		y.held = false
+	}
+}
@@ -0,0 +1,112 @@
+package jsonrpc
+
+import (
+	"fmt"
+	"reflect"
+	"sync/atomic"
+)
+
+// WithNotificationConcurrency runs up to limit handlers registered with
+// RegisterNotification at a time per connection. When limit is 1 they run in
+// the order the notifications arrive, and requests read after a notification
+// wait for it to be handled, e.g. for document edits that must be applied in
+// sequence and before the requests that follow them. They don't take the
+// slots of WithConcurrencyLimit, so a burst of notifications can't hold up
+// calls or the other way around. By default each runs as soon as it is read.
+func WithNotificationConcurrency(limit int) Option {
+	return func(s *Server) {
+		s.notificationConcurrency = limit
+	}
+}
+
+// RegisterNotification adds a handler for notifications called name, shaped
+// like a handler that returns at most an error:
+//
+//	func(ctx context.Context[, params...]) [error]
+//
+// Errors are logged, as there is nobody to send them to. Calls to name, which
+// expect a response, get an invalid request error.
+func (s *Server) RegisterNotification(name string, fn interface{}) error {
+	v := reflect.ValueOf(fn)
+	if err := checkFunc(v); err != nil {
+		return err
+	}
+	if t := v.Type(); t.NumOut() > 1 || t.NumOut() == 1 && t.Out(0) != errorType {
+		return fmt.Errorf("jsonrpc: notification handler %s must return at most an error", t)
+	}
+	m := s.newMethod(v)
+	m.notification = true
+	s.updateMethods(func(methods Methods) {
+		methods[name] = m
+	})
+	return nil
+}
+
+// isNotificationOnly reports whether msg is a single notification to a
+// handler registered with RegisterNotification.
+func (s *Server) isNotificationOnly(msg *incoming) bool {
+	if msg.batch || len(msg.reqs) != 1 {
+		return false
+	}
+	req := msg.reqs[0]
+	if req.err != nil || !req.IsNotification() {
+		return false
+	}
+	m := s.method(req.Method)
+	return m != nil && m.notification
+}
+
+// notificationRunner runs a connection's notification handlers under
+// WithNotificationConcurrency.
+type notificationRunner struct {
+	queue *orderedQueue
+	sem   chan struct{}
+	// notifications queued and not yet handled
+	pending int64
+}
+
+func (s *Server) newNotificationRunner() *notificationRunner {
+	switch {
+	case s.notificationConcurrency == 1:
+		return &notificationRunner{queue: newOrderedQueue()}
+	case s.notificationConcurrency > 1:
+		return &notificationRunner{sem: make(chan struct{}, s.notificationConcurrency)}
+	}
+	return &notificationRunner{}
+}
+
+func (r *notificationRunner) run(fn func()) {
+	switch {
+	case r.queue != nil:
+		atomic.AddInt64(&r.pending, 1)
+		r.queue.push(func() {
+			defer atomic.AddInt64(&r.pending, -1)
+			fn()
+		})
+	case r.sem != nil:
+		go func() {
+			r.sem <- struct{}{}
+			defer func() { <-r.sem }()
+			fn()
+		}()
+	default:
+		go fn()
+	}
+}
+
+// barrier returns a channel closed once the notifications queued so far have
+// been handled when they run in order, or nil if there are none.
+func (r *notificationRunner) barrier() <-chan struct{} {
+	if r.queue == nil || atomic.LoadInt64(&r.pending) == 0 {
+		return nil
+	}
+	done := make(chan struct{})
+	r.queue.push(func() { close(done) })
+	return done
+}
+
+func (r *notificationRunner) close() {
+	if r.queue != nil {
+		r.queue.close()
+	}
+}
@@ -4,6 +4,14 @@ import (
 	"context"
 )
 
+// Notify sends a notification to the peer of the connection ctx belongs to.
+// It does nothing when there is no connection, as with HTTPHandler.
 func Notify(ctx context.Context, method string, params interface{}) {
-	ctxGetNotifyFunc(ctx)(method, params)
+	conn := ConnFromContext(ctx)
+	if conn == nil {
+		return
+	}
+	if err := conn.Notify(ctx, method, params); err != nil {
+		conn.logger.Log(LevelError, "notify error", "method", method, "error", err)
+	}
 }
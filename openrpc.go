@@ -0,0 +1,168 @@
+package jsonrpc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	openRPCVersion  = "1.2.6"
+	discoverMethod  = "rpc.discover"
+	openRPCRefsPath = "#/components/schemas/"
+)
+
+// OpenRPCDocument describes the methods of a server, see
+// https://spec.open-rpc.org.
+type OpenRPCDocument struct {
+	OpenRPC    string             `json:"openrpc"`
+	Info       OpenRPCInfo        `json:"info"`
+	Methods    []OpenRPCMethod    `json:"methods"`
+	Components *OpenRPCComponents `json:"components,omitempty"`
+}
+
+type OpenRPCInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type OpenRPCMethod struct {
+	Name           string              `json:"name"`
+	Params         []ContentDescriptor `json:"params"`
+	Result         *ContentDescriptor  `json:"result,omitempty"`
+	Description    string              `json:"description,omitempty"`
+	ParamStructure string              `json:"paramStructure,omitempty"`
+	Errors         []*Error            `json:"errors,omitempty"`
+}
+
+type ContentDescriptor struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required,omitempty"`
+	Schema   Schema `json:"schema"`
+}
+
+type OpenRPCComponents struct {
+	Schemas map[string]Schema `json:"schemas,omitempty"`
+}
+
+// WithOpenRPCInfo sets the info of the document returned by OpenRPC and
+// rpc.discover. The title defaults to the receiver's type name.
+func WithOpenRPCInfo(info OpenRPCInfo) Option {
+	return func(s *Server) {
+		s.openRPCInfo = info
+	}
+}
+
+// WithMethodErrors documents the errors method may return in its OpenRPC
+// description.
+func WithMethodErrors(method string, errs ...*Error) Option {
+	return func(s *Server) {
+		if s.methodErrors == nil {
+			s.methodErrors = map[string][]*Error{}
+		}
+		s.methodErrors[method] = append(s.methodErrors[method], errs...)
+	}
+}
+
+// OpenRPC describes the server's methods, including mounted ones, with JSON
+// Schemas reflected from their params and result types. Methods starting with
+// "rpc." are left out.
+func (s *Server) OpenRPC() *OpenRPCDocument {
+	b := newSchemaBuilder(openRPCRefsPath)
+	doc := &OpenRPCDocument{
+		OpenRPC: openRPCVersion,
+		Info:    s.openRPCInfo,
+		Methods: s.describeMethods("", b),
+	}
+	if doc.Info.Title == "" {
+		doc.Info.Title = receiverName(s.rcvr)
+	}
+	if doc.Info.Version == "" {
+		doc.Info.Version = "0.0.0"
+	}
+	if len(b.defs) > 0 {
+		doc.Components = &OpenRPCComponents{Schemas: b.defs}
+	}
+	return doc
+}
+
+func (s *Server) describeMethods(prefix string, b *schemaBuilder) []OpenRPCMethod {
+	methods := []OpenRPCMethod{}
+	for name, m := range s.methodSet() {
+		if strings.HasPrefix(name, "rpc.") || (m.fn.IsValid() && checkFunc(m.fn) != nil) {
+			continue
+		}
+		d := m.describe(prefix+name, b)
+		d.Errors = s.methodErrors[name]
+		d.Description = s.doc(name)
+		methods = append(methods, d)
+	}
+	for _, mnt := range s.mountSet() {
+		for _, m := range mnt.server.describeMethods(prefix+mnt.prefix, b) {
+			if s.method(strings.TrimPrefix(m.Name, prefix)) == nil {
+				methods = append(methods, m)
+			}
+		}
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].Name < methods[j].Name
+	})
+	return methods
+}
+
+func (m *Method) describe(name string, b *schemaBuilder) OpenRPCMethod {
+	d := OpenRPCMethod{Name: name, Params: []ContentDescriptor{}}
+	switch t := m.paramsType; {
+	case m.argTypes != nil:
+		d.ParamStructure = "by-position"
+		for i, t := range m.argTypes {
+			d.Params = append(d.Params, ContentDescriptor{
+				Name:   fmt.Sprintf("arg%d", i),
+				Schema: b.schema(t),
+			})
+		}
+	case t == nil:
+	case indirect(t).Kind() == reflect.Struct && indirect(t) != timeType:
+		d.ParamStructure = "by-name"
+		for _, f := range structFields(indirect(t)) {
+			schema := b.schema(f.typ)
+			if f.asString {
+				schema = Schema{"type": "string"}
+			}
+			d.Params = append(d.Params, ContentDescriptor{
+				Name:     f.name,
+				Required: !f.omitempty && f.def == "",
+				Schema:   schema,
+			})
+		}
+	default:
+		d.Params = append(d.Params, ContentDescriptor{Name: "params", Required: true, Schema: b.schema(t)})
+	}
+	result := Schema{"type": "null"}
+	if m.resultType != nil {
+		result = b.schema(m.resultType)
+	}
+	d.Result = &ContentDescriptor{Name: "result", Schema: result}
+	return d
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func receiverName(rcvr interface{}) string {
+	if rcvr == nil {
+		return "jsonrpc"
+	}
+	return indirect(reflect.TypeOf(rcvr)).Name()
+}
+
+func (s *Server) discover(ctx context.Context) (*OpenRPCDocument, error) {
+	return s.OpenRPC(), nil
+}
@@ -0,0 +1,107 @@
+package jsonrpc
+
+import (
+	"sync"
+)
+
+// WithOrderedExecution runs each connection's requests one at a time, in the
+// order they arrive, including the requests within a batch. Requests for the
+// bypass methods and cancellation requests are dispatched immediately. A
+// handler waiting for a call it made to the peer on the connection lets the
+// requests after it run meanwhile, since they may be how the peer answers.
+// Reading continues while requests wait, so combine this with
+// WithConcurrencyLimit to bound how many can be queued.
+func WithOrderedExecution(bypass ...string) Option {
+	return func(s *Server) {
+		s.ordered = true
+		s.orderedBypass = map[string]bool{}
+		for _, method := range bypass {
+			s.orderedBypass[method] = true
+		}
+	}
+}
+
+// bypassesQueue reports whether msg can run outside of the ordered queue.
+func (s *Server) bypassesQueue(msg *incoming) bool {
+	for _, req := range msg.reqs {
+		if req.err != nil || !(s.isCancel(req) || s.orderedBypass[req.Method]) {
+			return false
+		}
+	}
+	return true
+}
+
+// orderedQueue runs functions sequentially on a single goroutine. push never
+// blocks, so the reader can keep handling cancellations.
+type orderedQueue struct {
+	mu     sync.Mutex
+	fns    []func()
+	closed bool
+	wake   chan struct{}
+	// identifies the goroutine running the queue
+	runner uint64
+}
+
+func newOrderedQueue() *orderedQueue {
+	q := &orderedQueue{wake: make(chan struct{}, 1)}
+	go q.run(0)
+	return q
+}
+
+func (q *orderedQueue) push(fn func()) {
+	q.mu.Lock()
+	q.fns = append(q.fns, fn)
+	q.mu.Unlock()
+	q.signal()
+}
+
+// close stops the queue once everything pushed so far has run.
+func (q *orderedQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.signal()
+}
+
+func (q *orderedQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// yield hands the queue over to a new goroutine, so that the rest of it runs
+// while the function running now waits, which then finishes on its own. It
+// must be called by that function, at most once.
+func (q *orderedQueue) yield() {
+	q.mu.Lock()
+	q.runner++
+	runner := q.runner
+	q.mu.Unlock()
+	go q.run(runner)
+}
+
+func (q *orderedQueue) run(runner uint64) {
+	for {
+		q.mu.Lock()
+		if q.runner != runner {
+			// yielded
+			q.mu.Unlock()
+			return
+		}
+		if len(q.fns) == 0 {
+			closed := q.closed
+			q.mu.Unlock()
+			if closed {
+				return
+			}
+			<-q.wake
+			continue
+		}
+		fn := q.fns[0]
+		q.fns[0] = nil
+		q.fns = q.fns[1:]
+		q.mu.Unlock()
+		fn()
+	}
+}
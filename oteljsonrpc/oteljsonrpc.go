@@ -0,0 +1,199 @@
+// Package oteljsonrpc traces JSON-RPC calls with OpenTelemetry.
+//
+// Trace context travels inside the params object, under the "_meta" field by
+// default: {"_meta": {"traceparent": "..."}}. Requests whose params are not an
+// object start a new trace.
+package oteljsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	otelapi "go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/jdxcode/jsonrpc"
+)
+
+const (
+	instrumentationName = "github.com/jdxcode/jsonrpc/oteljsonrpc"
+	defaultMetaField    = "_meta"
+)
+
+type config struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+	metaField  string
+}
+
+type Option func(*config)
+
+// WithTracerProvider sets the provider spans are created with. Defaults to
+// the global provider.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracer = tp.Tracer(instrumentationName)
+	}
+}
+
+// WithPropagators sets how trace context is read from and written to params.
+// Defaults to the global propagators.
+func WithPropagators(p propagation.TextMapPropagator) Option {
+	return func(c *config) {
+		c.propagator = p
+	}
+}
+
+// WithMetaField sets the params field holding the trace context.
+func WithMetaField(field string) Option {
+	return func(c *config) {
+		c.metaField = field
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{
+		tracer:     otelapi.GetTracerProvider().Tracer(instrumentationName),
+		propagator: otelapi.GetTextMapPropagator(),
+		metaField:  defaultMetaField,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Interceptor starts a server span named after the method for every request,
+// continuing the trace found in its params.
+func Interceptor(opts ...Option) jsonrpc.Interceptor {
+	cfg := newConfig(opts)
+	return func(ctx context.Context, req *jsonrpc.Request, next jsonrpc.Handler) (*jsonrpc.Response, error) {
+		ctx = cfg.propagator.Extract(ctx, cfg.extract(req.Params))
+		ctx, span := cfg.tracer.Start(ctx, req.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(requestAttributes(req.Method, req.ID)...),
+		)
+		defer span.End()
+		if jsonrpc.IsNotification(ctx) {
+			span.SetAttributes(attribute.Bool("rpc.jsonrpc.notification", true))
+		}
+
+		rsp, err := next(ctx, req)
+		var panicErr *jsonrpc.PanicError
+		if errors.As(err, &panicErr) {
+			span.AddEvent("panic", trace.WithAttributes(
+				attribute.String("exception.message", fmt.Sprintf("%+v", panicErr.Value)),
+				attribute.String("exception.stacktrace", string(panicErr.Stack)),
+			))
+		}
+		switch {
+		case err != nil:
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		case rsp != nil && rsp.Error != nil:
+			recordRPCError(span, rsp.Error)
+		}
+		return rsp, err
+	}
+}
+
+// Caller is implemented by *jsonrpc.Client and *jsonrpc.Conn.
+type Caller interface {
+	Call(ctx context.Context, method string, params, result interface{}) error
+}
+
+// WrapCaller returns a Caller that starts a client span for every call and
+// sends the trace context in the params, so the server span is linked to it.
+func WrapCaller(c Caller, opts ...Option) Caller {
+	return &tracedCaller{c, newConfig(opts)}
+}
+
+type tracedCaller struct {
+	caller Caller
+	cfg    *config
+}
+
+func (t *tracedCaller) Call(ctx context.Context, method string, params, result interface{}) error {
+	ctx, span := t.cfg.tracer.Start(ctx, method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(requestAttributes(method, nil)...),
+	)
+	defer span.End()
+
+	err := t.caller.Call(ctx, method, t.cfg.inject(ctx, params), result)
+	var rpcErr *jsonrpc.Error
+	if errors.As(err, &rpcErr) {
+		recordRPCError(span, rpcErr)
+	} else if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+func requestAttributes(method string, id *jsonrpc.ID) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("rpc.system", "jsonrpc"),
+		attribute.String("rpc.method", method),
+		attribute.String("rpc.jsonrpc.version", "2.0"),
+	}
+	if id != nil {
+		attrs = append(attrs, attribute.String("rpc.jsonrpc.request_id", id.String()))
+	}
+	return attrs
+}
+
+func recordRPCError(span trace.Span, err *jsonrpc.Error) {
+	span.SetAttributes(
+		attribute.Int("rpc.jsonrpc.error_code", err.Code),
+		attribute.String("rpc.jsonrpc.error_message", err.Message),
+	)
+	span.SetStatus(codes.Error, err.Message)
+}
+
+// extract reads the trace context from the meta field of object params.
+func (c *config) extract(params *jsonrpc.ParamsRaw) propagation.MapCarrier {
+	carrier := propagation.MapCarrier{}
+	if params == nil {
+		return carrier
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(*params, &fields); err != nil {
+		return carrier
+	}
+	if meta, ok := fields[c.metaField]; ok {
+		_ = json.Unmarshal(meta, &carrier)
+	}
+	return carrier
+}
+
+// inject adds the trace context to params if they encode to an object.
+func (c *config) inject(ctx context.Context, params interface{}) interface{} {
+	carrier := propagation.MapCarrier{}
+	c.propagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return params
+	}
+	fields := map[string]interface{}{}
+	if params != nil {
+		b, err := json.Marshal(params)
+		if err != nil {
+			return params
+		}
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(b, &raw); err != nil {
+			// positional or scalar params have nowhere to carry it
+			return params
+		}
+		for k, v := range raw {
+			fields[k] = v
+		}
+	}
+	fields[c.metaField] = carrier
+	return fields
+}
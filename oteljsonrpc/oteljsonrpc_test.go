@@ -0,0 +1,78 @@
+package oteljsonrpc_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/jdxcode/jsonrpc"
+	"github.com/jdxcode/jsonrpc/oteljsonrpc"
+)
+
+type RPC struct{}
+
+type EchoParams struct {
+	Text string `json:"text"`
+}
+
+func (r *RPC) Echo(ctx context.Context, params *EchoParams) (string, error) {
+	return params.Text, nil
+}
+
+func (r *RPC) Fail(ctx context.Context) error {
+	return errors.New("uh oh")
+}
+
+func (r *RPC) Panic(ctx context.Context) error {
+	panic("uh oh")
+}
+
+func TestTracing(t *testing.T) {
+	assert := assert.New(t)
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	opts := []oteljsonrpc.Option{
+		oteljsonrpc.WithTracerProvider(tp),
+		oteljsonrpc.WithPropagators(propagation.TraceContext{}),
+	}
+
+	rpc := jsonrpc.New(&RPC{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger))
+	rpc.Use(oteljsonrpc.Interceptor(opts...))
+	a, b := net.Pipe()
+	go rpc.Handle(context.Background(), jsonrpc.NewStreamSocket(b))
+	client := jsonrpc.NewClient(jsonrpc.NewStreamSocket(a), jsonrpc.WithClientLogger(jsonrpc.DiscardLogger))
+	defer client.Close()
+	caller := oteljsonrpc.WrapCaller(client, opts...)
+
+	ctx := context.Background()
+	var result string
+	assert.NoError(caller.Call(ctx, "Echo", &EchoParams{Text: "abc"}, &result))
+	assert.Equal("abc", result)
+	assert.Error(caller.Call(ctx, "Fail", nil, nil))
+	assert.Error(caller.Call(ctx, "Panic", nil, nil))
+
+	spans := recorder.Ended()
+	assert.Len(spans, 6)
+	byKind := map[trace.SpanKind][]sdktrace.ReadOnlySpan{}
+	for _, span := range spans {
+		byKind[span.SpanKind()] = append(byKind[span.SpanKind()], span)
+	}
+	serverSpans, clientSpans := byKind[trace.SpanKindServer], byKind[trace.SpanKindClient]
+	assert.Len(serverSpans, 3)
+	assert.Len(clientSpans, 3)
+
+	// server spans end first, and continue the client's trace
+	assert.Equal("Echo", serverSpans[0].Name())
+	assert.Equal(clientSpans[0].SpanContext().TraceID(), serverSpans[0].SpanContext().TraceID())
+	assert.Equal(clientSpans[0].SpanContext().SpanID(), serverSpans[0].Parent().SpanID())
+	assert.Equal(codes.Error, serverSpans[1].Status().Code)
+	assert.Equal("panic", serverSpans[2].Events()[0].Name)
+}
@@ -1,23 +1,82 @@
 package jsonrpc
 
 import (
-	"errors"
+	"context"
 	"fmt"
-	"log"
 	"runtime/debug"
 )
 
-func handlePanic(req *Request, responses chan<- *Response) {
-	errish := recover()
-	if errish == nil {
-		return
+// PanicError is passed back through the interceptors when a handler panics,
+// so they can record it. The client receives an internal error.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+
+	redact bool
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %+v", e.Value)
+}
+
+// PanicHandler is called with the recovered value and stack whenever a
+// handler or interceptor panics. Panics in the PanicHandler itself are
+// recovered and logged.
+type PanicHandler func(ctx context.Context, req *Request, value interface{}, stack []byte)
+
+// WithPanicHandler sets a function to be called on every recovered panic,
+// e.g. to report it to an error tracker. Panics are logged either way.
+func WithPanicHandler(h PanicHandler) Option {
+	return func(s *Server) {
+		s.panicHandler = h
+	}
+}
+
+// WithProductionMode hides panic values from clients, which only receive a
+// generic internal error. The full details are still logged.
+func WithProductionMode() Option {
+	return func(s *Server) {
+		s.production = true
+	}
+}
+
+// recoverPanic turns a handler panic into a *PanicError.
+func (s *Server) recoverPanic(ctx context.Context, req *Request, err *error) {
+	if errish := recover(); errish != nil {
+		*err = s.newPanicError(ctx, req, errish)
+	}
+}
+
+// handlePanic catches panics outside of handlers, e.g. in interceptors.
+func (s *Server) handlePanic(ctx context.Context, req *Request, rsp **Response) {
+	if errish := recover(); errish != nil {
+		*rsp = newResponseError(req.ID, toError(s.newPanicError(ctx, req, errish)))
 	}
-	debug.PrintStack()
-	rsp := newResponseError(req.ID, errors.New("internal server error").Error())
-	log.Printf("%+v", errish)
+}
 
-	// TODO: hide error in production
-	rsp.Error = fmt.Sprintf("%+v", errish)
+// newPanicError logs, counts and reports a recovered panic. The stack only
+// goes to the server's logs and PanicHandler, never to the client.
+func (s *Server) newPanicError(ctx context.Context, req *Request, errish interface{}) *PanicError {
+	stack := debug.Stack()
+	keyvals := []interface{}{"id", req.ID, "method", req.Method, "error", errish}
+	if conn := ConnFromContext(ctx); conn != nil {
+		keyvals = append(keyvals, "conn", conn.ID())
+	}
+	s.logger.Log(LevelError, "panic", append(keyvals, "stack", string(stack))...)
+	if s.metrics != nil {
+		s.metrics.Panic(s.metricsMethod(req.Method))
+	}
+	if s.panicHandler != nil {
+		s.reportPanic(ctx, req, errish, stack)
+	}
+	return &PanicError{Value: errish, Stack: stack, redact: s.production}
+}
 
-	responses <- rsp
+func (s *Server) reportPanic(ctx context.Context, req *Request, errish interface{}, stack []byte) {
+	defer func() {
+		if err := recover(); err != nil {
+			s.logger.Log(LevelError, "panic handler panicked", "id", req.ID, "method", req.Method, "error", err)
+		}
+	}()
+	s.panicHandler(ctx, req, errish, stack)
 }
@@ -0,0 +1,157 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// rawResponse is a response to a call made from this end of the connection.
+// The result is decoded once it reaches the caller.
+type rawResponse struct {
+	ID     *ID             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+// pendingCalls correlates responses with outstanding calls by id.
+type pendingCalls struct {
+	mu     sync.Mutex
+	nextID int64
+	gen    IDGenerator
+	store  PendingStore
+	calls  map[ID]chan *rawResponse
+	err    error
+	done   chan struct{}
+	logger Logger
+}
+
+func newPendingCalls(logger Logger) *pendingCalls {
+	return &pendingCalls{
+		calls:  map[ID]chan *rawResponse{},
+		done:   make(chan struct{}),
+		logger: logger,
+	}
+}
+
+func (p *pendingCalls) add() (ID, chan *rawResponse, error) {
+	id, ch, err := p.addLocal()
+	if err == nil && p.store != nil {
+		if err = p.register(id, ch); err != nil {
+			p.mu.Lock()
+			delete(p.calls, id)
+			p.mu.Unlock()
+		}
+	}
+	return id, ch, err
+}
+
+func (p *pendingCalls) addLocal() (ID, chan *rawResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return ID{}, nil, p.err
+	}
+	var id ID
+	if p.gen != nil {
+		id = p.gen()
+		if _, dup := p.calls[id]; dup {
+			return ID{}, nil, fmt.Errorf("jsonrpc: id %s is already pending", id.String())
+		}
+	} else {
+		p.nextID++
+		id = Int64ID(p.nextID)
+	}
+	ch := make(chan *rawResponse, 1)
+	p.calls[id] = ch
+	return id, ch, nil
+}
+
+func (p *pendingCalls) remove(id ID) {
+	p.mu.Lock()
+	delete(p.calls, id)
+	p.mu.Unlock()
+	if p.store != nil {
+		p.store.Unregister(id)
+	}
+}
+
+func (p *pendingCalls) resolve(rsp *rawResponse) {
+	if rsp.ID == nil || rsp.ID.IsNull() {
+		p.logger.Log(LevelWarn, "rsp without id", "error", rsp.Error)
+		return
+	}
+	p.mu.Lock()
+	ch := p.calls[*rsp.ID]
+	p.mu.Unlock()
+	if ch == nil && p.store != nil {
+		if b, err := json.Marshal(rsp); err == nil && p.store.Resolve(*rsp.ID, b) {
+			return
+		}
+	}
+	if ch == nil {
+		p.logger.Log(LevelWarn, "rsp for unknown id", "id", rsp.ID)
+		return
+	}
+	select {
+	case ch <- rsp:
+	default:
+		p.logger.Log(LevelWarn, "duplicate rsp", "id", rsp.ID)
+	}
+}
+
+// wait blocks until the response arrives and decodes it into result. failed,
+// which may be nil, receives an error if the request could not be sent and
+// is closed otherwise.
+func (p *pendingCalls) wait(ctx context.Context, ch <-chan *rawResponse, failed <-chan error,
+	result interface{}) error {
+	for {
+		select {
+		case rsp := <-ch:
+			return decodeResult(rsp, result)
+		case err := <-failed:
+			if err != nil {
+				return err
+			}
+			failed = nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-p.done:
+			// the response may have arrived right before the connection closed
+			select {
+			case rsp := <-ch:
+				return decodeResult(rsp, result)
+			default:
+				return p.closeErr()
+			}
+		}
+	}
+}
+
+func decodeResult(rsp *rawResponse, result interface{}) error {
+	if rsp.Error != nil {
+		return rsp.Error
+	}
+	if result == nil || len(rsp.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(rsp.Result, result)
+}
+
+// shutdown fails every outstanding and future call with err.
+func (p *pendingCalls) shutdown(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return
+	}
+	p.err = err
+	close(p.done)
+}
+
+func (p *pendingCalls) closeErr() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
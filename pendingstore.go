@@ -0,0 +1,105 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// PendingStore correlates responses with the calls waiting for them across
+// connections, for deployments where a response may arrive on a different
+// connection or in a different process than its call was sent from, e.g.
+// gateway instances sharing backends, with a store backed by Redis pub/sub or
+// similar. Responses to calls of the connection itself are matched without
+// it. It must be safe for concurrent use.
+type PendingStore interface {
+	// Register records that the call id is waiting, for Resolve to call
+	// deliver with its response.
+	Register(id ID, deliver func(rsp json.RawMessage)) error
+	// Unregister forgets the call id, once it has its response or gave up.
+	Unregister(id ID)
+	// Resolve delivers rsp, the response to the call id, wherever that call
+	// is waiting, and reports whether one is.
+	Resolve(id ID, rsp json.RawMessage) bool
+}
+
+// WithPendingStore correlates the responses to the server's calls to its
+// clients through store, so that a response can reach a call made on
+// another connection. Unless WithIDGenerator is given, ids are UUIDv7IDs,
+// as they must be unique across everything sharing the store.
+func WithPendingStore(store PendingStore) Option {
+	return func(s *Server) {
+		s.pendingStore = store
+	}
+}
+
+// WithClientPendingStore is WithPendingStore for the client's calls.
+func WithClientPendingStore(store PendingStore) ClientOption {
+	return func(c *Client) {
+		c.pendingStore = store
+	}
+}
+
+// NewMemoryPendingStore returns a PendingStore for the connections of one
+// process, e.g. a call sent over one transport whose response comes back
+// over another.
+func NewMemoryPendingStore() PendingStore {
+	return &memoryPendingStore{calls: map[ID]func(json.RawMessage){}}
+}
+
+type memoryPendingStore struct {
+	mu    sync.Mutex
+	calls map[ID]func(json.RawMessage)
+}
+
+func (m *memoryPendingStore) Register(id ID, deliver func(rsp json.RawMessage)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, dup := m.calls[id]; dup {
+		return fmt.Errorf("jsonrpc: id %s is already pending", id.String())
+	}
+	m.calls[id] = deliver
+	return nil
+}
+
+func (m *memoryPendingStore) Unregister(id ID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.calls, id)
+}
+
+func (m *memoryPendingStore) Resolve(id ID, rsp json.RawMessage) bool {
+	m.mu.Lock()
+	deliver := m.calls[id]
+	m.mu.Unlock()
+	if deliver == nil {
+		return false
+	}
+	deliver(rsp)
+	return true
+}
+
+// useStore makes p register its calls with store.
+func (p *pendingCalls) useStore(store PendingStore) {
+	p.store = store
+	if store != nil && p.gen == nil {
+		p.gen = UUIDv7IDs()
+	}
+}
+
+// register adds the call id, whose response is delivered on ch, to the
+// store.
+func (p *pendingCalls) register(id ID, ch chan *rawResponse) error {
+	return p.store.Register(id, func(b json.RawMessage) {
+		var rsp rawResponse
+		if err := json.Unmarshal(b, &rsp); err != nil {
+			p.logger.Log(LevelWarn, "invalid rsp from pending store", "id", id, "error", err)
+			return
+		}
+		select {
+		case ch <- &rsp:
+		default:
+			p.logger.Log(LevelWarn, "duplicate rsp", "id", id)
+		}
+	})
+}
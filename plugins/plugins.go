@@ -0,0 +1,217 @@
+// Package plugins loads method handlers from Go plugins and child processes
+// and mounts them on a server by method prefix.
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"plugin"
+	"sync"
+	"time"
+
+	"github.com/jdxcode/jsonrpc"
+)
+
+// ErrNotLoaded is returned by Unload for a prefix with no plugin.
+var ErrNotLoaded = errors.New("plugins: not loaded")
+
+// GracePeriod is how long a child process has to exit after its stdin is
+// closed before it is killed.
+var GracePeriod = 5 * time.Second
+
+// Registry tracks the plugins mounted on a server.
+type Registry struct {
+	server *jsonrpc.Server
+
+	mu      sync.Mutex
+	plugins map[string]io.Closer
+}
+
+// NewRegistry returns a registry that mounts plugins on s.
+func NewRegistry(s *jsonrpc.Server) *Registry {
+	return &Registry{server: s, plugins: map[string]io.Closer{}}
+}
+
+// LoadGo opens the Go plugin at path and mounts the server returned by its
+// exported NewServer function under prefix:
+//
+//	func NewServer() *jsonrpc.Server
+//
+// The plugin runs in this process, so only the server's panic recovery
+// isolates it, and it stays loaded after Unload.
+func (r *Registry) LoadGo(prefix, path string) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return err
+	}
+	sym, err := p.Lookup("NewServer")
+	if err != nil {
+		return err
+	}
+	newServer, ok := sym.(func() *jsonrpc.Server)
+	if !ok {
+		return fmt.Errorf("plugins: %s: NewServer is %T, not func() *jsonrpc.Server", path, sym)
+	}
+	return r.add(prefix, newServer(), nopCloser{})
+}
+
+// Spawn starts the command returned by cmd and forwards requests for methods
+// under prefix to it, as newline-delimited JSON over its stdin and stdout. Its
+// stderr is inherited unless set. The child can use Serve to answer them.
+//
+// If the child exits, calls in flight fail and it is started again with the
+// backoff set by opts; calls made meanwhile wait for it or for their context.
+// cmd must return a new exec.Cmd each time.
+func (r *Registry) Spawn(ctx context.Context, prefix string, cmd func() *exec.Cmd,
+	opts ...jsonrpc.ReconnectOption) error {
+	client, err := jsonrpc.NewReconnectingClient(ctx, func(ctx context.Context) (jsonrpc.Socket, error) {
+		p, err := start(cmd())
+		if err != nil {
+			return nil, err
+		}
+		return jsonrpc.NewStreamSocket(p), nil
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	if err := r.add(prefix, Proxy(client), client); err != nil {
+		client.Close()
+		return err
+	}
+	return nil
+}
+
+// Unload unmounts the plugin under prefix and stops it. Child processes are
+// sent EOF on stdin and killed after GracePeriod.
+func (r *Registry) Unload(prefix string) error {
+	r.mu.Lock()
+	p, ok := r.plugins[prefix]
+	delete(r.plugins, prefix)
+	r.mu.Unlock()
+	if !ok {
+		return ErrNotLoaded
+	}
+	r.server.Unmount(prefix)
+	return p.Close()
+}
+
+// Close unloads every plugin.
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	prefixes := make([]string, 0, len(r.plugins))
+	for prefix := range r.plugins {
+		prefixes = append(prefixes, prefix)
+	}
+	r.mu.Unlock()
+	var firstErr error
+	for _, prefix := range prefixes {
+		if err := r.Unload(prefix); err != nil && err != ErrNotLoaded && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (r *Registry) add(prefix string, s *jsonrpc.Server, c io.Closer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.plugins[prefix]; ok {
+		return fmt.Errorf("plugins: %q already loaded", prefix)
+	}
+	r.plugins[prefix] = c
+	r.server.Mount(prefix, s)
+	return nil
+}
+
+// Caller is what Proxy forwards to, such as a *jsonrpc.Client or
+// *jsonrpc.ReconnectingClient.
+type Caller = jsonrpc.Upstream
+
+// Proxy returns a server that forwards every request to c as is, passing
+// back its result or error. It is meant to be mounted, as Registry does, so
+// the parent's authorization and rate limits apply first.
+func Proxy(c Caller) *jsonrpc.Server {
+	s := jsonrpc.New(&struct{}{})
+	forward := jsonrpc.Forward(c)
+	s.Use(func(ctx context.Context, req *jsonrpc.Request, next jsonrpc.Handler) (*jsonrpc.Response, error) {
+		return forward(ctx, req)
+	})
+	return s
+}
+
+// Serve answers requests from the parent process on stdin and stdout until
+// stdin is closed, for the child side of Spawn.
+func Serve(ctx context.Context, s *jsonrpc.Server) {
+	s.Handle(ctx, jsonrpc.NewStreamSocket(stdio{}))
+}
+
+type stdio struct{}
+
+func (stdio) Read(b []byte) (int, error)  { return os.Stdin.Read(b) }
+func (stdio) Write(b []byte) (int, error) { return os.Stdout.Write(b) }
+func (stdio) Close() error                { return os.Stdin.Close() }
+
+// process is a running child whose stdin and stdout are a connection.
+type process struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *os.File
+	exited chan struct{}
+	once   sync.Once
+}
+
+func start(cmd *exec.Cmd) (*process, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	// stdout is an os.Pipe rather than StdoutPipe so that Wait, called as
+	// soon as the child exits, doesn't close it before it has been read.
+	stdout, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = w
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		stdout.Close()
+		return nil, err
+	}
+	p := &process{cmd: cmd, stdin: stdin, stdout: stdout, exited: make(chan struct{})}
+	go func() {
+		cmd.Wait()
+		close(p.exited)
+	}()
+	return p, nil
+}
+
+func (p *process) Read(b []byte) (int, error)  { return p.stdout.Read(b) }
+func (p *process) Write(b []byte) (int, error) { return p.stdin.Write(b) }
+
+func (p *process) Close() error {
+	p.once.Do(func() {
+		p.stdin.Close()
+		timer := time.NewTimer(GracePeriod)
+		defer timer.Stop()
+		select {
+		case <-p.exited:
+		case <-timer.C:
+			p.cmd.Process.Kill()
+			<-p.exited
+		}
+		p.stdout.Close()
+	})
+	return nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,64 @@
+package plugins_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jdxcode/jsonrpc"
+	"github.com/jdxcode/jsonrpc/jsonrpctest"
+	"github.com/jdxcode/jsonrpc/plugins"
+)
+
+// TestMain runs the test binary as the child of Spawn when asked to.
+func TestMain(m *testing.M) {
+	if os.Getenv("PLUGINS_TEST_CHILD") == "1" {
+		s := jsonrpc.New(&struct{}{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger))
+		s.Register("echo", func(ctx context.Context, s string) (string, error) {
+			return s, nil
+		})
+		s.Register("crash", func(ctx context.Context) error {
+			os.Exit(1)
+			return nil
+		})
+		plugins.Serve(context.Background(), s)
+		return
+	}
+	os.Exit(m.Run())
+}
+
+func TestSpawn(t *testing.T) {
+	assert := assert.New(t)
+	s := jsonrpc.New(&struct{}{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger))
+	r := plugins.NewRegistry(s)
+	err := r.Spawn(context.Background(), "child/", func() *exec.Cmd {
+		cmd := exec.Command(os.Args[0])
+		cmd.Env = append(os.Environ(), "PLUGINS_TEST_CHILD=1")
+		return cmd
+	},
+		jsonrpc.WithReconnectBackoff(10*time.Millisecond, 10*time.Millisecond),
+		jsonrpc.WithClientOptions(jsonrpc.WithClientLogger(jsonrpc.DiscardLogger)),
+	)
+	assert.NoError(err)
+	c := jsonrpctest.NewClient(t, s)
+
+	var result string
+	c.MustCall("child/echo", "hi", &result)
+	assert.Equal("hi", result)
+	c.CallError("child/missing", nil, jsonrpc.CodeMethodNotFound)
+
+	// The child crashing fails the call but not the server, and it is
+	// restarted for the next one.
+	assert.Error(c.Call("child/crash", nil, nil))
+	c.MustCall("child/echo", "again", &result)
+	assert.Equal("again", result)
+
+	assert.NoError(r.Unload("child/"))
+	c.CallError("child/echo", "hi", jsonrpc.CodeMethodNotFound)
+	assert.Equal(plugins.ErrNotLoaded, r.Unload("child/"))
+	assert.NoError(r.Close())
+}
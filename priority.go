@@ -0,0 +1,179 @@
+package jsonrpc
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+)
+
+// PriorityPolicy returns the priority of req. Requests with a higher one run
+// first; 0 is normal.
+type PriorityPolicy func(req *Request) int
+
+// WithPriorities makes requests waiting for a slot under WithConcurrencyLimit
+// run in order of priority rather than arrival. A request's priority is the
+// highest any of policies gives it, and a batch's that of its highest
+// request. Instead of stopping reading as soon as the limit is reached, up to
+// queue messages per connection, or as many as the limit if queue is 0, are
+// read ahead to wait for a slot. With BusyReject, nothing waits, so
+// priorities don't apply.
+func WithPriorities(queue int, policies ...PriorityPolicy) Option {
+	return func(s *Server) {
+		s.priorityQueue = queue
+		s.priorities = policies
+	}
+}
+
+// PriorityMethods gives calls to methods priority, e.g. health checks that
+// should be answered even when the server is busy.
+func PriorityMethods(priority int, methods ...string) PriorityPolicy {
+	set := map[string]bool{}
+	for _, method := range methods {
+		set[method] = true
+	}
+	return func(req *Request) int {
+		if set[req.Method] {
+			return priority
+		}
+		return 0
+	}
+}
+
+// ClientPriority honors the priority member of requests, which clients set
+// with WithCallPriority, up to max so clients can't jump ahead of the
+// methods given priority by the server.
+func ClientPriority(max int) PriorityPolicy {
+	return func(req *Request) int {
+		if req.Priority > max {
+			return max
+		}
+		return req.Priority
+	}
+}
+
+type priorityCtxKey struct{}
+
+// WithCallPriority returns a context whose calls carry priority in their
+// priority member, for servers using ClientPriority.
+func WithCallPriority(ctx context.Context, priority int) context.Context {
+	return context.WithValue(ctx, priorityCtxKey{}, priority)
+}
+
+func priorityFromContext(ctx context.Context) int {
+	priority, _ := ctx.Value(priorityCtxKey{}).(int)
+	return priority
+}
+
+func (s *Server) priorityOf(msg *incoming) int {
+	max, first := 0, true
+	for _, req := range msg.reqs {
+		if req.err != nil {
+			continue
+		}
+		for _, policy := range s.priorities {
+			if p := policy(req); first || p > max {
+				max, first = p, false
+			}
+		}
+	}
+	return max
+}
+
+// prioritySlots is a semaphore that hands free slots to the waiter with the
+// highest priority, and the earliest among equals.
+type prioritySlots struct {
+	mu      sync.Mutex
+	free    int
+	seq     uint64
+	waiters slotWaiters
+}
+
+type slotWaiter struct {
+	priority int
+	seq      uint64
+	n        int
+	ready    chan struct{}
+	index    int
+}
+
+func (p *prioritySlots) acquire(ctx context.Context, priority, n int) error {
+	p.mu.Lock()
+	if len(p.waiters) == 0 && p.free >= n {
+		p.free -= n
+		p.mu.Unlock()
+		return nil
+	}
+	p.seq++
+	w := &slotWaiter{priority: priority, seq: p.seq, n: n, ready: make(chan struct{})}
+	heap.Push(&p.waiters, w)
+	p.mu.Unlock()
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		if w.index >= 0 {
+			heap.Remove(&p.waiters, w.index)
+			p.mu.Unlock()
+			return ctx.Err()
+		}
+		p.mu.Unlock()
+		// granted meanwhile
+		p.release(n)
+		return ctx.Err()
+	}
+}
+
+func (p *prioritySlots) tryAcquire(n int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.waiters) > 0 || p.free < n {
+		return false
+	}
+	p.free -= n
+	return true
+}
+
+func (p *prioritySlots) release(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.free += n
+	for len(p.waiters) > 0 && p.waiters[0].n <= p.free {
+		w := heap.Pop(&p.waiters).(*slotWaiter)
+		p.free -= w.n
+		close(w.ready)
+	}
+}
+
+// slotWaiters is a heap of waiters, highest priority first.
+type slotWaiters []*slotWaiter
+
+func (q slotWaiters) Len() int { return len(q) }
+
+func (q slotWaiters) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q slotWaiters) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *slotWaiters) Push(x interface{}) {
+	w := x.(*slotWaiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *slotWaiters) Pop() interface{} {
+	old := *q
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	w.index = -1
+	*q = old[:len(old)-1]
+	return w
+}
@@ -0,0 +1,60 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+)
+
+const defaultProgressMethod = "$/progress"
+
+type ctxProgressKey struct{}
+
+// Progress sends incremental results for a request ahead of its response.
+type Progress struct {
+	conn   *Conn
+	method string
+	token  interface{}
+}
+
+type progressParams struct {
+	Token interface{} `json:"token"`
+	Value interface{} `json:"value"`
+}
+
+// WithProgressMethod sets the notification method used by Progress.Report.
+// Defaults to "$/progress".
+func WithProgressMethod(method string) Option {
+	return func(s *Server) {
+		s.progressMethod = method
+	}
+}
+
+// ProgressFromContext returns the Progress for the request being handled. It
+// is nil for notifications and for transports that can't push notifications,
+// in which case Report does nothing.
+func ProgressFromContext(ctx context.Context) *Progress {
+	p, _ := ctx.Value(ctxProgressKey{}).(*Progress)
+	return p
+}
+
+// Report sends value to the client as a progress notification. The token is
+// the request's "progressToken" param if it has one, or else its id.
+func (p *Progress) Report(ctx context.Context, value interface{}) error {
+	if p == nil || !p.conn.Supports(ExtProgress) {
+		return nil
+	}
+	return p.conn.Notify(ctx, p.method, &progressParams{Token: p.token, Value: value})
+}
+
+func (s *Server) ctxWithProgress(ctx context.Context, conn *Conn, req *Request) context.Context {
+	p := &Progress{conn: conn, method: s.progressMethod, token: req.ID}
+	if req.Params != nil {
+		var params struct {
+			ProgressToken json.RawMessage `json:"progressToken"`
+		}
+		if json.Unmarshal(*req.Params, &params) == nil && params.ProgressToken != nil {
+			p.token = params.ProgressToken
+		}
+	}
+	return context.WithValue(ctx, ctxProgressKey{}, p)
+}
@@ -0,0 +1,162 @@
+// Package promjsonrpc exports jsonrpc server metrics to Prometheus.
+package promjsonrpc
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/jdxcode/jsonrpc"
+)
+
+// Metrics implements jsonrpc.Metrics with Prometheus collectors.
+type Metrics struct {
+	requests     *prometheus.CounterVec
+	duration     *prometheus.HistogramVec
+	inFlight     *prometheus.GaugeVec
+	panics       *prometheus.CounterVec
+	deprecated   *prometheus.CounterVec
+	bytesRead    prometheus.Counter
+	bytesWritten prometheus.Counter
+	sendQueue    prometheus.Gauge
+	sendLag      prometheus.Histogram
+	writeTime    prometheus.Histogram
+}
+
+var (
+	_ jsonrpc.Metrics            = (*Metrics)(nil)
+	_ jsonrpc.DeprecationMetrics = (*Metrics)(nil)
+	_ jsonrpc.SendMetrics        = (*Metrics)(nil)
+)
+
+type config struct {
+	namespace string
+	buckets   []float64
+}
+
+type Option func(*config)
+
+// WithNamespace prefixes every metric name. Defaults to "jsonrpc".
+func WithNamespace(namespace string) Option {
+	return func(c *config) {
+		c.namespace = namespace
+	}
+}
+
+// WithBuckets sets the request duration, send lag and write duration
+// histogram buckets, in seconds.
+func WithBuckets(buckets []float64) Option {
+	return func(c *config) {
+		c.buckets = buckets
+	}
+}
+
+// New creates the collectors and registers them with reg. Pass the result to
+// jsonrpc.WithMetrics.
+func New(reg prometheus.Registerer, opts ...Option) (*Metrics, error) {
+	cfg := &config{namespace: "jsonrpc", buckets: prometheus.DefBuckets}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: cfg.namespace,
+			Name:      "requests_total",
+			Help:      "Requests handled, by method and JSON-RPC error code (0 on success).",
+		}, []string{"method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: cfg.namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Time spent handling requests.",
+			Buckets:   cfg.buckets,
+		}, []string{"method"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: cfg.namespace,
+			Name:      "requests_in_flight",
+			Help:      "Requests currently being handled.",
+		}, []string{"method"}),
+		panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: cfg.namespace,
+			Name:      "panics_total",
+			Help:      "Handler panics recovered.",
+		}, []string{"method"}),
+		deprecated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: cfg.namespace,
+			Name:      "deprecated_calls_total",
+			Help:      "Calls to deprecated methods and aliases.",
+		}, []string{"method"}),
+		bytesRead: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: cfg.namespace,
+			Name:      "read_bytes_total",
+			Help:      "Bytes of messages read.",
+		}),
+		bytesWritten: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: cfg.namespace,
+			Name:      "written_bytes_total",
+			Help:      "Bytes of messages written.",
+		}),
+		sendQueue: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: cfg.namespace,
+			Name:      "send_queue_length",
+			Help:      "Messages waiting in send queues.",
+		}),
+		sendLag: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: cfg.namespace,
+			Name:      "send_lag_seconds",
+			Help:      "Time from a message being queued to being written.",
+			Buckets:   cfg.buckets,
+		}),
+		writeTime: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: cfg.namespace,
+			Name:      "write_duration_seconds",
+			Help:      "Time spent writing messages to sockets.",
+			Buckets:   cfg.buckets,
+		}),
+	}
+	for _, c := range []prometheus.Collector{
+		m.requests, m.duration, m.inFlight, m.panics, m.deprecated, m.bytesRead, m.bytesWritten,
+		m.sendQueue, m.sendLag, m.writeTime,
+	} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *Metrics) RequestStarted(method string) {
+	m.inFlight.WithLabelValues(method).Inc()
+}
+
+func (m *Metrics) RequestFinished(method string, duration time.Duration, code int) {
+	m.inFlight.WithLabelValues(method).Dec()
+	m.requests.WithLabelValues(method, strconv.Itoa(code)).Inc()
+	m.duration.WithLabelValues(method).Observe(duration.Seconds())
+}
+
+func (m *Metrics) Panic(method string) {
+	m.panics.WithLabelValues(method).Inc()
+}
+
+func (m *Metrics) MessageRead(bytes int) {
+	m.bytesRead.Add(float64(bytes))
+}
+
+func (m *Metrics) MessageWritten(bytes int) {
+	m.bytesWritten.Add(float64(bytes))
+}
+
+func (m *Metrics) DeprecatedCall(method string) {
+	m.deprecated.WithLabelValues(method).Inc()
+}
+
+func (m *Metrics) MessageQueued() {
+	m.sendQueue.Inc()
+}
+
+func (m *Metrics) MessageSent(lag, write time.Duration) {
+	m.sendQueue.Dec()
+	m.sendLag.Observe(lag.Seconds())
+	m.writeTime.Observe(write.Seconds())
+}
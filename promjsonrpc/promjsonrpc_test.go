@@ -0,0 +1,60 @@
+package promjsonrpc_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jdxcode/jsonrpc"
+	"github.com/jdxcode/jsonrpc/promjsonrpc"
+)
+
+type RPC struct{}
+
+func (r *RPC) Echo(ctx context.Context, params string) (string, error) {
+	return params, nil
+}
+
+func (r *RPC) Panic(ctx context.Context) error {
+	panic("uh oh")
+}
+
+func TestMetrics(t *testing.T) {
+	assert := assert.New(t)
+	reg := prometheus.NewRegistry()
+	metrics, err := promjsonrpc.New(reg)
+	assert.NoError(err)
+
+	rpc := jsonrpc.New(&RPC{}, jsonrpc.WithMetrics(metrics), jsonrpc.WithLogger(jsonrpc.DiscardLogger),
+		jsonrpc.WithAlias("echo", "Echo"), jsonrpc.WithDeprecated("echo", "use Echo"))
+	a, b := net.Pipe()
+	go rpc.Handle(context.Background(), jsonrpc.NewStreamSocket(b))
+	client := jsonrpc.NewClient(jsonrpc.NewStreamSocket(a), jsonrpc.WithClientLogger(jsonrpc.DiscardLogger))
+	defer client.Close()
+
+	ctx := context.Background()
+	assert.NoError(client.Call(ctx, "Echo", "abc", nil))
+	assert.Error(client.Call(ctx, "Panic", nil, nil))
+	assert.Error(client.Call(ctx, "missing", nil, nil))
+	assert.NoError(client.Call(ctx, "echo", "abc", nil))
+
+	count, err := testutil.GatherAndCount(reg, "jsonrpc_requests_total")
+	assert.NoError(err)
+	assert.Equal(3, count)
+	count, err = testutil.GatherAndCount(reg, "jsonrpc_send_lag_seconds")
+	assert.NoError(err)
+	assert.Equal(1, count)
+	assert.NoError(testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP jsonrpc_panics_total Handler panics recovered.
+# TYPE jsonrpc_panics_total counter
+jsonrpc_panics_total{method="Panic"} 1
+# HELP jsonrpc_deprecated_calls_total Calls to deprecated methods and aliases.
+# TYPE jsonrpc_deprecated_calls_total counter
+jsonrpc_deprecated_calls_total{method="echo"} 1
+`), "jsonrpc_panics_total", "jsonrpc_deprecated_calls_total"))
+}
@@ -0,0 +1,113 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// SendPolicy decides what happens to outgoing messages when a connection's
+// send queue is full because the peer is reading too slowly.
+type SendPolicy int
+
+const (
+	// SendBlock waits for room in the queue.
+	SendBlock SendPolicy = iota
+	// SendDropNotifications drops notifications to the peer, and waits for
+	// room for everything else.
+	SendDropNotifications
+	// SendClose closes the connection.
+	SendClose
+)
+
+var (
+	ErrSendQueueFull = errors.New("jsonrpc: send queue full")
+	ErrWriteTimeout  = errors.New("jsonrpc: write timeout")
+)
+
+// WithSendQueue buffers up to size outgoing messages per connection ahead of
+// the socket, and sets what happens once the buffer is full. By default
+// messages are handed to the socket one at a time and senders block.
+func WithSendQueue(size int, policy SendPolicy) Option {
+	return func(s *Server) {
+		s.sendQueueSize = size
+		s.sendPolicy = policy
+	}
+}
+
+// WithWriteTimeout closes a connection whose socket takes longer than d to
+// write a message.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.writeTimeout = d
+	}
+}
+
+// enqueue puts msg on a connection's send queue, applying the send policy if
+// the queue is full. ctx and done, which may be nil, bound the wait for room
+// in the queue.
+func (s *Server) enqueue(ctx context.Context, done <-chan struct{}, conn *Conn, out chan<- outgoing,
+	msg interface{}) error {
+	select {
+	case <-conn.closing:
+		return ErrConnClosed
+	default:
+	}
+	m, _ := s.metrics.(SendMetrics)
+	select {
+	case out <- outgoing{msg, time.Now()}:
+		if m != nil {
+			m.MessageQueued()
+		}
+		return nil
+	default:
+	}
+	switch {
+	case s.sendPolicy == SendDropNotifications && isNotificationMsg(msg):
+		s.logger.Log(LevelWarn, "send queue full, dropping notification")
+		return ErrSendQueueFull
+	case s.sendPolicy == SendClose:
+		s.logger.Log(LevelWarn, "send queue full, closing connection")
+		conn.abort(ErrSendQueueFull)
+		return ErrSendQueueFull
+	}
+	select {
+	case out <- outgoing{msg, time.Now()}:
+		if m != nil {
+			m.MessageQueued()
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-done:
+		return conn.pending.closeErr()
+	case <-conn.closing:
+		return ErrConnClosed
+	}
+}
+
+func isNotificationMsg(msg interface{}) bool {
+	switch msg := msg.(type) {
+	case *Response:
+		return msg.Method != ""
+	case *Request:
+		return msg.IsNotification()
+	}
+	return false
+}
+
+// abort stops reading, cancels the handlers and closes the socket without
+// waiting for pending responses. The first err is the disconnect error, and
+// abort reports whether it was this one.
+func (c *Conn) abort(err error) bool {
+	c.mu.Lock()
+	first := c.abortErr == nil
+	if first {
+		c.abortErr = err
+	}
+	c.mu.Unlock()
+	c.stopReading()
+	c.cancel()
+	c.sock.Close()
+	return first
+}
@@ -0,0 +1,104 @@
+package jsonrpc
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// CodeRateLimited is returned for requests over a rate limit.
+const CodeRateLimited = -32005
+
+// ErrRateLimited is sent with data {"retryAfter": <seconds>}.
+var ErrRateLimited = NewError(CodeRateLimited, "rate limited")
+
+// WithRateLimit limits requests across all connections to rate per second,
+// with bursts of up to burst requests.
+func WithRateLimit(rate float64, burst int) Option {
+	return func(s *Server) {
+		s.rateLimit = newTokenBucket(rate, burst)
+	}
+}
+
+// WithConnRateLimit limits the requests on each connection served by Handle.
+func WithConnRateLimit(rate float64, burst int) Option {
+	return func(s *Server) {
+		s.connRate, s.connBurst = rate, burst
+	}
+}
+
+// WithMethodRateLimit limits the calls to one method across all connections.
+func WithMethodRateLimit(method string, rate float64, burst int) Option {
+	return func(s *Server) {
+		if s.methodRateLimits == nil {
+			s.methodRateLimits = map[string]*tokenBucket{}
+		}
+		s.methodRateLimits[method] = newTokenBucket(rate, burst)
+	}
+}
+
+// checkRateLimit takes a token from each bucket req counts against, the
+// connection's first. A request turned away by one bucket takes nothing from
+// the others, so an over-limit connection doesn't use up the shared budget.
+func (s *Server) checkRateLimit(ctx context.Context, req *Request) error {
+	now := time.Now()
+	var buckets []*tokenBucket
+	if conn := ConnFromContext(ctx); conn != nil {
+		buckets = append(buckets, conn.rateLimit)
+	}
+	buckets = append(buckets, s.methodRateLimits[req.Method], s.rateLimit)
+	for i, b := range buckets {
+		if b == nil {
+			continue
+		}
+		if wait := b.take(now); wait > 0 {
+			for _, taken := range buckets[:i] {
+				if taken != nil {
+					taken.refund()
+				}
+			}
+			s.logger.Log(LevelInfo, "rate limited", "id", req.ID, "method", req.Method)
+			seconds := math.Ceil(wait.Seconds()*1000) / 1000
+			return ErrRateLimited.WithData(map[string]interface{}{"retryAfter": seconds})
+		}
+	}
+	return nil
+}
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// take removes a token, or else returns how long until one is available.
+func (b *tokenBucket) take(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.last.IsZero() {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	if b.rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// refund returns a token taken for a request that was turned away.
+func (b *tokenBucket) refund() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
@@ -0,0 +1,229 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Dialer opens a new connection for a ReconnectingClient.
+type Dialer func(ctx context.Context) (Socket, error)
+
+// ReplayPolicy decides what happens to calls in flight when the connection
+// drops.
+type ReplayPolicy int
+
+const (
+	// FailPending fails calls in flight with the disconnect error.
+	FailPending ReplayPolicy = iota
+	// RetryPending sends calls in flight again once reconnected. The server
+	// may have handled them already, so only use it for idempotent methods.
+	RetryPending
+)
+
+// ReconnectingClient is a client that redials with jittered exponential
+// backoff whenever its connection drops. Calls made while disconnected wait
+// for the next connection or for their context to end.
+type ReconnectingClient struct {
+	dial        Dialer
+	clientOpts  []ClientOption
+	policy      ReplayPolicy
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	onReconnect func(ctx context.Context, c *Client)
+	logger      Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	client  *Client
+	changed chan struct{}
+}
+
+type ReconnectOption func(*ReconnectingClient)
+
+// WithReconnectBackoff sets the delay before the first redial and the limit
+// it doubles up to after each failed attempt. Defaults to 100ms and 30s.
+func WithReconnectBackoff(min, max time.Duration) ReconnectOption {
+	return func(r *ReconnectingClient) {
+		r.minBackoff, r.maxBackoff = min, max
+	}
+}
+
+// WithReplayPolicy sets what happens to calls in flight on disconnect.
+// Defaults to FailPending.
+func WithReplayPolicy(p ReplayPolicy) ReconnectOption {
+	return func(r *ReconnectingClient) {
+		r.policy = p
+	}
+}
+
+// WithOnReconnect calls fn with each new client after a redial, before calls
+// waiting for the connection are let through, e.g. to subscribe again.
+func WithOnReconnect(fn func(ctx context.Context, c *Client)) ReconnectOption {
+	return func(r *ReconnectingClient) {
+		r.onReconnect = fn
+	}
+}
+
+// WithClientOptions sets the options for every Client the
+// ReconnectingClient creates.
+func WithClientOptions(opts ...ClientOption) ReconnectOption {
+	return func(r *ReconnectingClient) {
+		r.clientOpts = append(r.clientOpts, opts...)
+	}
+}
+
+// NewReconnectingClient dials the first connection, returning its error if
+// that fails, and keeps redialing after it drops until Close is called.
+func NewReconnectingClient(ctx context.Context, dial Dialer, opts ...ReconnectOption) (*ReconnectingClient, error) {
+	r := &ReconnectingClient{
+		dial:       dial,
+		minBackoff: 100 * time.Millisecond,
+		maxBackoff: 30 * time.Second,
+		logger:     defaultLogger,
+		changed:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	sock, err := dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	r.client = NewClient(sock, r.clientOpts...)
+	r.logger = r.client.logger
+	go r.run()
+	return r, nil
+}
+
+// Call invokes method on the current connection, see Client.Call.
+func (r *ReconnectingClient) Call(ctx context.Context, method string, params, result interface{}) error {
+	for {
+		c, err := r.connected(ctx)
+		if err != nil {
+			return err
+		}
+		err = c.Call(ctx, method, params, result)
+		if err == nil || r.policy == FailPending || !c.disconnected(ctx, err) {
+			return err
+		}
+	}
+}
+
+// Notify sends a notification on the current connection, waiting for one if
+// disconnected.
+func (r *ReconnectingClient) Notify(ctx context.Context, method string, params interface{}) error {
+	c, err := r.connected(ctx)
+	if err != nil {
+		return err
+	}
+	return c.Notify(ctx, method, params)
+}
+
+// Client returns the current client, which may be disconnected.
+func (r *ReconnectingClient) Client() *Client {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.client
+}
+
+// Close stops redialing and closes the current connection.
+func (r *ReconnectingClient) Close() error {
+	r.mu.Lock()
+	r.cancel()
+	c := r.client
+	r.mu.Unlock()
+	return c.Close()
+}
+
+// connected returns the current client once it is connected.
+func (r *ReconnectingClient) connected(ctx context.Context) (*Client, error) {
+	for {
+		r.mu.Lock()
+		c, changed := r.client, r.changed
+		r.mu.Unlock()
+		select {
+		case <-c.conn.pending.done:
+		default:
+			return c, nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-r.ctx.Done():
+			return nil, ErrClientClosed
+		}
+	}
+}
+
+func (r *ReconnectingClient) run() {
+	for {
+		dropped := r.Client()
+		select {
+		case <-dropped.conn.Done():
+		case <-r.ctx.Done():
+			return
+		}
+		dropped.sock.Close()
+		c, err := r.redial()
+		if err != nil {
+			return
+		}
+		if r.onReconnect != nil {
+			r.onReconnect(r.ctx, c)
+		}
+		r.mu.Lock()
+		if r.ctx.Err() != nil {
+			r.mu.Unlock()
+			c.Close()
+			return
+		}
+		r.client = c
+		close(r.changed)
+		r.changed = make(chan struct{})
+		r.mu.Unlock()
+	}
+}
+
+// redial dials until it succeeds or the client is closed.
+func (r *ReconnectingClient) redial() (*Client, error) {
+	backoff := r.minBackoff
+	for {
+		timer := time.NewTimer(backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1)))
+		select {
+		case <-timer.C:
+		case <-r.ctx.Done():
+			timer.Stop()
+			return nil, r.ctx.Err()
+		}
+		sock, err := r.dial(r.ctx)
+		if err == nil {
+			return NewClient(sock, r.clientOpts...), nil
+		}
+		r.logger.Log(LevelWarn, "redial error", "error", err, "backoff", backoff)
+		if backoff *= 2; backoff > r.maxBackoff {
+			backoff = r.maxBackoff
+		}
+	}
+}
+
+// disconnected reports whether err failed a call because c's connection
+// dropped rather than because of the server or ctx.
+func (c *Client) disconnected(ctx context.Context, err error) bool {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) || ctx.Err() != nil || errors.Is(err, ErrClientClosed) {
+		return false
+	}
+	select {
+	case <-c.conn.pending.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,318 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Directions of a RecordedMessage.
+const (
+	DirReceived = "in"
+	DirSent     = "out"
+)
+
+// RecordedMessage is a message in a recording made by a Recorder.
+type RecordedMessage struct {
+	Time time.Time `json:"time"`
+	// Conn is the ID of the connection, or 0 for HTTP.
+	Conn uint64 `json:"conn,omitempty"`
+	// Dir is DirReceived or DirSent.
+	Dir string          `json:"dir"`
+	Msg json.RawMessage `json:"msg,omitempty"`
+	// Invalid holds a received message that wasn't valid JSON instead of Msg.
+	Invalid string `json:"invalid,omitempty"`
+}
+
+func (m RecordedMessage) raw() json.RawMessage {
+	if m.Msg == nil {
+		return json.RawMessage(m.Invalid)
+	}
+	return m.Msg
+}
+
+// Recorder writes every message a server receives and sends to a recording,
+// one JSON RecordedMessage per line, to debug a session later or replay it
+// with ReplayRecording and NewPlaybackSocket.
+type Recorder struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	err    error
+}
+
+// NewRecorder returns a Recorder writing to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// CreateRecording returns a Recorder appending to the file at path, which is
+// created if needed.
+func CreateRecording(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{w: f, closer: f}, nil
+}
+
+// WithRecorder records the server's traffic with r, using the hooks of
+// WithOnReceiveRaw and WithOnSendRaw; hooks set before it still run.
+func WithRecorder(r *Recorder) Option {
+	return func(s *Server) {
+		onReceive, onSend := s.onReceiveRaw, s.onSendRaw
+		s.onReceiveRaw = func(conn *Conn, msg json.RawMessage) {
+			r.record(conn, DirReceived, msg)
+			if onReceive != nil {
+				onReceive(conn, msg)
+			}
+		}
+		s.onSendRaw = func(conn *Conn, msg json.RawMessage) {
+			r.record(conn, DirSent, msg)
+			if onSend != nil {
+				onSend(conn, msg)
+			}
+		}
+	}
+}
+
+func (r *Recorder) record(conn *Conn, dir string, msg json.RawMessage) {
+	rec := RecordedMessage{Time: time.Now(), Dir: dir}
+	if conn != nil {
+		rec.Conn = conn.id
+	}
+	if json.Valid(msg) {
+		rec.Msg = msg
+	} else {
+		rec.Invalid = string(msg)
+	}
+	b, err := json.Marshal(rec)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		_, err = r.w.Write(append(b, '\n'))
+	}
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+}
+
+// Close closes the recording file, if Recorder opened it, and returns the
+// first error recording hit.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closer != nil {
+		if err := r.closer.Close(); err != nil && r.err == nil {
+			r.err = err
+		}
+	}
+	return r.err
+}
+
+// ReadRecording reads the messages of a recording.
+func ReadRecording(rd io.Reader) ([]RecordedMessage, error) {
+	var msgs []RecordedMessage
+	sc := bufio.NewScanner(rd)
+	sc.Buffer(nil, 1<<30)
+	for line := 1; sc.Scan(); line++ {
+		var msg RecordedMessage
+		if err := json.Unmarshal(sc.Bytes(), &msg); err != nil {
+			return nil, fmt.Errorf("jsonrpc: recording line %d: %w", line, err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, sc.Err()
+}
+
+// ReplayRecording feeds the messages received in a recording to s, one
+// connection at a time, and returns what s sent back, to reproduce a bug or
+// check that responses haven't changed. Each connection is closed once every
+// request that expects an answer has one. Messages received over HTTP are
+// replayed on a connection of their own.
+func ReplayRecording(ctx context.Context, s *Server, msgs []RecordedMessage) ([]RecordedMessage, error) {
+	var out []RecordedMessage
+	for _, conn := range splitConns(msgs) {
+		sock := newReplaySocket(conn)
+		s.Handle(ctx, sock)
+		out = append(out, sock.sent...)
+		if err := ctx.Err(); err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+// splitConns groups the received messages by connection, in the order the
+// connections first appear.
+func splitConns(msgs []RecordedMessage) [][]RecordedMessage {
+	var conns [][]RecordedMessage
+	index := map[uint64]int{}
+	for _, msg := range msgs {
+		if msg.Dir != DirReceived {
+			continue
+		}
+		i, ok := index[msg.Conn]
+		if !ok || msg.Conn == 0 {
+			i = len(conns)
+			index[msg.Conn] = i
+			conns = append(conns, nil)
+		}
+		conns[i] = append(conns[i], msg)
+	}
+	return conns
+}
+
+// replaySocket reads recorded messages, then waits for the answers before
+// reporting EOF.
+type replaySocket struct {
+	in   []RecordedMessage
+	conn uint64
+
+	mu       sync.Mutex
+	expected int
+	sent     []RecordedMessage
+	answered chan struct{}
+	closed   chan struct{}
+	once     sync.Once
+}
+
+func newReplaySocket(in []RecordedMessage) *replaySocket {
+	sock := &replaySocket{in: in, conn: in[0].Conn, answered: make(chan struct{}), closed: make(chan struct{})}
+	for _, msg := range in {
+		if expectsAnswer(msg.raw()) {
+			sock.expected++
+		}
+	}
+	if sock.expected == 0 {
+		close(sock.answered)
+	}
+	return sock
+}
+
+// expectsAnswer reports whether the peer answers msg.
+func expectsAnswer(msg json.RawMessage) bool {
+	in, err := decodeIncoming(msg)
+	if err != nil {
+		return true
+	}
+	for _, req := range in.reqs {
+		if req.err != nil || !req.IsNotification() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *replaySocket) ReadJSON(v interface{}) error {
+	if len(r.in) > 0 {
+		msg := r.in[0]
+		r.in = r.in[1:]
+		return json.Unmarshal(msg.raw(), v)
+	}
+	select {
+	case <-r.answered:
+	case <-r.closed:
+	}
+	return io.EOF
+}
+
+func (r *replaySocket) WriteJSON(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, RecordedMessage{Time: time.Now(), Conn: r.conn, Dir: DirSent, Msg: b})
+	if msg, err := decodeIncoming(b); err == nil && len(msg.rsps) > 0 {
+		if r.expected--; r.expected == 0 {
+			close(r.answered)
+		}
+	}
+	return nil
+}
+
+func (r *replaySocket) Close() error {
+	r.once.Do(func() { close(r.closed) })
+	return nil
+}
+
+// NewPlaybackSocket returns a Socket that plays back the messages a server
+// sent in a recording, for testing a client against a recorded session
+// without the server. Each is read once the client has written as many
+// messages as the server had received before sending it. Pass the messages
+// of a single connection.
+func NewPlaybackSocket(msgs []RecordedMessage) Socket {
+	p := &playbackSocket{wrote: make(chan struct{}, 1), closed: make(chan struct{})}
+	received := 0
+	for _, msg := range msgs {
+		switch msg.Dir {
+		case DirReceived:
+			received++
+		case DirSent:
+			p.out = append(p.out, playback{msg.Msg, received})
+		}
+	}
+	return p
+}
+
+type playback struct {
+	msg json.RawMessage
+	// how many messages the client must have written first
+	after int
+}
+
+type playbackSocket struct {
+	out    []playback
+	wrote  chan struct{}
+	closed chan struct{}
+	once   sync.Once
+
+	mu     sync.Mutex
+	writes int
+}
+
+func (p *playbackSocket) ReadJSON(v interface{}) error {
+	if len(p.out) == 0 {
+		<-p.closed
+		return io.EOF
+	}
+	next := p.out[0]
+	for {
+		p.mu.Lock()
+		writes := p.writes
+		p.mu.Unlock()
+		if writes >= next.after {
+			break
+		}
+		select {
+		case <-p.wrote:
+		case <-p.closed:
+			return io.EOF
+		}
+	}
+	p.out = p.out[1:]
+	return json.Unmarshal(next.msg, v)
+}
+
+func (p *playbackSocket) WriteJSON(v interface{}) error {
+	p.mu.Lock()
+	p.writes++
+	p.mu.Unlock()
+	select {
+	case p.wrote <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (p *playbackSocket) Close() error {
+	p.once.Do(func() { close(p.closed) })
+	return nil
+}
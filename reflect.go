@@ -2,31 +2,213 @@ package jsonrpc
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"reflect"
 )
 
-func convertParams(method *Method, req *Request) (interface{}, error) {
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// newReflectMethod builds the call plan for fn, a handler method value or
+// function. Common signatures get a trampoline that calls fn directly; the
+// rest go through reflection with pooled argument slices. Arguments of the
+// types providers resolves are injected rather than read from params.
+func newReflectMethod(fn reflect.Value, providers func(reflect.Type) provider) *Method {
+	m := &Method{fn: fn}
+	var params []reflect.Type
+	for i := 1; i < fn.Type().NumIn(); i++ {
+		t := fn.Type().In(i)
+		if providers != nil {
+			if p := providers(t); p != nil {
+				m.inject = append(m.inject, injection{i, p})
+				continue
+			}
+		}
+		params = append(params, t)
+		m.paramsIn = append(m.paramsIn, i)
+	}
+	switch len(params) {
+	case 1:
+		m.paramsType = params[0]
+	case 0:
+	default:
+		m.argTypes = params
+	}
+	if fn.Type().NumOut() == 2 {
+		m.resultType = fn.Type().Out(0)
+	}
+	m.parse = func(raw *ParamsRaw, opts *DecodeOptions) (interface{}, error) {
+		return convertParams(m, raw, opts)
+	}
+	if m.inject == nil {
+		if m.call = trampoline(fn); m.call != nil {
+			return m
+		}
+	}
+	size := fn.Type().NumIn()
+	m.args.New = func() interface{} {
+		in := make([]reflect.Value, size)
+		return &in
+	}
+	m.call = func(ctx context.Context, params interface{}) (interface{}, error) {
+		return callMethod(ctx, m, params)
+	}
+	return m
+}
+
+// trampoline returns a call func that skips reflection for common handler
+// signatures, or nil.
+func trampoline(fn reflect.Value) func(ctx context.Context, params interface{}) (interface{}, error) {
+	if !fn.CanInterface() {
+		return nil
+	}
+	switch f := fn.Interface().(type) {
+	case func(context.Context):
+		return func(ctx context.Context, _ interface{}) (interface{}, error) {
+			f(ctx)
+			return nil, nil
+		}
+	case func(context.Context) error:
+		return func(ctx context.Context, _ interface{}) (interface{}, error) {
+			return nil, f(ctx)
+		}
+	case func(context.Context) (interface{}, error):
+		return func(ctx context.Context, _ interface{}) (interface{}, error) {
+			return f(ctx)
+		}
+	case func(context.Context, json.RawMessage) (interface{}, error):
+		return func(ctx context.Context, params interface{}) (interface{}, error) {
+			p, _ := params.(json.RawMessage)
+			return f(ctx, p)
+		}
+	case func(context.Context, map[string]interface{}) (interface{}, error):
+		return func(ctx context.Context, params interface{}) (interface{}, error) {
+			p, _ := params.(map[string]interface{})
+			return f(ctx, p)
+		}
+	case func(context.Context, string) (string, error):
+		return func(ctx context.Context, params interface{}) (interface{}, error) {
+			p, _ := params.(string)
+			return f(ctx, p)
+		}
+	}
+	return nil
+}
+
+// checkFunc reports whether fn has the shape of a handler: a context followed
+// by any params, returning an optional result and an optional error.
+func checkFunc(fn reflect.Value) error {
+	if fn.Kind() != reflect.Func {
+		return fmt.Errorf("jsonrpc: handler must be a function, got %s", fn.Kind())
+	}
+	t := fn.Type()
+	if t.NumIn() == 0 || t.In(0) != contextType {
+		return fmt.Errorf("jsonrpc: first argument of %s must be a context.Context", t)
+	}
+	if t.IsVariadic() {
+		return fmt.Errorf("jsonrpc: %s must not be variadic", t)
+	}
+	switch t.NumOut() {
+	case 0:
+	case 1, 2:
+		if t.Out(t.NumOut()-1) != errorType {
+			return fmt.Errorf("jsonrpc: last result of %s must be an error", t)
+		}
+	default:
+		return fmt.Errorf("jsonrpc: %s must return at most a result and an error", t)
+	}
+	return nil
+}
+
+func convertParams(method *Method, raw *ParamsRaw, opts *DecodeOptions) (interface{}, error) {
+	if method.argTypes != nil {
+		return convertPositionalParams(method.argTypes, raw, opts)
+	}
 	if method.paramsType == nil {
 		return nil, nil
 	}
-	params, err := req.Params.ParseInto(method.paramsType)
+	if method.paramsType == readerType {
+		return readerParams(raw), nil
+	}
+	if raw == nil {
+		return reflect.Zero(method.paramsType).Interface(), nil
+	}
+	params, err := raw.parseInto(method.paramsType, opts)
 	if err != nil {
 		return nil, err
 	}
 	return params, nil
 }
 
-func callMethod(ctx context.Context, t interface{}, method *Method, req *Request, params interface{}) *Response {
-	in := []reflect.Value{
-		reflect.ValueOf(t),
-		reflect.ValueOf(ctx),
+// convertPositionalParams reads array params into one value per argument.
+// Missing trailing arguments are left as zero values.
+func convertPositionalParams(types []reflect.Type, raw *ParamsRaw, opts *DecodeOptions) (interface{}, error) {
+	var elems []json.RawMessage
+	if raw != nil {
+		if err := json.Unmarshal(*raw, &elems); err != nil {
+			return nil, fmt.Errorf("rpc [params unmarshal]: expected %d positional params: %w", len(types), err)
+		}
+	}
+	if len(elems) > len(types) {
+		return nil, fmt.Errorf("rpc [params unmarshal]: expected at most %d positional params, got %d",
+			len(types), len(elems))
+	}
+	args := make([]interface{}, len(types))
+	for i, t := range types {
+		if i >= len(elems) {
+			args[i] = reflect.Zero(t).Interface()
+			continue
+		}
+		elem := ParamsRaw(elems[i])
+		arg, err := elem.parseInto(t, opts)
+		if err != nil {
+			return nil, fmt.Errorf("param %d: %w", i, err)
+		}
+		args[i] = arg
+	}
+	return args, nil
+}
+
+func callMethod(ctx context.Context, method *Method, params interface{}) (interface{}, error) {
+	inp := method.args.Get().(*[]reflect.Value)
+	in := *inp
+	in[0] = reflect.ValueOf(ctx)
+	release := func() {
+		for i := range in {
+			in[i] = reflect.Value{}
+		}
+		method.args.Put(inp)
 	}
 
-	if method.paramsType != nil {
-		in = append(in, reflect.ValueOf(params))
+	for _, inj := range method.inject {
+		v, err := inj.provide(ctx)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		in[inj.in] = v
+	}
+	if method.argTypes != nil {
+		for i, arg := range params.([]interface{}) {
+			if arg == nil {
+				in[method.paramsIn[i]] = reflect.Zero(method.argTypes[i])
+			} else {
+				in[method.paramsIn[i]] = reflect.ValueOf(arg)
+			}
+		}
+	} else if method.paramsType != nil {
+		if params == nil {
+			in[method.paramsIn[0]] = reflect.Zero(method.paramsType)
+		} else {
+			in[method.paramsIn[0]] = reflect.ValueOf(params)
+		}
 	}
 
 	out := method.fn.Call(in)
+	release()
 
 	var err error
 	var result interface{}
@@ -40,14 +222,7 @@ func callMethod(ctx context.Context, t interface{}, method *Method, req *Request
 	default:
 		panic("invalid # of arguments")
 	}
-
-	if err != nil {
-		if userErr, ok := err.(interface{ UserError() string }); ok {
-			return newResponseError(req.ID, userErr.UserError())
-		}
-		return newResponseError(req.ID, err.Error())
-	}
-	return newResponse(req.ID, result)
+	return result, err
 }
 
 func getResult(out reflect.Value) interface{} {
@@ -1,56 +1,118 @@
 package jsonrpc
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"reflect"
+	"time"
 )
 
 type Request struct {
-	ID      ID         `json:"id"`
+	ID      *ID        `json:"id,omitempty"`
 	Method  string     `json:"method"`
-	Params  *ParamsRaw `json:"params"`
+	Params  *ParamsRaw `json:"params,omitempty"`
 	JSONRPC string     `json:"jsonrpc"`
+
+	// IdempotencyKey is an extension member identifying retries of the same
+	// call, see WithIdempotency.
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+	// Deadline is an extension member holding the time by which the client
+	// stops waiting for the response, see WithDeadlines.
+	Deadline *time.Time `json:"deadline,omitempty"`
+	// Priority is an extension member asking for the call to run ahead of
+	// others, see ClientPriority.
+	Priority int `json:"priority,omitempty"`
+
+	// set when the request could not be decoded
+	err error
+	// its place in line, see WithSerializationKey
+	turn *turn
 }
 
-type (
-	ID        int
-	ParamsRaw []byte
-)
+type ParamsRaw []byte
+
+// IsNotification reports whether the request was sent without an id, in
+// which case the client does not expect a response.
+func (r *Request) IsNotification() bool {
+	return r.ID == nil
+}
 
 func (p *ParamsRaw) UnmarshalJSON(b []byte) error {
 	*p = b
 	return nil
 }
 
+func (p ParamsRaw) MarshalJSON() ([]byte, error) {
+	if len(p) == 0 {
+		return []byte("null"), nil
+	}
+	return p, nil
+}
+
 func (p *ParamsRaw) ParseInto(paramsType reflect.Type) (interface{}, error) {
-	var params interface{}
+	return p.parseInto(paramsType, nil)
+}
+
+func (p *ParamsRaw) parseInto(paramsType reflect.Type, opts *DecodeOptions) (interface{}, error) {
 	if paramsType.Kind() == reflect.Ptr {
-		params = reflect.New(paramsType.Elem()).Interface()
-	} else {
-		params = reflect.New(paramsType).Elem().Interface()
+		params := reflect.New(paramsType.Elem()).Interface()
+		if err := opts.unmarshal(*p, params); err != nil {
+			return nil, fmt.Errorf("rpc [params unmarshal]: %w", err)
+		}
+		return params, nil
 	}
-	if err := json.Unmarshal(*p, &params); err != nil {
+	params := reflect.New(paramsType)
+	if err := opts.unmarshal(*p, params.Interface()); err != nil {
 		return nil, fmt.Errorf("rpc [params unmarshal]: %w", err)
 	}
-	return params, nil
+	return params.Elem().Interface(), nil
+}
+
+// incoming is a single message read from the socket. A batch is a JSON array
+// of requests which must be answered with a JSON array of responses. Responses
+// to calls made from this end of the connection are collected in rsps.
+type incoming struct {
+	reqs  []*Request
+	rsps  []*rawResponse
+	batch bool
+	size  int
+	// the message as read
+	raw json.RawMessage
 }
 
-func readRequests(ctx context.Context, sock Socket) <-chan *Request {
-	requests := make(chan *Request)
+// readRequests reads messages until the socket fails or ctx is done. readErr
+// is set to the error that stopped it, if any, before the channel is closed.
+//
+// Malformed messages and the error that stopped it are passed to onError.
+func readRequests(ctx context.Context, logger Logger, sock Socket, readErr *error,
+	onError func(kind ConnErrorKind, err error)) <-chan *incoming {
+	requests := make(chan *incoming)
 	go func() {
 		defer close(requests)
 		for {
 			select {
-			case r := <-readNextRequest(sock):
+			case r := <-readNextRequest(ctx, sock):
+				if r.err != nil && ctx.Err() != nil {
+					// interrupted, not failed
+					return
+				}
 				if r.err != nil {
-					log.Printf("req error: %+v", r.err)
+					logger.Log(LevelInfo, "read error", "error", r.err)
+					*readErr = r.err
+					onError(r.kind, r.err)
+					return
+				}
+				if r.malformed != nil {
+					onError(DecodeError, r.malformed)
+				}
+				select {
+				case requests <- r.msg:
+				case <-ctx.Done():
 					return
 				}
-				log.Printf("req: %d %s", r.req.ID, r.req.Method)
-				requests <- r.req
 			case <-ctx.Done():
 				return
 			}
@@ -60,19 +122,130 @@ func readRequests(ctx context.Context, sock Socket) <-chan *Request {
 }
 
 type nextRequestResult struct {
-	req *Request
+	msg *incoming
 	err error
+	// what failed, with err
+	kind ConnErrorKind
+	// the syntax error of a malformed message answered with msg
+	malformed error
 }
 
-func readNextRequest(sock Socket) <-chan nextRequestResult {
-	ch := make(chan nextRequestResult)
+func readNextRequest(ctx context.Context, sock Socket) <-chan nextRequestResult {
+	ch := make(chan nextRequestResult, 1)
 	go func() {
-		var req Request
-		if err := sock.ReadJSON(&req); err != nil {
-			ch <- nextRequestResult{nil, err}
+		var raw json.RawMessage
+		var err error
+		if cs, ok := sock.(ContextSocket); ok {
+			err = cs.ReadJSONContext(ctx, &raw)
+		} else {
+			err = sock.ReadJSON(&raw)
+		}
+		if err != nil {
+			if isSyntaxError(err) {
+				// the socket has skipped the malformed message, so answer it
+				// and keep reading
+				ch <- nextRequestResult{msg: &incoming{reqs: []*Request{invalidRequest(err)}}, malformed: err}
+				return
+			}
+			ch <- nextRequestResult{err: err, kind: ReadError}
+			return
+		}
+		msg, err := decodeIncoming(raw)
+		if isSyntaxError(err) {
+			// sockets that don't validate what they read can hand over
+			// malformed JSON too
+			ch <- nextRequestResult{msg: &incoming{reqs: []*Request{invalidRequest(err)}}, malformed: err}
 			return
 		}
-		ch <- nextRequestResult{&req, nil}
+		ch <- nextRequestResult{msg: msg, err: err, kind: DecodeError}
 	}()
 	return ch
 }
+
+func decodeIncoming(raw json.RawMessage) (*incoming, error) {
+	msg := &incoming{size: len(raw), raw: raw}
+	if !isBatch(raw) {
+		req, rsp, err := decodeMessage(raw)
+		if isSyntaxError(err) {
+			return nil, err
+		} else if err != nil {
+			req = invalidRequest(err)
+		}
+		msg.add(req, rsp)
+		return msg, nil
+	}
+	var elems []json.RawMessage
+	if err := json.Unmarshal(raw, &elems); err != nil {
+		return nil, err
+	}
+	if len(elems) == 0 {
+		// an empty batch gets a single error response, not an array
+		msg.add(invalidRequest(fmt.Errorf("empty batch")), nil)
+		return msg, nil
+	}
+	msg.batch = true
+	for _, elem := range elems {
+		req, rsp, err := decodeMessage(elem)
+		if err != nil {
+			req = invalidRequest(err)
+		}
+		msg.add(req, rsp)
+	}
+	return msg, nil
+}
+
+func (msg *incoming) add(req *Request, rsp *rawResponse) {
+	if req != nil {
+		msg.reqs = append(msg.reqs, req)
+	}
+	if rsp != nil {
+		msg.rsps = append(msg.rsps, rsp)
+	}
+}
+
+// decodeMessage decodes either a request or a response to one of our calls.
+func decodeMessage(raw json.RawMessage) (*Request, *rawResponse, error) {
+	var msg struct {
+		Request
+		RawID  json.RawMessage `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *Error          `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return nil, nil, err
+	}
+	if msg.RawID != nil {
+		// an explicit null id is a request that must be answered with null
+		msg.ID = &ID{}
+		if err := msg.ID.UnmarshalJSON(msg.RawID); err != nil {
+			return invalidRequest(err), nil, nil
+		}
+	}
+	if msg.Method == "" && (msg.Result != nil || msg.Error != nil) {
+		return nil, &rawResponse{ID: msg.ID, Result: msg.Result, Error: msg.Error}, nil
+	}
+	return &msg.Request, nil, nil
+}
+
+func isBatch(raw json.RawMessage) bool {
+	raw = bytes.TrimLeft(raw, " \t\r\n")
+	return len(raw) > 0 && raw[0] == '['
+}
+
+func invalidRequest(err error) *Request {
+	return &Request{err: err}
+}
+
+func isSyntaxError(err error) bool {
+	var syntaxErr *json.SyntaxError
+	return errors.As(err, &syntaxErr)
+}
+
+// requestError is the error sent back for a request that could not be
+// decoded: a parse error for malformed JSON, or else an invalid request.
+func requestError(err error) *Error {
+	if isSyntaxError(err) {
+		return ErrParse.WithMessage(err.Error())
+	}
+	return ErrInvalidRequest.WithMessage(err.Error())
+}
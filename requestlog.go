@@ -0,0 +1,227 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// RequestLog durably records requests for WithRequestLog.
+type RequestLog interface {
+	// Append records req before it is dispatched, returning the sequence
+	// number to Ack it with.
+	Append(req *Request) (seq uint64, err error)
+	// Ack forgets a request once it has been answered.
+	Ack(seq uint64) error
+	// Pending returns the requests appended but not acked, oldest first.
+	Pending() ([]LogEntry, error)
+}
+
+// LogEntry is a request recorded in a RequestLog.
+type LogEntry struct {
+	Seq     uint64
+	Request *Request
+}
+
+// WithRequestLog appends incoming requests for methods, or all methods if
+// none are given, to log before they are dispatched, and acks them once the
+// response has been written, or the handler has returned for notifications.
+// Requests that can't be logged are rejected. After a crash, Replay runs the
+// requests that were never acked, so each runs at least once.
+func WithRequestLog(log RequestLog, methods ...string) Option {
+	return func(s *Server) {
+		s.requestLog = log
+		if len(methods) > 0 {
+			s.loggedMethods = map[string]bool{}
+			for _, method := range methods {
+				s.loggedMethods[method] = true
+			}
+		}
+	}
+}
+
+// logRequest appends req to the request log, returning the function that
+// acks it, or nil if it isn't logged.
+func (s *Server) logRequest(req *Request) (func(), error) {
+	if s.requestLog == nil || req.err != nil || s.isCancel(req) || s.isUnsubscribe(req) ||
+		s.loggedMethods != nil && !s.loggedMethods[req.Method] {
+		return nil, nil
+	}
+	seq, err := s.requestLog.Append(req)
+	if err != nil {
+		s.logger.Log(LevelError, "request log error", "method", req.Method, "error", err)
+		return nil, err
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if err := s.requestLog.Ack(seq); err != nil {
+				s.logger.Log(LevelError, "request log error", "seq", seq, "error", err)
+			}
+		})
+	}, nil
+}
+
+// acknowledge acks the logged requests answered by msg once it is written.
+func acknowledge(msg interface{}) {
+	switch msg := msg.(type) {
+	case *Response:
+		if msg.written != nil {
+			msg.written()
+		}
+	case []*Response:
+		for _, rsp := range msg {
+			acknowledge(rsp)
+		}
+	}
+}
+
+// Replay dispatches the requests in the request log that were never acked,
+// oldest first, and acks each once its handler returns. Call it on startup,
+// before serving, to finish the work of a server that crashed. Responses are
+// discarded, as the clients that sent the requests are gone.
+func (s *Server) Replay(ctx context.Context) error {
+	if s.requestLog == nil {
+		return nil
+	}
+	entries, err := s.requestLog.Pending()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		req := entry.Request
+		// the client is no longer waiting
+		req.Deadline = nil
+		s.logger.Log(LevelInfo, "replay", "seq", entry.Seq, "method", req.Method)
+		if rsp := s.dispatch(ctxWithNotification(ctx), req); rsp != nil && rsp.Error != nil {
+			s.logger.Log(LevelWarn, "replay error", "seq", entry.Seq, "method", req.Method, "error", rsp.Error)
+		}
+		if err := s.requestLog.Ack(entry.Seq); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FileLog is a RequestLog kept in an append-only file, synced after each
+// request is appended. The file is truncated whenever every request in it
+// has been acked.
+type FileLog struct {
+	mu      sync.Mutex
+	f       *os.File
+	seq     uint64
+	pending map[uint64]*Request
+}
+
+var _ RequestLog = (*FileLog)(nil)
+
+type fileLogRecord struct {
+	Seq     uint64   `json:"seq,omitempty"`
+	Request *Request `json:"req,omitempty"`
+	Ack     uint64   `json:"ack,omitempty"`
+}
+
+// OpenFileLog opens or creates the log at path, reading back the requests
+// that were never acked.
+func OpenFileLog(path string) (*FileLog, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	l := &FileLog{f: f, pending: map[uint64]*Request{}}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<30)
+	for sc.Scan() {
+		var rec fileLogRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			// the last record may be torn by a crash mid write
+			continue
+		}
+		switch {
+		case rec.Ack != 0:
+			delete(l.pending, rec.Ack)
+		case rec.Request != nil:
+			l.pending[rec.Seq] = rec.Request
+		}
+		if rec.Seq > l.seq {
+			l.seq = rec.Seq
+		}
+		if rec.Ack > l.seq {
+			l.seq = rec.Ack
+		}
+	}
+	if err := sc.Err(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("jsonrpc: read request log: %w", err)
+	}
+	if len(l.pending) == 0 {
+		if err := f.Truncate(0); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func (l *FileLog) write(rec fileLogRecord, sync bool) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := l.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if sync {
+		return l.f.Sync()
+	}
+	return nil
+}
+
+func (l *FileLog) Append(req *Request) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	if err := l.write(fileLogRecord{Seq: l.seq, Request: req}, true); err != nil {
+		return 0, err
+	}
+	l.pending[l.seq] = req
+	return l.seq, nil
+}
+
+// Ack records that a request was answered. Acks aren't synced: one lost in a
+// crash only means the request runs again.
+func (l *FileLog) Ack(seq uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.pending[seq]; !ok {
+		return nil
+	}
+	delete(l.pending, seq)
+	if len(l.pending) == 0 {
+		return l.f.Truncate(0)
+	}
+	return l.write(fileLogRecord{Ack: seq}, false)
+}
+
+func (l *FileLog) Pending() ([]LogEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries := make([]LogEntry, 0, len(l.pending))
+	for seq, req := range l.pending {
+		entries = append(entries, LogEntry{seq, req})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Seq < entries[j].Seq })
+	return entries, nil
+}
+
+// Close closes the file.
+func (l *FileLog) Close() error {
+	return l.f.Close()
+}
@@ -1,22 +1,85 @@
 package jsonrpc
 
 import (
-	"log"
+	"encoding/json"
+	"time"
 )
 
 type Response struct {
-	ID     ID          `json:"id,omitempty"`
+	ID     *ID         `json:"id,omitempty"`
 	Result interface{} `json:"result,omitempty"`
-	Error  string      `json:"error,omitempty"`
+	Error  *Error      `json:"error,omitempty"`
 
 	// for notifications to client
 	Method string      `json:"method,omitempty"`
 	Params interface{} `json:"params,omitempty"`
 
+	// Deprecated is an extension member holding the deprecation notice of
+	// the method called, see WithDeprecationNotices.
+	Deprecated string `json:"deprecated,omitempty"`
+
 	JSONRPC string `json:"jsonrpc"`
+
+	// acks the request in the request log once the response is written
+	written func()
+}
+
+// MarshalJSON always includes the id of a response, which is null when the
+// request's id could not be read, and the result of a successful response,
+// even when it is null, as the spec requires.
+func (r *Response) MarshalJSON() ([]byte, error) {
+	type response Response
+	if r.Method != "" {
+		return jsonMarshal((*response)(r))
+	}
+	id := r.ID
+	if id == nil {
+		id = &ID{}
+	}
+	if r.Error != nil {
+		return jsonMarshal(struct {
+			*response
+			ID *ID `json:"id"`
+		}{(*response)(r), id})
+	}
+	return jsonMarshal(struct {
+		*response
+		ID     *ID         `json:"id"`
+		Result interface{} `json:"result"`
+	}{(*response)(r), id, r.Result})
+}
+
+// PreMarshaled is a result that is already JSON, e.g. served from a cache or
+// an upstream server, which is written as is rather than marshalled again.
+// It must be valid JSON. Results of type json.RawMessage are treated the
+// same.
+type PreMarshaled []byte
+
+// MarshalJSON returns p, or null if p is empty.
+func (p PreMarshaled) MarshalJSON() ([]byte, error) {
+	if len(p) == 0 {
+		return []byte("null"), nil
+	}
+	return p, nil
+}
+
+// marshaledResult returns the JSON of a PreMarshaled or json.RawMessage
+// result.
+func marshaledResult(result interface{}) ([]byte, bool) {
+	switch result := result.(type) {
+	case PreMarshaled:
+		b, _ := result.MarshalJSON()
+		return b, true
+	case json.RawMessage:
+		if result == nil {
+			return []byte("null"), true
+		}
+		return result, true
+	}
+	return nil, false
 }
 
-func newResponse(id ID, result interface{}) *Response {
+func newResponse(id *ID, result interface{}) *Response {
 	return &Response{
 		ID:      id,
 		Result:  result,
@@ -24,7 +87,7 @@ func newResponse(id ID, result interface{}) *Response {
 	}
 }
 
-func newResponseError(id ID, err string) *Response {
+func newResponseError(id *ID, err *Error) *Response {
 	return &Response{
 		ID:      id,
 		Error:   err,
@@ -40,15 +103,91 @@ func newResponseNotification(method string, params interface{}) *Response {
 	}
 }
 
-func writeResponses(sock Socket, responses <-chan *Response) {
-	for rsp := range responses {
-		if rsp.Error != "" {
-			log.Printf("rsp error: %d %s", rsp.ID, rsp.Error)
-		} else {
-			log.Printf("rsp: %d", rsp.ID)
+// writeResponses writes each message to the socket. A message is a *Response,
+// a []*Response batch, or a *Request initiated by this end of the connection.
+// It returns once the connection is closing and the queue is drained.
+func (s *Server) writeResponses(conn *Conn, sock Socket, responses <-chan outgoing) {
+	for {
+		select {
+		case out := <-responses:
+			s.sendMessage(conn, sock, out)
+		case <-conn.closing:
+			for {
+				select {
+				case out := <-responses:
+					s.sendMessage(conn, sock, out)
+				default:
+					return
+				}
+			}
 		}
-		if err := sock.WriteJSON(rsp); err != nil {
-			log.Println(err)
+	}
+}
+
+func (s *Server) writeMessage(conn *Conn, sock Socket, msg interface{}) {
+	logger := s.logger
+	orig := msg
+	switch msg := msg.(type) {
+	case *Response:
+		logResponse(logger, msg)
+	case []*Response:
+		for _, rsp := range msg {
+			logResponse(logger, rsp)
+		}
+	case *Request:
+		logger.Log(LevelDebug, "req out", "id", msg.ID, "method", msg.Method)
+	}
+	if s.metrics != nil || s.onSendRaw != nil {
+		// marshal here to measure or tap it; the socket writes it verbatim
+		b, err := jsonMarshal(msg)
+		if err != nil {
+			logger.Log(LevelError, "marshal error", "error", err)
+			return
+		}
+		if s.metrics != nil {
+			s.metrics.MessageWritten(len(b))
+		}
+		msg = json.RawMessage(b)
+	}
+	var timer *time.Timer
+	if s.writeTimeout > 0 {
+		timer = time.AfterFunc(s.writeTimeout, func() {
+			logger.Log(LevelWarn, "write timeout, closing connection", "timeout", s.writeTimeout)
+			s.fail(conn, WriteError, ErrWriteTimeout)
+		})
+	}
+	conn.writeMu.Lock()
+	if conn.writeErr != nil {
+		// the socket is broken and being closed
+		conn.writeMu.Unlock()
+		if timer != nil {
+			timer.Stop()
 		}
+		return
+	}
+	err := sock.WriteJSON(msg)
+	if err != nil {
+		conn.writeErr = err
+	}
+	conn.writeMu.Unlock()
+	if err != nil {
+		logger.Log(LevelError, "write error, closing connection", "error", err)
+		s.fail(conn, WriteError, err)
+	} else {
+		acknowledge(orig)
+		if s.onSendRaw != nil {
+			s.onSendRaw(conn, msg.(json.RawMessage))
+		}
+	}
+	if timer != nil {
+		timer.Stop()
+	}
+}
+
+func logResponse(logger Logger, rsp *Response) {
+	if rsp.Error != nil {
+		logger.Log(LevelInfo, "rsp error", "id", rsp.ID, "code", rsp.Error.Code, "message", rsp.Error.Message)
+	} else {
+		logger.Log(LevelDebug, "rsp", "id", rsp.ID)
 	}
 }
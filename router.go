@@ -0,0 +1,109 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+type mount struct {
+	prefix string
+	server *Server
+}
+
+// Mount hands every request whose method starts with prefix to sub, with the
+// prefix trimmed. sub's own interceptors and hooks apply. Methods registered
+// directly on s take precedence, and the longest matching prefix wins.
+// It is safe to call while serving.
+func (s *Server) Mount(prefix string, sub *Server) {
+	s.methodsMu.Lock()
+	defer s.methodsMu.Unlock()
+	mounts := append(append([]mount{}, s.mountSet()...), mount{prefix, sub})
+	sort.SliceStable(mounts, func(i, j int) bool {
+		return len(mounts[i].prefix) > len(mounts[j].prefix)
+	})
+	s.mounts.Store(mounts)
+}
+
+// Unmount removes the server mounted at prefix, reporting whether there was
+// one. Requests already handed to it complete.
+func (s *Server) Unmount(prefix string) bool {
+	s.methodsMu.Lock()
+	defer s.methodsMu.Unlock()
+	old := s.mountSet()
+	mounts := []mount{}
+	for _, m := range old {
+		if m.prefix != prefix {
+			mounts = append(mounts, m)
+		}
+	}
+	s.mounts.Store(mounts)
+	return len(mounts) < len(old)
+}
+
+// Group creates a server for rcvr's methods and mounts it under prefix + "/",
+// so a method Foo is called as "prefix/Foo".
+func (s *Server) Group(prefix string, rcvr interface{}, opts ...Option) *Server {
+	sub := New(rcvr, append([]Option{WithLogger(s.logger)}, opts...)...)
+	s.Mount(prefix+"/", sub)
+	return sub
+}
+
+func (s *Server) lookupMount(method string) (*Server, string) {
+	for _, m := range s.mountSet() {
+		if strings.HasPrefix(method, m.prefix) {
+			return m.server, strings.TrimPrefix(method, m.prefix)
+		}
+	}
+	return nil, ""
+}
+
+// mountSet returns the current mounts, longest prefix first.
+func (s *Server) mountSet() []mount {
+	mounts, _ := s.mounts.Load().([]mount)
+	return mounts
+}
+
+// WithFallback hands requests for methods that aren't registered or mounted
+// to h instead of answering them with ErrMethodNotFound, e.g. to resolve
+// methods dynamically or proxy them to another server. h runs inside the
+// interceptors, after authorization and rate limiting, and may call
+// MethodNotFound for the requests it doesn't handle.
+func WithFallback(h Handler) Option {
+	return func(s *Server) {
+		s.fallback = h
+	}
+}
+
+// MethodNotFound answers req with ErrMethodNotFound, as is done for unknown
+// methods without a fallback.
+func MethodNotFound(ctx context.Context, req *Request) (*Response, error) {
+	return handleNotFound(req), nil
+}
+
+// Upstream is what Forward sends requests to, such as a *Client or
+// *ReconnectingClient.
+type Upstream interface {
+	Call(ctx context.Context, method string, params, result interface{}) error
+	Notify(ctx context.Context, method string, params interface{}) error
+}
+
+// Forward returns a Handler that sends every request to u as is, passing
+// back its result or error, e.g. for WithFallback.
+func Forward(u Upstream) Handler {
+	return func(ctx context.Context, req *Request) (*Response, error) {
+		var params interface{}
+		if req.Params != nil {
+			params = json.RawMessage(*req.Params)
+		}
+		if req.IsNotification() {
+			return nil, u.Notify(ctx, req.Method, params)
+		}
+		var result json.RawMessage
+		if err := u.Call(ctx, req.Method, params, &result); err != nil {
+			return nil, err
+		}
+		return &Response{ID: req.ID, Result: result, JSONRPC: "2.0"}, nil
+	}
+}
@@ -0,0 +1,188 @@
+package jsonrpc
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON Schema.
+type Schema map[string]interface{}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	rawMessageType      = reflect.TypeOf(json.RawMessage(nil))
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// schemaBuilder reflects Go types into JSON Schemas. Named structs are
+// collected into defs and referenced, which also handles recursive types.
+type schemaBuilder struct {
+	refPrefix string
+	defs      map[string]Schema
+	names     map[reflect.Type]string
+}
+
+// SchemaOf returns the JSON Schema of t as OpenRPC would describe it, with
+// the named structs it references under $defs. A struct's own schema is
+// inlined rather than referenced.
+func SchemaOf(t reflect.Type) Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	b := newSchemaBuilder("#/$defs/")
+	var s Schema
+	if t.Kind() == reflect.Struct {
+		s = b.structSchema(t)
+	} else {
+		s = b.schema(t)
+	}
+	if len(b.defs) > 0 {
+		s["$defs"] = b.defs
+	}
+	return s
+}
+
+func newSchemaBuilder(refPrefix string) *schemaBuilder {
+	return &schemaBuilder{
+		refPrefix: refPrefix,
+		defs:      map[string]Schema{},
+		names:     map[reflect.Type]string{},
+	}
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return Schema{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return Schema{}
+	case t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType):
+		return Schema{}
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return Schema{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return Schema{"type": "string", "contentEncoding": "base64"}
+		}
+		return Schema{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		return Schema{"$ref": b.refPrefix + b.define(t)}
+	}
+	return Schema{}
+}
+
+// define adds the schema of the named struct t to defs once and returns its
+// key, suffixed with a number if another type has the same name.
+func (b *schemaBuilder) define(t reflect.Type) string {
+	if name, ok := b.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	for i := 2; b.defs[name] != nil; i++ {
+		name = fmt.Sprintf("%s%d", t.Name(), i)
+	}
+	b.names[t] = name
+	b.defs[name] = Schema{}
+	for k, v := range b.structSchema(t) {
+		b.defs[name][k] = v
+	}
+	return name
+}
+
+func (b *schemaBuilder) structSchema(t reflect.Type) Schema {
+	props := Schema{}
+	var required []string
+	for _, f := range structFields(t) {
+		s := b.schema(f.typ)
+		if f.asString {
+			s = Schema{"type": "string"}
+		}
+		if f.def != "" {
+			var def interface{}
+			if json.Unmarshal(defaultValue(f), &def) == nil {
+				s["default"] = def
+			}
+		}
+		props[f.name] = s
+		if !f.omitempty && f.def == "" {
+			required = append(required, f.name)
+		}
+	}
+	s := Schema{"type": "object", "properties": props}
+	if required != nil {
+		s["required"] = required
+	}
+	return s
+}
+
+type structField struct {
+	name      string
+	typ       reflect.Type
+	omitempty bool
+	asString  bool
+	// the default tag
+	def string
+}
+
+// structFields lists the fields encoding/json would use for t, flattening
+// untagged embedded structs.
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if f.Anonymous && name == "" {
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				fields = append(fields, structFields(ft)...)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, structField{
+			name:      name,
+			typ:       f.Type,
+			omitempty: strings.Contains(","+opts+",", ",omitempty,"),
+			asString:  strings.Contains(","+opts+",", ",string,"),
+			def:       f.Tag.Get("default"),
+		})
+	}
+	return fields
+}
@@ -0,0 +1,103 @@
+package jsonrpc
+
+import (
+	"sync"
+	"time"
+)
+
+// SendStats describes the write path of a connection served by Handle.
+type SendStats struct {
+	// Queued is the number of messages waiting in the send queue.
+	Queued int
+	// Written is the number of messages written so far.
+	Written uint64
+	// Lag is how long the last message written took from being queued to
+	// being written, and MaxLag the longest any has taken.
+	Lag    time.Duration
+	MaxLag time.Duration
+	// WriteTime is the total time spent writing to the socket.
+	WriteTime time.Duration
+}
+
+// SendMetrics is implemented by Metrics that measure the write path.
+type SendMetrics interface {
+	// MessageQueued is called when a message is put on a send queue.
+	MessageQueued()
+	// MessageSent is called when it has been written, with the time from
+	// being queued to being written and the time the write itself took.
+	MessageSent(lag, write time.Duration)
+}
+
+// WithSlowConsumer calls fn when a connection's messages start taking longer
+// than threshold from being queued to being written, e.g. to call
+// Conn.Disconnect. It is called again only once the connection has caught up
+// and lags again. fn runs on the connection's writer, which doesn't write
+// meanwhile. WithWriteTimeout covers writes that never finish.
+func WithSlowConsumer(threshold time.Duration, fn func(conn *Conn, lag time.Duration)) Option {
+	return func(s *Server) {
+		s.slowThreshold = threshold
+		s.onSlowConsumer = fn
+	}
+}
+
+// outgoing is a message on a send queue.
+type outgoing struct {
+	msg    interface{}
+	queued time.Time
+}
+
+type sendStats struct {
+	mu      sync.Mutex
+	stats   SendStats
+	lagging bool
+}
+
+// SendStats returns the connection's send queue depth and write latencies,
+// or the zero SendStats for a client's connection, which has no send queue.
+func (c *Conn) SendStats() SendStats {
+	c.sendStats.mu.Lock()
+	stats := c.sendStats.stats
+	c.sendStats.mu.Unlock()
+	stats.Queued = len(c.queue)
+	return stats
+}
+
+// Disconnect closes the connection at once, e.g. to drop a slow consumer.
+// Unlike Close, it cancels the handlers and doesn't wait for their responses.
+// err is passed to the WithOnDisconnect callback.
+func (c *Conn) Disconnect(err error) {
+	if c.stopReading == nil {
+		// a client's connection
+		_ = c.Close()
+		return
+	}
+	c.abort(err)
+}
+
+// sendMessage writes a message from the send queue and records how long it
+// took.
+func (s *Server) sendMessage(conn *Conn, sock Socket, out outgoing) {
+	start := time.Now()
+	s.writeMessage(conn, sock, out.msg)
+	end := time.Now()
+	lag, write := end.Sub(out.queued), end.Sub(start)
+	if m, ok := s.metrics.(SendMetrics); ok {
+		m.MessageSent(lag, write)
+	}
+
+	st := &conn.sendStats
+	st.mu.Lock()
+	st.stats.Written++
+	st.stats.Lag = lag
+	if lag > st.stats.MaxLag {
+		st.stats.MaxLag = lag
+	}
+	st.stats.WriteTime += write
+	slow := s.onSlowConsumer != nil && lag > s.slowThreshold && !st.lagging
+	st.lagging = lag > s.slowThreshold
+	st.mu.Unlock()
+	if slow {
+		s.logger.Log(LevelWarn, "slow consumer", "conn", conn.ID(), "lag", lag)
+		s.onSlowConsumer(conn, lag)
+	}
+}
@@ -0,0 +1,143 @@
+package jsonrpc
+
+import (
+	"context"
+	"sync"
+)
+
+// WithMethodConcurrency limits how many calls to method run at once across
+// all connections; the rest wait their turn, or until they are cancelled or
+// time out. A limit of 1 keeps method from running concurrently with itself.
+func WithMethodConcurrency(method string, limit int) Option {
+	return func(s *Server) {
+		if s.methodConcurrency == nil {
+			s.methodConcurrency = map[string]chan struct{}{}
+		}
+		s.methodConcurrency[method] = make(chan struct{}, limit)
+	}
+}
+
+// WithSerializationKey runs requests that key maps to the same non-empty
+// string one at a time, in the order they were read, across all
+// connections. Requests with different keys, or an empty one, stay parallel.
+// For example, to keep saves of one document in order:
+//
+//	jsonrpc.WithSerializationKey(func(req *jsonrpc.Request) string {
+//		if req.Method != "saveDocument" {
+//			return ""
+//		}
+//		var p struct{ URI string }
+//		_ = json.Unmarshal(*req.Params, &p)
+//		return p.URI
+//	})
+//
+// key may return the same string for several methods to order them together.
+func WithSerializationKey(key func(req *Request) string) Option {
+	return func(s *Server) {
+		s.serializer = &serializer{key: key, tails: map[string]chan struct{}{}}
+	}
+}
+
+// serializer queues requests by key. Each key maps to a channel closed once
+// the last request queued with it has finished.
+type serializer struct {
+	key func(req *Request) string
+
+	mu    sync.Mutex
+	tails map[string]chan struct{}
+}
+
+// turn is a request's place in a serializer queue.
+type turn struct {
+	ready <-chan struct{}
+	done  chan struct{}
+	once  sync.Once
+	end   func()
+}
+
+// reserveTurns reserves the turns of the requests in msg, in order, so they
+// follow the order of reading rather than of the handler goroutines.
+func (s *Server) reserveTurns(msg *incoming) {
+	if s.serializer == nil {
+		return
+	}
+	for _, req := range msg.reqs {
+		s.takeTurn(req)
+	}
+}
+
+// takeTurn reserves req's turn, unless it already has one, and returns it,
+// or nil if req isn't serialized.
+func (s *Server) takeTurn(req *Request) *turn {
+	if s.serializer == nil || req.turn != nil || req.err != nil || s.isCancel(req) || s.isUnsubscribe(req) {
+		return req.turn
+	}
+	key := s.serializer.key(req)
+	if key == "" {
+		return nil
+	}
+	z := s.serializer
+	t := &turn{done: make(chan struct{})}
+	z.mu.Lock()
+	prev := z.tails[key]
+	z.tails[key] = t.done
+	z.mu.Unlock()
+	if prev == nil {
+		prev = closedChan
+	}
+	t.ready = prev
+	t.end = func() {
+		z.mu.Lock()
+		if z.tails[key] == t.done {
+			delete(z.tails, key)
+		}
+		z.mu.Unlock()
+		close(t.done)
+	}
+	req.turn = t
+	return t
+}
+
+var closedChan = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// release lets the next request with the same key run, once the previous
+// one has, even if this one gave up waiting.
+func (t *turn) release() {
+	t.once.Do(func() {
+		select {
+		case <-t.ready:
+			t.end()
+		default:
+			go func() {
+				<-t.ready
+				t.end()
+			}()
+		}
+	})
+}
+
+// waitTurn waits until req may run: its turn has come, and there is a free
+// slot for its method. The returned func frees the slot.
+func (s *Server) waitTurn(ctx context.Context, req *Request) (func(), error) {
+	if t := req.turn; t != nil {
+		select {
+		case <-t.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	sem := s.methodConcurrency[req.Method]
+	if sem == nil {
+		return func() {}, nil
+	}
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
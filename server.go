@@ -1,41 +1,157 @@
 package jsonrpc
 
 import (
+	"context"
+	"encoding/json"
 	"io"
 	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Server struct {
-	methods       Methods
-	rcvr          interface{}
-	afterConnect  afterConnectFN
-	beforeRequest beforeRequestFN
+	methods                 atomic.Value // Methods, replaced on every change
+	methodsMu               sync.Mutex
+	rcvr                    interface{}
+	afterConnect            afterConnectFN
+	beforeRequest           beforeRequestFN
+	interceptors            []Interceptor
+	handler                 Handler
+	logger                  Logger
+	metrics                 Metrics
+	panicHandler            PanicHandler
+	production              bool
+	validator               func(params interface{}) error
+	mounts                  atomic.Value // []mount
+	strict                  bool
+	requestLog              RequestLog
+	loggedMethods           map[string]bool
+	deadlines               bool
+	aliases                 map[string]string
+	deprecated              map[string]string
+	deprecationNotices      bool
+	decodeOptions           *DecodeOptions
+	methodDecodeOptions     map[string]*DecodeOptions
+	errorMapper             func(error) *Error
+	idempotency             *responseCache
+	compressThreshold       int
+	compressors             []Compressor
+	maxRequestSize          int
+	closeOversized          bool
+	maxResponseSize         int
+	heartbeat               *heartbeat
+	openRPCInfo             OpenRPCInfo
+	methodErrors            map[string][]*Error
+	docsMu                  sync.RWMutex
+	docs                    map[string]string
+	auth                    *authConfig
+	rateLimit               *tokenBucket
+	connRate                float64
+	connBurst               int
+	methodRateLimits        map[string]*tokenBucket
+	sendQueueSize           int
+	sendPolicy              SendPolicy
+	writeTimeout            time.Duration
+	timeout                 time.Duration
+	methodTimeouts          map[string]time.Duration
+	onConnect               func(ctx context.Context, conn *Conn)
+	onDisconnect            func(conn *Conn, err error)
+	onAbandoned             func(ctx context.Context, req *Request)
+	onResponse              func(ctx context.Context, req *Request, rsp *Response) *Response
+	fallback                Handler
+	pendingStore            PendingStore
+	onError                 func(conn *Conn, err *ConnError)
+	gatedMethods            []methodRule
+	ethereum                bool
+	slowThreshold           time.Duration
+	onSlowConsumer          func(conn *Conn, lag time.Duration)
+	idGenerator             IDGenerator
+	hello                   bool
+	helloExtensions         []string
+	notificationConcurrency int
+	stats                   *serverStats
+	healthCheck             func(ctx context.Context) error
+	naming                  NamingStrategy
+	methodNames             map[string]string
+	onReceiveRaw            func(conn *Conn, msg json.RawMessage)
+	onSendRaw               func(conn *Conn, msg json.RawMessage)
+	providers               map[reflect.Type]provider
+	methodConcurrency       map[string]chan struct{}
+	serializer              *serializer
+	progressMethod          string
+	subscriptionMethod      string
+	unsubscribeMethod       string
+	cancelMethod            string
+	concurrency             int
+	busyPolicy              BusyPolicy
+	priorities              []PriorityPolicy
+	priorityQueue           int
+	ordered                 bool
+	orderedBypass           map[string]bool
+
+	mu      sync.Mutex
+	conns   map[*Conn]struct{}
+	active  sync.WaitGroup
+	closing bool
 }
 
-type Socket interface {
-	io.Closer
+// MessageReader reads JSON messages. ReadJSON should return a
+// *json.SyntaxError, possibly wrapped, only when it has skipped past a
+// malformed message and can read the next one; the peer then gets a parse
+// error and the connection stays open. Any other error ends the connection.
+type MessageReader interface {
 	ReadJSON(interface{}) error
+}
+
+// MessageWriter writes JSON messages.
+type MessageWriter interface {
 	WriteJSON(interface{}) error
 }
 
-func New(sampleMethodReceiver interface{}) *Server {
-	methods := Methods{}
-	ty := reflect.TypeOf(sampleMethodReceiver)
-	for i := 0; i < ty.NumMethod(); i++ {
-		m := ty.Method(i)
-		fn := m.Func
-		fnType := fn.Type()
-		var paramsType reflect.Type
-		if fnType.NumIn() == 3 {
-			paramsType = fnType.In(2)
-		}
-		methods[m.Name] = &Method{fn, paramsType}
+// Socket carries JSON messages. Handle and Client read from a single
+// goroutine and serialize their writes, messages and attachments alike, so a
+// socket used by one of them needn't be safe for concurrent reads or
+// concurrent writes, only for a read running alongside a write. Wrap sockets
+// shared with another writer, e.g. a *websocket.Conn also written to
+// directly, with NewLockedSocket.
+type Socket interface {
+	io.Closer
+	MessageReader
+	MessageWriter
+}
+
+type Option func(*Server)
+
+// WithLogger sets where the server logs. Request params are only logged at
+// LevelDebug. Defaults to the standard logger at LevelInfo.
+func WithLogger(l Logger) Option {
+	return func(s *Server) {
+		s.logger = l
 	}
+}
 
-	return &Server{
-		methods:       methods,
-		rcvr:          sampleMethodReceiver,
-		afterConnect:  getAfterConnect(sampleMethodReceiver),
-		beforeRequest: getBeforeRequest(sampleMethodReceiver),
+func New(sampleMethodReceiver interface{}, opts ...Option) *Server {
+	s := &Server{
+		rcvr:               sampleMethodReceiver,
+		afterConnect:       getAfterConnect(sampleMethodReceiver),
+		beforeRequest:      getBeforeRequest(sampleMethodReceiver),
+		logger:             defaultLogger,
+		cancelMethod:       defaultCancelMethod,
+		progressMethod:     defaultProgressMethod,
+		subscriptionMethod: defaultSubscriptionMethod,
+		unsubscribeMethod:  defaultUnsubscribeMethod,
+	}
+	s.handler = s.invoke
+	for _, opt := range opts {
+		opt(s)
 	}
+	// after the options, which may add providers and names
+	methods := s.receiverMethods(reflect.ValueOf(sampleMethodReceiver), false)
+	methods[discoverMethod] = newReflectMethod(reflect.ValueOf(s.discover), nil)
+	methods[listMethodsMethod] = newReflectMethod(reflect.ValueOf(s.listMethods), nil)
+	s.statusMethods(methods)
+	s.helloMethods(methods)
+	s.methods.Store(methods)
+	return s
 }
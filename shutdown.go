@@ -0,0 +1,62 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrServerClosed = errors.New("jsonrpc: server closed")
+
+// Shutdown stops every connection from reading new requests, waits for the
+// in-flight handlers to finish and their responses to be written, then closes
+// the sockets. If ctx is done first, handler contexts are cancelled, the
+// sockets are closed and ctx.Err() is returned. Handle returns immediately
+// for connections made after Shutdown is called.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+	for conn := range s.conns {
+		conn.stopReading()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.active.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.abort(ctx.Err())
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// track registers a connection, reporting false if the server is shut down.
+func (s *Server) track(conn *Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = map[*Conn]struct{}{}
+	}
+	s.conns[conn] = struct{}{}
+	s.active.Add(1)
+	return true
+}
+
+func (s *Server) untrack(conn *Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+	s.active.Done()
+}
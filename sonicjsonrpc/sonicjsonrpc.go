@@ -0,0 +1,15 @@
+// Package sonicjsonrpc makes jsonrpc marshal messages and decode params with
+// sonic when imported, on amd64 and arm64:
+//
+//	import _ "github.com/jdxcode/jsonrpc/sonicjsonrpc"
+package sonicjsonrpc
+
+import (
+	"github.com/bytedance/sonic"
+
+	"github.com/jdxcode/jsonrpc"
+)
+
+func init() {
+	jsonrpc.SetJSONImplementation("github.com/bytedance/sonic", sonic.ConfigStd.Marshal, sonic.ConfigStd.Unmarshal)
+}
@@ -0,0 +1,229 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SSEHandler serves s over Server-Sent Events: a GET opens a session and
+// streams messages back as they are sent, starting with a "session" event
+// whose data is {"session": id}, then one "message" event per message. The
+// client POSTs its messages to the same URL with the SessionHeader, or a
+// session query parameter for an EventSource in a browser. The session
+// closes with the stream. WithPollTimeout sets how often an idle stream gets
+// a keepalive comment.
+func SSEHandler(s *Server, opts ...LongPollOption) http.Handler {
+	return &sseHandler{newHTTPSessions(s, opts)}
+}
+
+type sseHandler struct {
+	*httpSessions
+}
+
+func (h *sseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.stream(w, r)
+	case http.MethodPost:
+		sess := h.lookup(r)
+		if sess == nil {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+		h.send(w, r, sess)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *sseHandler) stream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	sess, err := h.open(r, 0)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer sess.Close()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "event: session\ndata: {\"session\":%q}\n\n", sess.id)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(h.cfg.pollTimeout)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-sess.ready:
+			for _, msg := range sess.take() {
+				// marshaled JSON has no raw newlines, so it fits one data line
+				if _, err := fmt.Fprintf(w, "event: message\ndata: %s\n\n", msg); err != nil {
+					return
+				}
+			}
+		case <-keepalive.C:
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-sess.done:
+			return
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// DialSSE opens an event stream from an SSEHandler at url and returns it as
+// a Socket, which POSTs the messages it writes.
+func DialSSE(ctx context.Context, url string, opts ...LongPollOption) (Socket, error) {
+	cfg := newLongPollConfig(opts)
+	sock := &sseSocket{url: url, client: cfg.client}
+	sock.ctx, sock.cancel = context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(sock.ctx, http.MethodGet, url, nil)
+	if err != nil {
+		sock.cancel()
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	// ctx bounds opening the stream, not the stream itself
+	opened := make(chan struct{})
+	defer close(opened)
+	go func() {
+		select {
+		case <-ctx.Done():
+			sock.cancel()
+		case <-opened:
+		}
+	}()
+	rsp, err := cfg.client.Do(req)
+	if err != nil {
+		sock.cancel()
+		return nil, err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		rsp.Body.Close()
+		sock.cancel()
+		return nil, fmt.Errorf("jsonrpc: open event stream: %s", rsp.Status)
+	}
+	sock.body = rsp.Body
+	sock.events = bufio.NewReader(rsp.Body)
+	event, data, err := sock.next()
+	if err == nil && event != "session" {
+		err = fmt.Errorf("jsonrpc: event stream started with %q", event)
+	}
+	var created struct {
+		Session string `json:"session"`
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &created)
+	}
+	if err != nil {
+		sock.Close()
+		return nil, err
+	}
+	sock.session = created.Session
+	return sock, nil
+}
+
+// sseSocket is the client end of an event stream.
+type sseSocket struct {
+	url     string
+	session string
+	client  *http.Client
+	ctx     context.Context
+	cancel  context.CancelFunc
+	body    io.ReadCloser
+	events  *bufio.Reader
+
+	writeMu sync.Mutex
+}
+
+// next reads the next event, skipping comments.
+func (s *sseSocket) next() (string, []byte, error) {
+	var event string
+	var data []byte
+	for {
+		line, err := s.events.ReadString('\n')
+		if err != nil {
+			if s.ctx.Err() != nil {
+				err = io.EOF
+			}
+			return "", nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			if event != "" || data != nil {
+				if event == "" {
+					event = "message"
+				}
+				return event, data, nil
+			}
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data != nil {
+				data = append(data, '\n')
+			}
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")...)
+		}
+	}
+}
+
+func (s *sseSocket) ReadJSON(v interface{}) error {
+	for {
+		event, data, err := s.next()
+		if err != nil {
+			return err
+		}
+		if event == "message" {
+			return json.Unmarshal(data, v)
+		}
+	}
+}
+
+func (s *sseSocket) WriteJSON(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, s.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SessionHeader, s.session)
+	// one at a time, so messages arrive in order
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	rsp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("jsonrpc: event stream send: %s", rsp.Status)
+	}
+	return nil
+}
+
+// Close ends the event stream, which closes the session on the server.
+func (s *sseSocket) Close() error {
+	s.cancel()
+	return s.body.Close()
+}
@@ -0,0 +1,150 @@
+package jsonrpc
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	healthMethod  = "rpc.health"
+	versionMethod = "rpc.version"
+	statsMethod   = "rpc.stats"
+)
+
+// WithStatusMethods adds the built-in methods rpc.health, which returns a
+// Health, rpc.version, which returns a Version reporting version, and
+// rpc.stats, which returns the server's Stats.
+func WithStatusMethods(version string) Option {
+	return func(s *Server) {
+		s.stats = &serverStats{version: version, start: time.Now(), methods: map[string]*MethodStats{}}
+	}
+}
+
+// WithHealthCheck makes rpc.health fail with check's error while check
+// fails, e.g. when a database is unreachable.
+func WithHealthCheck(check func(ctx context.Context) error) Option {
+	return func(s *Server) {
+		s.healthCheck = check
+	}
+}
+
+// Health is returned by rpc.health.
+type Health struct {
+	Status string `json:"status"`
+	// Uptime is in seconds.
+	Uptime float64 `json:"uptime"`
+}
+
+// Version is returned by rpc.version.
+type Version struct {
+	Version string `json:"version"`
+	Go      string `json:"go"`
+}
+
+// Stats is a snapshot of what a server with WithStatusMethods is doing,
+// returned by rpc.stats.
+type Stats struct {
+	// Uptime is in seconds.
+	Uptime      float64 `json:"uptime"`
+	Methods     int     `json:"methods"`
+	Connections int     `json:"connections"`
+	InFlight    int64   `json:"inFlight"`
+	// Calls are the requests handled so far by method, with unregistered
+	// methods counted as UnknownMethod.
+	Calls map[string]MethodStats `json:"calls"`
+}
+
+// MethodStats counts the requests for a method.
+type MethodStats struct {
+	Calls  uint64 `json:"calls"`
+	Errors uint64 `json:"errors"`
+	// Duration is the total time spent handling them, in seconds.
+	Duration float64 `json:"duration"`
+}
+
+type serverStats struct {
+	// 64-bit aligned for atomic access
+	inFlight int64
+	version  string
+	start    time.Time
+
+	mu      sync.Mutex
+	methods map[string]*MethodStats
+}
+
+func (st *serverStats) started() {
+	if st != nil {
+		atomic.AddInt64(&st.inFlight, 1)
+	}
+}
+
+func (st *serverStats) finished(method string, d time.Duration, code int) {
+	if st == nil {
+		return
+	}
+	atomic.AddInt64(&st.inFlight, -1)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	m := st.methods[method]
+	if m == nil {
+		m = &MethodStats{}
+		st.methods[method] = m
+	}
+	m.Calls++
+	if code != 0 {
+		m.Errors++
+	}
+	m.Duration += d.Seconds()
+}
+
+// Stats returns what the server is doing, or the zero Stats without
+// WithStatusMethods.
+func (s *Server) Stats() Stats {
+	st := s.stats
+	if st == nil {
+		return Stats{}
+	}
+	stats := Stats{
+		Uptime:      time.Since(st.start).Seconds(),
+		Methods:     len(s.Describe()),
+		Connections: len(s.Connections()),
+		InFlight:    atomic.LoadInt64(&st.inFlight),
+		Calls:       map[string]MethodStats{},
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for method, m := range st.methods {
+		stats.Calls[method] = *m
+	}
+	return stats
+}
+
+func (s *Server) statusMethods(methods Methods) {
+	if s.stats == nil {
+		return
+	}
+	methods[healthMethod] = newReflectMethod(reflect.ValueOf(s.health), nil)
+	methods[versionMethod] = newReflectMethod(reflect.ValueOf(s.version), nil)
+	methods[statsMethod] = newReflectMethod(reflect.ValueOf(s.statsSnapshot), nil)
+}
+
+func (s *Server) health(ctx context.Context) (*Health, error) {
+	if s.healthCheck != nil {
+		if err := s.healthCheck(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return &Health{Status: "ok", Uptime: time.Since(s.stats.start).Seconds()}, nil
+}
+
+func (s *Server) version(ctx context.Context) (*Version, error) {
+	return &Version{Version: s.stats.version, Go: runtime.Version()}, nil
+}
+
+func (s *Server) statsSnapshot(ctx context.Context) (Stats, error) {
+	return s.Stats(), nil
+}
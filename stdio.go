@@ -0,0 +1,175 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// HeaderSocket frames messages with the LSP base protocol: a header section
+// holding at least Content-Length, a blank line, then the JSON content.
+type HeaderSocket struct {
+	src    io.Reader
+	limit  *limitedReader
+	r      *textproto.Reader
+	w      io.Writer
+	closer io.Closer
+
+	contentType string
+	onHeader    func(textproto.MIMEHeader) error
+	maxContent  int
+
+	writeMu sync.Mutex
+}
+
+var _ ContextSocket = (*HeaderSocket)(nil)
+
+type HeaderOption func(*HeaderSocket)
+
+// WithContentType sets the Content-Type header written with each message.
+// By default no Content-Type is sent, which LSP peers treat as
+// "application/vscode-jsonrpc; charset=utf-8".
+func WithContentType(contentType string) HeaderOption {
+	return func(s *HeaderSocket) {
+		s.contentType = contentType
+	}
+}
+
+// WithHeaderFunc is called with the headers of every message read, before its
+// content. Returning an error fails the read, e.g. for an unsupported
+// Content-Type.
+func WithHeaderFunc(fn func(textproto.MIMEHeader) error) HeaderOption {
+	return func(s *HeaderSocket) {
+		s.onHeader = fn
+	}
+}
+
+// WithMaxContentLength bounds the content of the messages read to n bytes,
+// or leaves it unbounded if n is 0, like WithMaxMessageSize does for a
+// StreamSocket. Longer messages, and header sections of more than 64KiB,
+// fail the read with ErrMessageTooLarge. Defaults to DefaultMaxMessageSize.
+func WithMaxContentLength(n int) HeaderOption {
+	return func(s *HeaderSocket) {
+		s.maxContent = n
+	}
+}
+
+// maxHeaderSize bounds the header section of a message, so a peer that
+// never ends it can't exhaust memory.
+const maxHeaderSize = 64 << 10
+
+// NewHeaderSocket reads messages from r and writes them to w. closer, which
+// may be nil, is closed by Close.
+func NewHeaderSocket(r io.Reader, w io.Writer, closer io.Closer, opts ...HeaderOption) *HeaderSocket {
+	s := &HeaderSocket{
+		src:        r,
+		limit:      &limitedReader{r: r, n: -1},
+		w:          w,
+		closer:     closer,
+		maxContent: DefaultMaxMessageSize,
+	}
+	s.r = textproto.NewReader(bufio.NewReader(s.limit))
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// NewStdioSocket speaks the LSP base protocol over stdin and stdout, for
+// servers started as a subprocess by an editor.
+func NewStdioSocket(opts ...HeaderOption) *HeaderSocket {
+	return NewHeaderSocket(os.Stdin, os.Stdout, os.Stdin, opts...)
+}
+
+func (s *HeaderSocket) ReadJSON(v interface{}) error {
+	if s.maxContent > 0 {
+		s.limit.n = maxHeaderSize
+	}
+	header, err := s.r.ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF && len(header) > 0 {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if s.onHeader != nil {
+		if err := s.onHeader(header); err != nil {
+			return err
+		}
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return fmt.Errorf("jsonrpc: invalid Content-Length: %q", header.Get("Content-Length"))
+	}
+	if s.maxContent > 0 {
+		if length > s.maxContent {
+			return ErrMessageTooLarge
+		}
+		s.limit.n += int64(length)
+	}
+	body, err := readFrame(s.r.R, int64(length))
+	if err != nil {
+		return err
+	}
+	return JSON.Unmarshal(body, v)
+}
+
+// ReadJSONContext is ReadJSON, interrupted when ctx is done if the reader
+// has a read deadline.
+func (s *HeaderSocket) ReadJSONContext(ctx context.Context, v interface{}) error {
+	return readWithContext(ctx, s.src, func() error { return s.ReadJSON(v) })
+}
+
+func (s *HeaderSocket) WriteJSON(v interface{}) error {
+	body, err := JSON.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Content-Length: %d\r\n", len(body))
+	if s.contentType != "" {
+		fmt.Fprintf(&buf, "Content-Type: %s\r\n", s.contentType)
+	}
+	buf.WriteString("\r\n")
+	buf.Write(body)
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_, err = s.w.Write(buf.Bytes())
+	return err
+}
+
+// limitedReader reads from r until n bytes are left, then fails with
+// ErrMessageTooLarge. A negative n is unlimited.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(b []byte) (int, error) {
+	if l.n < 0 {
+		return l.r.Read(b)
+	}
+	if l.n == 0 {
+		return 0, ErrMessageTooLarge
+	}
+	if int64(len(b)) > l.n {
+		b = b[:l.n]
+	}
+	n, err := l.r.Read(b)
+	l.n -= int64(n)
+	return n, err
+}
+
+func (s *HeaderSocket) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
@@ -0,0 +1,398 @@
+package jsonrpc_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jdxcode/jsonrpc"
+)
+
+func TestHeaderSocket(t *testing.T) {
+	assert := assert.New(t)
+	var buf bytes.Buffer
+	w := jsonrpc.NewHeaderSocket(nil, &buf, nil, jsonrpc.WithContentType("application/json"))
+	assert.NoError(w.WriteJSON(map[string]int{"id": 1}))
+	assert.NoError(w.WriteJSON(map[string]int{"id": 2}))
+	assert.True(strings.HasPrefix(buf.String(), "Content-Length: 8\r\nContent-Type: application/json\r\n\r\n{\"id\":1}"))
+
+	r := jsonrpc.NewHeaderSocket(&buf, nil, nil)
+	var v map[string]int
+	assert.NoError(r.ReadJSON(&v))
+	assert.Equal(1, v["id"])
+	assert.NoError(r.ReadJSON(&v))
+	assert.Equal(2, v["id"])
+	assert.Equal(io.EOF, r.ReadJSON(&v))
+}
+
+func TestHeaderSocketHeaderFunc(t *testing.T) {
+	assert := assert.New(t)
+	errBadType := errors.New("bad content type")
+	in := strings.NewReader("Content-Length: 2\r\nContent-Type: text/plain\r\n\r\n{}")
+	r := jsonrpc.NewHeaderSocket(in, nil, nil, jsonrpc.WithHeaderFunc(func(h textproto.MIMEHeader) error {
+		if h.Get("Content-Type") != "application/json" {
+			return errBadType
+		}
+		return nil
+	}))
+	var v interface{}
+	assert.Equal(errBadType, r.ReadJSON(&v))
+}
+
+func TestStreamSocket(t *testing.T) {
+	for _, opts := range [][]jsonrpc.StreamOption{nil, {jsonrpc.WithLengthPrefix()}} {
+		assert := assert.New(t)
+		a, b := net.Pipe()
+		go rpc.Handle(ctx, jsonrpc.NewStreamSocket(b, opts...))
+		client := jsonrpc.NewClient(jsonrpc.NewStreamSocket(a, opts...))
+
+		var result int
+		assert.NoError(client.Call(ctx, "Foo", "test-abc", &result))
+		assert.Equal(123, result)
+		client.Close()
+	}
+}
+
+func TestStreamWriter(t *testing.T) {
+	rpc := jsonrpc.New(&struct{}{})
+	assert.NoError(t, rpc.Register("count", func(ctx context.Context, params io.Reader) (interface{}, error) {
+		var n int
+		if err := json.NewDecoder(params).Decode(&n); err != nil {
+			return nil, err
+		}
+		return jsonrpc.StreamWriter(func(w io.Writer) error {
+			io.WriteString(w, "[")
+			for i := 0; i < n; i++ {
+				if i > 0 {
+					io.WriteString(w, ",")
+				}
+				fmt.Fprint(w, i)
+			}
+			_, err := io.WriteString(w, "]")
+			return err
+		}), nil
+	}))
+	for _, opts := range [][]jsonrpc.StreamOption{nil, {jsonrpc.WithLengthPrefix()}} {
+		assert := assert.New(t)
+		a, b := net.Pipe()
+		go rpc.Handle(ctx, jsonrpc.NewStreamSocket(b, opts...))
+		client := jsonrpc.NewClient(jsonrpc.NewStreamSocket(a, opts...))
+
+		var result []int
+		assert.NoError(client.Call(ctx, "count", 100000, &result))
+		assert.Len(result, 100000)
+		assert.Equal(99999, result[99999])
+		assert.Error(client.Call(ctx, "count", "x", nil))
+		client.Close()
+	}
+}
+
+func TestServe(t *testing.T) {
+	assert := assert.New(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- rpc.Serve(ctx, l, jsonrpc.WithMaxConns(1)) }()
+
+	first, err := jsonrpc.Dial(ctx, "tcp", l.Addr().String())
+	assert.NoError(err)
+	var result int
+	assert.NoError(first.Call(ctx, "Foo", "test-abc", &result))
+	assert.Equal(123, result)
+
+	// the second connection is only handled once the first closes
+	second, err := jsonrpc.Dial(ctx, "tcp", l.Addr().String())
+	assert.NoError(err)
+	defer second.Close()
+	called := make(chan error)
+	go func() { called <- second.Call(ctx, "Foo", "test-abc", nil) }()
+	select {
+	case <-called:
+		t.Fatal("second connection handled past WithMaxConns")
+	case <-time.After(50 * time.Millisecond):
+	}
+	first.Close()
+	assert.NoError(<-called)
+
+	cancel()
+	assert.NoError(<-served)
+}
+
+// newCert returns a certificate for name signed by parent, or self-signed
+// when parent is nil.
+func newCert(t *testing.T, name string, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	issuer, signer := tmpl, interface{}(key)
+	if parent != nil {
+		issuer, signer = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, issuer, &key.PublicKey, signer)
+	assert.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestServeMutualTLS(t *testing.T) {
+	assert := assert.New(t)
+	ca := newCert(t, "ca", nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	serverCert, clientCert := newCert(t, "127.0.0.1", &ca), newCert(t, "alice", &ca)
+
+	rpc := jsonrpc.New(&struct{}{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger), jsonrpc.WithAuth(
+		func(ctx context.Context, token string) (interface{}, error) { return nil, errors.New("no tokens") },
+		jsonrpc.AuthClientCert(func(cert *x509.Certificate) (interface{}, error) {
+			return cert.Subject.CommonName, nil
+		}),
+	))
+	assert.NoError(rpc.Register("whoami", func(ctx context.Context) (interface{}, error) {
+		return jsonrpc.IdentityFromContext(ctx), nil
+	}))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go rpc.Serve(ctx, l, jsonrpc.WithTLS(&tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}))
+
+	client, err := jsonrpc.Dial(ctx, "tcp", l.Addr().String(), jsonrpc.WithTLS(&tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		RootCAs:      pool,
+	}))
+	assert.NoError(err)
+	defer client.Close()
+	var who string
+	assert.NoError(client.Call(ctx, "whoami", nil, &who))
+	assert.Equal("alice", who)
+
+	// without a client certificate the handshake fails
+	anon, err := jsonrpc.Dial(ctx, "tcp", l.Addr().String(), jsonrpc.WithTLS(&tls.Config{RootCAs: pool}))
+	if err == nil {
+		defer anon.Close()
+		assert.Error(anon.Call(ctx, "whoami", nil, nil))
+	}
+}
+
+func TestStreamSocketMessagePack(t *testing.T) {
+	assert := assert.New(t)
+	a, b := net.Pipe()
+	go rpc.Handle(ctx, jsonrpc.NewStreamSocket(b, jsonrpc.WithLengthPrefix(), jsonrpc.WithCodec(jsonrpc.MessagePack)))
+	client := jsonrpc.NewClient(jsonrpc.NewStreamSocket(a, jsonrpc.WithLengthPrefix(), jsonrpc.WithCodec(jsonrpc.MessagePack)))
+	defer client.Close()
+
+	var result FooStructResult
+	assert.NoError(client.Call(ctx, "FooStruct", &FooStructParams{Foo: "abc"}, &result))
+	assert.Equal("abc", result.Bar)
+
+	b1, err := jsonrpc.MessagePack.Marshal(map[string]interface{}{"a": 1, "b": []interface{}{-1, "x", nil, true, 1.5}})
+	assert.NoError(err)
+	assert.Equal([]byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0x95, 0xff, 0xa1, 'x', 0xc0, 0xc3,
+		0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}, b1)
+	var v json.RawMessage
+	assert.NoError(jsonrpc.MessagePack.Unmarshal(b1, &v))
+	assert.JSONEq(`{"a":1,"b":[-1,"x",null,true,1.5]}`, string(v))
+}
+
+func TestMessagePackDepth(t *testing.T) {
+	assert := assert.New(t)
+	var v interface{}
+	assert.NoError(jsonrpc.MessagePack.Unmarshal(append(bytes.Repeat([]byte{0x91}, 100), 0x01), &v))
+	// deeper than encoding/json allows, and deep enough to overflow the stack
+	assert.EqualError(jsonrpc.MessagePack.Unmarshal(bytes.Repeat([]byte{0x91}, 20<<20), &v),
+		"msgpack: exceeded max depth")
+	assert.EqualError(jsonrpc.MessagePack.Unmarshal(bytes.Repeat([]byte{0x81, 0xa1, 'a'}, 20000), &v),
+		"msgpack: exceeded max depth")
+}
+
+func TestStreamSocketNewlines(t *testing.T) {
+	assert := assert.New(t)
+	sock := jsonrpc.NewStreamSocket(nopCloser{strings.NewReader("{\"id\":1}\n\n  \n{\"id\":2}")})
+	var v map[string]int
+	assert.NoError(sock.ReadJSON(&v))
+	assert.Equal(1, v["id"])
+	assert.NoError(sock.ReadJSON(&v))
+	assert.Equal(2, v["id"])
+	assert.Equal(io.EOF, sock.ReadJSON(&v))
+}
+
+func TestStreamSocketMaxMessageSize(t *testing.T) {
+	assert := assert.New(t)
+	big := `{"id":"` + strings.Repeat("x", 10000) + `"}`
+	sock := jsonrpc.NewStreamSocket(nopCloser{strings.NewReader("{\"id\":1}\n" + big + "\n{\"id\":2}\n")},
+		jsonrpc.WithMaxMessageSize(100))
+	var v json.RawMessage
+	assert.NoError(sock.ReadJSON(&v))
+	assert.Equal(jsonrpc.ErrMessageTooLarge, sock.ReadJSON(&v))
+
+	// over the limit without a newline, e.g. a peer streaming garbage
+	sock = jsonrpc.NewStreamSocket(nopCloser{strings.NewReader(strings.Repeat("x", 10000))},
+		jsonrpc.WithMaxMessageSize(100))
+	assert.Equal(jsonrpc.ErrMessageTooLarge, sock.ReadJSON(&v))
+
+	// surrounding whitespace doesn't count
+	sock = jsonrpc.NewStreamSocket(nopCloser{strings.NewReader(strings.Repeat(" ", 200) + "{}\r\n")},
+		jsonrpc.WithMaxMessageSize(2))
+	assert.NoError(sock.ReadJSON(&v))
+	assert.Equal("{}", string(v))
+	// but whitespace within a message does, with or without a newline
+	sock = jsonrpc.NewStreamSocket(nopCloser{strings.NewReader("{" + strings.Repeat(" ", 10000))},
+		jsonrpc.WithMaxMessageSize(100))
+	assert.Equal(jsonrpc.ErrMessageTooLarge, sock.ReadJSON(&v))
+	sock = jsonrpc.NewStreamSocket(nopCloser{strings.NewReader(strings.Repeat(" ", 10000))},
+		jsonrpc.WithMaxMessageSize(100))
+	assert.Equal(io.EOF, sock.ReadJSON(&v))
+
+	frame := func(msg string) string {
+		var buf bytes.Buffer
+		_ = binary.Write(&buf, binary.BigEndian, uint32(len(msg)))
+		return buf.String() + msg
+	}
+	sock = jsonrpc.NewStreamSocket(nopCloser{strings.NewReader(frame(`{"id":1}`) + frame(big))},
+		jsonrpc.WithLengthPrefix(), jsonrpc.WithMaxMessageSize(100))
+	assert.NoError(sock.ReadJSON(&v))
+	assert.Equal(jsonrpc.ErrMessageTooLarge, sock.ReadJSON(&v))
+
+	// 0 is unbounded
+	sock = jsonrpc.NewStreamSocket(nopCloser{strings.NewReader(big)}, jsonrpc.WithMaxMessageSize(0))
+	assert.NoError(sock.ReadJSON(&v))
+	assert.Len(v, len(big))
+
+	// header framing
+	header := func(msg string) string {
+		return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(msg), msg)
+	}
+	hsock := jsonrpc.NewHeaderSocket(strings.NewReader(header(`{"id":1}`)+header(big)), nil, nil,
+		jsonrpc.WithMaxContentLength(100))
+	assert.NoError(hsock.ReadJSON(&v))
+	assert.Equal(jsonrpc.ErrMessageTooLarge, hsock.ReadJSON(&v))
+	// the limit applies to each message, not the stream
+	hsock = jsonrpc.NewHeaderSocket(strings.NewReader(strings.Repeat(header(big), 10)), nil, nil,
+		jsonrpc.WithMaxContentLength(len(big)))
+	for i := 0; i < 10; i++ {
+		assert.NoError(hsock.ReadJSON(&v))
+	}
+	hsock = jsonrpc.NewHeaderSocket(strings.NewReader("X-Padding: "+strings.Repeat("x", 1<<20)), nil, nil)
+	assert.Equal(jsonrpc.ErrMessageTooLarge, hsock.ReadJSON(&v))
+	hsock = jsonrpc.NewHeaderSocket(strings.NewReader(header(big)+header(big)), nil, nil, jsonrpc.WithMaxContentLength(0))
+	for i := 0; i < 2; i++ {
+		assert.NoError(hsock.ReadJSON(&v))
+		assert.Len(v, len(big))
+	}
+
+	// the server ends the connection
+	a, b := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rpc.Handle(ctx, jsonrpc.NewStreamSocket(b, jsonrpc.WithMaxMessageSize(100)))
+	}()
+	go func() { _, _ = io.WriteString(a, big+"\n") }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection still open")
+	}
+	a.Close()
+}
+
+func TestStreamSocketParseError(t *testing.T) {
+	assert := assert.New(t)
+	a, b := net.Pipe()
+	go rpc.Handle(ctx, jsonrpc.NewStreamSocket(b))
+	sock := jsonrpc.NewStreamSocket(a)
+	defer sock.Close()
+
+	type response struct {
+		ID     json.RawMessage `json:"id"`
+		Result int             `json:"result"`
+		Error  *jsonrpc.Error  `json:"error"`
+	}
+	send := func(line string) *response {
+		go func() { _, _ = io.WriteString(a, line+"\n") }()
+		var rsp response
+		assert.NoError(sock.ReadJSON(&rsp))
+		return &rsp
+	}
+
+	rsp := send(`{"id": 1, oops`)
+	assert.Equal("null", string(rsp.ID))
+	assert.Equal(jsonrpc.CodeParseError, rsp.Error.Code)
+	rsp = send(`{"id":2,"method":"Foo","params":"abc"}`)
+	assert.Equal("2", string(rsp.ID))
+	assert.Equal(123, rsp.Result)
+	rsp = send(`{"id":3,"method":7}`)
+	assert.Equal("null", string(rsp.ID))
+	assert.Equal(jsonrpc.CodeInvalidRequest, rsp.Error.Code)
+}
+
+func TestReadJSONContext(t *testing.T) {
+	assert := assert.New(t)
+	a, b := net.Pipe()
+	defer a.Close()
+	sock := jsonrpc.NewStreamSocket(b)
+	cctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	var v interface{}
+	assert.Equal(context.DeadlineExceeded, sock.ReadJSONContext(cctx, &v))
+
+	handled := make(chan struct{})
+	cctx, cancel = context.WithCancel(ctx)
+	go func() {
+		rpc.Handle(cctx, sock)
+		close(handled)
+	}()
+	cancel()
+	select {
+	case <-handled:
+	case <-time.After(time.Second):
+		t.Fatal("Handle didn't return")
+	}
+}
+
+type nopCloser struct {
+	io.Reader
+}
+
+func (nopCloser) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,175 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrMessageTooLarge is returned reading a message longer than a
+// StreamSocket's WithMaxMessageSize or a HeaderSocket's WithMaxContentLength.
+// The stream can't be resynchronized after it, so the connection ends.
+var ErrMessageTooLarge = errors.New("jsonrpc: message too large")
+
+// DefaultMaxMessageSize is the longest message a StreamSocket or HeaderSocket
+// reads unless WithMaxMessageSize or WithMaxContentLength says otherwise.
+const DefaultMaxMessageSize = 64 << 20
+
+// StreamSocket frames messages over a byte stream such as a TCP or Unix
+// socket or a pipe. Messages are newline-delimited JSON unless
+// WithLengthPrefix is used.
+type StreamSocket struct {
+	rwc            io.ReadWriteCloser
+	r              *bufio.Reader
+	lengthPrefixed bool
+	maxMessageSize int
+	codec          Codec
+
+	writeMu sync.Mutex
+}
+
+var _ ContextSocket = (*StreamSocket)(nil)
+
+type StreamOption func(*StreamSocket)
+
+// WithLengthPrefix frames each message with a 4 byte big-endian length
+// instead of a trailing newline.
+func WithLengthPrefix() StreamOption {
+	return func(s *StreamSocket) {
+		s.lengthPrefixed = true
+	}
+}
+
+// WithMaxMessageSize bounds the size of the messages read to n bytes, or
+// leaves it unbounded if n is 0. Defaults to DefaultMaxMessageSize.
+func WithMaxMessageSize(n int) StreamOption {
+	return func(s *StreamSocket) {
+		s.maxMessageSize = n
+	}
+}
+
+// WithCodec sets how messages are encoded. Defaults to JSON.
+func WithCodec(c Codec) StreamOption {
+	return func(s *StreamSocket) {
+		s.codec = c
+	}
+}
+
+func NewStreamSocket(rwc io.ReadWriteCloser, opts ...StreamOption) *StreamSocket {
+	s := &StreamSocket{rwc: rwc, r: bufio.NewReader(rwc), maxMessageSize: DefaultMaxMessageSize, codec: JSON}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *StreamSocket) ReadJSON(v interface{}) error {
+	msg, err := s.readMessage()
+	if err != nil {
+		return err
+	}
+	return s.codec.Unmarshal(msg, v)
+}
+
+// ReadJSONContext is ReadJSON, interrupted when ctx is done if the stream
+// has a read deadline.
+func (s *StreamSocket) ReadJSONContext(ctx context.Context, v interface{}) error {
+	return readWithContext(ctx, s.rwc, func() error { return s.ReadJSON(v) })
+}
+
+func (s *StreamSocket) readMessage() ([]byte, error) {
+	if s.lengthPrefixed {
+		var length uint32
+		if err := binary.Read(s.r, binary.BigEndian, &length); err != nil {
+			return nil, err
+		}
+		if s.tooLarge(int64(length)) {
+			return nil, ErrMessageTooLarge
+		}
+		return readFrame(s.r, int64(length))
+	}
+	var line []byte
+	for {
+		chunk, err := s.r.ReadSlice('\n')
+		if len(line) == 0 {
+			// leading whitespace doesn't count, so drop it as it arrives
+			chunk = bytes.TrimLeft(chunk, " \t\r\n")
+		}
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull {
+			// no newline yet: read on, up to the limit
+			if s.tooLarge(int64(len(line))) {
+				return nil, ErrMessageTooLarge
+			}
+			continue
+		}
+		line = bytes.TrimSpace(line)
+		if s.tooLarge(int64(len(line))) {
+			return nil, ErrMessageTooLarge
+		}
+		if len(line) > 0 {
+			// a final message without a trailing newline is still a message
+			return line, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (s *StreamSocket) tooLarge(n int64) bool {
+	return s.maxMessageSize > 0 && n > int64(s.maxMessageSize)
+}
+
+// readFrame reads a frame of n bytes. The buffer grows as data arrives rather
+// than being allocated up front, so a bogus length can't exhaust memory.
+func readFrame(r io.Reader, n int64) ([]byte, error) {
+	var buf bytes.Buffer
+	if n <= 64*1024 {
+		buf.Grow(int(n))
+	}
+	if _, err := io.CopyN(&buf, r, n); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *StreamSocket) WriteJSON(v interface{}) error {
+	if rsp, sw := streamedResult(v); sw != nil && !s.lengthPrefixed && s.codec == JSON {
+		s.writeMu.Lock()
+		defer s.writeMu.Unlock()
+		err := writeStreamed(s.rwc, rsp, sw)
+		if _, werr := s.rwc.Write([]byte{'\n'}); err == nil {
+			err = werr
+		}
+		return err
+	}
+	msg, err := s.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if s.lengthPrefixed {
+		_ = binary.Write(&buf, binary.BigEndian, uint32(len(msg)))
+		buf.Write(msg)
+	} else {
+		buf.Write(msg)
+		buf.WriteByte('\n')
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_, err = s.rwc.Write(buf.Bytes())
+	return err
+}
+
+func (s *StreamSocket) Close() error {
+	return s.rwc.Close()
+}
@@ -0,0 +1,83 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+)
+
+var readerType = reflect.TypeOf((*io.Reader)(nil)).Elem()
+
+// StreamWriter is a result that writes itself, as exactly one JSON value, to
+// w. Return one from a handler to send a large result without building it in
+// memory first:
+//
+//	return jsonrpc.StreamWriter(func(w io.Writer) error {
+//		_, err := io.Copy(w, file)
+//		return err
+//	}), nil
+//
+// A StreamSocket without a length prefix and the HTTP handler write it
+// straight to the connection; other sockets, compressed HTTP responses and
+// WithMaxResponseSize buffer it. If it fails part way, the message is cut
+// short. For the params, a handler can take an io.Reader, or a
+// json.RawMessage, to read them undecoded.
+type StreamWriter func(w io.Writer) error
+
+// MarshalJSON buffers the stream, for sockets that can't write it directly.
+func (f StreamWriter) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := f(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// streamedResult returns msg's result when it is a StreamWriter that can be
+// written straight to the connection.
+func streamedResult(msg interface{}) (*Response, StreamWriter) {
+	rsp, ok := msg.(*Response)
+	if !ok || rsp.Error != nil || rsp.Method != "" {
+		return nil, nil
+	}
+	sw, ok := rsp.Result.(StreamWriter)
+	if !ok {
+		return nil, nil
+	}
+	return rsp, sw
+}
+
+// writeStreamed writes rsp to w with its result streamed from sw.
+func writeStreamed(w io.Writer, rsp *Response, sw StreamWriter) error {
+	bw := bufio.NewWriterSize(w, 32*1024)
+	id, err := json.Marshal(rsp.ID)
+	if err != nil {
+		return err
+	}
+	bw.WriteString(`{"jsonrpc":"2.0","id":`)
+	bw.Write(id)
+	if rsp.Deprecated != "" {
+		notice, err := json.Marshal(rsp.Deprecated)
+		if err != nil {
+			return err
+		}
+		bw.WriteString(`,"deprecated":`)
+		bw.Write(notice)
+	}
+	bw.WriteString(`,"result":`)
+	if err := sw(bw); err != nil {
+		return err
+	}
+	bw.WriteByte('}')
+	return bw.Flush()
+}
+
+// readerParams gives handlers taking an io.Reader their raw params.
+func readerParams(raw *ParamsRaw) io.Reader {
+	if raw == nil {
+		return bytes.NewReader(nil)
+	}
+	return bytes.NewReader(*raw)
+}
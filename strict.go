@@ -0,0 +1,28 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"errors"
+)
+
+// WithStrict rejects requests that don't follow JSON-RPC 2.0 to the letter:
+// the "jsonrpc" member must be "2.0" and params, if present, must be an
+// object or an array. By default such requests are accepted.
+func WithStrict() Option {
+	return func(s *Server) {
+		s.strict = true
+	}
+}
+
+func checkStrict(req *Request) error {
+	if req.JSONRPC != "2.0" {
+		return errors.New(`jsonrpc must be "2.0"`)
+	}
+	if req.Params != nil {
+		params := bytes.TrimLeft(*req.Params, " \t\r\n")
+		if len(params) == 0 || params[0] != '{' && params[0] != '[' {
+			return errors.New("params must be an object or an array")
+		}
+	}
+	return nil
+}
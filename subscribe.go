@@ -0,0 +1,299 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrSlowConsumer ends subscriptions using SlowUnsubscribe whose events
+// aren't read fast enough.
+var ErrSlowConsumer = errors.New("jsonrpc: subscription events not read fast enough")
+
+// SlowPolicy decides what happens to subscription events arriving while the
+// channel returned by Subscribe is full.
+type SlowPolicy int
+
+const (
+	// SlowBlock waits for room, holding up everything else the client reads
+	// meanwhile.
+	SlowBlock SlowPolicy = iota
+	// SlowDropNewest drops the event.
+	SlowDropNewest
+	// SlowDropOldest drops the oldest event in the channel to make room.
+	SlowDropOldest
+	// SlowUnsubscribe ends the subscription with ErrSlowConsumer.
+	SlowUnsubscribe
+)
+
+const defaultEventBuffer = 16
+
+// SubscribeOption configures a subscription made with Subscribe.
+type SubscribeOption func(*subscribeConfig)
+
+type subscribeConfig struct {
+	buffer int
+	policy SlowPolicy
+}
+
+// WithEventBuffer buffers up to size events in the channel returned by
+// Subscribe, and sets what happens once it is full. Defaults to 16 and
+// SlowBlock.
+func WithEventBuffer(size int, policy SlowPolicy) SubscribeOption {
+	return func(c *subscribeConfig) {
+		c.buffer = size
+		c.policy = policy
+	}
+}
+
+// WithClientSubscriptionMethods sets the notification method the server
+// delivers subscription events with and the method Unsubscribe calls, as
+// WithSubscriptionMethods does on the server. Defaults to "$/subscription"
+// and "$/unsubscribe".
+func WithClientSubscriptionMethods(notify, unsubscribe string) ClientOption {
+	return func(c *Client) {
+		c.subscriptionMethod = notify
+		c.unsubscribeMethod = unsubscribe
+	}
+}
+
+// ClientSubscription is the client's end of a subscription made with
+// Subscribe.
+type ClientSubscription struct {
+	// 64-bit aligned for atomic access
+	dropped uint64
+
+	ID string
+
+	client   *Client
+	deliver  func(result json.RawMessage)
+	done     chan struct{}
+	doneOnce sync.Once
+	err      error
+
+	// sendMu keeps the events channel from being closed during a send
+	sendMu sync.Mutex
+	closed bool
+	events func() // closes the events channel
+}
+
+// Subscribe calls method, which must return a subscription ID as handlers
+// using NewSubscription do, and returns a channel of the events the server
+// sends for it, decoded into T. The subscription lasts until ctx is done,
+// Unsubscribe is called or the client closes, after which the channel is
+// closed.
+func Subscribe[T any](ctx context.Context, c *Client, method string, params interface{},
+	opts ...SubscribeOption) (<-chan T, *ClientSubscription, error) {
+	cfg := subscribeConfig{buffer: defaultEventBuffer}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	c.subsMu.Lock()
+	c.subscribing++
+	c.subsMu.Unlock()
+
+	var id string
+	err := c.Call(ctx, method, params, &id)
+
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	// events that beat the subscription's registration
+	early := c.early[id]
+	delete(c.early, id)
+	if c.subscribing--; c.subscribing == 0 {
+		c.early = nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.subs == nil {
+		return nil, nil, c.conn.pending.closeErr()
+	}
+
+	size := cfg.buffer
+	if cfg.policy == SlowBlock && len(early) > size {
+		// nobody can be reading yet
+		size = len(early)
+	}
+	ch := make(chan T, size)
+	sub := &ClientSubscription{ID: id, client: c, done: make(chan struct{})}
+	sub.events = func() { close(ch) }
+	sub.deliver = func(result json.RawMessage) {
+		var v T
+		if err := json.Unmarshal(result, &v); err != nil {
+			c.logger.Log(LevelWarn, "subscription decode error", "subscription", id, "error", err)
+			return
+		}
+		deliverEvent(sub, cfg.policy, ch, v)
+	}
+	for _, result := range early {
+		sub.deliver(result)
+	}
+	c.subs[id] = sub
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = sub.Unsubscribe(c.ctx)
+		case <-sub.done:
+		}
+	}()
+	return ch, sub, nil
+}
+
+func deliverEvent[T any](sub *ClientSubscription, policy SlowPolicy, ch chan T, v T) {
+	sub.sendMu.Lock()
+	defer sub.sendMu.Unlock()
+	if sub.closed {
+		return
+	}
+	select {
+	case ch <- v:
+		return
+	default:
+	}
+	switch policy {
+	case SlowBlock:
+		select {
+		case ch <- v:
+		case <-sub.done:
+		}
+	case SlowDropNewest:
+		atomic.AddUint64(&sub.dropped, 1)
+	case SlowDropOldest:
+		select {
+		case <-ch:
+			atomic.AddUint64(&sub.dropped, 1)
+		default:
+		}
+		select {
+		case ch <- v:
+		default:
+			atomic.AddUint64(&sub.dropped, 1)
+		}
+	case SlowUnsubscribe:
+		if sub.end(ErrSlowConsumer) {
+			// not from the read loop, which has to read the response
+			go func() {
+				sub.client.removeSubscription(sub)
+				_ = sub.client.Call(sub.client.ctx, sub.client.unsubscribeMethod, []string{sub.ID}, nil)
+			}()
+		}
+	}
+}
+
+// Unsubscribe ends the subscription and tells the server to stop sending its
+// events.
+func (s *ClientSubscription) Unsubscribe(ctx context.Context) error {
+	if !s.end(nil) {
+		return nil
+	}
+	s.client.removeSubscription(s)
+	return s.client.Call(ctx, s.client.unsubscribeMethod, []string{s.ID}, nil)
+}
+
+// Done is closed when the subscription ends.
+func (s *ClientSubscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns why the subscription ended: nil after Unsubscribe or ctx being
+// done, ErrSlowConsumer, or the error that closed the client.
+func (s *ClientSubscription) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Dropped returns how many events were dropped because the channel was full.
+func (s *ClientSubscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// end marks the subscription as ended with err, reporting false if it
+// already had.
+func (s *ClientSubscription) end(err error) bool {
+	ended := false
+	s.doneOnce.Do(func() {
+		s.err = err
+		close(s.done)
+		ended = true
+	})
+	return ended
+}
+
+// closeEvents closes the events channel once it has ended.
+func (s *ClientSubscription) closeEvents() {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	if !s.closed {
+		s.closed = true
+		s.events()
+	}
+}
+
+func (c *Client) removeSubscription(sub *ClientSubscription) {
+	c.subsMu.Lock()
+	if c.subs[sub.ID] == sub {
+		delete(c.subs, sub.ID)
+	}
+	c.subsMu.Unlock()
+	sub.closeEvents()
+}
+
+// routeEvents delivers the subscription events in msg to Subscribe channels
+// and returns the requests left for the client's server.
+func (c *Client) routeEvents(reqs []*Request) []*Request {
+	if c.subscriptionMethod == "" {
+		return reqs
+	}
+	out := reqs[:0]
+	for _, req := range reqs {
+		if req.err != nil || !req.IsNotification() || req.Method != c.subscriptionMethod || req.Params == nil {
+			out = append(out, req)
+			continue
+		}
+		var params struct {
+			Subscription string          `json:"subscription"`
+			Result       json.RawMessage `json:"result"`
+		}
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			out = append(out, req)
+			continue
+		}
+		c.subsMu.Lock()
+		sub := c.subs[params.Subscription]
+		if sub == nil && c.subscribing > 0 {
+			if c.early == nil {
+				c.early = map[string][]json.RawMessage{}
+			}
+			c.early[params.Subscription] = append(c.early[params.Subscription], params.Result)
+			c.subsMu.Unlock()
+			continue
+		}
+		c.subsMu.Unlock()
+		if sub == nil {
+			out = append(out, req)
+			continue
+		}
+		sub.deliver(params.Result)
+	}
+	return out
+}
+
+// endSubscriptions ends the client's subscriptions with err.
+func (c *Client) endSubscriptions(err error) {
+	c.subsMu.Lock()
+	subs := c.subs
+	c.subs = nil
+	c.subsMu.Unlock()
+	for _, sub := range subs {
+		sub.end(err)
+		sub.closeEvents()
+	}
+}
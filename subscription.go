@@ -0,0 +1,222 @@
+package jsonrpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+const (
+	defaultSubscriptionMethod = "$/subscription"
+	defaultUnsubscribeMethod  = "$/unsubscribe"
+)
+
+// ErrSubscriptionsUnsupported is returned by NewSubscription when the
+// connection can't carry notifications, e.g. over HTTP, or the client left
+// them out of rpc.hello.
+var ErrSubscriptionsUnsupported = errors.New("jsonrpc: subscriptions are not supported on this connection")
+
+// ErrSubscriptionClosed is returned by Notify after the client unsubscribed
+// or disconnected.
+var ErrSubscriptionClosed = errors.New("jsonrpc: subscription closed")
+
+type ctxSubscriberKey struct{}
+
+type subscriber struct {
+	conn   *Conn
+	method string
+	id     ID
+}
+
+// Subscription delivers events to a client until it unsubscribes or
+// disconnects. A handler creates one with NewSubscription and returns it as
+// its result, which sends the subscription's ID to the client. Events sent
+// with Notify are held back until that response has been written.
+type Subscription struct {
+	ID string
+
+	conn      *Conn
+	method    string
+	request   ID
+	ready     chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type subscriptionParams struct {
+	Subscription string      `json:"subscription"`
+	Result       interface{} `json:"result"`
+}
+
+// WithSubscriptionMethods sets the notification method used to deliver
+// subscription events and the method clients call to unsubscribe, with the
+// subscription ID as params. Defaults to "$/subscription" and "$/unsubscribe".
+func WithSubscriptionMethods(notify, unsubscribe string) Option {
+	return func(s *Server) {
+		s.subscriptionMethod = notify
+		s.unsubscribeMethod = unsubscribe
+	}
+}
+
+// NewSubscription creates a subscription on the connection of the request
+// being handled.
+func NewSubscription(ctx context.Context) (*Subscription, error) {
+	sub, _ := ctx.Value(ctxSubscriberKey{}).(*subscriber)
+	if sub == nil || !sub.conn.Supports(ExtSubscriptions) {
+		return nil, ErrSubscriptionsUnsupported
+	}
+	id, err := newSubscriptionID()
+	if err != nil {
+		return nil, err
+	}
+	s := &Subscription{
+		ID:      id,
+		conn:    sub.conn,
+		method:  sub.method,
+		request: sub.id,
+		ready:   make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	sub.conn.mu.Lock()
+	closed := sub.conn.subs == nil
+	if !closed {
+		sub.conn.subs[id] = s
+		sub.conn.newSubs[sub.id] = append(sub.conn.newSubs[sub.id], s)
+	}
+	sub.conn.mu.Unlock()
+	if closed {
+		return nil, ErrConnClosed
+	}
+	return s, nil
+}
+
+func (s *Subscription) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.ID)
+}
+
+// Notify sends result to the client. It blocks until the subscription's ID
+// has been sent.
+func (s *Subscription) Notify(ctx context.Context, result interface{}) error {
+	select {
+	case <-s.ready:
+	case <-s.done:
+		return ErrSubscriptionClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-s.done:
+		return ErrSubscriptionClosed
+	default:
+	}
+	return s.conn.Notify(ctx, s.method, &subscriptionParams{Subscription: s.ID, Result: result})
+}
+
+// Done is closed when the client unsubscribes or disconnects.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close ends the subscription from the server side.
+func (s *Subscription) Close() {
+	s.conn.mu.Lock()
+	if s.conn.subs[s.ID] == s {
+		delete(s.conn.subs, s.ID)
+	}
+	s.conn.mu.Unlock()
+	s.close()
+}
+
+func (s *Subscription) close() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
+
+func newSubscriptionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "0x" + hex.EncodeToString(b), nil
+}
+
+func (s *Server) ctxWithSubscriber(ctx context.Context, conn *Conn, req *Request) context.Context {
+	return context.WithValue(ctx, ctxSubscriberKey{}, &subscriber{conn: conn, method: s.subscriptionMethod, id: *req.ID})
+}
+
+func (s *Server) isUnsubscribe(req *Request) bool {
+	return s.unsubscribeMethod != "" && req.Method == s.unsubscribeMethod
+}
+
+// handleUnsubscribe accepts the subscription ID either as the params or as
+// the only element of a params array.
+func (s *Server) handleUnsubscribe(ctx context.Context, req *Request) *Response {
+	var id string
+	if req.Params != nil {
+		if err := json.Unmarshal(*req.Params, &id); err != nil {
+			var ids [1]string
+			if err := json.Unmarshal(*req.Params, &ids); err != nil {
+				return newResponseError(req.ID, ErrInvalidParams.WithMessage(err.Error()))
+			}
+			id = ids[0]
+		}
+	}
+	conn := ConnFromContext(ctx)
+	if conn == nil {
+		return newResponse(req.ID, false)
+	}
+	conn.mu.Lock()
+	sub := conn.subs[id]
+	delete(conn.subs, id)
+	conn.mu.Unlock()
+	if sub == nil {
+		return newResponse(req.ID, false)
+	}
+	sub.close()
+	return newResponse(req.ID, true)
+}
+
+// activateSubscriptions releases the events of subscriptions created by the
+// requests answered in out, which has just been written. Subscriptions whose
+// request failed are closed.
+func (c *Conn) activateSubscriptions(out interface{}) {
+	var rsps []*Response
+	switch out := out.(type) {
+	case *Response:
+		rsps = []*Response{out}
+	case []*Response:
+		rsps = out
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.newSubs) == 0 {
+		return
+	}
+	for _, rsp := range rsps {
+		if rsp.ID == nil {
+			continue
+		}
+		for _, sub := range c.newSubs[*rsp.ID] {
+			if rsp.Error != nil {
+				delete(c.subs, sub.ID)
+				sub.close()
+			} else {
+				close(sub.ready)
+			}
+		}
+		delete(c.newSubs, *rsp.ID)
+	}
+}
+
+func (c *Conn) closeSubscriptions() {
+	c.mu.Lock()
+	subs := c.subs
+	c.subs = nil
+	c.newSubs = nil
+	c.mu.Unlock()
+	for _, sub := range subs {
+		sub.close()
+	}
+}
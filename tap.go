@@ -0,0 +1,22 @@
+package jsonrpc
+
+import "encoding/json"
+
+// WithOnReceiveRaw calls fn with each message read, exactly as received,
+// before it is decoded, e.g. to capture traffic for debugging or audit. conn
+// is nil for HTTP requests. fn runs on the reading goroutine, so it should
+// return quickly, and must not keep msg past the call without copying it.
+func WithOnReceiveRaw(fn func(conn *Conn, msg json.RawMessage)) Option {
+	return func(s *Server) {
+		s.onReceiveRaw = fn
+	}
+}
+
+// WithOnSendRaw calls fn with each message once it has been written, as the
+// JSON marshaled for the socket. conn is nil for HTTP responses, which are
+// passed before compression.
+func WithOnSendRaw(fn func(conn *Conn, msg json.RawMessage)) Option {
+	return func(s *Server) {
+		s.onSendRaw = fn
+	}
+}
@@ -0,0 +1,62 @@
+package jsonrpc
+
+import (
+	"context"
+	"time"
+)
+
+// CodeRequestTimeout is returned when a handler runs past its timeout.
+const CodeRequestTimeout = -32002
+
+var ErrRequestTimeout = NewError(CodeRequestTimeout, "request timed out")
+
+// WithTimeout limits how long each handler may run. Once the timeout passes,
+// the handler's context is cancelled and the client gets ErrRequestTimeout
+// without waiting for the handler to return.
+func WithTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.timeout = d
+	}
+}
+
+// WithMethodTimeout overrides the timeout for one method. Zero means no
+// timeout.
+func WithMethodTimeout(method string, d time.Duration) Option {
+	return func(s *Server) {
+		if s.methodTimeouts == nil {
+			s.methodTimeouts = map[string]time.Duration{}
+		}
+		s.methodTimeouts[method] = d
+	}
+}
+
+func (s *Server) timeoutFor(method string) time.Duration {
+	if d, ok := s.methodTimeouts[method]; ok {
+		return d
+	}
+	return s.timeout
+}
+
+func (s *Server) dispatchWithTimeout(ctx context.Context, req *Request, d time.Duration) *Response {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	ch := make(chan *Response, 1)
+	go func() {
+		ch <- s.dispatchHandler(ctx, req)
+	}()
+	var rsp *Response
+	select {
+	case rsp = <-ch:
+	case <-ctx.Done():
+		if ctx.Err() != context.DeadlineExceeded {
+			// cancelled by the client or the server; the handler is expected
+			// to return
+			rsp = <-ch
+		}
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		s.logger.Log(LevelWarn, "timeout", "id", req.ID, "method", req.Method, "timeout", d)
+		return newResponseError(req.ID, ErrRequestTimeout)
+	}
+	return rsp
+}
@@ -0,0 +1,55 @@
+package jsonrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+)
+
+// WithTLS serves or dials with TLS using cfg. For mutual TLS, set
+// cfg.ClientAuth to tls.RequireAndVerifyClientCert on the server and
+// cfg.Certificates on the client; handlers then read the client's certificate
+// with ClientCertFromContext, or WithAuth turns it into an identity with
+// AuthClientCert.
+func WithTLS(cfg *tls.Config) NetOption {
+	return func(c *netConfig) {
+		c.tls = cfg
+	}
+}
+
+type ctxTLSStateKey struct{}
+
+func ctxWithTLSState(ctx context.Context, state tls.ConnectionState) context.Context {
+	return context.WithValue(ctx, ctxTLSStateKey{}, &state)
+}
+
+// TLSStateFromContext returns the TLS state of the connection a request
+// arrived on, from Serve with WithTLS or an HTTPS request, or nil.
+func TLSStateFromContext(ctx context.Context) *tls.ConnectionState {
+	if state, ok := ctx.Value(ctxTLSStateKey{}).(*tls.ConnectionState); ok {
+		return state
+	}
+	if r := HTTPRequestFromContext(ctx); r != nil {
+		return r.TLS
+	}
+	return nil
+}
+
+// ClientCertFromContext returns the verified certificate the client
+// presented over mutual TLS, or nil.
+func ClientCertFromContext(ctx context.Context) *x509.Certificate {
+	state := TLSStateFromContext(ctx)
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
+
+// AuthClientCert authenticates connections with a verified client
+// certificate by calling identify with it, e.g. to map its subject to a user.
+// Connections without one fall back to tokens.
+func AuthClientCert(identify func(cert *x509.Certificate) (identity interface{}, err error)) AuthOption {
+	return func(c *authConfig) {
+		c.clientCert = identify
+	}
+}
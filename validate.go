@@ -0,0 +1,35 @@
+package jsonrpc
+
+import "reflect"
+
+// Validator is implemented by params types that check themselves. Validate is
+// called after the params are parsed; an error is sent back as invalid params.
+type Validator interface {
+	Validate() error
+}
+
+// WithValidator sets a function that checks every parsed params value, e.g.
+// one backed by a struct tag validation library. It runs after Validate.
+func WithValidator(fn func(params interface{}) error) Option {
+	return func(s *Server) {
+		s.validator = fn
+	}
+}
+
+func (s *Server) validate(params interface{}) error {
+	if params == nil {
+		return nil
+	}
+	if v := reflect.ValueOf(params); v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+	if v, ok := params.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return err
+		}
+	}
+	if s.validator != nil {
+		return s.validator(params)
+	}
+	return nil
+}
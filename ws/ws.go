@@ -0,0 +1,466 @@
+// Package ws adapts gorilla/websocket connections to jsonrpc.Socket, with
+// ping/pong keepalives, typed close errors and binary attachments.
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/jdxcode/jsonrpc"
+)
+
+const (
+	defaultPingInterval = 30 * time.Second
+	defaultPongWait     = 60 * time.Second
+	defaultWriteWait    = 10 * time.Second
+
+	defaultMaxAttachments     = 64
+	defaultMaxAttachmentBytes = 64 << 20
+
+	subprotocolPrefix = "jsonrpc-"
+)
+
+// CloseError is returned by ReadJSON once the peer closes the connection.
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("ws: closed %d: %s", e.Code, e.Text)
+}
+
+// Normal reports whether the peer closed the connection deliberately.
+func (e *CloseError) Normal() bool {
+	return e.Code == websocket.CloseNormalClosure || e.Code == websocket.CloseGoingAway
+}
+
+type config struct {
+	pingInterval time.Duration
+	pongWait     time.Duration
+	writeWait    time.Duration
+	upgrader     *websocket.Upgrader
+	dialer       *websocket.Dialer
+	header       http.Header
+	codecs       []jsonrpc.Codec
+	compress     int
+
+	maxAttachments     int
+	maxAttachmentBytes int
+}
+
+type Option func(*config)
+
+// WithPingInterval sets how often pings are sent. Zero disables keepalives.
+func WithPingInterval(d time.Duration) Option {
+	return func(c *config) {
+		c.pingInterval = d
+	}
+}
+
+// WithPongWait sets how long to wait for any message, including a pong,
+// before considering the connection dead.
+func WithPongWait(d time.Duration) Option {
+	return func(c *config) {
+		c.pongWait = d
+	}
+}
+
+// WithWriteWait sets the deadline for each write.
+func WithWriteWait(d time.Duration) Option {
+	return func(c *config) {
+		c.writeWait = d
+	}
+}
+
+// WithUpgrader sets the upgrader used by Upgrade and Handler.
+func WithUpgrader(u *websocket.Upgrader) Option {
+	return func(c *config) {
+		c.upgrader = u
+	}
+}
+
+// WithDialer sets the dialer used by Dial.
+func WithDialer(d *websocket.Dialer) Option {
+	return func(c *config) {
+		c.dialer = d
+	}
+}
+
+// WithHeader sets headers sent with the upgrade response or dial request.
+func WithHeader(h http.Header) Option {
+	return func(c *config) {
+		c.header = h
+	}
+}
+
+// WithCodecs offers codecs to negotiate for each connection, in order of
+// preference, as the subprotocols "jsonrpc-" + the codec's name. Peers that
+// agree on none of them use JSON text messages.
+func WithCodecs(codecs ...jsonrpc.Codec) Option {
+	return func(c *config) {
+		c.codecs = codecs
+	}
+}
+
+// WithCompression negotiates permessage-deflate and compresses messages of at
+// least threshold bytes. Compressed messages from the peer are always read.
+func WithCompression(threshold int) Option {
+	return func(c *config) {
+		c.compress = threshold
+	}
+}
+
+// WithMaxAttachments bounds the attachments received and not yet read to n,
+// of at most size bytes in all, ending the connection once the peer sends
+// more. Zero leaves either unbounded. Defaults to 64 and 64 MiB.
+func WithMaxAttachments(n, size int) Option {
+	return func(c *config) {
+		c.maxAttachments = n
+		c.maxAttachmentBytes = size
+	}
+}
+
+func (c *config) subprotocols() []string {
+	var protocols []string
+	for _, codec := range c.codecs {
+		protocols = append(protocols, subprotocolPrefix+codec.Name())
+	}
+	return protocols
+}
+
+func (c *config) codec(subprotocol string) jsonrpc.Codec {
+	for _, codec := range c.codecs {
+		if subprotocolPrefix+codec.Name() == subprotocol {
+			return codec
+		}
+	}
+	return nil
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{
+		pingInterval: defaultPingInterval,
+		pongWait:     defaultPongWait,
+		writeWait:    defaultWriteWait,
+		upgrader:     &websocket.Upgrader{},
+		dialer:       websocket.DefaultDialer,
+
+		maxAttachments:     defaultMaxAttachments,
+		maxAttachmentBytes: defaultMaxAttachmentBytes,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Socket is a jsonrpc.Socket over a websocket connection. Writes are
+// serialized, so it is safe to use from multiple goroutines.
+type Socket struct {
+	conn  *websocket.Conn
+	cfg   *config
+	codec jsonrpc.Codec
+
+	writeMu   sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+	// set once a read is interrupted, after which the deadline stays put
+	interrupted int32
+
+	attachmentsMu   sync.Mutex
+	attachments     map[string][]byte
+	attachmentBytes int
+}
+
+// ErrTooManyAttachments is returned by ReadJSON once the peer sends more
+// attachments than WithMaxAttachments allows.
+var ErrTooManyAttachments = errors.New("ws: too many attachments")
+
+var (
+	_ jsonrpc.AttachmentSocket = (*Socket)(nil)
+	_ jsonrpc.ContextSocket    = (*Socket)(nil)
+)
+
+// attachmentFrame starts binary frames carrying an attachment, followed by
+// the length of the id, the id and the data. No JSON or MessagePack message
+// starts with it.
+const attachmentFrame = 0x00
+
+// New wraps an established websocket connection.
+func New(conn *websocket.Conn, opts ...Option) *Socket {
+	return newSocket(conn, newConfig(opts))
+}
+
+func newSocket(conn *websocket.Conn, cfg *config) *Socket {
+	s := &Socket{conn: conn, cfg: cfg, codec: cfg.codec(conn.Subprotocol()), done: make(chan struct{})}
+	if cfg.pingInterval > 0 {
+		s.extendReadDeadline()
+		conn.SetPongHandler(func(string) error {
+			s.extendReadDeadline()
+			return nil
+		})
+		go s.ping()
+	}
+	return s
+}
+
+// Upgrade upgrades an HTTP request to a websocket Socket.
+func Upgrade(w http.ResponseWriter, r *http.Request, opts ...Option) (*Socket, error) {
+	cfg := newConfig(opts)
+	upgrader := cfg.upgrader
+	if len(cfg.codecs) > 0 || cfg.compress > 0 {
+		u := *upgrader
+		if len(cfg.codecs) > 0 {
+			u.Subprotocols = cfg.subprotocols()
+		}
+		u.EnableCompression = u.EnableCompression || cfg.compress > 0
+		upgrader = &u
+	}
+	conn, err := upgrader.Upgrade(w, r, cfg.header)
+	if err != nil {
+		return nil, err
+	}
+	return newSocket(conn, cfg), nil
+}
+
+// Handler upgrades each request and serves it with rpc until the
+// connection closes.
+func Handler(rpc *jsonrpc.Server, opts ...Option) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sock, err := Upgrade(w, r, opts...)
+		if err != nil {
+			// the upgrader has already written an error response
+			return
+		}
+		rpc.Handle(jsonrpc.ContextWithHTTPRequest(r.Context(), r), sock)
+	})
+}
+
+// Dial connects to a websocket JSON-RPC endpoint.
+func Dial(ctx context.Context, url string, opts ...Option) (*Socket, error) {
+	cfg := newConfig(opts)
+	dialer := cfg.dialer
+	if len(cfg.codecs) > 0 || cfg.compress > 0 {
+		d := *dialer
+		if len(cfg.codecs) > 0 {
+			d.Subprotocols = cfg.subprotocols()
+		}
+		d.EnableCompression = d.EnableCompression || cfg.compress > 0
+		dialer = &d
+	}
+	conn, _, err := dialer.DialContext(ctx, url, cfg.header)
+	if err != nil {
+		return nil, err
+	}
+	return newSocket(conn, cfg), nil
+}
+
+// DialClient dials url and returns a client using the connection.
+func DialClient(ctx context.Context, url string, opts []Option, clientOpts ...jsonrpc.ClientOption) (
+	*jsonrpc.Client, error) {
+	sock, err := Dial(ctx, url, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return jsonrpc.NewClient(sock, clientOpts...), nil
+}
+
+// DialFunc returns a jsonrpc.Dialer for url, for use with
+// jsonrpc.NewReconnectingClient.
+func DialFunc(url string, opts ...Option) jsonrpc.Dialer {
+	return func(ctx context.Context) (jsonrpc.Socket, error) {
+		return Dial(ctx, url, opts...)
+	}
+}
+
+func (s *Socket) ReadJSON(v interface{}) error {
+	err := s.read(v)
+	if err == nil {
+		s.extendReadDeadline()
+		return nil
+	}
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		return &CloseError{Code: closeErr.Code, Text: closeErr.Text}
+	}
+	return err
+}
+
+// ReadJSONContext is ReadJSON, interrupted when ctx is done. The websocket
+// can't be read from after an interrupted read.
+func (s *Socket) ReadJSONContext(ctx context.Context, v interface{}) error {
+	if ctx.Done() == nil {
+		return s.ReadJSON(v)
+	}
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			atomic.StoreInt32(&s.interrupted, 1)
+			_ = s.conn.SetReadDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+	err := s.ReadJSON(v)
+	close(stop)
+	<-stopped
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (s *Socket) WriteJSON(v interface{}) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.cfg.writeWait > 0 {
+		if err := s.conn.SetWriteDeadline(time.Now().Add(s.cfg.writeWait)); err != nil {
+			return err
+		}
+	}
+	if s.codec == nil && s.cfg.compress <= 0 {
+		return s.conn.WriteJSON(v)
+	}
+	typ, marshal := websocket.TextMessage, json.Marshal
+	if s.codec != nil {
+		typ, marshal = websocket.BinaryMessage, s.codec.Marshal
+	}
+	b, err := marshal(v)
+	if err != nil {
+		return err
+	}
+	if s.cfg.compress > 0 {
+		s.conn.EnableWriteCompression(len(b) >= s.cfg.compress)
+	}
+	return s.conn.WriteMessage(typ, b)
+}
+
+func (s *Socket) read(v interface{}) error {
+	for {
+		typ, b, err := s.conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if typ == websocket.BinaryMessage && len(b) > 0 && b[0] == attachmentFrame {
+			if err := s.storeAttachment(b); err != nil {
+				return err
+			}
+			s.extendReadDeadline()
+			continue
+		}
+		if s.codec == nil {
+			return json.Unmarshal(b, v)
+		}
+		return s.codec.Unmarshal(b, v)
+	}
+}
+
+// WriteAttachment sends data in a binary frame of its own, for a later
+// message to reference by id.
+func (s *Socket) WriteAttachment(id string, data []byte) error {
+	if len(id) > 255 {
+		return errors.New("ws: attachment id too long")
+	}
+	frame := make([]byte, 0, 2+len(id)+len(data))
+	frame = append(frame, attachmentFrame, byte(len(id)))
+	frame = append(frame, id...)
+	frame = append(frame, data...)
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.cfg.writeWait > 0 {
+		if err := s.conn.SetWriteDeadline(time.Now().Add(s.cfg.writeWait)); err != nil {
+			return err
+		}
+	}
+	if s.cfg.compress > 0 {
+		s.conn.EnableWriteCompression(len(frame) >= s.cfg.compress)
+	}
+	return s.conn.WriteMessage(websocket.BinaryMessage, frame)
+}
+
+// Attachment returns and forgets the attachment received with id.
+func (s *Socket) Attachment(id string) ([]byte, bool) {
+	s.attachmentsMu.Lock()
+	defer s.attachmentsMu.Unlock()
+	data, ok := s.attachments[id]
+	delete(s.attachments, id)
+	s.attachmentBytes -= len(data)
+	return data, ok
+}
+
+func (s *Socket) storeAttachment(frame []byte) error {
+	if len(frame) < 2 || len(frame) < 2+int(frame[1]) {
+		return errors.New("ws: truncated attachment frame")
+	}
+	id, data := string(frame[2:2+int(frame[1])]), frame[2+int(frame[1]):]
+	s.attachmentsMu.Lock()
+	defer s.attachmentsMu.Unlock()
+	if s.attachments == nil {
+		s.attachments = map[string][]byte{}
+	}
+	old, replaced := s.attachments[id]
+	n, size := len(s.attachments), s.attachmentBytes-len(old)+len(data)
+	if !replaced {
+		n++
+	}
+	if max := s.cfg.maxAttachments; max > 0 && n > max {
+		return ErrTooManyAttachments
+	}
+	if max := s.cfg.maxAttachmentBytes; max > 0 && size > max {
+		return ErrTooManyAttachments
+	}
+	s.attachments[id] = data
+	s.attachmentBytes = size
+	return nil
+}
+
+// Codec returns the codec negotiated for the connection, or nil for JSON
+// text messages.
+func (s *Socket) Codec() jsonrpc.Codec {
+	return s.codec
+}
+
+// Close sends a normal close message and closes the connection.
+func (s *Socket) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+		_ = s.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(s.cfg.writeWait))
+		err = s.conn.Close()
+	})
+	return err
+}
+
+func (s *Socket) extendReadDeadline() {
+	if s.cfg.pingInterval > 0 && s.cfg.pongWait > 0 && atomic.LoadInt32(&s.interrupted) == 0 {
+		_ = s.conn.SetReadDeadline(time.Now().Add(s.cfg.pongWait))
+	}
+}
+
+func (s *Socket) ping() {
+	ticker := time.NewTicker(s.cfg.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			deadline := time.Now().Add(s.cfg.writeWait)
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package ws_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jdxcode/jsonrpc"
+	"github.com/jdxcode/jsonrpc/ws"
+)
+
+type RPC struct{}
+
+func (r *RPC) Echo(ctx context.Context, params string) (string, error) {
+	return params, nil
+}
+
+func TestDialClient(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&RPC{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger))
+	srv := httptest.NewServer(ws.Handler(rpc, ws.WithPingInterval(10*time.Millisecond)))
+	defer srv.Close()
+
+	ctx := context.Background()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	client, err := ws.DialClient(ctx, url, []ws.Option{ws.WithPingInterval(10 * time.Millisecond)})
+	assert.NoError(err)
+	defer client.Close()
+
+	// outlive a few keepalive intervals
+	time.Sleep(50 * time.Millisecond)
+	var result string
+	assert.NoError(client.Call(ctx, "Echo", "abc", &result))
+	assert.Equal("abc", result)
+}
+
+func TestCodecNegotiation(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&RPC{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger))
+	srv := httptest.NewServer(ws.Handler(rpc, ws.WithCodecs(jsonrpc.MessagePack, jsonrpc.JSON)))
+	defer srv.Close()
+
+	ctx := context.Background()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	sock, err := ws.Dial(ctx, url, ws.WithCodecs(jsonrpc.MessagePack))
+	assert.NoError(err)
+	assert.Equal(jsonrpc.MessagePack, sock.Codec())
+	client := jsonrpc.NewClient(sock)
+	defer client.Close()
+
+	var result string
+	assert.NoError(client.Call(ctx, "Echo", "abc", &result))
+	assert.Equal("abc", result)
+
+	plain, err := ws.Dial(ctx, url)
+	assert.NoError(err)
+	assert.Nil(plain.Codec())
+	plain.Close()
+}
+
+func TestCompression(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&RPC{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger))
+	srv := httptest.NewServer(ws.Handler(rpc, ws.WithCompression(64)))
+	defer srv.Close()
+
+	ctx := context.Background()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	client, err := ws.DialClient(ctx, url, []ws.Option{ws.WithCompression(64)})
+	assert.NoError(err)
+	defer client.Close()
+
+	for _, s := range []string{"abc", strings.Repeat("abc", 1000)} {
+		var result string
+		assert.NoError(client.Call(ctx, "Echo", s, &result))
+		assert.Equal(s, result)
+	}
+}
+
+func (r *RPC) Reverse(ctx context.Context, attachment string) (string, error) {
+	conn := jsonrpc.ConnFromContext(ctx)
+	data, ok := conn.Attachment(attachment)
+	if !ok {
+		return "", errors.New("missing attachment")
+	}
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[len(data)-1-i] = b
+	}
+	return conn.Attach(out)
+}
+
+func TestAttachments(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&RPC{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger))
+	srv := httptest.NewServer(ws.Handler(rpc, ws.WithCodecs(jsonrpc.MessagePack)))
+	defer srv.Close()
+
+	ctx := context.Background()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	for _, opts := range [][]ws.Option{nil, {ws.WithCodecs(jsonrpc.MessagePack)}} {
+		client, err := ws.DialClient(ctx, url, opts)
+		assert.NoError(err)
+		id, err := client.Conn().Attach([]byte{0, 1, 2, 0xff})
+		assert.NoError(err)
+		var result string
+		assert.NoError(client.Call(ctx, "Reverse", id, &result))
+		data, ok := client.Conn().Attachment(result)
+		assert.True(ok)
+		assert.Equal([]byte{0xff, 2, 1, 0}, data)
+		_, ok = client.Conn().Attachment(result)
+		assert.False(ok, "attachments are read once")
+		client.Close()
+	}
+}
+
+func TestMaxAttachments(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&RPC{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger))
+	srv := httptest.NewServer(ws.Handler(rpc, ws.WithMaxAttachments(2, 10)))
+	defer srv.Close()
+
+	ctx := context.Background()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	// attachments read don't count
+	client, err := ws.DialClient(ctx, url, nil)
+	assert.NoError(err)
+	for i := 0; i < 5; i++ {
+		id, err := client.Conn().Attach([]byte{1, 2, 3})
+		assert.NoError(err)
+		var result string
+		assert.NoError(client.Call(ctx, "Reverse", id, &result))
+	}
+	client.Close()
+
+	for _, attachments := range [][][]byte{{{1}, {2}, {3}}, {make([]byte, 6), make([]byte, 6)}} {
+		sock, err := ws.Dial(ctx, url)
+		assert.NoError(err)
+		for i, data := range attachments {
+			assert.NoError(sock.WriteAttachment(strconv.Itoa(i), data))
+		}
+		var v json.RawMessage
+		assert.Error(sock.ReadJSON(&v), "the server ends the connection")
+		sock.Close()
+	}
+}
+
+func TestCloseError(t *testing.T) {
+	assert := assert.New(t)
+	rpc := jsonrpc.New(&RPC{}, jsonrpc.WithLogger(jsonrpc.DiscardLogger))
+	srv := httptest.NewServer(ws.Handler(rpc))
+	defer srv.Close()
+
+	sock, err := ws.Dial(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http"))
+	assert.NoError(err)
+	defer sock.Close()
+	go rpc.Shutdown(context.Background())
+
+	var v interface{}
+	err = sock.ReadJSON(&v)
+	var closeErr *ws.CloseError
+	assert.True(errors.As(err, &closeErr))
+	assert.True(closeErr.Normal())
+}